@@ -13,6 +13,7 @@ import (
 
 	"EnigmaNetz/Enigma-Go-Sensor/config"
 	"EnigmaNetz/Enigma-Go-Sensor/internal/api"
+	"EnigmaNetz/Enigma-Go-Sensor/internal/assets"
 	"EnigmaNetz/Enigma-Go-Sensor/internal/capture"
 	"EnigmaNetz/Enigma-Go-Sensor/internal/capture/common"
 	collect_logs "EnigmaNetz/Enigma-Go-Sensor/internal/collect_logs"
@@ -26,12 +27,13 @@ import (
 func printHelp() {
 	fmt.Print(`Enigma Sensor - Network Capture & Processing Tool
 
-Usage: enigma-sensor [collect-logs] [--version|-v] [--help|-h]
+Usage: enigma-sensor [collect-logs|assets] [--version|-v] [--help|-h]
 
 Runs a network capture and processing session using config.json.
 
 Options:
   collect-logs    Package logs, captures, config, and diagnostics into an archive for support
+  assets          List or export the local asset inventory (see enigma-sensor assets --help)
   --version, -v   Print version and exit
   --help, -h      Show this help message and exit
 
@@ -47,6 +49,9 @@ Example:
   enigma-sensor collect-logs
     Packages logs, captures, config, and diagnostics into an archive for support.
 
+  enigma-sensor assets export --format json --output assets.json
+    Exports the devices seen on the local network (requires assets.enabled).
+
   enigma-sensor --help
     Shows this help message.
 
@@ -55,27 +60,9 @@ Example:
 `)
 }
 
-func main() {
-	if len(os.Args) > 1 {
-		switch os.Args[1] {
-		case "--help", "-h":
-			printHelp()
-			return
-		case "--version", "-v":
-			fmt.Println(version.Version)
-			return
-		case "collect-logs":
-			outName := fmt.Sprintf("enigma-logs-%s%s", time.Now().Format("20060102-150405"), collect_logs.ArchiveExt)
-			size, err := collect_logs.CollectLogs(outName)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to collect logs: %v\n", err)
-				os.Exit(1)
-			}
-			fmt.Printf("Created %s (%d bytes) with logs, config, and diagnostics.\n", outName, size)
-			return
-		}
-	}
-	// Load config from config.json
+// loadConfig loads config.json from the platform's config directory, falling
+// back to the working directory, and exits if neither can be loaded.
+func loadConfig() *config.Config {
 	var configPaths []string
 	if runtime.GOOS == "windows" {
 		configPaths = []string{
@@ -93,7 +80,7 @@ func main() {
 	for _, path := range configPaths {
 		cfg, err = config.LoadConfig(path)
 		if err == nil {
-			break
+			return cfg
 		}
 		// If the file exists but has validation errors, stop and report the error
 		// rather than trying the next config path
@@ -101,9 +88,38 @@ func main() {
 			log.Fatalf("Failed to load config from %s: %v", path, err)
 		}
 	}
-	if cfg == nil {
-		log.Fatalf("Failed to load config: %v", err)
+	log.Fatalf("Failed to load config: %v", err)
+	return nil
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "--help", "-h":
+			printHelp()
+			return
+		case "--version", "-v":
+			fmt.Println(version.Version)
+			return
+		case "assets":
+			cfg := loadConfig()
+			if err := assets.Command(os.Args[2:], assets.Dir(cfg.Buffering.Dir), os.Stdout); err != nil {
+				fmt.Fprintf(os.Stderr, "assets: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "collect-logs":
+			outName := fmt.Sprintf("enigma-logs-%s%s", time.Now().Format("20060102-150405"), collect_logs.ArchiveExt)
+			size, err := collect_logs.CollectLogs(outName)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to collect logs: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Created %s (%d bytes) with logs, config, and diagnostics.\n", outName, size)
+			return
+		}
 	}
+	cfg := loadConfig()
 
 	// Set up standard logger to log to file if specified
 	if cfg.Logging.File != "" {
@@ -145,7 +161,7 @@ func main() {
 		if server == "" || apiKey == "" {
 			log.Printf("enigma_api.server and enigma_api.api_key must be set to upload logs; skipping upload.")
 		} else {
-			u, err := api.NewLogUploader(server, apiKey, cfg.NetworkID, cfg.Capture.Interface, cfg.EnigmaAPI.MaxPayloadSizeMB, cfg.Buffering.Dir, cfg.Buffering.MaxAgeHours, cfg.EnigmaAPI.CACertFile)
+			u, err := api.NewLogUploader(server, apiKey, cfg.NetworkID, cfg.Capture.Interface, cfg.EnigmaAPI.MaxPayloadSizeMB, cfg.Capture.WorkerMemoryMB, cfg.Buffering.Dir, cfg.Buffering.MaxAgeHours, cfg.EnigmaAPI.CACertFile)
 			if err != nil {
 				log.Printf("Failed to initialize LogUploader: %v", err)
 			} else {
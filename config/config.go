@@ -5,8 +5,33 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+
+	"EnigmaNetz/Enigma-Go-Sensor/internal/logenc"
+	"EnigmaNetz/Enigma-Go-Sensor/internal/policy"
+	"EnigmaNetz/Enigma-Go-Sensor/internal/rules"
+)
+
+// Capture modes (capture.mode).
+const (
+	CaptureModePCAP = "pcap"
+	CaptureModeLive = "live"
+)
+
+// Zeek script checks at startup (zeek.script_check).
+const (
+	ScriptCheckDegrade = "degrade"
+	ScriptCheckStrict  = "strict"
+	ScriptCheckOff     = "off"
+)
+
+// Traffic summary uploads (summary.upload).
+const (
+	SummaryUploadAlongside = "alongside"
+	SummaryUploadInstead   = "instead"
 )
 
 // Config represents the application configuration
@@ -36,10 +61,22 @@ type Config struct {
 		WindowSeconds int `json:"window_seconds"`
 		// Loop determines if the sensor should run in a continuous loop
 		Loop bool `json:"loop"`
+		// Mode is how traffic reaches Zeek: CaptureModePCAP (default)
+		// captures a PCAP per window and replays it with zeek -r;
+		// CaptureModeLive runs one long-lived Zeek process reading the
+		// interface directly, rotating its logs every WindowSeconds and
+		// restarted if it exits. Live mode is Linux only, reads a single
+		// interface and always loops.
+		Mode string `json:"mode"`
 		// Interface specifies which network interface to capture from. "any" captures on every interface
 		Interface string `json:"interface"`
 		// MaxProcessingWorkers is the max number of concurrent PCAP processing workers (default: 10, min: 1, max: 20)
 		MaxProcessingWorkers int `json:"max_processing_workers"`
+		// WorkerMemoryMB is the memory budget per processing worker for
+		// streaming log rewrites (filtering, enrichment, encoding); it caps
+		// the longest log line and any buffered output such as Parquet row
+		// groups (default: 64, min: 16, max: 4096)
+		WorkerMemoryMB int `json:"worker_memory_mb"`
 		// RetentionHours is how long to keep zeek_out folders after processing (0 = delete immediately after upload, max 720)
 		RetentionHours *int `json:"retention_hours,omitempty"`
 	} `json:"capture"`
@@ -72,13 +109,101 @@ type Config struct {
 		Path string `json:"path"`
 		// SamplingPercentage is the percentage of traffic to process (0-100)
 		SamplingPercentage float64 `json:"sampling_percentage"`
+		// SubnetSampling is a comma-delimited list of per-subnet sampling
+		// rates, "CIDR=percentage" (e.g. "10.1.0.0/16=100,10.50.0.0/16=5").
+		// A flow with an endpoint in one of these subnets (most specific
+		// match) is sampled at that rate instead of SamplingPercentage; when
+		// both endpoints match, the higher rate wins. Sampling is
+		// flow-consistent and the effective rate is recorded in a sample_rate
+		// column of conn.log and dns.log. Empty = feature off.
+		SubnetSampling string `json:"subnet_sampling"`
 		// ExcludedSubnets is a comma-delimited list of CIDRs (e.g.
 		// "10.0.0.0/8,172.20.10.0/24"). Any flow/record whose source or
 		// destination IP falls inside one of these subnets is dropped from the
-		// produced logs and never uploaded. Stored as a single string (not an
+		// produced logs and never uploaded. An entry may carry a per-CIDR
+		// policy suffix: "=drop" (default), "=mask" (keep the row, replace the
+		// address with 0.0.0.0/::) or "=truncate-to-prefix" (keep the row,
+		// replace the address with its /24 or /64 network), e.g.
+		// "10.0.0.0/8=mask,172.20.10.0/24". Stored as a single string (not an
 		// array) so it flows through the reflection-based SENSOR_ env overrides
 		// (SENSOR_ZEEK_EXCLUDED_SUBNETS). Empty = feature off.
 		ExcludedSubnets string `json:"excluded_subnets"`
+		// MonitoredSubnets is a comma-delimited allow-list of CIDRs this
+		// sensor is responsible for (e.g. "10.1.0.0/16,192.168.0.0/24"). When
+		// set, only rows with at least one endpoint address inside a
+		// monitored range are kept; transit traffic between unmonitored
+		// networks is dropped. It is applied before excluded_subnets, and an
+		// address that is both monitored and excluded gets its exclusion
+		// policy, so exclusions can carve holes in a monitored range. A
+		// monitored range entirely covered by a drop exclusion is rejected as
+		// contradictory. Empty = everything is in scope.
+		MonitoredSubnets string `json:"monitored_subnets"`
+		// ExcludedDomains is a comma-delimited list of DNS names whose dns.log
+		// queries/answers and JA3/JA4 server_name values are never uploaded.
+		// A plain name ("hr.corp") matches it and every subdomain; a glob
+		// ("*.hr.corp", "portal?.health.example") matches the whole name. An
+		// entry may carry a policy suffix: "=drop" (default, drop the row) or
+		// "=redact" (keep the row, replace the name with "(redacted)").
+		// Empty = feature off.
+		ExcludedDomains string `json:"excluded_domains"`
+		// FilterRules is a semicolon-delimited list of record filter rules,
+		// e.g. "drop conn where id.resp_p in (873, 445) and proto == tcp;
+		// drop dns where qtype_name == PTR". Each rule names a log (or * for
+		// all) and a condition over its columns; matching rows are dropped
+		// before upload. Rules see the row before excluded_subnets and
+		// excluded_domains mask or redact it. See internal/rules for the
+		// syntax. Empty = feature off.
+		FilterRules string `json:"filter_rules"`
+		// OutputEncoding is the format the Zeek logs are converted to before
+		// upload and in retained zeek_out copies: "tsv" (default, Zeek's
+		// native format, left as .log files), "csv", "ndjson", "xlsx" or
+		// "parquet" (typed columnar, dictionary-encoded). The encoding is
+		// declared to the API in the upload metadata.
+		OutputEncoding string `json:"output_encoding"`
+		// CommunityIDSeed is the Community ID v1 seed for the community_id
+		// column added to every log with a connection 4-tuple. It must match
+		// the seed configured in Suricata/EDR tooling for the hashes to
+		// correlate (0-65535, default 0).
+		CommunityIDSeed int `json:"community_id_seed"`
+		// GeoIPPath is a MaxMind-format .mmdb database, or a directory of
+		// them (e.g. GeoLite2-Country.mmdb and GeoLite2-ASN.mmdb), used to add
+		// orig_cc, resp_cc, resp_asn and resp_as_org columns to conn.log and
+		// the TLS fingerprint logs. A database that changes on disk is
+		// reloaded on the next run; a missing one is not a startup error, the
+		// logs are just not enriched. Empty = feature off.
+		GeoIPPath string `json:"geoip_path"`
+		// OUIPath is a comma-separated list of local copies of the IEEE OUI
+		// registry files (oui.csv, mam.csv, oas.csv or oui.txt from
+		// standards-oui.ieee.org), or directories of them, used to resolve
+		// the mac_vendor columns of dhcp.log and conn.log. They are layered
+		// over the sensor's built-in MA-L registry and reloaded when they
+		// change; a missing one is not a startup error. Empty = built-in
+		// registry only.
+		OUIPath string `json:"oui_path"`
+		// IntelDir is a directory of threat-intel feed files (CSV, STIX 2
+		// JSON or Zeek intel format; .csv, .txt, .json, .intel or .dat)
+		// matched against traffic with Zeek's Intel framework. JA3, JA4 and
+		// JA4S indicators, which Zeek cannot match, are matched by the
+		// sensor. Hits are uploaded as intel.log. The feeds are re-read when
+		// they change, from the next run. Empty = feature off.
+		IntelDir string `json:"intel_dir"`
+		// HealthCaptureLossPercent is the capture loss Zeek may report for
+		// a run, in percent of TCP ACKs for data it never saw, before the
+		// sensor logs a warning that the run's logs are missing traffic
+		// (0-100, nil = default 1, 0 = warn on any loss).
+		HealthCaptureLossPercent *float64 `json:"health_capture_loss_percent,omitempty"`
+		// HealthReporterErrors is the number of errors Zeek may report in
+		// reporter.log for a run before the sensor logs a warning
+		// (default 0).
+		HealthReporterErrors int `json:"health_reporter_errors"`
+		// ScriptCheck is what the sensor does when the installed Zeek cannot
+		// parse one of its scripts, found by dry-running every script with
+		// --parse-only at startup: ScriptCheckDegrade (default) disables the
+		// features whose scripts fail and reports them, ScriptCheckStrict
+		// refuses to start, ScriptCheckOff skips the check. A Zeek that does
+		// not run, or cannot parse the sampling or live mode scripts, always
+		// stops the sensor unless the check is off.
+		ScriptCheck string `json:"script_check"`
 	} `json:"zeek"`
 
 	// PcapIngest configuration for offline PCAP file processing
@@ -91,7 +216,129 @@ type Config struct {
 		PollIntervalSeconds int `json:"poll_interval_seconds"`
 		// FileStableSeconds is how long a file's size must be unchanged before processing (default: 5, min: 1, max: 60)
 		FileStableSeconds int `json:"file_stable_seconds"`
+		// Shards splits a PCAP of at least ShardMinMB into this many parts by flow and runs
+		// one Zeek per part in parallel, merging their logs (default: 1 = no splitting, max: 64)
+		Shards int `json:"shards"`
+		// ShardMinMB is the smallest PCAP that is split into shards (default: 1024)
+		ShardMinMB int `json:"shard_min_mb"`
 	} `json:"pcap_ingest"`
+
+	// Assets configuration for the local asset inventory
+	Assets struct {
+		// Enabled keeps a persistent inventory of local devices (MAC, IPs, hostnames,
+		// DHCP fingerprint, first/last seen) under buffering.dir/assets, built from
+		// the DHCP, DNS and conn logs of every window
+		Enabled bool `json:"enabled"`
+		// Upload sends the assets that changed in each window as an "assets" log
+		// alongside the Zeek logs (requires enabled)
+		Upload bool `json:"upload"`
+		// DeviceEvents raises an event when a never-before-seen MAC appears, or a known
+		// MAC's DHCP fingerprint, hostname or vendor changes, and uploads the events as a
+		// "device_events" log alongside the Zeek logs (requires enabled)
+		DeviceEvents bool `json:"device_events"`
+		// RetentionDays drops assets not seen for this many days (default: 90, max: 3650)
+		RetentionDays int `json:"retention_days"`
+	} `json:"assets"`
+
+	// Beacons configuration for beaconing detection
+	Beacons struct {
+		// Enabled keeps a rolling history of connection times per (orig_h, resp_h, resp_p)
+		// across windows, scores how periodic each is, and uploads the pairs that look like
+		// command-and-control check-ins as a "beacons" log alongside the Zeek logs
+		Enabled bool `json:"enabled"`
+		// LookbackHours is how much connection history is kept and scored (default: 24, max: 168)
+		LookbackHours int `json:"lookback_hours"`
+		// MinConnections is the fewest check-ins a pair needs before it is scored (default: 10, min: 4, max: 256)
+		MinConnections int `json:"min_connections"`
+		// ScoreThreshold is the periodicity score at or above which a pair is reported
+		// (0-1, nil = default 0.8, 0 = report every pair scored)
+		ScoreThreshold *float64 `json:"score_threshold,omitempty"`
+		// MaxPairs caps the pairs tracked, dropping the least recently active beyond it;
+		// each takes at most about 1 KB (default: 50000, min: 1000, max: 1000000)
+		MaxPairs int `json:"max_pairs"`
+	} `json:"beacons"`
+
+	// DNSAnomalies configuration for DNS tunneling and DGA detection
+	DNSAnomalies struct {
+		// Enabled computes per registered domain and per client features of each window's
+		// dns.log and uploads the domains and clients that cross the thresholds below as a
+		// "dns_anomalies" log alongside the Zeek logs
+		Enabled bool `json:"enabled"`
+		// MinUniqueNames is the fewest distinct names queried under a registered domain in a
+		// window before it is considered for tunneling (default: 100)
+		MinUniqueNames int `json:"min_unique_names"`
+		// EntropyThreshold is the mean entropy (bits per character) of a domain's subdomain
+		// labels at or above which they look like encoded data
+		// (0-8, nil = default 3.5, 0 = any labels)
+		EntropyThreshold *float64 `json:"entropy_threshold,omitempty"`
+		// QueryLengthThreshold is the mean query name length at or above which a domain's
+		// names look like encoded data (default: 60)
+		QueryLengthThreshold int `json:"query_length_threshold"`
+		// TXTThreshold is the number of TXT and NULL queries to a domain in a window at or
+		// above which it looks like a tunnel (default: 50)
+		TXTThreshold int `json:"txt_threshold"`
+		// MinNXDomains is the fewest distinct domains answered NXDOMAIN for one client in a
+		// window before it is considered for DGA activity (default: 25)
+		MinNXDomains int `json:"min_nxdomains"`
+		// NXDomainRatio is the share of a client's queries answered NXDOMAIN at or
+		// above which it may be running a DGA (0-1, nil = default 0.25, 0 = any share)
+		NXDomainRatio *float64 `json:"nxdomain_ratio,omitempty"`
+		// DGAEntropyThreshold is the mean entropy (bits per character) of those domains'
+		// names at or above which they look generated (0-8, nil = default 3.0, 0 = any names)
+		DGAEntropyThreshold *float64 `json:"dga_entropy_threshold,omitempty"`
+	} `json:"dns_anomalies"`
+
+	// Continuity configuration for connections cut by a capture window boundary
+	Continuity struct {
+		// Enabled adds continuity_id and window_truncated columns to conn.log, tagging the
+		// halves of a connection open across a window boundary with a shared ID so their
+		// durations and byte counts can be reconciled (pcap mode only)
+		Enabled bool `json:"enabled"`
+		// EdgeSeconds is how close to a window's first or last packet a UDP or ICMP flow
+		// must be active to count as cut there (default: 1, max: 30)
+		EdgeSeconds int `json:"edge_seconds"`
+		// MaxGapSeconds is the longest gap between one window's last packet and the next
+		// one's first for the windows to count as consecutive (default: 10, max: 300)
+		MaxGapSeconds int `json:"max_gap_seconds"`
+	} `json:"continuity"`
+
+	// Validation configuration for the logs Zeek writes
+	Validation struct {
+		// Enabled checks every log Zeek wrote against its schema (required columns and
+		// types, column count per row, #close footer) before it is processed; runs that
+		// fail are quarantined instead of uploaded
+		Enabled bool `json:"enabled"`
+		// QuarantineDir is where failing runs are moved with their PCAP and the reason
+		// (default: <buffering.dir>/quarantine)
+		QuarantineDir string `json:"quarantine_dir"`
+	} `json:"validation"`
+
+	// EncryptedDNS configuration for DNS over TLS, HTTPS and QUIC detection
+	EncryptedDNS struct {
+		// Enabled identifies each window's DoT, DoQ and DoH connections by port 853, the
+		// client's TLS ALPN and a list of public resolver addresses and server names, and
+		// uploads them as an "encrypted_dns" log alongside the Zeek logs, flagging those
+		// to resolvers outside the network
+		Enabled bool `json:"enabled"`
+		// ResolversPath is a local resolver list (CSV of provider,type,value with types
+		// ip, cidr and domain) used over the embedded one; it is re-read when it changes
+		ResolversPath string `json:"resolvers_path"`
+	} `json:"encrypted_dns"`
+
+	// Summary configuration for per-window traffic summaries
+	Summary struct {
+		// Enabled aggregates each window's conn.log into a "summary" log of byte, packet
+		// and connection totals, the protocol and service mix, per internal host totals
+		// and distinct external destinations, and the top talkers
+		Enabled bool `json:"enabled"`
+		// Upload is whether the summary is uploaded alongside the conn, dns, dhcp,
+		// ja3_ja4 and ja4s logs (SummaryUploadAlongside, default) or instead of them
+		// (SummaryUploadInstead), for low-bandwidth sites
+		Upload string `json:"upload"`
+		// TopTalkers is how many originator/responder pairs, by bytes, are listed
+		// (default: 10, max: 1000)
+		TopTalkers int `json:"top_talkers"`
+	} `json:"summary"`
 }
 
 // splitCSV splits a comma-delimited string into trimmed, non-empty entries.
@@ -105,13 +352,121 @@ func splitCSV(s string) []string {
 	return out
 }
 
-// ExcludedSubnetList returns the configured excluded subnet CIDRs as a trimmed,
-// non-empty slice. Returns nil when the feature is off. Entries are validated by
-// ValidateAndSetDefaults at load time.
+// ExcludedSubnetList returns the configured excluded subnet entries
+// ("CIDR[=action]") as a trimmed, non-empty slice. Returns nil when the feature
+// is off. Entries are validated by ValidateAndSetDefaults at load time.
 func (c *Config) ExcludedSubnetList() []string {
 	return splitCSV(c.Zeek.ExcludedSubnets)
 }
 
+// SubnetSamplingList returns the configured per-subnet sampling entries
+// ("CIDR=percentage") as a trimmed, non-empty slice. Returns nil when the
+// feature is off. Entries are validated by ValidateAndSetDefaults at load time.
+func (c *Config) SubnetSamplingList() []string {
+	return splitCSV(c.Zeek.SubnetSampling)
+}
+
+// MonitoredSubnetList returns the configured monitored subnet CIDRs as a
+// trimmed, non-empty slice. Returns nil when the allow-list is off. Entries are
+// validated by ValidateAndSetDefaults at load time.
+func (c *Config) MonitoredSubnetList() []string {
+	return splitCSV(c.Zeek.MonitoredSubnets)
+}
+
+// ExcludedDomainList returns the configured excluded domain entries
+// ("pattern[=action]") as a trimmed, non-empty slice. Returns nil when the
+// feature is off. Entries are validated by ValidateAndSetDefaults at load time.
+func (c *Config) ExcludedDomainList() []string {
+	return splitCSV(c.Zeek.ExcludedDomains)
+}
+
+// OUIPathList returns the configured OUI registry files and directories as a
+// trimmed, non-empty slice. Returns nil when only the built-in registry is
+// used. Entries are validated by ValidateAndSetDefaults at load time.
+func (c *Config) OUIPathList() []string {
+	return splitCSV(c.Zeek.OUIPath)
+}
+
+// FilterRuleList returns the configured record filter rules as a trimmed,
+// non-empty slice of rule sources. Returns nil when the feature is off. Rules
+// are validated by ValidateAndSetDefaults at load time.
+func (c *Config) FilterRuleList() []string {
+	return rules.Split(c.Zeek.FilterRules)
+}
+
+// defaultHealthCaptureLossPercent is the capture loss warned about when
+// health_capture_loss_percent is not configured.
+const defaultHealthCaptureLossPercent = 1
+
+// HealthCaptureLossThreshold returns the capture loss, in percent, above
+// which a run is logged as a warning: the configured
+// health_capture_loss_percent, where 0 warns on any loss, or 1 when it is
+// not configured.
+func (c *Config) HealthCaptureLossThreshold() float64 {
+	if c.Zeek.HealthCaptureLossPercent == nil {
+		return defaultHealthCaptureLossPercent
+	}
+	return *c.Zeek.HealthCaptureLossPercent
+}
+
+// defaultBeaconScoreThreshold is the beacon score reported when
+// beacons.score_threshold is not configured.
+const defaultBeaconScoreThreshold = 0.8
+
+// BeaconScoreThreshold returns the periodicity score at or above which a pair
+// is reported as beaconing: the configured beacons.score_threshold, where 0
+// reports every pair scored, or 0.8 when it is not configured.
+func (c *Config) BeaconScoreThreshold() float64 {
+	if c.Beacons.ScoreThreshold == nil {
+		return defaultBeaconScoreThreshold
+	}
+	return *c.Beacons.ScoreThreshold
+}
+
+// Defaults of the DNS anomaly thresholds that are not configured.
+const (
+	defaultDNSEntropyThreshold    = 3.5
+	defaultDNSNXDomainRatio       = 0.25
+	defaultDNSDGAEntropyThreshold = 3.0
+)
+
+// DNSEntropyThreshold returns the mean subdomain label entropy at or above
+// which a domain looks like a tunnel: the configured
+// dns_anomalies.entropy_threshold, or 3.5 when it is not configured.
+func (c *Config) DNSEntropyThreshold() float64 {
+	if c.DNSAnomalies.EntropyThreshold == nil {
+		return defaultDNSEntropyThreshold
+	}
+	return *c.DNSAnomalies.EntropyThreshold
+}
+
+// DNSNXDomainRatio returns the share of a client's queries answered NXDOMAIN
+// at or above which it may be running a DGA: the configured
+// dns_anomalies.nxdomain_ratio, or 0.25 when it is not configured.
+func (c *Config) DNSNXDomainRatio() float64 {
+	if c.DNSAnomalies.NXDomainRatio == nil {
+		return defaultDNSNXDomainRatio
+	}
+	return *c.DNSAnomalies.NXDomainRatio
+}
+
+// DNSDGAEntropyThreshold returns the mean entropy of a client's NXDOMAIN
+// names at or above which they look generated: the configured
+// dns_anomalies.dga_entropy_threshold, or 3.0 when it is not configured.
+func (c *Config) DNSDGAEntropyThreshold() float64 {
+	if c.DNSAnomalies.DGAEntropyThreshold == nil {
+		return defaultDNSDGAEntropyThreshold
+	}
+	return *c.DNSAnomalies.DGAEntropyThreshold
+}
+
+// subnetCovers reports whether outer contains every address of inner.
+func subnetCovers(outer, inner *net.IPNet) bool {
+	outerOnes, outerBits := outer.Mask.Size()
+	innerOnes, innerBits := inner.Mask.Size()
+	return outerBits == innerBits && outerOnes <= innerOnes && outer.Contains(inner.IP)
+}
+
 // validateNetworkID validates the network_id format
 // Rules: 1-64 characters, alphanumeric + spaces/hyphens/underscores, must start/end with alphanumeric
 func validateNetworkID(networkID string) error {
@@ -189,11 +544,36 @@ func (config *Config) ValidateAndSetDefaults() error {
 	if config.Capture.Interface == "" {
 		config.Capture.Interface = "any"
 	}
+	switch config.Capture.Mode {
+	case "":
+		config.Capture.Mode = CaptureModePCAP
+	case CaptureModePCAP:
+	case CaptureModeLive:
+		interfaces, err := config.GetAllInterfaces()
+		if err != nil {
+			return err
+		}
+		if len(interfaces) != 1 {
+			return fmt.Errorf("capture.mode live reads a single interface, got %q", config.Capture.Interface)
+		}
+		if config.Capture.WindowSeconds < 10 {
+			return fmt.Errorf("capture.window_seconds must be at least 10 in live mode, got %d", config.Capture.WindowSeconds)
+		}
+	default:
+		return fmt.Errorf("capture.mode must be %q or %q, got %q", CaptureModePCAP, CaptureModeLive, config.Capture.Mode)
+	}
 	if config.Capture.MaxProcessingWorkers == 0 {
 		config.Capture.MaxProcessingWorkers = 10
 	} else if config.Capture.MaxProcessingWorkers < 1 || config.Capture.MaxProcessingWorkers > 20 {
 		return fmt.Errorf("capture.max_processing_workers must be between 1 and 20, got %d", config.Capture.MaxProcessingWorkers)
 	}
+
+	// Validate WorkerMemoryMB: default 64, min 16, max 4096
+	if config.Capture.WorkerMemoryMB == 0 {
+		config.Capture.WorkerMemoryMB = 64
+	} else if config.Capture.WorkerMemoryMB < 16 || config.Capture.WorkerMemoryMB > 4096 {
+		return fmt.Errorf("capture.worker_memory_mb must be between 16 and 4096, got %d", config.Capture.WorkerMemoryMB)
+	}
 	// Validate Capture RetentionHours: nil means "not configured" (fall back to log_retention_days), 0 = immediate cleanup, max 720
 	if config.Capture.RetentionHours != nil {
 		if *config.Capture.RetentionHours < 0 {
@@ -206,12 +586,119 @@ func (config *Config) ValidateAndSetDefaults() error {
 	if config.Zeek.SamplingPercentage == 0 {
 		config.Zeek.SamplingPercentage = 100 // Default to 100% (process all traffic)
 	}
+	// Validate subnet_sampling: empty = feature off. Every entry must be a
+	// CIDR with a percentage between 0 and 100.
+	for _, entry := range splitCSV(config.Zeek.SubnetSampling) {
+		cidr, pct, found := strings.Cut(entry, "=")
+		if !found {
+			return fmt.Errorf("zeek.subnet_sampling: missing rate in %q (expected e.g. 10.50.0.0/16=5)", entry)
+		}
+		if _, _, err := net.ParseCIDR(strings.TrimSpace(cidr)); err != nil {
+			return fmt.Errorf("zeek.subnet_sampling: invalid CIDR in %q: %w", entry, err)
+		}
+		if rate, err := strconv.ParseFloat(strings.TrimSpace(pct), 64); err != nil || rate < 0 || rate > 100 {
+			return fmt.Errorf("zeek.subnet_sampling: invalid percentage in %q (expected 0-100)", entry)
+		}
+	}
 	// Validate excluded_subnets: empty = feature off. Every comma-separated
-	// entry must be a valid CIDR; reject malformed lists with a clear error.
+	// entry must be a valid CIDR with an optional known policy suffix; reject
+	// malformed lists with a clear error.
 	for _, entry := range splitCSV(config.Zeek.ExcludedSubnets) {
-		if _, _, err := net.ParseCIDR(entry); err != nil {
+		cidr, action := policy.SplitSubnet(entry)
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
 			return fmt.Errorf("zeek.excluded_subnets: invalid CIDR %q (expected e.g. 10.0.0.0/8): %w", entry, err)
 		}
+		if !policy.ValidSubnetAction(action) {
+			return fmt.Errorf("zeek.excluded_subnets: invalid policy %q in %q (expected %s, %s or %s)", action, entry, policy.SubnetDrop, policy.SubnetMask, policy.SubnetTruncate)
+		}
+	}
+	// Validate monitored_subnets: empty = allow-list off. Every entry must be
+	// a plain CIDR, and no monitored range may be wholly swallowed by a drop
+	// exclusion (nothing in it could ever be uploaded).
+	for _, entry := range splitCSV(config.Zeek.MonitoredSubnets) {
+		_, monitored, err := net.ParseCIDR(entry)
+		if err != nil {
+			return fmt.Errorf("zeek.monitored_subnets: invalid CIDR %q (expected e.g. 10.1.0.0/16): %w", entry, err)
+		}
+		for _, excl := range splitCSV(config.Zeek.ExcludedSubnets) {
+			cidr, action := policy.SplitSubnet(excl)
+			if action != policy.SubnetDrop {
+				continue
+			}
+			_, excluded, _ := net.ParseCIDR(cidr)
+			if subnetCovers(excluded, monitored) {
+				return fmt.Errorf("zeek.monitored_subnets: %q is entirely dropped by zeek.excluded_subnets entry %q", entry, excl)
+			}
+		}
+	}
+	// Validate excluded_domains: empty = feature off. Every entry must be a DNS
+	// name or glob with an optional known policy suffix.
+	for _, entry := range splitCSV(config.Zeek.ExcludedDomains) {
+		pattern, action := policy.SplitDomain(entry)
+		if !policy.ValidDomainPattern(pattern) {
+			return fmt.Errorf("zeek.excluded_domains: invalid domain pattern %q (expected e.g. hr.corp, *.hr.corp or host[0-9].hr.corp)", entry)
+		}
+		if !policy.ValidDomainAction(action) {
+			return fmt.Errorf("zeek.excluded_domains: invalid policy %q in %q (expected %s or %s)", action, entry, policy.DomainDrop, policy.DomainRedact)
+		}
+	}
+	// Validate output_encoding: default tsv (what the backend has always
+	// received).
+	config.Zeek.OutputEncoding = strings.ToLower(strings.TrimSpace(config.Zeek.OutputEncoding))
+	if config.Zeek.OutputEncoding == "" {
+		config.Zeek.OutputEncoding = logenc.TSV
+	} else if !logenc.Valid(config.Zeek.OutputEncoding) {
+		return fmt.Errorf("zeek.output_encoding: unsupported encoding %q (expected one of %s)", config.Zeek.OutputEncoding, strings.Join(logenc.Names(), ", "))
+	}
+	// Validate community_id_seed: a 16-bit value, as in the Community ID spec.
+	if config.Zeek.CommunityIDSeed < 0 || config.Zeek.CommunityIDSeed > 65535 {
+		return fmt.Errorf("zeek.community_id_seed must be between 0 and 65535, got %d", config.Zeek.CommunityIDSeed)
+	}
+	// Validate oui_path: each entry may be missing (it is picked up once it
+	// appears), but one that exists must be a directory or a .csv or .txt
+	// registry file, and none may be listed twice.
+	ouiSeen := make(map[string]bool)
+	for _, p := range config.OUIPathList() {
+		clean := filepath.Clean(p)
+		if ouiSeen[clean] {
+			return fmt.Errorf("zeek.oui_path: %q is listed more than once", p)
+		}
+		ouiSeen[clean] = true
+		fi, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(p))
+		switch {
+		case fi.IsDir():
+		case !fi.Mode().IsRegular():
+			return fmt.Errorf("zeek.oui_path: %q is not a file or directory", p)
+		case ext != ".csv" && ext != ".txt":
+			return fmt.Errorf("zeek.oui_path: %q is not an IEEE registry file (expected .csv or .txt)", p)
+		}
+	}
+	// Validate filter_rules: empty = feature off. Every rule must parse.
+	if _, err := rules.ParseList(config.Zeek.FilterRules); err != nil {
+		return fmt.Errorf("zeek.filter_rules: %w", err)
+	}
+	// Defaults and validation for the Zeek health thresholds: nil means
+	// "not configured", an explicit 0 warns on any capture loss
+	if config.Zeek.HealthCaptureLossPercent == nil {
+		defaultLoss := float64(defaultHealthCaptureLossPercent)
+		config.Zeek.HealthCaptureLossPercent = &defaultLoss
+	}
+	if loss := *config.Zeek.HealthCaptureLossPercent; loss < 0 || loss > 100 {
+		return fmt.Errorf("zeek.health_capture_loss_percent must be between 0 and 100, got %g", loss)
+	}
+	if config.Zeek.HealthReporterErrors < 0 {
+		return fmt.Errorf("zeek.health_reporter_errors must be 0 or more, got %d", config.Zeek.HealthReporterErrors)
+	}
+	switch config.Zeek.ScriptCheck {
+	case "":
+		config.Zeek.ScriptCheck = ScriptCheckDegrade
+	case ScriptCheckDegrade, ScriptCheckStrict, ScriptCheckOff:
+	default:
+		return fmt.Errorf("zeek.script_check must be %q, %q or %q, got %q", ScriptCheckDegrade, ScriptCheckStrict, ScriptCheckOff, config.Zeek.ScriptCheck)
 	}
 	// Defaults for buffering
 	if config.Buffering.Dir == "" {
@@ -238,6 +725,122 @@ func (config *Config) ValidateAndSetDefaults() error {
 	} else if config.PcapIngest.FileStableSeconds > 60 {
 		config.PcapIngest.FileStableSeconds = 60
 	}
+	if config.PcapIngest.Shards < 1 {
+		config.PcapIngest.Shards = 1
+	} else if config.PcapIngest.Shards > 64 {
+		config.PcapIngest.Shards = 64
+	}
+	if config.PcapIngest.ShardMinMB <= 0 {
+		config.PcapIngest.ShardMinMB = 1024
+	}
+	// Defaults and validation for Assets
+	if config.Assets.Upload && !config.Assets.Enabled {
+		return fmt.Errorf("assets.upload requires assets.enabled")
+	}
+	if config.Assets.DeviceEvents && !config.Assets.Enabled {
+		return fmt.Errorf("assets.device_events requires assets.enabled")
+	}
+	if config.Assets.RetentionDays == 0 {
+		config.Assets.RetentionDays = 90
+	} else if config.Assets.RetentionDays < 0 || config.Assets.RetentionDays > 3650 {
+		return fmt.Errorf("assets.retention_days must be between 1 and 3650, got %d", config.Assets.RetentionDays)
+	}
+	// Defaults and validation for Beacons
+	if config.Beacons.LookbackHours == 0 {
+		config.Beacons.LookbackHours = 24
+	} else if config.Beacons.LookbackHours < 0 || config.Beacons.LookbackHours > 168 {
+		return fmt.Errorf("beacons.lookback_hours must be between 1 and 168, got %d", config.Beacons.LookbackHours)
+	}
+	if config.Beacons.MinConnections == 0 {
+		config.Beacons.MinConnections = 10
+	} else if config.Beacons.MinConnections < 4 || config.Beacons.MinConnections > 256 {
+		return fmt.Errorf("beacons.min_connections must be between 4 and 256, got %d", config.Beacons.MinConnections)
+	}
+	// nil means "not configured", an explicit 0 reports every pair scored
+	if config.Beacons.ScoreThreshold == nil {
+		defaultScore := defaultBeaconScoreThreshold
+		config.Beacons.ScoreThreshold = &defaultScore
+	}
+	if score := *config.Beacons.ScoreThreshold; score < 0 || score > 1 {
+		return fmt.Errorf("beacons.score_threshold must be between 0 and 1, got %g", score)
+	}
+	if config.Beacons.MaxPairs == 0 {
+		config.Beacons.MaxPairs = 50000
+	} else if config.Beacons.MaxPairs < 1000 || config.Beacons.MaxPairs > 1000000 {
+		return fmt.Errorf("beacons.max_pairs must be between 1000 and 1000000, got %d", config.Beacons.MaxPairs)
+	}
+	// Defaults and validation for DNSAnomalies
+	if config.DNSAnomalies.MinUniqueNames == 0 {
+		config.DNSAnomalies.MinUniqueNames = 100
+	} else if config.DNSAnomalies.MinUniqueNames < 1 {
+		return fmt.Errorf("dns_anomalies.min_unique_names must be at least 1, got %d", config.DNSAnomalies.MinUniqueNames)
+	}
+	// For the ratio and entropy thresholds nil means "not configured", an
+	// explicit 0 means any value crosses them
+	if config.DNSAnomalies.EntropyThreshold == nil {
+		defaultEntropy := defaultDNSEntropyThreshold
+		config.DNSAnomalies.EntropyThreshold = &defaultEntropy
+	}
+	if entropy := *config.DNSAnomalies.EntropyThreshold; entropy < 0 || entropy > 8 {
+		return fmt.Errorf("dns_anomalies.entropy_threshold must be between 0 and 8, got %g", entropy)
+	}
+	if config.DNSAnomalies.QueryLengthThreshold == 0 {
+		config.DNSAnomalies.QueryLengthThreshold = 60
+	} else if config.DNSAnomalies.QueryLengthThreshold < 1 || config.DNSAnomalies.QueryLengthThreshold > 255 {
+		return fmt.Errorf("dns_anomalies.query_length_threshold must be between 1 and 255, got %d", config.DNSAnomalies.QueryLengthThreshold)
+	}
+	if config.DNSAnomalies.TXTThreshold == 0 {
+		config.DNSAnomalies.TXTThreshold = 50
+	} else if config.DNSAnomalies.TXTThreshold < 1 {
+		return fmt.Errorf("dns_anomalies.txt_threshold must be at least 1, got %d", config.DNSAnomalies.TXTThreshold)
+	}
+	if config.DNSAnomalies.MinNXDomains == 0 {
+		config.DNSAnomalies.MinNXDomains = 25
+	} else if config.DNSAnomalies.MinNXDomains < 1 {
+		return fmt.Errorf("dns_anomalies.min_nxdomains must be at least 1, got %d", config.DNSAnomalies.MinNXDomains)
+	}
+	if config.DNSAnomalies.NXDomainRatio == nil {
+		defaultRatio := defaultDNSNXDomainRatio
+		config.DNSAnomalies.NXDomainRatio = &defaultRatio
+	}
+	if ratio := *config.DNSAnomalies.NXDomainRatio; ratio < 0 || ratio > 1 {
+		return fmt.Errorf("dns_anomalies.nxdomain_ratio must be between 0 and 1, got %g", ratio)
+	}
+	if config.DNSAnomalies.DGAEntropyThreshold == nil {
+		defaultEntropy := defaultDNSDGAEntropyThreshold
+		config.DNSAnomalies.DGAEntropyThreshold = &defaultEntropy
+	}
+	if entropy := *config.DNSAnomalies.DGAEntropyThreshold; entropy < 0 || entropy > 8 {
+		return fmt.Errorf("dns_anomalies.dga_entropy_threshold must be between 0 and 8, got %g", entropy)
+	}
+	// Defaults and validation for Continuity
+	if config.Continuity.EdgeSeconds == 0 {
+		config.Continuity.EdgeSeconds = 1
+	} else if config.Continuity.EdgeSeconds < 0 || config.Continuity.EdgeSeconds > 30 {
+		return fmt.Errorf("continuity.edge_seconds must be between 1 and 30, got %d", config.Continuity.EdgeSeconds)
+	}
+	if config.Continuity.MaxGapSeconds == 0 {
+		config.Continuity.MaxGapSeconds = 10
+	} else if config.Continuity.MaxGapSeconds < 0 || config.Continuity.MaxGapSeconds > 300 {
+		return fmt.Errorf("continuity.max_gap_seconds must be between 1 and 300, got %d", config.Continuity.MaxGapSeconds)
+	}
+	// Defaults for Validation
+	if config.Validation.QuarantineDir == "" {
+		config.Validation.QuarantineDir = filepath.Join(config.Buffering.Dir, "quarantine")
+	}
+	// Defaults and validation for Summary
+	switch config.Summary.Upload {
+	case "":
+		config.Summary.Upload = SummaryUploadAlongside
+	case SummaryUploadAlongside, SummaryUploadInstead:
+	default:
+		return fmt.Errorf("summary.upload must be %q or %q, got %q", SummaryUploadAlongside, SummaryUploadInstead, config.Summary.Upload)
+	}
+	if config.Summary.TopTalkers == 0 {
+		config.Summary.TopTalkers = 10
+	} else if config.Summary.TopTalkers < 1 || config.Summary.TopTalkers > 1000 {
+		return fmt.Errorf("summary.top_talkers must be between 1 and 1000, got %d", config.Summary.TopTalkers)
+	}
 	return nil
 }
 
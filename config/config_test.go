@@ -1,6 +1,9 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -20,6 +23,10 @@ func TestValidateExcludedSubnets(t *testing.T) {
 		{"missing mask rejected", "10.0.0.0", true, nil},
 		{"garbage rejected", "10.0.0.0/8,not-a-cidr", true, nil},
 		{"bad mask rejected", "10.0.0.0/99", true, nil},
+		{"policy suffixes accepted", "10.0.0.0/8=mask, 172.20.10.0/24=truncate-to-prefix,fd00::/8=drop", false, []string{"10.0.0.0/8=mask", "172.20.10.0/24=truncate-to-prefix", "fd00::/8=drop"}},
+		{"policy suffix is case-insensitive", "10.0.0.0/8=MASK", false, []string{"10.0.0.0/8=MASK"}},
+		{"unknown policy rejected", "10.0.0.0/8=hide", true, nil},
+		{"empty policy means drop", "10.0.0.0/8=", false, []string{"10.0.0.0/8="}},
 	}
 
 	for _, tt := range tests {
@@ -67,6 +74,297 @@ func TestExcludedSubnetsEnvOverride(t *testing.T) {
 	}
 }
 
+func TestValidateSubnetSampling(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		wantError bool
+		wantLen   int
+	}{
+		{"empty is feature off", "", false, 0},
+		{"valid list", "10.1.0.0/16=100, 10.50.0.0/16=5,fd00::/8=0.5", false, 3},
+		{"missing rate rejected", "10.1.0.0/16", true, 0},
+		{"invalid CIDR rejected", "10.1.0.0=5", true, 0},
+		{"rate above 100 rejected", "10.1.0.0/16=150", true, 0},
+		{"non-numeric rate rejected", "10.1.0.0/16=half", true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newBaseConfig()
+			cfg.Zeek.SubnetSampling = tt.value
+			err := cfg.ValidateAndSetDefaults()
+			if tt.wantError {
+				if err == nil {
+					t.Fatalf("expected error for %q, got nil", tt.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error for %q: %v", tt.value, err)
+			}
+			if got := cfg.SubnetSamplingList(); len(got) != tt.wantLen {
+				t.Errorf("SubnetSamplingList() = %v, want %d entries", got, tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestValidateMonitoredSubnets(t *testing.T) {
+	tests := []struct {
+		name      string
+		monitored string
+		excluded  string
+		wantError bool
+		wantLen   int
+	}{
+		{"empty is feature off", "", "", false, 0},
+		{"valid list", "10.1.0.0/16, 192.168.0.0/24,fd00::/8", "", false, 3},
+		{"invalid CIDR rejected", "10.1.0.0", "", true, 0},
+		{"policy suffix rejected", "10.1.0.0/16=mask", "", true, 0},
+		{"exclusion carving a hole is fine", "10.0.0.0/8", "10.9.0.0/16", false, 1},
+		{"masked exclusion covering range is fine", "10.1.0.0/16", "10.0.0.0/8=mask", false, 1},
+		{"drop exclusion covering range rejected", "10.1.0.0/16", "10.0.0.0/8", true, 0},
+		{"explicit drop covering range rejected", "10.1.0.0/16", "10.1.0.0/16=drop", true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newBaseConfig()
+			cfg.Zeek.MonitoredSubnets = tt.monitored
+			cfg.Zeek.ExcludedSubnets = tt.excluded
+			err := cfg.ValidateAndSetDefaults()
+			if tt.wantError {
+				if err == nil {
+					t.Fatalf("expected error for %q / %q, got nil", tt.monitored, tt.excluded)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error for %q / %q: %v", tt.monitored, tt.excluded, err)
+			}
+			if got := cfg.MonitoredSubnetList(); len(got) != tt.wantLen {
+				t.Errorf("MonitoredSubnetList() = %v, want %d entries", got, tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestValidateExcludedDomains(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		wantError bool
+		wantLen   int
+	}{
+		{"empty is feature off", "", false, 0},
+		{"suffix and glob", "hr.corp, *.health.example", false, 2},
+		{"policy suffixes", "hr.corp=redact,legal.corp=DROP", false, 2},
+		{"trailing root dot", "hr.corp.", false, 1},
+		{"bracket class glob", "db[0-9].corp,host[^a-c]?.hr.corp=redact", false, 2},
+		{"unterminated bracket rejected", "db[0-9.corp", true, 0},
+		{"escape rejected", `db\*.corp`, true, 0},
+		{"empty policy means drop", "hr.corp=", false, 1},
+		{"unknown policy rejected", "hr.corp=mask", true, 0},
+		{"invalid characters rejected", "hr corp", true, 0},
+		{"empty label rejected", "hr..corp", true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newBaseConfig()
+			cfg.Zeek.ExcludedDomains = tt.value
+			err := cfg.ValidateAndSetDefaults()
+			if tt.wantError {
+				if err == nil {
+					t.Fatalf("expected error for %q, got nil", tt.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error for %q: %v", tt.value, err)
+			}
+			if got := cfg.ExcludedDomainList(); len(got) != tt.wantLen {
+				t.Errorf("ExcludedDomainList() = %v, want %d entries", got, tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestValidateFilterRules(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		wantError bool
+		wantLen   int
+	}{
+		{"empty is feature off", "", false, 0},
+		{"single rule", "drop conn where id.resp_p in (873, 445) and proto == tcp", false, 1},
+		{"multiple rules", "drop conn where proto == icmp; drop dns where qtype_name == PTR;", false, 2},
+		{"unknown action rejected", "keep conn where proto == tcp", true, 0},
+		{"missing condition rejected", "drop conn where", true, 0},
+		{"bad regex rejected", `drop dns where query =~ "("`, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newBaseConfig()
+			cfg.Zeek.FilterRules = tt.value
+			err := cfg.ValidateAndSetDefaults()
+			if tt.wantError {
+				if err == nil {
+					t.Fatalf("expected error for %q, got nil", tt.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error for %q: %v", tt.value, err)
+			}
+			if got := cfg.FilterRuleList(); len(got) != tt.wantLen {
+				t.Errorf("FilterRuleList() = %v, want %d entries", got, tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestValidateOutputEncoding(t *testing.T) {
+	tests := []struct {
+		value     string
+		want      string
+		wantError bool
+	}{
+		{"", "tsv", false},
+		{"tsv", "tsv", false},
+		{" CSV ", "csv", false},
+		{"ndjson", "ndjson", false},
+		{"xlsx", "xlsx", false},
+		{"parquet", "parquet", false},
+		{"yaml", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			cfg := newBaseConfig()
+			cfg.Zeek.OutputEncoding = tt.value
+			err := cfg.ValidateAndSetDefaults()
+			if tt.wantError {
+				if err == nil {
+					t.Fatalf("expected error for %q, got nil", tt.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error for %q: %v", tt.value, err)
+			}
+			if cfg.Zeek.OutputEncoding != tt.want {
+				t.Errorf("OutputEncoding = %q, want %q", cfg.Zeek.OutputEncoding, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateWorkerMemory(t *testing.T) {
+	tests := []struct {
+		value     int
+		want      int
+		wantError bool
+	}{
+		{0, 64, false},
+		{16, 16, false},
+		{4096, 4096, false},
+		{8, 0, true},
+		{8192, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.value), func(t *testing.T) {
+			cfg := newBaseConfig()
+			cfg.Capture.WorkerMemoryMB = tt.value
+			err := cfg.ValidateAndSetDefaults()
+			if tt.wantError {
+				if err == nil {
+					t.Fatalf("expected error for %d, got nil", tt.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error for %d: %v", tt.value, err)
+			}
+			if cfg.Capture.WorkerMemoryMB != tt.want {
+				t.Errorf("WorkerMemoryMB = %d, want %d", cfg.Capture.WorkerMemoryMB, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateCommunityIDSeed(t *testing.T) {
+	for _, seed := range []int{0, 1, 65535} {
+		cfg := newBaseConfig()
+		cfg.Zeek.CommunityIDSeed = seed
+		if err := cfg.ValidateAndSetDefaults(); err != nil {
+			t.Errorf("seed %d: unexpected error: %v", seed, err)
+		}
+	}
+	for _, seed := range []int{-1, 65536} {
+		cfg := newBaseConfig()
+		cfg.Zeek.CommunityIDSeed = seed
+		if err := cfg.ValidateAndSetDefaults(); err == nil {
+			t.Errorf("seed %d: expected error, got nil", seed)
+		}
+	}
+}
+
+func TestValidateGeoIPPathMayBeMissing(t *testing.T) {
+	cfg := newBaseConfig()
+	cfg.Zeek.GeoIPPath = "/nonexistent/GeoLite2-Country.mmdb"
+	if err := cfg.ValidateAndSetDefaults(); err != nil {
+		t.Errorf("a missing GeoIP database must not fail startup: %v", err)
+	}
+}
+
+func TestValidateOUIPath(t *testing.T) {
+	dir := t.TempDir()
+	ouiCSV := filepath.Join(dir, "oui.csv")
+	ouiTXT := filepath.Join(dir, "oui.txt")
+	mmdb := filepath.Join(dir, "GeoLite2-ASN.mmdb")
+	for _, p := range []string{ouiCSV, ouiTXT, mmdb} {
+		if err := os.WriteFile(p, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, ok := range []string{
+		"",
+		ouiCSV,
+		dir,
+		ouiCSV + ", " + ouiTXT,
+		dir + "," + filepath.Join(dir, "missing.csv"),
+		"/nonexistent/oui",
+	} {
+		cfg := newBaseConfig()
+		cfg.Zeek.OUIPath = ok
+		if err := cfg.ValidateAndSetDefaults(); err != nil {
+			t.Errorf("oui_path %q: unexpected error: %v", ok, err)
+		}
+	}
+	for _, bad := range []string{
+		mmdb,
+		ouiCSV + "," + ouiTXT + "," + ouiCSV,
+		dir + "," + dir + "/",
+	} {
+		cfg := newBaseConfig()
+		cfg.Zeek.OUIPath = bad
+		if err := cfg.ValidateAndSetDefaults(); err == nil {
+			t.Errorf("oui_path %q: expected error, got nil", bad)
+		}
+	}
+
+	cfg := newBaseConfig()
+	cfg.Zeek.OUIPath = " " + ouiCSV + " ,, " + dir
+	if got := cfg.OUIPathList(); len(got) != 2 || got[0] != ouiCSV || got[1] != dir {
+		t.Errorf("OUIPathList() = %q", got)
+	}
+}
+
 func TestValidateInterfaceName(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -558,6 +856,22 @@ func TestConfig_PcapIngest_Defaults(t *testing.T) {
 	if cfg.PcapIngest.Enabled {
 		t.Error("Expected PcapIngest.Enabled to default to false")
 	}
+	if cfg.PcapIngest.Shards != 1 || cfg.PcapIngest.ShardMinMB != 1024 {
+		t.Errorf("Expected no sharding from 1024 MB by default, got %d shards from %d MB", cfg.PcapIngest.Shards, cfg.PcapIngest.ShardMinMB)
+	}
+}
+
+func TestConfig_PcapIngest_Shards(t *testing.T) {
+	for input, want := range map[int]int{-2: 1, 0: 1, 4: 4, 64: 64, 100: 64} {
+		cfg := &Config{NetworkID: "Test-Network-01"}
+		cfg.PcapIngest.Shards = input
+		if err := cfg.ValidateAndSetDefaults(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if cfg.PcapIngest.Shards != want {
+			t.Errorf("Shards: input %d, expected %d, got %d", input, want, cfg.PcapIngest.Shards)
+		}
+	}
 }
 
 func TestConfig_PcapIngest_Validation(t *testing.T) {
@@ -626,6 +940,156 @@ func TestConfig_PcapIngest_Bounds(t *testing.T) {
 	}
 }
 
+func TestConfig_Assets(t *testing.T) {
+	cfg := &Config{NetworkID: "Test-Network-01"}
+	if err := cfg.ValidateAndSetDefaults(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Assets.Enabled || cfg.Assets.Upload {
+		t.Error("Expected the asset inventory to default to off")
+	}
+	if cfg.Assets.RetentionDays != 90 {
+		t.Errorf("Expected default RetentionDays to be 90, got %d", cfg.Assets.RetentionDays)
+	}
+
+	cfg = &Config{NetworkID: "Test-Network-01"}
+	cfg.Assets.Upload = true
+	if err := cfg.ValidateAndSetDefaults(); err == nil || !strings.Contains(err.Error(), "assets.upload requires assets.enabled") {
+		t.Errorf("Expected error for upload without enabled, got: %v", err)
+	}
+
+	cfg = &Config{NetworkID: "Test-Network-01"}
+	cfg.Assets.DeviceEvents = true
+	if err := cfg.ValidateAndSetDefaults(); err == nil || !strings.Contains(err.Error(), "assets.device_events requires assets.enabled") {
+		t.Errorf("Expected error for device_events without enabled, got: %v", err)
+	}
+
+	for _, days := range []int{-1, 3651} {
+		cfg = &Config{NetworkID: "Test-Network-01"}
+		cfg.Assets.Enabled = true
+		cfg.Assets.RetentionDays = days
+		if err := cfg.ValidateAndSetDefaults(); err == nil {
+			t.Errorf("Expected error for retention_days %d", days)
+		}
+	}
+}
+
+func TestConfig_Beacons(t *testing.T) {
+	cfg := &Config{NetworkID: "Test-Network-01"}
+	if err := cfg.ValidateAndSetDefaults(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Beacons.Enabled {
+		t.Error("Expected beacon detection to default to off")
+	}
+	if cfg.Beacons.LookbackHours != 24 || cfg.Beacons.MinConnections != 10 || cfg.BeaconScoreThreshold() != 0.8 || cfg.Beacons.MaxPairs != 50000 {
+		t.Errorf("Unexpected beacon defaults: %+v", cfg.Beacons)
+	}
+
+	// An explicit 0 is kept: it reports every pair scored.
+	zero := 0.0
+	cfg = &Config{NetworkID: "Test-Network-01"}
+	cfg.Beacons.ScoreThreshold = &zero
+	if err := cfg.ValidateAndSetDefaults(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := cfg.BeaconScoreThreshold(); got != 0 {
+		t.Errorf("score_threshold 0 became %v", got)
+	}
+
+	tooHigh := 1.5
+	for name, set := range map[string]func(*Config){
+		"lookback_hours":  func(c *Config) { c.Beacons.LookbackHours = 169 },
+		"min_connections": func(c *Config) { c.Beacons.MinConnections = 3 },
+		"score_threshold": func(c *Config) { c.Beacons.ScoreThreshold = &tooHigh },
+		"max_pairs":       func(c *Config) { c.Beacons.MaxPairs = 10 },
+	} {
+		cfg = &Config{NetworkID: "Test-Network-01"}
+		set(cfg)
+		if err := cfg.ValidateAndSetDefaults(); err == nil || !strings.Contains(err.Error(), "beacons."+name) {
+			t.Errorf("Expected error for invalid beacons.%s, got: %v", name, err)
+		}
+	}
+}
+
+func TestConfig_DNSAnomalies(t *testing.T) {
+	cfg := &Config{NetworkID: "Test-Network-01"}
+	if err := cfg.ValidateAndSetDefaults(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	d := cfg.DNSAnomalies
+	if d.Enabled {
+		t.Error("Expected DNS anomaly detection to default to off")
+	}
+	if d.MinUniqueNames != 100 || cfg.DNSEntropyThreshold() != 3.5 || d.QueryLengthThreshold != 60 || d.TXTThreshold != 50 ||
+		d.MinNXDomains != 25 || cfg.DNSNXDomainRatio() != 0.25 || cfg.DNSDGAEntropyThreshold() != 3.0 {
+		t.Errorf("Unexpected DNS anomaly defaults: %+v", d)
+	}
+
+	// An explicit 0 is kept rather than replaced by the default.
+	zero := 0.0
+	cfg = &Config{NetworkID: "Test-Network-01"}
+	cfg.DNSAnomalies.EntropyThreshold = &zero
+	cfg.DNSAnomalies.NXDomainRatio = &zero
+	cfg.DNSAnomalies.DGAEntropyThreshold = &zero
+	if err := cfg.ValidateAndSetDefaults(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if e, r, g := cfg.DNSEntropyThreshold(), cfg.DNSNXDomainRatio(), cfg.DNSDGAEntropyThreshold(); e != 0 || r != 0 || g != 0 {
+		t.Errorf("thresholds of 0 became %v, %v, %v", e, r, g)
+	}
+
+	tooHigh, negative := 9.0, -1.0
+	for name, set := range map[string]func(*Config){
+		"min_unique_names":       func(c *Config) { c.DNSAnomalies.MinUniqueNames = -1 },
+		"entropy_threshold":      func(c *Config) { c.DNSAnomalies.EntropyThreshold = &tooHigh },
+		"query_length_threshold": func(c *Config) { c.DNSAnomalies.QueryLengthThreshold = 300 },
+		"txt_threshold":          func(c *Config) { c.DNSAnomalies.TXTThreshold = -5 },
+		"min_nxdomains":          func(c *Config) { c.DNSAnomalies.MinNXDomains = -1 },
+		"nxdomain_ratio":         func(c *Config) { c.DNSAnomalies.NXDomainRatio = &tooHigh },
+		"dga_entropy_threshold":  func(c *Config) { c.DNSAnomalies.DGAEntropyThreshold = &negative },
+	} {
+		cfg = &Config{NetworkID: "Test-Network-01"}
+		set(cfg)
+		if err := cfg.ValidateAndSetDefaults(); err == nil || !strings.Contains(err.Error(), "dns_anomalies."+name) {
+			t.Errorf("Expected error for invalid dns_anomalies.%s, got: %v", name, err)
+		}
+	}
+}
+
+func TestConfig_CaptureMode(t *testing.T) {
+	cfg := &Config{NetworkID: "Test-Network-01"}
+	if err := cfg.ValidateAndSetDefaults(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Capture.Mode != CaptureModePCAP {
+		t.Errorf("Expected capture mode to default to pcap, got %q", cfg.Capture.Mode)
+	}
+
+	cfg = &Config{NetworkID: "Test-Network-01"}
+	cfg.Capture.Mode = CaptureModeLive
+	cfg.Capture.Interface = "eth0"
+	cfg.Capture.WindowSeconds = 60
+	if err := cfg.ValidateAndSetDefaults(); err != nil {
+		t.Errorf("Unexpected error for live mode: %v", err)
+	}
+
+	for name, set := range map[string]func(*Config){
+		"capture.mode":           func(c *Config) { c.Capture.Mode = "ring" },
+		"single interface":       func(c *Config) { c.Capture.Interface = "eth0,eth1" },
+		"capture.window_seconds": func(c *Config) { c.Capture.WindowSeconds = 5 },
+	} {
+		cfg = &Config{NetworkID: "Test-Network-01"}
+		cfg.Capture.Mode = CaptureModeLive
+		cfg.Capture.Interface = "eth0"
+		cfg.Capture.WindowSeconds = 60
+		set(cfg)
+		if err := cfg.ValidateAndSetDefaults(); err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("Expected %s error, got: %v", name, err)
+		}
+	}
+}
+
 func TestConfig_ValidateAndSetDefaults_NetworkID(t *testing.T) {
 	// Test that missing network_id causes error
 	cfg := &Config{}
@@ -653,3 +1117,119 @@ func TestConfig_ValidateAndSetDefaults_NetworkID(t *testing.T) {
 		t.Errorf("Expected network_id to be trimmed to 'Trimmed-Network', got %q", cfg.NetworkID)
 	}
 }
+
+func TestConfig_Continuity(t *testing.T) {
+	cfg := &Config{NetworkID: "Test-Network-01"}
+	if err := cfg.ValidateAndSetDefaults(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Continuity.Enabled {
+		t.Error("Expected continuity tagging to default to off")
+	}
+	if cfg.Continuity.EdgeSeconds != 1 || cfg.Continuity.MaxGapSeconds != 10 {
+		t.Errorf("Unexpected continuity defaults: %+v", cfg.Continuity)
+	}
+
+	for name, set := range map[string]func(*Config){
+		"edge_seconds":    func(c *Config) { c.Continuity.EdgeSeconds = 31 },
+		"max_gap_seconds": func(c *Config) { c.Continuity.MaxGapSeconds = -1 },
+	} {
+		cfg = &Config{NetworkID: "Test-Network-01"}
+		set(cfg)
+		if err := cfg.ValidateAndSetDefaults(); err == nil || !strings.Contains(err.Error(), "continuity."+name) {
+			t.Errorf("Expected error for invalid continuity.%s, got: %v", name, err)
+		}
+	}
+}
+
+func TestConfig_ZeekHealth(t *testing.T) {
+	cfg := &Config{NetworkID: "Test-Network-01"}
+	if err := cfg.ValidateAndSetDefaults(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Zeek.HealthCaptureLossPercent == nil || *cfg.Zeek.HealthCaptureLossPercent != 1 || cfg.Zeek.HealthReporterErrors != 0 {
+		t.Errorf("Unexpected Zeek health defaults: %v, %v", cfg.Zeek.HealthCaptureLossPercent, cfg.Zeek.HealthReporterErrors)
+	}
+
+	// An explicit 0 is kept: it warns on any capture loss.
+	zero := 0.0
+	cfg = &Config{NetworkID: "Test-Network-01"}
+	cfg.Zeek.HealthCaptureLossPercent = &zero
+	if err := cfg.ValidateAndSetDefaults(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := cfg.HealthCaptureLossThreshold(); got != 0 {
+		t.Errorf("health_capture_loss_percent 0 became %v", got)
+	}
+
+	tooHigh := 101.0
+	for name, set := range map[string]func(*Config){
+		"health_capture_loss_percent": func(c *Config) { c.Zeek.HealthCaptureLossPercent = &tooHigh },
+		"health_reporter_errors":      func(c *Config) { c.Zeek.HealthReporterErrors = -1 },
+	} {
+		cfg = &Config{NetworkID: "Test-Network-01"}
+		set(cfg)
+		if err := cfg.ValidateAndSetDefaults(); err == nil || !strings.Contains(err.Error(), "zeek."+name) {
+			t.Errorf("Expected error for invalid zeek.%s, got: %v", name, err)
+		}
+	}
+}
+
+func TestConfig_ZeekScriptCheck(t *testing.T) {
+	cfg := &Config{NetworkID: "Test-Network-01"}
+	if err := cfg.ValidateAndSetDefaults(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Zeek.ScriptCheck != ScriptCheckDegrade {
+		t.Errorf("Expected script_check to default to %q, got %q", ScriptCheckDegrade, cfg.Zeek.ScriptCheck)
+	}
+	cfg = &Config{NetworkID: "Test-Network-01"}
+	cfg.Zeek.ScriptCheck = "lenient"
+	if err := cfg.ValidateAndSetDefaults(); err == nil || !strings.Contains(err.Error(), "zeek.script_check") {
+		t.Errorf("Expected error for invalid zeek.script_check, got: %v", err)
+	}
+}
+
+func TestConfig_Validation(t *testing.T) {
+	cfg := &Config{NetworkID: "Test-Network-01"}
+	if err := cfg.ValidateAndSetDefaults(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Validation.Enabled {
+		t.Error("Expected schema validation to default to off")
+	}
+	if want := filepath.Join("logs/buffer", "quarantine"); cfg.Validation.QuarantineDir != want {
+		t.Errorf("Expected quarantine_dir to default to %q, got %q", want, cfg.Validation.QuarantineDir)
+	}
+}
+
+func TestConfig_Summary(t *testing.T) {
+	cfg := &Config{NetworkID: "Test-Network-01"}
+	if err := cfg.ValidateAndSetDefaults(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Summary.Enabled || cfg.Summary.Upload != SummaryUploadAlongside || cfg.Summary.TopTalkers != 10 {
+		t.Errorf("Unexpected summary defaults: %v, %q, %d", cfg.Summary.Enabled, cfg.Summary.Upload, cfg.Summary.TopTalkers)
+	}
+
+	for name, set := range map[string]func(*Config){
+		"upload":      func(c *Config) { c.Summary.Upload = "only" },
+		"top_talkers": func(c *Config) { c.Summary.TopTalkers = 1001 },
+	} {
+		cfg = &Config{NetworkID: "Test-Network-01"}
+		set(cfg)
+		if err := cfg.ValidateAndSetDefaults(); err == nil || !strings.Contains(err.Error(), "summary."+name) {
+			t.Errorf("Expected error for invalid summary.%s, got: %v", name, err)
+		}
+	}
+}
+
+func TestConfig_EncryptedDNS(t *testing.T) {
+	cfg := &Config{NetworkID: "Test-Network-01"}
+	if err := cfg.ValidateAndSetDefaults(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.EncryptedDNS.Enabled || cfg.EncryptedDNS.ResolversPath != "" {
+		t.Errorf("Expected encrypted DNS detection to default to off with the embedded list, got %v, %q", cfg.EncryptedDNS.Enabled, cfg.EncryptedDNS.ResolversPath)
+	}
+}
@@ -429,6 +429,8 @@ func TestApplyEnvOverrides_AllFieldEnvVarNames(t *testing.T) {
 				switch elemKind {
 				case reflect.Int:
 					sentinel = "99999"
+				case reflect.Float64:
+					sentinel = "99.999"
 				default:
 					t.Fatalf("unsupported pointer element type %v for %s", elemKind, spec.description)
 				}
@@ -2,14 +2,13 @@ package api
 
 import (
 	"bufio"
-	"bytes"
 	"compress/zlib"
 	"context"
 	"crypto/x509"
 	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
@@ -21,6 +20,7 @@ import (
 	"google.golang.org/protobuf/proto"
 
 	pb "EnigmaNetz/Enigma-Go-Sensor/internal/api/publish"
+	"EnigmaNetz/Enigma-Go-Sensor/internal/logenc"
 	"EnigmaNetz/Enigma-Go-Sensor/internal/metadata"
 )
 
@@ -37,8 +37,9 @@ type LogUploader struct {
 	captureInterface string
 	retryCount       int
 	retryDelay       time.Duration
-	compressFunc     func([]byte) ([]byte, error) // for DI/testing
-	maxPayloadSizeMB int64                        // maximum payload size before chunking
+	compressFunc     func(io.Writer) (io.WriteCloser, error) // for DI/testing
+	maxPayloadSizeMB int64                                   // maximum payload size before chunking
+	memoryLimit      int64                                   // bytes a payload may take in memory; 0 = no limit
 	bufferDir        string
 	bufferMaxAge     time.Duration
 }
@@ -50,27 +51,69 @@ type LogFiles struct {
 	DHCPPath   string
 	JA3JA4Path string
 	JA4SPath   string
+	// AssetsPath is the optional log of asset inventory changes; it is
+	// only included in the payload when set.
+	AssetsPath string
+	// DeviceEventsPath is the optional log of new-device and device-change
+	// events; it is only included in the payload when set.
+	DeviceEventsPath string
+	// BeaconsPath is the optional log of beaconing connection pairs; it is
+	// only included in the payload when set.
+	BeaconsPath string
+	// DNSAnomaliesPath is the optional log of likely DNS tunneling and DGA
+	// activity; it is only included in the payload when set.
+	DNSAnomaliesPath string
+	// IntelPath is the optional log of threat-intel hits; it is only
+	// included in the payload when set.
+	IntelPath string
+	// EncryptedDNSPath is the optional log of DNS over TLS, HTTPS and QUIC
+	// connections; it is only included in the payload when set.
+	EncryptedDNSPath string
+	// SummaryPath is the optional per-window traffic summary; it is only
+	// included in the payload when set. When it is set ConnPath may be
+	// empty, for sensors uploading the summary instead of the full logs.
+	SummaryPath string
+	// Encoding is the output encoding of the files (logenc name, e.g. "tsv",
+	// "csv"). It is declared to the API as log_encoding. Empty = tsv.
+	Encoding string
+	// chunk marks the files of one chunk of a split upload, which may hold
+	// no piece of the conn log.
+	chunk bool
 }
 
-// CombinedLogs represents the compressed log data
-type CombinedLogs struct {
-	DNS    string `json:"dns"`    // base64 encoded compressed data
-	Conn   string `json:"conn"`   // base64 encoded compressed data
-	JA3JA4 string `json:"ja3ja4"` // base64 encoded compressed data
-	JA4S   string `json:"ja4s"`   // base64 encoded compressed data
-	DHCP   string `json:"dhcp"`   // base64 encoded compressed data
+// encodingMetadataKey is the upload metadata key declaring the payload's log
+// encoding.
+const encodingMetadataKey = "log_encoding"
+
+// encoding returns the declared encoding of files, defaulting to tsv.
+func (f LogFiles) encoding() string {
+	if f.Encoding == "" {
+		return logenc.TSV
+	}
+	return f.Encoding
 }
 
 // ErrAPIGone is returned when the API responds with HTTP 410 (Gone), indicating the sensor should stop.
 var ErrAPIGone = errors.New("API returned 410 Gone: sensor should stop sending data and terminate")
 
+// errPayloadTooLarge is returned by readPayload for a payload over the
+// memory limit.
+var errPayloadTooLarge = errors.New("payload exceeds the memory limit")
+
+// minChunkBytes is the smallest budget an oversized payload's logs are
+// split to before it is dropped.
+const minChunkBytes = 64 << 10
+
 // grpcClientImpl implements the grpcClient interface
 type grpcClientImpl struct {
 	client pb.PublishServiceClient
 }
 
-// NewLogUploader creates a new log uploader instance
-func NewLogUploader(serverAddr string, apiKey string, networkID string, captureInterface string, maxPayloadSizeMB int64, bufferDir string, bufferMaxAgeHours int, caCertFile string) (*LogUploader, error) {
+// NewLogUploader creates a new log uploader instance. memoryLimitMB is the
+// worker memory budget (capture.worker_memory_mb): the publish call is
+// unary, so each payload is held in memory while it is sent, and payloads
+// are chunked to fit it.
+func NewLogUploader(serverAddr string, apiKey string, networkID string, captureInterface string, maxPayloadSizeMB int64, memoryLimitMB int, bufferDir string, bufferMaxAgeHours int, caCertFile string) (*LogUploader, error) {
 	var opts []grpc.DialOption
 
 	host := serverAddr
@@ -110,6 +153,7 @@ func NewLogUploader(serverAddr string, apiKey string, networkID string, captureI
 		retryDelay:       5 * time.Second,
 		compressFunc:     compressData,
 		maxPayloadSizeMB: maxPayloadSizeMB,
+		memoryLimit:      int64(memoryLimitMB) << 20,
 		bufferDir:        bufferDir,
 		bufferMaxAge:     time.Duration(bufferMaxAgeHours) * time.Hour,
 	}, nil
@@ -147,32 +191,66 @@ func (u *LogUploader) UploadLogs(ctx context.Context, files LogFiles) error {
 		return fmt.Errorf("failed to calculate file size: %v", err)
 	}
 
-	if totalSizeMB > u.maxPayloadSizeMB {
-		return u.uploadLogsChunked(ctx, files)
+	if totalSizeMB > u.payloadLimitMB() {
+		// Calculate chunk size (90% of max to leave room for compression variance)
+		return u.uploadLogsChunked(ctx, files, (u.payloadLimitMB()*1024*1024*90)/100)
 	}
 
 	// Use existing upload path for smaller files
-	return u.uploadLogsSingle(ctx, files)
+	return u.uploadLogsSingle(ctx, files, 0)
 }
 
-// uploadLogsSingle uploads logs as a single payload (existing behavior)
-func (u *LogUploader) uploadLogsSingle(ctx context.Context, files LogFiles) error {
-	// Read and compress log files
-	combinedData, err := u.prepareLogData(files)
+// uploadLogsSingle uploads logs as a single payload (existing behavior).
+// chunkSizeBytes is the budget the logs were split to, or 0 if they were
+// not; a payload over the memory limit is split below it.
+func (u *LogUploader) uploadLogsSingle(ctx context.Context, files LogFiles, chunkSizeBytes int64) error {
+	// Read and compress log files into a payload file
+	payloadPath, err := u.prepareLogData(files)
 	if err != nil {
 		return fmt.Errorf("failed to prepare log data: %v", err)
 	}
+	defer os.Remove(payloadPath)
 
 	// Best-effort flush of any buffered payloads first
 	_ = u.flushBuffer(ctx)
 
+	// The publish call is unary, so the payload is read in once, at its
+	// exact size, for the upload attempts only.
+	// A payload over the memory limit is split into smaller chunks, halving
+	// the budget until they fit; one that cannot be split small enough is
+	// dropped, since no retry could read it either. Any other payload that
+	// cannot be read is buffered like one that cannot be sent: payloadPath
+	// is removed on return and holds the only copy.
+	combinedData, err := u.readPayload(payloadPath)
+	if errors.Is(err, errPayloadTooLarge) {
+		size, sizeErr := u.totalFileBytes(files)
+		if sizeErr != nil {
+			return fmt.Errorf("failed to calculate file size: %v", sizeErr)
+		}
+		next := size / 2
+		if chunkSizeBytes > 0 {
+			next = min(next, chunkSizeBytes/2)
+		}
+		if next < minChunkBytes {
+			return fmt.Errorf("failed to read payload: %w (logs cannot be split below the limit; payload dropped)", err)
+		}
+		log.Printf("[upload] Payload exceeds the %d byte memory limit; splitting logs into %d byte chunks", u.memoryLimit, next)
+		return u.uploadLogsChunked(ctx, files, next)
+	}
+	if err != nil {
+		if bufErr := u.bufferSave(payloadPath, files.encoding()); bufErr != nil {
+			return fmt.Errorf("failed to read payload and also failed to buffer it: %v; original error: %v", bufErr, err)
+		}
+		return fmt.Errorf("failed to read payload: %w (payload buffered for retry)", err)
+	}
+
 	// Upload with retries
 	var lastErr error
 	for i := 0; i < u.retryCount; i++ {
 		if ctx.Err() != nil {
 			return ctx.Err()
 		}
-		if err := u.upload(ctx, combinedData); err != nil {
+		if err := u.upload(ctx, combinedData, files.encoding()); err != nil {
 			lastErr = err
 			time.Sleep(u.retryDelay)
 			continue
@@ -181,43 +259,72 @@ func (u *LogUploader) uploadLogsSingle(ctx context.Context, files LogFiles) erro
 	}
 
 	// If we reach here, upload failed after retries. Buffer the payload for later.
-	if err := u.bufferSave(combinedData); err != nil {
+	if err := u.bufferSave(payloadPath, files.encoding()); err != nil {
 		return fmt.Errorf("failed to upload after %d retries and also failed to buffer payload: %v; original error: %v", u.retryCount, err, lastErr)
 	}
 	return fmt.Errorf("failed to upload after %d retries: %w (payload buffered for retry)", u.retryCount, lastErr)
 }
 
-// uploadLogsChunked splits files and uploads each chunk separately
-func (u *LogUploader) uploadLogsChunked(ctx context.Context, files LogFiles) error {
-	// Calculate chunk size (90% of max to leave room for compression variance)
-	chunkSizeBytes := (u.maxPayloadSizeMB * 1024 * 1024 * 90) / 100
+// uploadLogsChunked splits files and uploads each chunk separately, each
+// holding at most about chunkSizeBytes of logs
+func (u *LogUploader) uploadLogsChunked(ctx context.Context, files LogFiles, chunkSizeBytes int64) error {
+	split := splitterFor(files.encoding())
+
+	// The assets, device events, beacons, DNS anomalies, encrypted DNS,
+	// intel and summary logs are one row per changed device, beaconing
+	// pair, flagged domain or client, encrypted DNS connection, intel hit
+	// or summarized host or pair; they go whole with the first chunk, and
+	// the split logs share what they leave of the budget. When they would
+	// take more than half of it they are split like the others instead.
+	sideBytes, sideCount, err := logsSize(sideLogs(&files))
+	if err != nil {
+		return fmt.Errorf("failed to calculate file size: %v", err)
+	}
+	_, splitCount, err := logsSize(splitLogs(&files))
+	if err != nil {
+		return fmt.Errorf("failed to calculate file size: %v", err)
+	}
+	var sideChunks [][]string
+	var share int64
+	if sideBytes*2 <= chunkSizeBytes {
+		share = (chunkSizeBytes - sideBytes) / int64(max(splitCount, 1))
+	} else {
+		share = chunkSizeBytes / int64(splitCount+sideCount)
+		for _, path := range sideLogs(&files) {
+			chunks, err := split(*path, share)
+			if err != nil {
+				return fmt.Errorf("failed to split %s: %v", filepath.Base(*path), err)
+			}
+			sideChunks = append(sideChunks, chunks)
+		}
+	}
 
 	// Split DNS file if present
-	dnsChunks, err := splitCSVFile(files.DNSPath, chunkSizeBytes/5)
+	dnsChunks, err := split(files.DNSPath, share)
 	if err != nil {
 		return fmt.Errorf("failed to split DNS file: %v", err)
 	}
 
 	// Split connection file
-	connChunks, err := splitCSVFile(files.ConnPath, chunkSizeBytes/5)
+	connChunks, err := split(files.ConnPath, share)
 	if err != nil {
 		return fmt.Errorf("failed to split connection file: %v", err)
 	}
 
 	// Split JA3JA4 file if present
-	ja3ja4Chunks, err := splitCSVFile(files.JA3JA4Path, chunkSizeBytes/5)
+	ja3ja4Chunks, err := split(files.JA3JA4Path, share)
 	if err != nil {
 		return fmt.Errorf("failed to split JA3JA4 file: %v", err)
 	}
 
 	// Split JA4S file if present
-	ja4sChunks, err := splitCSVFile(files.JA4SPath, chunkSizeBytes/5)
+	ja4sChunks, err := split(files.JA4SPath, share)
 	if err != nil {
 		return fmt.Errorf("failed to split JA4S file: %v", err)
 	}
 
 	// Split DHCP file if present
-	dhcpChunks, err := splitCSVFile(files.DHCPPath, chunkSizeBytes/5)
+	dhcpChunks, err := split(files.DHCPPath, share)
 	if err != nil {
 		return fmt.Errorf("failed to split DHCP file: %v", err)
 	}
@@ -236,20 +343,48 @@ func (u *LogUploader) uploadLogsChunked(ctx context.Context, files LogFiles) err
 	if len(dhcpChunks) > maxChunks {
 		maxChunks = len(dhcpChunks)
 	}
+	for _, chunks := range sideChunks {
+		maxChunks = max(maxChunks, len(chunks))
+	}
+	// The whole-file logs go with the first chunk, which must be sent even
+	// when there is nothing to split, as in a summary-only upload. An empty
+	// first chunk is skipped below.
+	maxChunks = max(maxChunks, 1)
 
 	// Track temp files for cleanup
 	var tempFiles []string
 	defer func() {
 		for _, file := range tempFiles {
-			if file != files.DNSPath && file != files.ConnPath && file != files.JA3JA4Path && file != files.JA4SPath && file != files.DHCPPath {
-				os.Remove(file)
-			}
+			os.Remove(file)
 		}
 	}()
 
 	// Upload each chunk
 	for i := 0; i < maxChunks; i++ {
-		chunkFiles := LogFiles{}
+		chunkFiles := LogFiles{Encoding: files.Encoding, chunk: true}
+
+		// Side logs go whole with the first chunk, or a piece with each
+		if sideChunks == nil {
+			if i == 0 {
+				chunkFiles.AssetsPath = files.AssetsPath
+				chunkFiles.DeviceEventsPath = files.DeviceEventsPath
+				chunkFiles.BeaconsPath = files.BeaconsPath
+				chunkFiles.DNSAnomaliesPath = files.DNSAnomaliesPath
+				chunkFiles.IntelPath = files.IntelPath
+				chunkFiles.EncryptedDNSPath = files.EncryptedDNSPath
+				chunkFiles.SummaryPath = files.SummaryPath
+			}
+		} else {
+			originals := sideLogs(&files)
+			for j, path := range sideLogs(&chunkFiles) {
+				if i < len(sideChunks[j]) && sideChunks[j][i] != "" {
+					*path = sideChunks[j][i]
+					if sideChunks[j][i] != *originals[j] {
+						tempFiles = append(tempFiles, sideChunks[j][i])
+					}
+				}
+			}
+		}
 
 		// Set DNS chunk path (or empty if no more chunks)
 		if i < len(dnsChunks) && dnsChunks[i] != "" {
@@ -292,12 +427,12 @@ func (u *LogUploader) uploadLogsChunked(ctx context.Context, files LogFiles) err
 		}
 
 		// Skip empty chunks
-		if chunkFiles.DNSPath == "" && chunkFiles.ConnPath == "" && chunkFiles.JA3JA4Path == "" && chunkFiles.JA4SPath == "" && chunkFiles.DHCPPath == "" {
+		if chunkFiles.DNSPath == "" && chunkFiles.ConnPath == "" && chunkFiles.JA3JA4Path == "" && chunkFiles.JA4SPath == "" && chunkFiles.DHCPPath == "" && chunkFiles.AssetsPath == "" && chunkFiles.DeviceEventsPath == "" && chunkFiles.BeaconsPath == "" && chunkFiles.DNSAnomaliesPath == "" && chunkFiles.IntelPath == "" && chunkFiles.EncryptedDNSPath == "" && chunkFiles.SummaryPath == "" {
 			continue
 		}
 
 		// Upload this chunk
-		if err := u.uploadLogsSingle(ctx, chunkFiles); err != nil {
+		if err := u.uploadLogsSingle(ctx, chunkFiles, chunkSizeBytes); err != nil {
 			return fmt.Errorf("failed to upload chunk %d: %v", i+1, err)
 		}
 	}
@@ -305,107 +440,173 @@ func (u *LogUploader) uploadLogsChunked(ctx context.Context, files LogFiles) err
 	return nil
 }
 
-// prepareLogData reads, compresses, and combines the log files
-func (u *LogUploader) prepareLogData(files LogFiles) ([]byte, error) {
-	// Read DNS log (allow missing)
-	dnsData, err := os.ReadFile(files.DNSPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			dnsData = []byte{} // treat missing DNS log as empty
-		} else {
-			return nil, fmt.Errorf("failed to read DNS log: %v", err)
-		}
-	}
+// splitLogs returns the paths in f of the logs split across chunks.
+func splitLogs(f *LogFiles) []*string {
+	return []*string{&f.DNSPath, &f.ConnPath, &f.JA3JA4Path, &f.JA4SPath, &f.DHCPPath}
+}
 
-	// Read connection log (required)
-	connData, err := os.ReadFile(files.ConnPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read connection log: %v", err)
-	}
+// sideLogs returns the paths in f of the logs uploaded whole with the
+// first chunk while they fit.
+func sideLogs(f *LogFiles) []*string {
+	return []*string{&f.AssetsPath, &f.DeviceEventsPath, &f.BeaconsPath, &f.DNSAnomaliesPath, &f.IntelPath, &f.EncryptedDNSPath, &f.SummaryPath}
+}
 
-	// Read JA3JA4 log (allow missing)
-	ja3ja4Data, err := os.ReadFile(files.JA3JA4Path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			ja3ja4Data = []byte{} // treat missing JA3JA4 log as empty
-		} else {
-			return nil, fmt.Errorf("failed to read JA3JA4 log: %v", err)
+// logsSize returns the total size in bytes of the logs at paths and how
+// many of them exist.
+func logsSize(paths []*string) (int64, int, error) {
+	var size int64
+	var count int
+	for _, path := range paths {
+		if *path == "" {
+			continue
+		}
+		stat, err := os.Stat(*path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return 0, 0, fmt.Errorf("failed to stat %s: %v", filepath.Base(*path), err)
 		}
+		size += stat.Size()
+		count++
 	}
+	return size, count, nil
+}
 
-	// Read JA4S log (allow missing)
-	ja4sData, err := os.ReadFile(files.JA4SPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			ja4sData = []byte{} // treat missing JA4S log as empty
-		} else {
-			return nil, fmt.Errorf("failed to read JA4S log: %v", err)
-		}
+// uploadedLog is one member of the payload object: its JSON key, file, the name used
+// in errors, and whether the log must exist.
+type uploadedLog struct {
+	key, path, name string
+	required        bool
+}
+
+// uploadedLogs lists the payload members in order. The conn log
+// is required unless a summary is uploaded, possibly instead of it, or
+// the files are a chunk past the end of the conn log.
+func uploadedLogs(files LogFiles) []uploadedLog {
+	logs := []uploadedLog{
+		{"dns", files.DNSPath, "DNS", false},
+		{"conn", files.ConnPath, "connection", files.SummaryPath == "" && !files.chunk},
+		{"ja3ja4", files.JA3JA4Path, "JA3JA4", false},
+		{"ja4s", files.JA4SPath, "JA4S", false},
+		{"dhcp", files.DHCPPath, "DHCP", false},
+	}
+	if files.AssetsPath != "" {
+		logs = append(logs, uploadedLog{"assets", files.AssetsPath, "assets", false})
 	}
+	if files.DeviceEventsPath != "" {
+		logs = append(logs, uploadedLog{"device_events", files.DeviceEventsPath, "device events", false})
+	}
+	if files.BeaconsPath != "" {
+		logs = append(logs, uploadedLog{"beacons", files.BeaconsPath, "beacons", false})
+	}
+	if files.DNSAnomaliesPath != "" {
+		logs = append(logs, uploadedLog{"dns_anomalies", files.DNSAnomaliesPath, "DNS anomalies", false})
+	}
+	if files.IntelPath != "" {
+		logs = append(logs, uploadedLog{"intel", files.IntelPath, "intel", false})
+	}
+	if files.EncryptedDNSPath != "" {
+		logs = append(logs, uploadedLog{"encrypted_dns", files.EncryptedDNSPath, "encrypted DNS", false})
+	}
+	if files.SummaryPath != "" {
+		logs = append(logs, uploadedLog{"summary", files.SummaryPath, "summary", false})
+	}
+	return logs
+}
 
-	// Read DHCP log (allow missing)
-	dhcpData, err := os.ReadFile(files.DHCPPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			dhcpData = []byte{} // treat missing DHCP log as empty
-		} else {
-			return nil, fmt.Errorf("failed to read DHCP log: %v", err)
+// prepareLogData builds the upload payload in a temporary file and returns
+// its path; the caller removes it. The payload is a compressed JSON object
+// with a member per log of uploadedLogs, holding the log compressed and
+// base64 encoded.
+// It is streamed: every log is copied file -> compressor -> base64 -> outer
+// compressor -> file, so memory use is bounded by the compressors' buffers,
+// whatever the size of the logs or the payload.
+func (u *LogUploader) prepareLogData(files LogFiles) (string, error) {
+	logs := uploadedLogs(files)
+
+	// Open every log first so a missing required log fails before any work.
+	readers := make([]io.Reader, len(logs))
+	for i, l := range logs {
+		f, err := os.Open(l.path)
+		if err != nil {
+			if os.IsNotExist(err) && !l.required {
+				readers[i] = strings.NewReader("") // treat missing optional log as empty
+				continue
+			}
+			return "", fmt.Errorf("failed to read %s log: %v", l.name, err)
 		}
+		defer f.Close()
+		readers[i] = f
 	}
 
-	// Compress DNS data
-	dnsCompressed, err := u.compressFunc(dnsData)
+	payload, err := os.CreateTemp("", "payload_*.bin")
 	if err != nil {
-		return nil, fmt.Errorf("failed to compress DNS data: %v", err)
+		return "", fmt.Errorf("failed to create payload file: %v", err)
 	}
-
-	// Compress connection data
-	connCompressed, err := u.compressFunc(connData)
-	if err != nil {
-		return nil, fmt.Errorf("failed to compress connection data: %v", err)
+	if err := u.writeLogData(payload, logs, readers); err != nil {
+		payload.Close()
+		os.Remove(payload.Name())
+		return "", err
 	}
-
-	// Compress JA3JA4 data
-	ja3ja4Compressed, err := u.compressFunc(ja3ja4Data)
-	if err != nil {
-		return nil, fmt.Errorf("failed to compress JA3JA4 data: %v", err)
+	if err := payload.Close(); err != nil {
+		os.Remove(payload.Name())
+		return "", fmt.Errorf("failed to write payload file: %v", err)
 	}
+	return payload.Name(), nil
+}
 
-	// Compress JA4S data
-	ja4sCompressed, err := u.compressFunc(ja4sData)
+// writeLogData streams the compressed payload object for logs, read
+// from readers, to w.
+func (u *LogUploader) writeLogData(w io.Writer, logs []uploadedLog, readers []io.Reader) error {
+	outer, err := u.compressFunc(w)
 	if err != nil {
-		return nil, fmt.Errorf("failed to compress JA4S data: %v", err)
+		return fmt.Errorf("failed to compress combined data: %v", err)
 	}
-
-	// Compress DHCP data
-	dhcpCompressed, err := u.compressFunc(dhcpData)
-	if err != nil {
-		return nil, fmt.Errorf("failed to compress DHCP data: %v", err)
+	bw := bufio.NewWriter(outer)
+	bw.WriteByte('{')
+	for i, l := range logs {
+		if i > 0 {
+			bw.WriteByte(',')
+		}
+		bw.WriteString(`"` + l.key + `":"`)
+		if err := u.writeCompressedBase64(bw, readers[i]); err != nil {
+			return fmt.Errorf("failed to compress %s data: %v", l.name, err)
+		}
+		bw.WriteByte('"')
 	}
-
-	// Combine into JSON structure
-	combined := CombinedLogs{
-		DNS:    base64.StdEncoding.EncodeToString(dnsCompressed),
-		Conn:   base64.StdEncoding.EncodeToString(connCompressed),
-		JA3JA4: base64.StdEncoding.EncodeToString(ja3ja4Compressed),
-		JA4S:   base64.StdEncoding.EncodeToString(ja4sCompressed),
-		DHCP:   base64.StdEncoding.EncodeToString(dhcpCompressed),
+	bw.WriteByte('}')
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to compress combined data: %v", err)
 	}
+	if err := outer.Close(); err != nil {
+		return fmt.Errorf("failed to close compressor: %v", err)
+	}
+	return nil
+}
 
-	// Marshal to JSON
-	jsonData, err := json.Marshal(combined)
+// writeCompressedBase64 streams r through the compressor and a base64 encoder
+// into w.
+func (u *LogUploader) writeCompressedBase64(w io.Writer, r io.Reader) error {
+	b64 := base64.NewEncoder(base64.StdEncoding, w)
+	zw, err := u.compressFunc(b64)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal combined data: %v", err)
+		return err
 	}
-
-	// Compress the combined JSON
-	return u.compressFunc(jsonData)
+	if _, err := io.Copy(zw, r); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return b64.Close()
 }
 
-// upload sends the compressed data to the server
-func (u *LogUploader) upload(ctx context.Context, data []byte) error {
+// upload sends the compressed data to the server, declaring its log encoding
+func (u *LogUploader) upload(ctx context.Context, data []byte, encoding string) error {
 	// Generate metadata for the payload
 	metadataMap := metadata.GenerateMetadata(u.networkID, u.captureInterface)
+	metadataMap[encodingMetadataKey] = encoding
 	log.Printf("[upload] Sending metadata to API: %+v", metadataMap)
 
 	_, statusCode, message, err := u.client.uploadExcelMethod(ctx, data, u.apiKey, metadataMap)
@@ -424,8 +625,12 @@ func (u *LogUploader) upload(ctx context.Context, data []byte) error {
 	return nil
 }
 
-// bufferSave writes a compressed payload to disk for later retry
-func (u *LogUploader) bufferSave(data []byte) error {
+// bufferSave moves the payload file at payloadPath into the buffer directory
+// for later retry, copying it when the two are on different file systems.
+// Non-tsv payloads carry their encoding in the file name
+// (buf_<ts>_<nsec>.<enc>.bin) so a retry after a restart with a different
+// encoding still declares it correctly; plain .bin files are tsv.
+func (u *LogUploader) bufferSave(payloadPath string, encoding string) error {
 	if u.bufferDir == "" {
 		return nil
 	}
@@ -436,13 +641,38 @@ func (u *LogUploader) bufferSave(data []byte) error {
 	ts := time.Now().UTC().Format("20060102T150405Z")
 	// Include monotonic nsec to avoid collisions
 	fname := fmt.Sprintf("buf_%s_%d.bin", ts, time.Now().UTC().UnixNano())
+	if encoding != logenc.TSV {
+		fname = strings.TrimSuffix(fname, ".bin") + "." + encoding + ".bin"
+	}
 	path := filepath.Join(u.bufferDir, fname)
-	if err := os.WriteFile(path, data, 0o600); err != nil {
+	if err := os.Rename(payloadPath, path); err == nil {
+		return nil
+	}
+	if err := copyFile(path, payloadPath); err != nil {
+		os.Remove(path)
 		return fmt.Errorf("failed to write buffer file: %w", err)
 	}
 	return nil
 }
 
+// copyFile streams the file src to a new file dst.
+func copyFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
 // flushBuffer attempts to send buffered payloads oldest-first and purges old entries
 func (u *LogUploader) flushBuffer(ctx context.Context) error {
 	if u.bufferDir == "" {
@@ -479,6 +709,12 @@ func (u *LogUploader) flushBuffer(ctx context.Context) error {
 			_ = os.Remove(full)
 			continue
 		}
+		// A payload buffered under a larger memory limit waits for it, or
+		// for the retention to expire.
+		if u.memoryLimit > 0 && info.Size() > u.memoryLimit {
+			log.Printf("[upload] Warning: skipping buffered payload %s: %d bytes exceeds the %d byte memory limit", e.Name(), info.Size(), u.memoryLimit)
+			continue
+		}
 		// Try upload
 		data, readErr := os.ReadFile(full)
 		if readErr != nil {
@@ -486,7 +722,7 @@ func (u *LogUploader) flushBuffer(ctx context.Context) error {
 			_ = os.Remove(full)
 			continue
 		}
-		if err := u.upload(ctx, data); err != nil {
+		if err := u.upload(ctx, data, bufferedEncoding(e.Name())); err != nil {
 			// Stop on first failure (likely still down); keep file
 			return err
 		}
@@ -496,24 +732,66 @@ func (u *LogUploader) flushBuffer(ctx context.Context) error {
 	return nil
 }
 
-// compressData compresses byte data using zlib
-func compressData(data []byte) ([]byte, error) {
-	var buf bytes.Buffer
-	writer := zlib.NewWriter(&buf)
+// bufferedEncoding recovers the log encoding from a buffer file name written
+// by bufferSave.
+func bufferedEncoding(name string) string {
+	base := strings.TrimSuffix(name, ".bin")
+	if i := strings.LastIndexByte(base, '.'); i >= 0 {
+		return base[i+1:]
+	}
+	return logenc.TSV
+}
 
-	if _, err := writer.Write(data); err != nil {
-		return nil, fmt.Errorf("failed to write compressed data: %v", err)
+// payloadLimitMB returns the size of logs, in MB, above which an upload is
+// chunked: maxPayloadSizeMB, or less when the payload would not fit the
+// memory limit. Logs are sized before compression, and base64 grows what
+// does not compress by a third, so they may take three quarters of it.
+func (u *LogUploader) payloadLimitMB() int64 {
+	limit := u.maxPayloadSizeMB
+	if u.memoryLimit > 0 {
+		limit = min(limit, max(u.memoryLimit*3/4>>20, 1))
 	}
+	return limit
+}
 
-	if err := writer.Close(); err != nil {
-		return nil, fmt.Errorf("failed to close compressor: %v", err)
+// readPayload reads the payload file at path, failing rather than
+// exceeding the memory limit.
+func (u *LogUploader) readPayload(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
 	}
+	if u.memoryLimit > 0 && info.Size() > u.memoryLimit {
+		return nil, fmt.Errorf("%w (%d bytes, limit %d)", errPayloadTooLarge, info.Size(), u.memoryLimit)
+	}
+	data := make([]byte, info.Size())
+	if _, err := io.ReadFull(f, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
 
-	return buf.Bytes(), nil
+// compressData returns a zlib compressor writing to w.
+func compressData(w io.Writer) (io.WriteCloser, error) {
+	return zlib.NewWriter(w), nil
 }
 
 // calculateTotalFileSize calculates the total size of log files in MB
 func (u *LogUploader) calculateTotalFileSize(files LogFiles) (int64, error) {
+	totalSize, err := u.totalFileBytes(files)
+	if err != nil {
+		return 0, err
+	}
+	return totalSize / (1024 * 1024), nil
+}
+
+// totalFileBytes calculates the total size of log files in bytes
+func (u *LogUploader) totalFileBytes(files LogFiles) (int64, error) {
 	var totalSize int64
 
 	// Check DNS file size (optional)
@@ -525,11 +803,13 @@ func (u *LogUploader) calculateTotalFileSize(files LogFiles) (int64, error) {
 		}
 	}
 
-	// Check conn file size (required)
-	if stat, err := os.Stat(files.ConnPath); err != nil {
-		return 0, fmt.Errorf("failed to stat connection file: %v", err)
-	} else {
-		totalSize += stat.Size()
+	// Check conn file size (required unless a summary is uploaded)
+	if files.SummaryPath == "" || files.ConnPath != "" {
+		if stat, err := os.Stat(files.ConnPath); err == nil {
+			totalSize += stat.Size()
+		} else if files.SummaryPath == "" || !os.IsNotExist(err) {
+			return 0, fmt.Errorf("failed to stat connection file: %v", err)
+		}
 	}
 
 	// Check JA3JA4 file size (optional)
@@ -559,12 +839,260 @@ func (u *LogUploader) calculateTotalFileSize(files LogFiles) (int64, error) {
 		}
 	}
 
-	// Convert to MB
-	return totalSize / (1024 * 1024), nil
+	// Check assets file size (optional)
+	if files.AssetsPath != "" {
+		if stat, err := os.Stat(files.AssetsPath); err == nil {
+			totalSize += stat.Size()
+		} else if !os.IsNotExist(err) {
+			return 0, fmt.Errorf("failed to stat assets file: %v", err)
+		}
+	}
+
+	// Check device events file size (optional)
+	if files.DeviceEventsPath != "" {
+		if stat, err := os.Stat(files.DeviceEventsPath); err == nil {
+			totalSize += stat.Size()
+		} else if !os.IsNotExist(err) {
+			return 0, fmt.Errorf("failed to stat device events file: %v", err)
+		}
+	}
+
+	// Check beacons file size (optional)
+	if files.BeaconsPath != "" {
+		if stat, err := os.Stat(files.BeaconsPath); err == nil {
+			totalSize += stat.Size()
+		} else if !os.IsNotExist(err) {
+			return 0, fmt.Errorf("failed to stat beacons file: %v", err)
+		}
+	}
+
+	// Check DNS anomalies file size (optional)
+	if files.DNSAnomaliesPath != "" {
+		if stat, err := os.Stat(files.DNSAnomaliesPath); err == nil {
+			totalSize += stat.Size()
+		} else if !os.IsNotExist(err) {
+			return 0, fmt.Errorf("failed to stat DNS anomalies file: %v", err)
+		}
+	}
+
+	// Check intel file size (optional)
+	if files.IntelPath != "" {
+		if stat, err := os.Stat(files.IntelPath); err == nil {
+			totalSize += stat.Size()
+		} else if !os.IsNotExist(err) {
+			return 0, fmt.Errorf("failed to stat intel file: %v", err)
+		}
+	}
+
+	// Check encrypted DNS file size (optional)
+	if files.EncryptedDNSPath != "" {
+		if stat, err := os.Stat(files.EncryptedDNSPath); err == nil {
+			totalSize += stat.Size()
+		} else if !os.IsNotExist(err) {
+			return 0, fmt.Errorf("failed to stat encrypted DNS file: %v", err)
+		}
+	}
+
+	// Check summary file size (optional)
+	if files.SummaryPath != "" {
+		if stat, err := os.Stat(files.SummaryPath); err == nil {
+			totalSize += stat.Size()
+		} else if !os.IsNotExist(err) {
+			return 0, fmt.Errorf("failed to stat summary file: %v", err)
+		}
+	}
+
+	return totalSize, nil
+}
+
+// splitterFor returns the chunking function for an output encoding. Line
+// oriented encodings with a header line (tsv, csv) repeat the header in every
+// chunk, ndjson splits on record lines alone, and binary container formats
+// (xlsx, parquet) are rewritten as smaller files of the same format. Any
+// other encoding cannot be split and is uploaded whole.
+func splitterFor(encoding string) func(string, int64) ([]string, error) {
+	switch encoding {
+	case logenc.TSV:
+		// Zeek escapes newlines in values, so every line is a row.
+		return func(filePath string, maxSizeBytes int64) ([]string, error) {
+			return splitRecordsFile(filePath, maxSizeBytes, bufio.ScanLines)
+		}
+	case logenc.CSV:
+		return splitCSVFile
+	case logenc.NDJSON:
+		return splitLinesFile
+	}
+	if logenc.CanSplit(encoding) {
+		return func(filePath string, maxSizeBytes int64) ([]string, error) {
+			return splitEncodedFile(filePath, maxSizeBytes, encoding)
+		}
+	}
+	return func(filePath string, _ int64) ([]string, error) {
+		if filePath == "" {
+			return nil, nil
+		}
+		if _, err := os.Stat(filePath); err != nil {
+			if os.IsNotExist(err) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("failed to stat file %s: %v", filePath, err)
+		}
+		log.Printf("[upload] %s payloads cannot be chunked; uploading %s whole", encoding, filepath.Base(filePath))
+		return []string{filePath}, nil
+	}
+}
+
+// splitEncodedFile splits a binary encoded log (xlsx, parquet) larger than
+// maxSizeBytes into complete files of its encoding, each with a run of its
+// rows (see logenc.Split).
+func splitEncodedFile(filePath string, maxSizeBytes int64, encoding string) ([]string, error) {
+	if filePath == "" {
+		return nil, nil
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open file %s: %v", filePath, err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file %s: %v", filePath, err)
+	}
+	if info.Size() <= maxSizeBytes {
+		return []string{filePath}, nil
+	}
+
+	ext := filepath.Ext(filePath)
+	var chunks []string
+	var current *os.File
+	closeCurrent := func() error {
+		if current == nil {
+			return nil
+		}
+		err := current.Close()
+		current = nil
+		return err
+	}
+	err = logenc.Split(encoding, file, info.Size(), maxSizeBytes, func() (io.Writer, error) {
+		if err := closeCurrent(); err != nil {
+			return nil, err
+		}
+		chunkPath := fmt.Sprintf("%s_chunk_%d%s", strings.TrimSuffix(filePath, ext), len(chunks)+1, ext)
+		f, err := os.OpenFile(chunkPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create chunk file: %v", err)
+		}
+		current = f
+		chunks = append(chunks, chunkPath)
+		return f, nil
+	})
+	if closeErr := closeCurrent(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		for _, chunk := range chunks {
+			os.Remove(chunk)
+		}
+		return nil, fmt.Errorf("failed to split %s: %v", filePath, err)
+	}
+	return chunks, nil
+}
+
+// splitLinesFile splits a headerless line-oriented file (ndjson) into chunks
+// of roughly maxSizeBytes, never splitting a line.
+func splitLinesFile(filePath string, maxSizeBytes int64) ([]string, error) {
+	if filePath == "" {
+		return nil, nil
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open file %s: %v", filePath, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	var chunks []string
+	var current []string
+	var size int64
+	for scanner.Scan() {
+		line := scanner.Text()
+		if size > 0 && size+int64(len(line)+1) > maxSizeBytes {
+			chunkPath, err := writeLinesChunk(filePath, len(chunks)+1, current)
+			if err != nil {
+				return nil, err
+			}
+			chunks = append(chunks, chunkPath)
+			current, size = current[:0], 0
+		}
+		current = append(current, line)
+		size += int64(len(line) + 1)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading file %s: %v", filePath, err)
+	}
+	if len(chunks) == 0 {
+		return []string{filePath}, nil
+	}
+	if len(current) > 0 {
+		chunkPath, err := writeLinesChunk(filePath, len(chunks)+1, current)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunkPath)
+	}
+	return chunks, nil
+}
+
+// writeLinesChunk writes lines to a chunk file next to originalPath.
+func writeLinesChunk(originalPath string, chunkNum int, lines []string) (string, error) {
+	ext := filepath.Ext(originalPath)
+	chunkPath := fmt.Sprintf("%s_chunk_%d%s", strings.TrimSuffix(originalPath, ext), chunkNum, ext)
+	data := strings.Join(lines, "\n") + "\n"
+	if err := os.WriteFile(chunkPath, []byte(data), 0600); err != nil {
+		return "", fmt.Errorf("failed to create chunk file: %v", err)
+	}
+	return chunkPath, nil
 }
 
-// splitCSVFile splits a CSV file into chunks of specified size
+// splitCSVFile splits a CSV file into chunks of specified size. Quoted
+// values may hold newlines, so it splits on records rather than lines.
 func splitCSVFile(filePath string, maxSizeBytes int64) ([]string, error) {
+	return splitRecordsFile(filePath, maxSizeBytes, scanCSVRecords)
+}
+
+// scanCSVRecords is a bufio.SplitFunc returning each CSV record without its
+// terminating newline. A newline inside a quoted value does not end the
+// record; quotes within quoted values are doubled, so counting them is
+// enough to tell.
+func scanCSVRecords(data []byte, atEOF bool) (int, []byte, error) {
+	quoted := false
+	for i, b := range data {
+		switch b {
+		case '"':
+			quoted = !quoted
+		case '\n':
+			if !quoted {
+				return i + 1, data[:i], nil
+			}
+		}
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// splitRecordsFile splits a file of a header record followed by data
+// records, as split delimits them, into chunks of roughly maxSizeBytes that
+// each start with the header.
+func splitRecordsFile(filePath string, maxSizeBytes int64, split bufio.SplitFunc) ([]string, error) {
 	if filePath == "" {
 		return nil, nil // Skip empty files
 	}
@@ -579,6 +1107,8 @@ func splitCSVFile(filePath string, maxSizeBytes int64) ([]string, error) {
 	defer file.Close()
 
 	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	scanner.Split(split)
 
 	// Read header
 	if !scanner.Scan() {
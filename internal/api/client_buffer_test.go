@@ -88,3 +88,71 @@ func TestLogUploader_BufferPurgeOld(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, 0, len(entries))
 }
+
+// Test that a buffered payload keeps its log encoding and declares it on flush
+func TestLogUploader_BufferKeepsEncoding(t *testing.T) {
+	tmpDir := t.TempDir()
+	connPath := filepath.Join(tmpDir, "conn.ndjson")
+	require.NoError(t, os.WriteFile(connPath, []byte("{\"uid\":\"C1\"}\n"), 0600))
+
+	mock := &mockPublishClient{uploadResponses: []uploadResponse{
+		{status: "fail", statusCode: 500, message: "server error"},
+		{status: "success", statusCode: 200, message: "ok"},
+		{status: "success", statusCode: 200, message: "ok"},
+	}}
+	uploader := &LogUploader{
+		client:           mock,
+		apiKey:           "k",
+		networkID:        "Test-Network-01",
+		retryCount:       1,
+		retryDelay:       time.Millisecond,
+		compressFunc:     compressData,
+		maxPayloadSizeMB: 25,
+		bufferDir:        filepath.Join(tmpDir, "buffer"),
+		bufferMaxAge:     2 * time.Hour,
+	}
+
+	require.Error(t, uploader.UploadLogs(context.Background(), LogFiles{ConnPath: connPath, Encoding: "ndjson"}))
+	entries, err := os.ReadDir(uploader.bufferDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "ndjson", bufferedEncoding(entries[0].Name()))
+
+	// The flush (buffered ndjson) and the current tsv upload each declare
+	// their own encoding.
+	require.NoError(t, uploader.UploadLogs(context.Background(), LogFiles{ConnPath: connPath}))
+	require.Len(t, mock.metadata, 3)
+	require.Equal(t, "ndjson", mock.metadata[0]["log_encoding"])
+	require.Equal(t, "ndjson", mock.metadata[1]["log_encoding"])
+	require.Equal(t, "tsv", mock.metadata[2]["log_encoding"])
+	require.Equal(t, "tsv", bufferedEncoding("buf_20000101T000000Z_1.bin"))
+}
+
+// Test that a payload over the memory limit that cannot be split below it
+// is dropped, not buffered where no flush could ever read it
+func TestLogUploader_BufferOversizedPayload(t *testing.T) {
+	tmpDir := t.TempDir()
+	connPath := filepath.Join(tmpDir, "conn.log")
+	require.NoError(t, os.WriteFile(connPath, []byte("h\nb\n"), 0600))
+
+	mock := &mockPublishClient{}
+	uploader := &LogUploader{
+		client:           mock,
+		apiKey:           "k",
+		networkID:        "Test-Network-01",
+		retryCount:       1,
+		retryDelay:       time.Millisecond,
+		compressFunc:     compressData,
+		maxPayloadSizeMB: 25,
+		memoryLimit:      16,
+		bufferDir:        filepath.Join(tmpDir, "buffer"),
+		bufferMaxAge:     2 * time.Hour,
+	}
+
+	err := uploader.UploadLogs(context.Background(), LogFiles{ConnPath: connPath})
+	require.ErrorContains(t, err, "memory limit")
+	require.ErrorContains(t, err, "payload dropped")
+	_, err = os.Stat(uploader.bufferDir)
+	require.True(t, os.IsNotExist(err), "expected nothing to be buffered")
+	require.Equal(t, 0, mock.currentCall)
+}
@@ -10,6 +10,7 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/base64"
+	"encoding/csv"
 	"encoding/json"
 	"encoding/pem"
 	"errors"
@@ -18,10 +19,13 @@ import (
 	"math/big"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
 
+	"EnigmaNetz/Enigma-Go-Sensor/internal/logenc"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc/codes"
@@ -40,6 +44,17 @@ func decompressData(data []byte) ([]byte, error) {
 	return io.ReadAll(zlibReader)
 }
 
+// preparedPayload returns the payload prepareLogData builds for files,
+// removing its temporary file.
+func preparedPayload(u *LogUploader, files LogFiles) ([]byte, error) {
+	path, err := u.prepareLogData(files)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(path)
+	return os.ReadFile(path)
+}
+
 func base64DecodeAndDecompress(data string) ([]byte, error) {
 	decoded, err := base64.StdEncoding.DecodeString(data)
 	if err != nil {
@@ -52,6 +67,8 @@ func base64DecodeAndDecompress(data string) ([]byte, error) {
 type mockPublishClient struct {
 	uploadResponses []uploadResponse
 	currentCall     int
+	metadata        []map[string]string // metadata sent with each call
+	sizes           []int               // payload size of each call
 }
 
 type uploadResponse struct {
@@ -67,6 +84,8 @@ func (m *mockPublishClient) uploadExcelMethod(ctx context.Context, data []byte,
 	}
 	resp := m.uploadResponses[m.currentCall]
 	m.currentCall++
+	m.metadata = append(m.metadata, metadata)
+	m.sizes = append(m.sizes, len(data))
 	return resp.status, resp.statusCode, resp.message, resp.err
 }
 
@@ -113,7 +132,7 @@ func TestNewLogUploaderCACertFile(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			uploader, err := NewLogUploader("api.example.test:443", "test-key", "Test-Network-01", "any", 25, t.TempDir(), 24, tt.certFile(t))
+			uploader, err := NewLogUploader("api.example.test:443", "test-key", "Test-Network-01", "any", 25, 64, t.TempDir(), 24, tt.certFile(t))
 			if tt.wantErr {
 				require.Error(t, err)
 				assert.Contains(t, err.Error(), tt.errContain)
@@ -283,7 +302,7 @@ func TestLogUploader_PrepareLogData(t *testing.T) {
 	}
 
 	// Test data preparation
-	compressed, err := uploader.prepareLogData(LogFiles{
+	compressed, err := preparedPayload(uploader, LogFiles{
 		DNSPath:  dnsPath,
 		ConnPath: connPath,
 	})
@@ -293,18 +312,135 @@ func TestLogUploader_PrepareLogData(t *testing.T) {
 	decompressed, err := decompressData(compressed)
 	require.NoError(t, err)
 
-	var combined CombinedLogs
+	var combined map[string]string
 	require.NoError(t, json.Unmarshal(decompressed, &combined))
 
 	// Decode and decompress DNS data
-	dnsDecoded, err := base64DecodeAndDecompress(combined.DNS)
+	dnsDecoded, err := base64DecodeAndDecompress(combined["dns"])
 	require.NoError(t, err)
 	assert.Equal(t, dnsData, dnsDecoded)
 
 	// Decode and decompress conn data
-	connDecoded, err := base64DecodeAndDecompress(combined.Conn)
+	connDecoded, err := base64DecodeAndDecompress(combined["conn"])
 	require.NoError(t, err)
 	assert.Equal(t, connData, connDecoded)
+	assert.NotContains(t, string(decompressed), `"assets"`, "assets member is only sent when an assets log is given")
+}
+
+func TestLogUploader_PrepareLogDataWithDerivedLogs(t *testing.T) {
+	tmpDir := t.TempDir()
+	connPath := filepath.Join(tmpDir, "conn.log")
+	assetsPath := filepath.Join(tmpDir, "assets.log")
+	assetsData := []byte("test assets data")
+	require.NoError(t, os.WriteFile(connPath, []byte("test conn data"), 0644))
+	require.NoError(t, os.WriteFile(assetsPath, assetsData, 0644))
+
+	uploader := &LogUploader{compressFunc: compressData}
+	eventsPath := filepath.Join(tmpDir, "device_events.log")
+	eventsData := []byte("test device events data")
+	require.NoError(t, os.WriteFile(eventsPath, eventsData, 0644))
+	beaconsPath := filepath.Join(tmpDir, "beacons.log")
+	beaconsData := []byte("test beacons data")
+	require.NoError(t, os.WriteFile(beaconsPath, beaconsData, 0644))
+	anomaliesPath := filepath.Join(tmpDir, "dns_anomalies.log")
+	anomaliesData := []byte("test dns anomalies data")
+	require.NoError(t, os.WriteFile(anomaliesPath, anomaliesData, 0644))
+	intelPath := filepath.Join(tmpDir, "intel.log")
+	intelData := []byte("test intel data")
+	require.NoError(t, os.WriteFile(intelPath, intelData, 0644))
+	encryptedDNSPath := filepath.Join(tmpDir, "encrypted_dns.log")
+	encryptedDNSData := []byte("test encrypted dns data")
+	require.NoError(t, os.WriteFile(encryptedDNSPath, encryptedDNSData, 0644))
+	compressed, err := preparedPayload(uploader, LogFiles{ConnPath: connPath, AssetsPath: assetsPath, DeviceEventsPath: eventsPath, BeaconsPath: beaconsPath, DNSAnomaliesPath: anomaliesPath, IntelPath: intelPath, EncryptedDNSPath: encryptedDNSPath})
+	require.NoError(t, err)
+	decompressed, err := decompressData(compressed)
+	require.NoError(t, err)
+
+	var combined map[string]string
+	require.NoError(t, json.Unmarshal(decompressed, &combined))
+	assetsDecoded, err := base64DecodeAndDecompress(combined["assets"])
+	require.NoError(t, err)
+	assert.Equal(t, assetsData, assetsDecoded)
+	eventsDecoded, err := base64DecodeAndDecompress(combined["device_events"])
+	require.NoError(t, err)
+	assert.Equal(t, eventsData, eventsDecoded)
+	beaconsDecoded, err := base64DecodeAndDecompress(combined["beacons"])
+	require.NoError(t, err)
+	assert.Equal(t, beaconsData, beaconsDecoded)
+	anomaliesDecoded, err := base64DecodeAndDecompress(combined["dns_anomalies"])
+	require.NoError(t, err)
+	assert.Equal(t, anomaliesData, anomaliesDecoded)
+	intelDecoded, err := base64DecodeAndDecompress(combined["intel"])
+	require.NoError(t, err)
+	assert.Equal(t, intelData, intelDecoded)
+	encryptedDNSDecoded, err := base64DecodeAndDecompress(combined["encrypted_dns"])
+	require.NoError(t, err)
+	assert.Equal(t, encryptedDNSData, encryptedDNSDecoded)
+}
+
+func TestLogUploader_PrepareLogDataSummaryOnly(t *testing.T) {
+	tmpDir := t.TempDir()
+	summaryPath := filepath.Join(tmpDir, "summary.log")
+	summaryData := []byte("test summary data")
+	require.NoError(t, os.WriteFile(summaryPath, summaryData, 0644))
+
+	uploader := &LogUploader{compressFunc: compressData}
+	_, err := preparedPayload(uploader, LogFiles{})
+	require.Error(t, err, "conn log is required without a summary")
+
+	files := LogFiles{SummaryPath: summaryPath}
+	size, err := uploader.calculateTotalFileSize(files)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), size)
+	compressed, err := preparedPayload(uploader, files)
+	require.NoError(t, err)
+	decompressed, err := decompressData(compressed)
+	require.NoError(t, err)
+
+	var combined map[string]string
+	require.NoError(t, json.Unmarshal(decompressed, &combined))
+	summaryDecoded, err := base64DecodeAndDecompress(combined["summary"])
+	require.NoError(t, err)
+	assert.Equal(t, summaryData, summaryDecoded)
+	connDecoded, err := base64DecodeAndDecompress(combined["conn"])
+	require.NoError(t, err)
+	assert.Empty(t, connDecoded)
+}
+
+// TestLogUploader_PrepareLogDataMemory checks that building the payload
+// streams the logs to the payload file: what it allocates stays within a
+// fixed budget, far below the size of the logs and the payload.
+func TestLogUploader_PrepareLogDataMemory(t *testing.T) {
+	const (
+		logSize = 16 << 20
+		budget  = 8 << 20
+	)
+	tmpDir := t.TempDir()
+	connPath := filepath.Join(tmpDir, "conn.log")
+	dnsPath := filepath.Join(tmpDir, "dns.log")
+	for _, p := range []string{connPath, dnsPath} {
+		f, err := os.Create(p)
+		require.NoError(t, err)
+		// Random data does not compress, so the payload is as large as the logs.
+		_, err = io.CopyN(f, rand.Reader, logSize)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+
+	uploader := &LogUploader{compressFunc: compressData}
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	path, err := uploader.prepareLogData(LogFiles{ConnPath: connPath, DNSPath: dnsPath})
+	runtime.ReadMemStats(&after)
+	require.NoError(t, err)
+	defer os.Remove(path)
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Greater(t, fi.Size(), int64(2*logSize), "payload should hold both logs")
+	allocated := after.TotalAlloc - before.TotalAlloc
+	assert.Less(t, allocated, uint64(budget), "prepareLogData allocated %d bytes for a %d byte payload", allocated, fi.Size())
 }
 
 // TestUploadLogs_ReadFileError simulates a failure to read one of the log files and expects an error from UploadLogs.
@@ -345,7 +481,7 @@ func TestUploadLogs_CompressError(t *testing.T) {
 		networkID:    "Test-Network-01",
 		retryCount:   1,
 		retryDelay:   time.Millisecond,
-		compressFunc: func(_ []byte) ([]byte, error) { return nil, fmt.Errorf("compress error") },
+		compressFunc: func(io.Writer) (io.WriteCloser, error) { return nil, fmt.Errorf("compress error") },
 	}
 	// Create temp files with valid data
 	tmpDir := t.TempDir()
@@ -523,6 +659,108 @@ func TestSplitCSVFile(t *testing.T) {
 	}
 }
 
+// TestSplitCSVFileQuotedNewlines tests that CSV records whose quoted values
+// hold newlines are never split across chunks
+func TestSplitCSVFileQuotedNewlines(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "weird.csv")
+	var want [][]string
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	header := []string{"ts", "name", "addl"}
+	require.NoError(t, cw.Write(header))
+	for i := 0; i < 40; i++ {
+		rec := []string{fmt.Sprint(i), "bad_HTTP_request", fmt.Sprintf("line one\nline \"two\" of %d\nthree", i)}
+		require.NoError(t, cw.Write(rec))
+		want = append(want, rec)
+	}
+	cw.Flush()
+	require.NoError(t, os.WriteFile(testFile, buf.Bytes(), 0600))
+
+	chunks, err := splitCSVFile(testFile, 200)
+	require.NoError(t, err)
+	require.Greater(t, len(chunks), 1)
+	var got [][]string
+	for i, c := range chunks {
+		f, err := os.Open(c)
+		require.NoError(t, err)
+		records, err := csv.NewReader(f).ReadAll()
+		f.Close()
+		require.NoError(t, err, "chunk %d is not valid CSV", i)
+		require.Equal(t, header, records[0], "chunk %d header", i)
+		got = append(got, records[1:]...)
+	}
+	assert.Equal(t, want, got, "chunks must reassemble to the original records")
+}
+
+// TestSplitLinesFile tests that ndjson files are split on record lines with no
+// header repeated into each chunk
+func TestSplitLinesFile(t *testing.T) {
+	tempDir := t.TempDir()
+	testFile := filepath.Join(tempDir, "conn.ndjson")
+	var content string
+	for i := 0; i < 50; i++ {
+		content += fmt.Sprintf("{\"uid\":\"C%d\"}\n", i)
+	}
+	require.NoError(t, os.WriteFile(testFile, []byte(content), 0600))
+
+	chunks, err := splitLinesFile(testFile, 100)
+	require.NoError(t, err)
+	require.Greater(t, len(chunks), 1)
+
+	var joined string
+	for _, c := range chunks {
+		data, err := os.ReadFile(c)
+		require.NoError(t, err)
+		joined += string(data)
+	}
+	assert.Equal(t, content, joined, "chunks must reassemble to the original records")
+}
+
+// encodedRows feeds generated conn rows to a logenc encoder.
+type encodedRows struct{ n, i int }
+
+func (r *encodedRows) Next() ([]string, error) {
+	if r.i >= r.n {
+		return nil, io.EOF
+	}
+	r.i++
+	return []string{fmt.Sprintf("C%039d", r.i), fmt.Sprint(r.i % 65536)}, nil
+}
+
+// TestSplitEncodedFile tests that xlsx and parquet logs are rewritten as
+// smaller files of their encoding, and kept whole when they fit.
+func TestSplitEncodedFile(t *testing.T) {
+	header := logenc.Header{Path: "conn", Fields: []string{"uid", "id.resp_p"}, Types: []string{"string", "port"}}
+	for _, encoding := range []string{logenc.XLSX, logenc.PARQUET} {
+		t.Run(encoding, func(t *testing.T) {
+			enc, ok := logenc.Lookup(encoding)
+			require.True(t, ok)
+			enc = logenc.WithMemoryLimit(enc, 64<<10)
+			path := filepath.Join(t.TempDir(), "conn"+enc.Ext())
+			f, err := os.Create(path)
+			require.NoError(t, err)
+			require.NoError(t, enc.Encode(f, header, &encodedRows{n: 20000}))
+			require.NoError(t, f.Close())
+			info, err := os.Stat(path)
+			require.NoError(t, err)
+
+			whole, err := splitterFor(encoding)(path, info.Size())
+			require.NoError(t, err)
+			assert.Equal(t, []string{path}, whole)
+
+			chunks, err := splitterFor(encoding)(path, info.Size()/4)
+			require.NoError(t, err)
+			require.GreaterOrEqual(t, len(chunks), 4)
+			for _, chunk := range chunks {
+				assert.True(t, strings.HasSuffix(chunk, enc.Ext()), chunk)
+				chunkInfo, err := os.Stat(chunk)
+				require.NoError(t, err)
+				assert.Less(t, chunkInfo.Size(), info.Size()/2, chunk)
+			}
+		})
+	}
+}
+
 // TestUploadLogsChunking tests that large files trigger chunking behavior
 func TestUploadLogsChunking(t *testing.T) {
 	tempDir := t.TempDir()
@@ -573,6 +811,148 @@ func TestUploadLogsChunking(t *testing.T) {
 	assert.GreaterOrEqual(t, mockClient.currentCall, 2, "Expected multiple upload calls due to chunking")
 }
 
+// TestUploadLogsChunkingSummaryOnly tests that a summary-only upload too
+// large for one payload is still published, split across chunks that each
+// carry a piece of the summary.
+func TestUploadLogsChunkingSummaryOnly(t *testing.T) {
+	summaryPath := filepath.Join(t.TempDir(), "summary.log")
+	summaryData := []byte(strings.Repeat("1000.000000\thost\t192.168.1.10\t-\t1\t2\t3\t4\n", 80000))
+	require.NoError(t, os.WriteFile(summaryPath, summaryData, 0600))
+
+	var responses []uploadResponse
+	for i := 0; i < 20; i++ {
+		responses = append(responses, uploadResponse{"success", 200, "ok", nil})
+	}
+	mockClient := &mockPublishClient{uploadResponses: responses}
+	uploader := &LogUploader{
+		client:           mockClient,
+		apiKey:           "test-key",
+		networkID:        "Test-Network-01",
+		retryCount:       1,
+		retryDelay:       time.Millisecond,
+		compressFunc:     compressData,
+		maxPayloadSizeMB: 1,
+	}
+	size, err := uploader.calculateTotalFileSize(LogFiles{SummaryPath: summaryPath})
+	require.NoError(t, err)
+	require.Greater(t, size, uploader.maxPayloadSizeMB, "summary must be large enough to force chunking")
+
+	require.NoError(t, uploader.UploadLogs(context.Background(), LogFiles{SummaryPath: summaryPath}))
+	assert.Equal(t, int(size)+1, mockClient.currentCall, "expected the summary to be split into 90%% chunks")
+}
+
+// TestUploadLogsChunkingSideLogsBudget tests that the logs sent whole with
+// the first chunk count against the chunk budget, and are split when they
+// would take most of it.
+func TestUploadLogsChunkingSideLogsBudget(t *testing.T) {
+	dir := t.TempDir()
+	connPath := filepath.Join(dir, "conn.log")
+	assetsPath := filepath.Join(dir, "assets.log")
+	writeRandomLines(t, connPath, 3<<19)
+	writeRandomLines(t, assetsPath, 3<<20)
+
+	var responses []uploadResponse
+	for i := 0; i < 100; i++ {
+		responses = append(responses, uploadResponse{"success", 200, "ok", nil})
+	}
+	mockClient := &mockPublishClient{uploadResponses: responses}
+	uploader := &LogUploader{
+		client:           mockClient,
+		retryCount:       1,
+		retryDelay:       time.Millisecond,
+		compressFunc:     compressData,
+		maxPayloadSizeMB: 1,
+	}
+	require.NoError(t, uploader.UploadLogs(context.Background(), LogFiles{ConnPath: connPath, AssetsPath: assetsPath}))
+	require.Greater(t, mockClient.currentCall, 4, "expected the assets log to be split too")
+	// Base64 grows what does not compress by a third.
+	for i, size := range mockClient.sizes {
+		assert.LessOrEqual(t, size, 4<<20/3, "payload %d", i)
+	}
+}
+
+// writeRandomLines writes about size bytes of barely compressible lines,
+// base64 encoded random data, to path.
+func writeRandomLines(t *testing.T, path string, size int) {
+	t.Helper()
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	raw := make([]byte, 57)
+	for i := 0; i < size/77; i++ {
+		_, err := rand.Read(raw)
+		require.NoError(t, err)
+		_, err = f.WriteString(base64.StdEncoding.EncodeToString(raw) + "\n")
+		require.NoError(t, err)
+	}
+	require.NoError(t, f.Close())
+}
+
+// TestUploadLogsMemoryLimit tests that logs whose payload would not fit the
+// memory limit are chunked below it even when the payload size limit is
+// not reached, and that a payload file over the limit is not read.
+func TestUploadLogsMemoryLimit(t *testing.T) {
+	connPath := filepath.Join(t.TempDir(), "conn.log")
+	writeRandomLines(t, connPath, 3<<20)
+
+	var responses []uploadResponse
+	for i := 0; i < 100; i++ {
+		responses = append(responses, uploadResponse{"success", 200, "ok", nil})
+	}
+	mockClient := &mockPublishClient{uploadResponses: responses}
+	uploader := &LogUploader{
+		client:           mockClient,
+		retryCount:       1,
+		retryDelay:       time.Millisecond,
+		compressFunc:     compressData,
+		maxPayloadSizeMB: 25,
+		memoryLimit:      2 << 20,
+	}
+	require.NoError(t, uploader.UploadLogs(context.Background(), LogFiles{ConnPath: connPath}))
+	require.Greater(t, mockClient.currentCall, 1, "expected the upload to be chunked")
+	for i, size := range mockClient.sizes {
+		assert.LessOrEqual(t, size, int(uploader.memoryLimit), "payload %d", i)
+	}
+
+	_, err := uploader.readPayload(connPath)
+	assert.ErrorIs(t, err, errPayloadTooLarge)
+	uploader.memoryLimit = 0
+	data, err := uploader.readPayload(connPath)
+	require.NoError(t, err)
+	assert.Len(t, data, 3<<20/77*77)
+}
+
+// TestUploadLogsOversizedPayload tests that logs under the chunking
+// threshold whose payload is over the memory limit are split until every
+// payload fits, rather than buffered.
+func TestUploadLogsOversizedPayload(t *testing.T) {
+	dir := t.TempDir()
+	connPath := filepath.Join(dir, "conn.log")
+	writeRandomLines(t, connPath, 900<<10)
+
+	var responses []uploadResponse
+	for i := 0; i < 100; i++ {
+		responses = append(responses, uploadResponse{"success", 200, "ok", nil})
+	}
+	mockClient := &mockPublishClient{uploadResponses: responses}
+	uploader := &LogUploader{
+		client:           mockClient,
+		retryCount:       1,
+		retryDelay:       time.Millisecond,
+		compressFunc:     compressData,
+		maxPayloadSizeMB: 25,
+		memoryLimit:      512 << 10,
+		bufferDir:        filepath.Join(dir, "buffer"),
+	}
+	require.Equal(t, int64(1), uploader.payloadLimitMB(), "logs must be under the chunking threshold")
+	require.NoError(t, uploader.UploadLogs(context.Background(), LogFiles{ConnPath: connPath}))
+	require.Greater(t, mockClient.currentCall, 1, "expected the payload to be split")
+	for i, size := range mockClient.sizes {
+		assert.LessOrEqual(t, size, int(uploader.memoryLimit), "payload %d", i)
+	}
+	_, err := os.Stat(uploader.bufferDir)
+	assert.True(t, os.IsNotExist(err), "expected nothing to be buffered")
+}
+
 // TestUploadLogsSinglePath tests that small files use the single upload path
 func TestUploadLogsSinglePath(t *testing.T) {
 	tempDir := t.TempDir()
@@ -0,0 +1,172 @@
+package assets
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	types "EnigmaNetz/Enigma-Go-Sensor/internal/processor/common"
+)
+
+// Usage is the help text of the assets command.
+const Usage = `Usage: enigma-sensor assets [list]
+       enigma-sensor assets export [--format csv|json] [--output FILE]
+
+Lists the local asset inventory (requires assets.enabled in config.json), or
+exports it as CSV or JSON to FILE or standard output.
+`
+
+// Command runs the assets command with the arguments that follow "assets",
+// reading the inventory in dir and writing to stdout.
+func Command(args []string, dir string, stdout io.Writer) error {
+	sub := "list"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		sub, args = args[0], args[1:]
+	}
+	fs := flag.NewFlagSet("assets "+sub, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	format := fs.String("format", "csv", "export format: csv or json")
+	output := fs.String("output", "", "export file (default: standard output)")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			fmt.Fprint(stdout, Usage)
+			return nil
+		}
+		return fmt.Errorf("%v\n\n%s", err, Usage)
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q\n\n%s", fs.Arg(0), Usage)
+	}
+
+	var write func(io.Writer, []types.Asset) error
+	switch sub {
+	case "list":
+		// The table is for reading on the terminal; --format and --output
+		// belong to export.
+		var exportFlag string
+		fs.Visit(func(f *flag.Flag) { exportFlag = f.Name })
+		if exportFlag != "" {
+			return fmt.Errorf("--%s applies to assets export, not list\n\n%s", exportFlag, Usage)
+		}
+		write = WriteTable
+	case "export":
+		switch *format {
+		case "csv":
+			write = WriteCSV
+		case "json":
+			write = WriteJSON
+		default:
+			return fmt.Errorf("unknown export format %q (want csv or json)", *format)
+		}
+	case "help":
+		fmt.Fprint(stdout, Usage)
+		return nil
+	default:
+		return fmt.Errorf("unknown assets command %q\n\n%s", sub, Usage)
+	}
+
+	inv, err := Load(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("no asset inventory in %s; set assets.enabled in config.json and let the sensor run", dir)
+	}
+	if err != nil {
+		return err
+	}
+	defer inv.Close()
+
+	if *output == "" {
+		return write(stdout, inv.Assets())
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := write(f, inv.Assets()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Exported %d assets to %s\n", inv.Len(), *output)
+	return nil
+}
+
+// csvHeader is the header row of WriteCSV.
+var csvHeader = []string{"mac", "vendor", "ips", "hostnames", "dhcp_fingerprint", "dhcp_vendor_class", "first_seen", "last_seen"}
+
+// WriteCSV writes assets as CSV, one row per asset. Addresses and hostnames
+// are joined with ";", most recent first, and times are RFC 3339.
+func WriteCSV(w io.Writer, assets []types.Asset) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	for _, a := range assets {
+		cw.Write([]string{
+			a.MAC,
+			a.Vendor,
+			strings.Join(a.IPs, ";"),
+			strings.Join(a.Hostnames, ";"),
+			a.DHCPFingerprint,
+			a.DHCPVendorClass,
+			formatTime(a.FirstSeen),
+			formatTime(a.LastSeen),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes assets as an indented JSON array.
+func WriteJSON(w io.Writer, assets []types.Asset) error {
+	if assets == nil {
+		assets = []types.Asset{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(assets)
+}
+
+// WriteTable writes assets as an aligned table for the terminal, with the
+// current address and hostname of each.
+func WriteTable(w io.Writer, assets []types.Asset) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "MAC\tVENDOR\tIP\tHOSTNAME\tDHCP FINGERPRINT\tFIRST SEEN\tLAST SEEN")
+	for _, a := range assets {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			a.MAC, orDash(a.Vendor), orDash(first(a.IPs)), orDash(first(a.Hostnames)),
+			orDash(a.DHCPFingerprint), formatTime(a.FirstSeen), formatTime(a.LastSeen))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%d assets\n", len(assets))
+	return err
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func first(list []string) string {
+	if len(list) == 0 {
+		return ""
+	}
+	return list[0]
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,97 @@
+package assets
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	types "EnigmaNetz/Enigma-Go-Sensor/internal/processor/common"
+)
+
+func commandDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	inv, err := Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record(t, inv,
+		types.AssetObservation{Time: t0, MAC: "00:50:56:aa:bb:cc", IP: "192.168.1.10", Hostname: "vm", DHCPFingerprint: "1,3,6", Vendor: "VMware, Inc."},
+		types.AssetObservation{Time: t0.Add(time.Hour), MAC: "00:50:56:aa:bb:cc", IP: "192.168.1.11"},
+	)
+	inv.Close()
+	return dir
+}
+
+func TestCommand_List(t *testing.T) {
+	var out bytes.Buffer
+	if err := Command(nil, commandDir(t), &out); err != nil {
+		t.Fatalf("Command: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "MAC") || lines[2] != "1 assets" {
+		t.Fatalf("list output:\n%s", out.String())
+	}
+	for _, want := range []string{"00:50:56:aa:bb:cc", "VMware, Inc.", "192.168.1.11", "vm", "2026-03-01T13:00:00Z"} {
+		if !strings.Contains(lines[1], want) {
+			t.Errorf("row %q missing %q", lines[1], want)
+		}
+	}
+}
+
+func TestCommand_ExportCSV(t *testing.T) {
+	var out bytes.Buffer
+	if err := Command([]string{"export"}, commandDir(t), &out); err != nil {
+		t.Fatalf("Command: %v", err)
+	}
+	want := "mac,vendor,ips,hostnames,dhcp_fingerprint,dhcp_vendor_class,first_seen,last_seen\n" +
+		"00:50:56:aa:bb:cc,\"VMware, Inc.\",192.168.1.11;192.168.1.10,vm,\"1,3,6\",,2026-03-01T12:00:00Z,2026-03-01T13:00:00Z\n"
+	if out.String() != want {
+		t.Errorf("csv export:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestCommand_ExportJSONFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "assets.json")
+	var out bytes.Buffer
+	if err := Command([]string{"export", "--format", "json", "--output", path}, commandDir(t), &out); err != nil {
+		t.Fatalf("Command: %v", err)
+	}
+	if !strings.Contains(out.String(), "Exported 1 assets") {
+		t.Errorf("output = %q", out.String())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []types.Asset
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("export is not JSON: %v", err)
+	}
+	if len(got) != 1 || got[0].MAC != "00:50:56:aa:bb:cc" || len(got[0].IPs) != 2 {
+		t.Errorf("exported %+v", got)
+	}
+}
+
+func TestCommand_Errors(t *testing.T) {
+	dir := commandDir(t)
+	for name, args := range map[string][]string{
+		"unknown command": {"delete"},
+		"unknown format":  {"export", "--format", "xml"},
+		"unknown flag":    {"export", "--since", "1h"},
+		"extra argument":  {"list", "extra"},
+		"list to a file":  {"list", "--output", filepath.Join(t.TempDir(), "assets.csv")},
+		"list format":     {"list", "--format", "json"},
+	} {
+		if err := Command(args, dir, &bytes.Buffer{}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if err := Command(nil, t.TempDir(), &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "assets.enabled") {
+		t.Errorf("missing inventory error = %v", err)
+	}
+}
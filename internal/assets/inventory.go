@@ -0,0 +1,312 @@
+// Package assets keeps the sensor's local asset inventory: every device seen
+// on the local network, keyed by MAC address, with the IP addresses and
+// hostnames it has used, its DHCP fingerprint and vendor, and when it was
+// first and last seen. The inventory is built across capture windows from the
+// observations the processor takes from the DHCP, DNS and conn logs (see
+// types.UpdateAssetInventory), persisted in an embedded key-value store under
+// the buffering directory, and listed or exported by the
+// `enigma-sensor assets` command.
+package assets
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	types "EnigmaNetz/Enigma-Go-Sensor/internal/processor/common"
+)
+
+// FileName is the inventory's journal file in its directory.
+const FileName = "assets.db"
+
+// Limits on the history kept per asset, most recent first.
+const (
+	maxIPs       = 8
+	maxHostnames = 8
+)
+
+// Dir returns the inventory directory under the sensor's buffering directory.
+func Dir(bufferDir string) string {
+	return filepath.Join(bufferDir, "assets")
+}
+
+// Inventory is the persistent asset inventory. It is safe for concurrent use
+// by the processing workers.
+type Inventory struct {
+	mu        sync.Mutex
+	store     *store
+	assets    map[string]*types.Asset
+	byIP      map[string]string // address -> MAC of the asset last seen holding it
+	retention time.Duration
+	now       func() time.Time
+}
+
+// Open opens (creating if needed) the inventory in dir for recording. Assets
+// not seen for retention are dropped as new observations are recorded;
+// retention 0 keeps them forever.
+func Open(dir string, retention time.Duration) (*Inventory, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("asset inventory: %w", err)
+	}
+	return open(dir, retention, false)
+}
+
+// Load reads the inventory in dir without opening it for recording, so it
+// can be listed while the sensor is running.
+func Load(dir string) (*Inventory, error) {
+	return open(dir, 0, true)
+}
+
+func open(dir string, retention time.Duration, readOnly bool) (*Inventory, error) {
+	s, err := openStore(filepath.Join(dir, FileName), readOnly)
+	if err != nil {
+		return nil, fmt.Errorf("asset inventory: %w", err)
+	}
+	inv := &Inventory{
+		store:     s,
+		assets:    make(map[string]*types.Asset, len(s.data)),
+		byIP:      make(map[string]string),
+		retention: retention,
+		now:       time.Now,
+	}
+	for mac, raw := range s.data {
+		var a types.Asset
+		if err := json.Unmarshal(raw, &a); err != nil {
+			s.close()
+			return nil, fmt.Errorf("asset inventory: record %s: %w", mac, err)
+		}
+		inv.assets[mac] = &a
+	}
+	// Attribute each address to the asset that was seen holding it last.
+	for _, a := range inv.sorted() {
+		for _, ip := range a.IPs {
+			if owner, ok := inv.assets[inv.byIP[ip]]; !ok || a.LastSeen.After(owner.LastSeen) {
+				inv.byIP[ip] = a.MAC
+			}
+		}
+	}
+	return inv, nil
+}
+
+// Close closes the inventory.
+func (inv *Inventory) Close() error {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	return inv.store.close()
+}
+
+// Len returns the number of assets in the inventory.
+func (inv *Inventory) Len() int {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	return len(inv.assets)
+}
+
+// Assets returns a copy of every asset, ordered by MAC address.
+func (inv *Inventory) Assets() []types.Asset {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	out := make([]types.Asset, 0, len(inv.assets))
+	for _, a := range inv.sorted() {
+		out = append(out, clone(a))
+	}
+	return out
+}
+
+// RecordAssets implements types.AssetRecorder. Observations with a MAC
+// address create or update that asset and bind the address to it;
+// observations of an address alone update the asset last seen holding it and
+// are dropped when there is none.
+//
+// A MAC address the inventory has never recorded raises a
+// types.DeviceNew event, and a DHCP fingerprint, DHCP hostname or DHCP
+// vendor class that differs from the one last recorded for its MAC address
+// raises the matching change event. The vendor looked up from the MAC
+// address is updated without an event, since it only changes with the OUI
+// table. An observation older than the asset's LastSeen, from a window
+// processed late, never replaces its DHCP identity: it would raise a change
+// event, and the next window another one changing it back. The first observations
+// recorded in a new inventory are its baseline: the devices already on the
+// network are not new, so they raise no events.
+func (inv *Inventory) RecordAssets(obs []types.AssetObservation) ([]types.Asset, []types.DeviceEvent, error) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	now := inv.now().UTC()
+	baseline := inv.store.records == 0
+	touched := make(map[string]bool)
+	changed := make(map[string]bool)
+	var events []types.DeviceEvent
+	for _, o := range obs {
+		ts := o.Time
+		if ts.IsZero() {
+			ts = now
+		}
+		mac := o.MAC
+		if mac == "" {
+			mac = inv.byIP[o.IP]
+		}
+		a := inv.assets[mac]
+		var kinds []string
+		var olds, news []string
+		isNew := false
+		if a == nil {
+			if o.MAC == "" {
+				continue
+			}
+			a = &types.Asset{MAC: mac, FirstSeen: ts, LastSeen: ts}
+			inv.assets[mac] = a
+			changed[mac] = true
+			isNew = true
+		}
+		// An older window's DHCP identity is not the device's current one.
+		current := !ts.Before(a.LastSeen)
+		change := func(kind, from, to string) {
+			if from != "" && !isNew {
+				kinds, olds, news = append(kinds, kind), append(olds, from), append(news, to)
+			}
+		}
+		if o.MAC != "" && o.IP != "" {
+			inv.byIP[o.IP] = mac
+			if pushFront(&a.IPs, o.IP, maxIPs) {
+				changed[mac] = true
+			}
+		}
+		if o.Hostname != "" && pushFront(&a.Hostnames, o.Hostname, maxHostnames) {
+			changed[mac] = true
+		}
+		if current && o.Source == types.AssetSourceDHCP && o.Hostname != "" && o.Hostname != a.DHCPHostname {
+			change(types.DeviceHostnameChanged, a.DHCPHostname, o.Hostname)
+			a.DHCPHostname = o.Hostname
+		}
+		if current && o.DHCPFingerprint != "" && o.DHCPFingerprint != a.DHCPFingerprint {
+			change(types.DeviceFingerprintChanged, a.DHCPFingerprint, o.DHCPFingerprint)
+			a.DHCPFingerprint = o.DHCPFingerprint
+			changed[mac] = true
+		}
+		if current && o.DHCPVendorClass != "" && o.DHCPVendorClass != a.DHCPVendorClass {
+			change(types.DeviceVendorChanged, a.DHCPVendorClass, o.DHCPVendorClass)
+			a.DHCPVendorClass = o.DHCPVendorClass
+			changed[mac] = true
+		}
+		if o.Vendor != "" && o.Vendor != a.Vendor {
+			a.Vendor = o.Vendor
+			changed[mac] = true
+		}
+		if ts.Before(a.FirstSeen) {
+			a.FirstSeen = ts
+		}
+		if ts.After(a.LastSeen) {
+			a.LastSeen = ts
+		}
+		touched[mac] = true
+
+		if baseline {
+			continue
+		}
+		if isNew {
+			events = append(events, deviceEvent(a, ts, types.DeviceNew, "", ""))
+		}
+		for i, kind := range kinds {
+			events = append(events, deviceEvent(a, ts, kind, olds[i], news[i]))
+		}
+	}
+
+	var expired []string
+	if inv.retention > 0 {
+		cutoff := now.Add(-inv.retention)
+		for mac, a := range inv.assets {
+			if a.LastSeen.Before(cutoff) {
+				expired = append(expired, mac)
+			}
+		}
+		sort.Strings(expired)
+		for _, mac := range expired {
+			for _, ip := range inv.assets[mac].IPs {
+				if inv.byIP[ip] == mac {
+					delete(inv.byIP, ip)
+				}
+			}
+			delete(inv.assets, mac)
+			delete(touched, mac)
+			delete(changed, mac)
+		}
+	}
+
+	puts := make(map[string]json.RawMessage, len(touched))
+	for mac := range touched {
+		b, err := json.Marshal(inv.assets[mac])
+		if err != nil {
+			return nil, nil, err
+		}
+		puts[mac] = b
+	}
+	if err := inv.store.write(puts, expired); err != nil {
+		return nil, nil, fmt.Errorf("asset inventory: %w", err)
+	}
+
+	out := make([]types.Asset, 0, len(changed))
+	for mac := range changed {
+		out = append(out, clone(inv.assets[mac]))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].MAC < out[j].MAC })
+	return out, events, nil
+}
+
+// deviceEvent describes a change to a, as it is after the change.
+func deviceEvent(a *types.Asset, ts time.Time, kind, from, to string) types.DeviceEvent {
+	return types.DeviceEvent{
+		Time:            ts,
+		Kind:            kind,
+		MAC:             a.MAC,
+		IP:              first(a.IPs),
+		Hostname:        first(a.Hostnames),
+		Vendor:          a.Vendor,
+		DHCPFingerprint: a.DHCPFingerprint,
+		Old:             from,
+		New:             to,
+	}
+}
+
+// sorted returns the assets ordered by MAC address. inv.mu must be held.
+func (inv *Inventory) sorted() []*types.Asset {
+	out := make([]*types.Asset, 0, len(inv.assets))
+	for _, a := range inv.assets {
+		out = append(out, a)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].MAC < out[j].MAC })
+	return out
+}
+
+// pushFront moves v to the front of the most-recent-first list, capped at
+// max entries, and reports whether v is new to the list. A device going back
+// to an address or name it used before is not a change worth reporting.
+func pushFront(list *[]string, v string, max int) bool {
+	l := *list
+	if len(l) > 0 && l[0] == v {
+		return false
+	}
+	added := true
+	out := make([]string, 0, len(l)+1)
+	out = append(out, v)
+	for _, x := range l {
+		if x == v {
+			added = false
+		} else if len(out) < max {
+			out = append(out, x)
+		}
+	}
+	*list = out
+	return added
+}
+
+func clone(a *types.Asset) types.Asset {
+	c := *a
+	c.IPs = append([]string(nil), a.IPs...)
+	c.Hostnames = append([]string(nil), a.Hostnames...)
+	return c
+}
@@ -0,0 +1,251 @@
+package assets
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	types "EnigmaNetz/Enigma-Go-Sensor/internal/processor/common"
+)
+
+var t0 = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func openInventory(t *testing.T, dir string) *Inventory {
+	t.Helper()
+	inv, err := Open(dir, 0)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { inv.Close() })
+	return inv
+}
+
+func record(t *testing.T, inv *Inventory, obs ...types.AssetObservation) []types.Asset {
+	t.Helper()
+	changed, _, err := inv.RecordAssets(obs)
+	if err != nil {
+		t.Fatalf("RecordAssets: %v", err)
+	}
+	return changed
+}
+
+func TestRecordAssets(t *testing.T) {
+	inv := openInventory(t, t.TempDir())
+
+	changed := record(t, inv,
+		types.AssetObservation{Time: t0, MAC: "00:50:56:aa:bb:cc", IP: "192.168.1.10", Hostname: "vm", DHCPFingerprint: "1,3,6", Vendor: "VMware, Inc."},
+		types.AssetObservation{Time: t0.Add(time.Minute), IP: "192.168.1.10", Hostname: "vm.corp.example"},
+		types.AssetObservation{Time: t0.Add(2 * time.Minute), IP: "192.168.1.99"}, // no known device
+	)
+	want := types.Asset{
+		MAC:             "00:50:56:aa:bb:cc",
+		Vendor:          "VMware, Inc.",
+		IPs:             []string{"192.168.1.10"},
+		Hostnames:       []string{"vm.corp.example", "vm"},
+		DHCPFingerprint: "1,3,6",
+		FirstSeen:       t0,
+		LastSeen:        t0.Add(time.Minute),
+	}
+	if len(changed) != 1 || !reflect.DeepEqual(changed[0], want) {
+		t.Fatalf("changed = %+v, want [%+v]", changed, want)
+	}
+
+	// Seen again at the same address: updated but not reported.
+	if changed := record(t, inv, types.AssetObservation{Time: t0.Add(time.Hour), IP: "192.168.1.10"}); len(changed) != 0 {
+		t.Errorf("activity alone reported as a change: %+v", changed)
+	}
+	if got := inv.Assets()[0].LastSeen; !got.Equal(t0.Add(time.Hour)) {
+		t.Errorf("LastSeen = %v", got)
+	}
+
+	// A new lease is a change, and the address moves to the front. Going back
+	// to the old address is not.
+	if changed := record(t, inv, types.AssetObservation{Time: t0.Add(2 * time.Hour), MAC: "00:50:56:aa:bb:cc", IP: "192.168.1.11"}); len(changed) != 1 {
+		t.Errorf("new address not reported: %+v", changed)
+	}
+	if changed := record(t, inv, types.AssetObservation{Time: t0.Add(3 * time.Hour), MAC: "00:50:56:aa:bb:cc", IP: "192.168.1.10"}); len(changed) != 0 {
+		t.Errorf("previous address reported as new: %+v", changed)
+	}
+	if got := inv.Assets()[0].IPs; !reflect.DeepEqual(got, []string{"192.168.1.10", "192.168.1.11"}) {
+		t.Errorf("IPs = %v", got)
+	}
+
+	// An address handed to another device is attributed to it from then on.
+	record(t, inv, types.AssetObservation{Time: t0.Add(4 * time.Hour), MAC: "b8:27:eb:01:02:03", IP: "192.168.1.10"})
+	record(t, inv, types.AssetObservation{Time: t0.Add(5 * time.Hour), IP: "192.168.1.10", Hostname: "pi"})
+	for _, a := range inv.Assets() {
+		if (a.MAC == "b8:27:eb:01:02:03") != (a.Hostnames[0] == "pi") {
+			t.Errorf("hostname attributed to the wrong asset: %+v", a)
+		}
+	}
+}
+
+func TestRecordAssets_DeviceEvents(t *testing.T) {
+	inv := openInventory(t, t.TempDir())
+	events := func(obs ...types.AssetObservation) []string {
+		t.Helper()
+		_, evs, err := inv.RecordAssets(obs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, e := range evs {
+			out = append(out, e.Kind+" "+e.MAC+" "+e.Old+">"+e.New)
+		}
+		return out
+	}
+	dhcp := func(ts time.Time, mac, ip, host, fp, class, vendor string) types.AssetObservation {
+		return types.AssetObservation{Time: ts, Source: types.AssetSourceDHCP, MAC: mac, IP: ip, Hostname: host, DHCPFingerprint: fp, DHCPVendorClass: class, Vendor: vendor}
+	}
+
+	// The devices in the first window are the baseline.
+	if got := events(dhcp(t0, "00:50:56:aa:bb:cc", "192.168.1.10", "vm", "1,3,6", "MSFT 5.0", "VMware, Inc.")); got != nil {
+		t.Errorf("baseline raised events: %v", got)
+	}
+
+	got := events(
+		dhcp(t0.Add(time.Hour), "b8:27:eb:01:02:03", "192.168.1.20", "pi", "1,3,6,15", "dhcpcd-9.4.1", "Raspberry Pi Foundation"),
+		dhcp(t0.Add(time.Hour), "00:50:56:aa:bb:cc", "192.168.1.10", "laptop", "1,121,3,6", "MSFT 5.0", "VMware, Inc."),
+		// DNS names and seeing the device again are not changes.
+		types.AssetObservation{Time: t0.Add(2 * time.Hour), Source: types.AssetSourceDNS, IP: "192.168.1.10", Hostname: "vm.corp.example"},
+		dhcp(t0.Add(2*time.Hour), "b8:27:eb:01:02:03", "192.168.1.20", "pi", "1,3,6,15", "", ""),
+	)
+	want := []string{
+		"hostname_changed 00:50:56:aa:bb:cc vm>laptop",
+		"fingerprint_changed 00:50:56:aa:bb:cc 1,3,6>1,121,3,6",
+		"new_device b8:27:eb:01:02:03 >",
+	}
+	sort.Strings(got)
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+
+	// State survives a restart: a known device is not new again. A vendor
+	// class it did not announce before is a change; its vendor, renamed in
+	// a newer OUI table, is updated without an event.
+	inv.Close()
+	inv = openInventory(t, filepath.Dir(inv.store.path))
+	if got := events(dhcp(t0.Add(3*time.Hour), "b8:27:eb:01:02:03", "192.168.1.20", "pi", "1,3,6,15", "android-dhcp-13", "Raspberry Pi Trading Ltd")); len(got) != 1 || got[0] != "vendor_changed b8:27:eb:01:02:03 dhcpcd-9.4.1>android-dhcp-13" {
+		t.Errorf("events after restart = %v", got)
+	}
+	if a := inv.assets["b8:27:eb:01:02:03"]; a == nil || a.Vendor != "Raspberry Pi Trading Ltd" {
+		t.Errorf("asset after vendor rename = %+v", a)
+	}
+
+	// A window processed late does not roll the DHCP identity back.
+	if got := events(dhcp(t0.Add(30*time.Minute), "b8:27:eb:01:02:03", "192.168.1.20", "old-pi", "1,3", "dhcpcd-8", "")); got != nil {
+		t.Errorf("older observation raised events: %v", got)
+	}
+	if a := inv.assets["b8:27:eb:01:02:03"]; a.DHCPHostname != "pi" || a.DHCPFingerprint != "1,3,6,15" || a.DHCPVendorClass != "android-dhcp-13" {
+		t.Errorf("older observation replaced the DHCP identity: %+v", a)
+	}
+}
+
+func TestRecordAssets_Retention(t *testing.T) {
+	inv, err := Open(t.TempDir(), 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inv.Close()
+	inv.now = func() time.Time { return t0.Add(48 * time.Hour) }
+
+	record(t, inv,
+		types.AssetObservation{Time: t0, MAC: "00:50:56:aa:bb:cc", IP: "192.168.1.10"},
+		types.AssetObservation{Time: t0.Add(47 * time.Hour), MAC: "b8:27:eb:01:02:03", IP: "192.168.1.20"},
+	)
+	if got := inv.Assets(); len(got) != 1 || got[0].MAC != "b8:27:eb:01:02:03" {
+		t.Errorf("assets after retention = %+v", got)
+	}
+}
+
+func TestInventory_Persists(t *testing.T) {
+	dir := t.TempDir()
+	inv, err := Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record(t, inv, types.AssetObservation{Time: t0, MAC: "00:50:56:aa:bb:cc", IP: "192.168.1.10", Hostname: "vm"})
+	if err := inv.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A write cut short leaves a torn last line, which is ignored.
+	f, err := os.OpenFile(filepath.Join(dir, FileName), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"k":"b8:27:eb:01:02:03","v":{"mac":`)
+	f.Close()
+
+	loaded, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := loaded.Assets(); len(got) != 1 || got[0].Hostnames[0] != "vm" {
+		t.Errorf("loaded assets = %+v", got)
+	}
+
+	// Reopening for recording cuts the torn line off and keeps the address
+	// bindings.
+	inv = openInventory(t, dir)
+	record(t, inv, types.AssetObservation{Time: t0.Add(time.Hour), IP: "192.168.1.10", Hostname: "vm2"})
+	inv.Close()
+	loaded, err = Load(dir)
+	if err != nil {
+		t.Fatalf("Load after torn write: %v", err)
+	}
+	if got := loaded.Assets(); len(got) != 1 || got[0].Hostnames[0] != "vm2" {
+		t.Errorf("assets after reopen = %+v", got)
+	}
+}
+
+func TestLoad_Missing(t *testing.T) {
+	if _, err := Load(t.TempDir()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Load of a missing inventory = %v, want a not-exist error", err)
+	}
+}
+
+func TestLoad_Corrupt(t *testing.T) {
+	dir := t.TempDir()
+	content := `{"k":"a","v":{"mac":"a"}}` + "\nnot json\n" + `{"k":"b","v":{"mac":"b"}}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(dir); err == nil {
+		t.Error("expected an error for a corrupt record before the end of the journal")
+	}
+}
+
+func TestStore_Compacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	s, err := openStore(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < compactMinRecords; i++ {
+		if err := s.write(map[string]json.RawMessage{"k": []byte(`{"n":1}`)}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.records != 1 {
+		t.Errorf("records after compaction = %d, want 1", s.records)
+	}
+	if err := s.write(map[string]json.RawMessage{"k2": []byte(`{"n":2}`)}, []string{"k"}); err != nil {
+		t.Fatal(err)
+	}
+	s.close()
+
+	reopened, err := openStore(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reopened.data) != 1 || string(reopened.data["k2"]) != `{"n":2}` {
+		t.Errorf("data after compaction and reopen = %v", reopened.data)
+	}
+}
@@ -0,0 +1,220 @@
+package assets
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// store is the embedded key-value store behind the inventory: an append-only
+// journal of JSON records, one per line, replayed into memory when it is
+// opened. Every write appends and syncs its records, so a crash loses at most
+// the batch being written; a torn last line is ignored on replay and cut off
+// when the store is next opened for writing. Once most records in the
+// journal are superseded it is compacted by rewriting the live records to a
+// new file and renaming it into place.
+type store struct {
+	path    string
+	f       *os.File // journal opened for appending; nil when read-only
+	data    map[string]json.RawMessage
+	records int // records in the journal, live or superseded
+}
+
+// journalRecord is one line of the journal: a key set to a value, or a key
+// deleted.
+type journalRecord struct {
+	Key     string          `json:"k"`
+	Value   json.RawMessage `json:"v,omitempty"`
+	Deleted bool            `json:"d,omitempty"`
+}
+
+// compactMinRecords is the journal length below which it is never compacted.
+const compactMinRecords = 1024
+
+// openStore replays the journal at path, creating it unless readOnly. A
+// read-only store of a missing journal fails with an os.ErrNotExist error.
+func openStore(path string, readOnly bool) (*store, error) {
+	s := &store{path: path, data: make(map[string]json.RawMessage)}
+	flag := os.O_RDWR | os.O_CREATE
+	if readOnly {
+		flag = os.O_RDONLY
+	}
+	f, err := os.OpenFile(path, flag, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	valid, err := s.replay(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if readOnly {
+		f.Close()
+		return s, nil
+	}
+	// Drop a torn last record so new records start on a line of their own.
+	if err := f.Truncate(valid); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(valid, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	s.f = f
+	return s, nil
+}
+
+// replay loads the records of the journal in r and returns the length of its
+// valid prefix. Only the last line may be incomplete or unreadable (a write
+// cut short); anything else is corruption.
+func (s *store) replay(r io.Reader) (int64, error) {
+	br := bufio.NewReader(r)
+	var valid int64
+	for line := 1; ; line++ {
+		b, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if len(b) == 0 {
+			return valid, nil
+		}
+		var rec journalRecord
+		complete := b[len(b)-1] == '\n'
+		if jerr := json.Unmarshal(bytes.TrimSpace(b), &rec); jerr != nil || rec.Key == "" {
+			if !complete {
+				return valid, nil
+			}
+			if _, perr := br.Peek(1); perr == io.EOF {
+				return valid, nil
+			}
+			return 0, fmt.Errorf("corrupt record at line %d", line)
+		}
+		if !complete {
+			return valid, nil
+		}
+		s.apply(rec)
+		valid += int64(len(b))
+	}
+}
+
+func (s *store) apply(rec journalRecord) {
+	s.records++
+	if rec.Deleted {
+		delete(s.data, rec.Key)
+		return
+	}
+	s.data[rec.Key] = rec.Value
+}
+
+// write appends puts and deletes to the journal as one batch and syncs it.
+func (s *store) write(puts map[string]json.RawMessage, deletes []string) error {
+	if s.f == nil {
+		return errors.New("store is read-only")
+	}
+	recs := make([]journalRecord, 0, len(puts)+len(deletes))
+	for _, k := range sortedKeys(puts) {
+		recs = append(recs, journalRecord{Key: k, Value: puts[k]})
+	}
+	for _, k := range deletes {
+		recs = append(recs, journalRecord{Key: k, Deleted: true})
+	}
+	if len(recs) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	for _, rec := range recs {
+		b, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+	if _, err := s.f.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if err := s.f.Sync(); err != nil {
+		return err
+	}
+	for _, rec := range recs {
+		s.apply(rec)
+	}
+	if s.records >= compactMinRecords && s.records > 2*len(s.data) {
+		return s.compact()
+	}
+	return nil
+}
+
+// compact rewrites the journal with only the live records.
+func (s *store) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("compact: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	for _, k := range sortedKeys(s.data) {
+		b, err := json.Marshal(journalRecord{Key: k, Value: s.data[k]})
+		if err != nil {
+			tmp.Close()
+			return fmt.Errorf("compact: %w", err)
+		}
+		w.Write(b)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("compact: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("compact: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("compact: %w", err)
+	}
+	// The journal is closed before the rename, which Windows requires.
+	if err := s.f.Close(); err != nil {
+		return fmt.Errorf("compact: %w", err)
+	}
+	s.f = nil
+	renameErr := os.Rename(tmp.Name(), s.path)
+	// Reopen whichever journal is now in place, so a failed rename leaves
+	// the store writable on the uncompacted one.
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("compact: %w", err)
+	}
+	s.f = f
+	if renameErr != nil {
+		return fmt.Errorf("compact: %w", renameErr)
+	}
+	s.records = len(s.data)
+	return nil
+}
+
+// close closes the journal.
+func (s *store) close() error {
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
+
+func sortedKeys(m map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
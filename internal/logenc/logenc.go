@@ -0,0 +1,210 @@
+// Package logenc converts Zeek TSV logs into the output encodings the sensor
+// can upload (zeek.output_encoding). Encoders are pluggable: each registers
+// itself under a name and file extension, and the processor looks the
+// configured one up after filtering.
+//
+// TSV is the default and is special: it is Zeek's native format, so the
+// processor leaves the .log files untouched rather than re-encoding them. This
+// keeps the payload byte-for-byte identical to what the backend has always
+// received.
+//
+// Like the rules package, logenc has no dependencies on the rest of the sensor
+// so configuration loading can validate encoding names.
+package logenc
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Encoding names accepted by zeek.output_encoding.
+const (
+	TSV     = "tsv"
+	CSV     = "csv"
+	NDJSON  = "ndjson"
+	XLSX    = "xlsx"
+	PARQUET = "parquet"
+)
+
+// Header describes the schema of a Zeek log, taken from its "#" preamble.
+type Header struct {
+	Path   string   // log stream name (#path), e.g. "conn"
+	Fields []string // #fields column names
+	Types  []string // #types column types, aligned with Fields (may be nil)
+	SetSep string   // #set_separator for set/vector columns
+}
+
+// RowReader yields a log's data rows one at a time, already split into
+// columns. Next returns io.EOF after the last row.
+type RowReader interface {
+	Next() ([]string, error)
+}
+
+// Encoder writes a Zeek log in one output encoding.
+type Encoder interface {
+	// Name is the zeek.output_encoding value selecting this encoder.
+	Name() string
+	// Ext is the file extension (with leading dot) for encoded files.
+	Ext() string
+	// Encode writes the header and every row from rows to w.
+	Encode(w io.Writer, h Header, rows RowReader) error
+}
+
+var registry = map[string]Encoder{}
+
+// Register makes an encoder available under its Name. It is intended to be
+// called from init functions; registering a name twice replaces the encoder.
+func Register(e Encoder) {
+	registry[e.Name()] = e
+}
+
+// Lookup returns the encoder registered under name. TSV has no encoder (logs
+// are passed through as-is), so Lookup(TSV) reports false.
+func Lookup(name string) (Encoder, bool) {
+	e, ok := registry[name]
+	return e, ok
+}
+
+// memoryLimited is implemented by encoders that buffer rows before writing
+// them (Parquet row groups) and can bound that buffer.
+type memoryLimited interface {
+	withMemoryLimit(bytes int64) Encoder
+}
+
+// WithMemoryLimit returns e configured to buffer at most about limit bytes of
+// row data. Streaming encoders are returned unchanged.
+func WithMemoryLimit(e Encoder, limit int64) Encoder {
+	if m, ok := e.(memoryLimited); ok && limit > 0 {
+		return m.withMemoryLimit(limit)
+	}
+	return e
+}
+
+// Valid reports whether name is a supported output encoding.
+func Valid(name string) bool {
+	if name == TSV {
+		return true
+	}
+	_, ok := registry[name]
+	return ok
+}
+
+// Names returns every supported encoding name, sorted.
+func Names() []string {
+	names := []string{TSV}
+	for n := range registry {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Ext returns the file extension for an encoding; TSV keeps Zeek's ".log".
+func Ext(name string) string {
+	if e, ok := registry[name]; ok {
+		return e.Ext()
+	}
+	return ".log"
+}
+
+// kind is how a column's values are represented in typed encodings.
+type kind int
+
+const (
+	kindString kind = iota
+	kindInt
+	kindFloat
+	kindBool
+)
+
+// columnType splits a Zeek type into its element kind and whether it is a
+// container (set[...] or vector[...]).
+func columnType(zeekType string) (k kind, container bool) {
+	t := zeekType
+	if open := strings.IndexByte(t, '['); open >= 0 && strings.HasSuffix(t, "]") {
+		container = true
+		t = t[open+1 : len(t)-1]
+	}
+	switch t {
+	case "count", "int", "port":
+		return kindInt, container
+	case "double", "time", "interval":
+		return kindFloat, container
+	case "bool":
+		return kindBool, container
+	}
+	return kindString, container
+}
+
+// typeAt returns the Zeek type of column i, or "" when #types is missing.
+func (h Header) typeAt(i int) string {
+	if i < len(h.Types) {
+		return h.Types[i]
+	}
+	return ""
+}
+
+// Zeek's markers for unset and empty-container values.
+const (
+	unsetValue = "-"
+	emptyValue = "(empty)"
+)
+
+// isUnset reports whether a raw cell is absent (unset or an empty container).
+func isUnset(cell string) bool {
+	return cell == unsetValue || cell == emptyValue || cell == ""
+}
+
+// elements splits a raw set/vector cell into unescaped elements.
+func elements(cell, setSep string) []string {
+	if isUnset(cell) {
+		return nil
+	}
+	parts := strings.Split(cell, setSep)
+	for i, p := range parts {
+		parts[i] = Unescape(p)
+	}
+	return parts
+}
+
+// Unescape decodes the escapes Zeek's ASCII writer applies to field values:
+// "\xHH" for separators and non-printable bytes, and "\\" for a backslash.
+func Unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			if s[i+1] == '\\' {
+				b.WriteByte('\\')
+				i++
+				continue
+			}
+			if s[i+1] == 'x' && i+3 < len(s) {
+				if v, err := strconv.ParseUint(s[i+2:i+4], 16, 8); err == nil {
+					b.WriteByte(byte(v))
+					i += 3
+					continue
+				}
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// text renders a raw cell as plain text: unset values become "", containers
+// are unescaped element-wise and re-joined with setSep.
+func text(cell, setSep string, container bool) string {
+	if isUnset(cell) {
+		return ""
+	}
+	if container {
+		return strings.Join(elements(cell, setSep), setSep)
+	}
+	return Unescape(cell)
+}
@@ -0,0 +1,278 @@
+package logenc
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+type sliceRows struct {
+	rows [][]string
+	i    int
+}
+
+func (r *sliceRows) Next() ([]string, error) {
+	if r.i >= len(r.rows) {
+		return nil, io.EOF
+	}
+	r.i++
+	return r.rows[r.i-1], nil
+}
+
+var testHeader = Header{
+	Path:   "conn",
+	Fields: []string{"uid", "id.resp_p", "duration", "local_orig", "service", "tunnel_parents"},
+	Types:  []string{"string", "port", "interval", "bool", "string", "set[string]"},
+	SetSep: ",",
+}
+
+func testRows() RowReader {
+	return &sliceRows{rows: [][]string{
+		{"C1", "443", "1.500000", "T", "ssl", "A,B"},
+		{"C2", "53", "-", "F", `a\x09b`, "(empty)"},
+	}}
+}
+
+func encode(t *testing.T, name string) []byte {
+	t.Helper()
+	enc, ok := Lookup(name)
+	if !ok {
+		t.Fatalf("encoder %q not registered", name)
+	}
+	var buf bytes.Buffer
+	if err := enc.Encode(&buf, testHeader, testRows()); err != nil {
+		t.Fatalf("Encode(%s): %v", name, err)
+	}
+	return buf.Bytes()
+}
+
+func TestRegistry(t *testing.T) {
+	for _, n := range []string{TSV, CSV, NDJSON, XLSX, PARQUET} {
+		if !Valid(n) {
+			t.Errorf("Valid(%q) = false", n)
+		}
+	}
+	if Valid("yaml") {
+		t.Error("Valid(yaml) = true")
+	}
+	if _, ok := Lookup(TSV); ok {
+		t.Error("tsv is a passthrough and has no encoder")
+	}
+	if Ext(TSV) != ".log" || Ext(CSV) != ".csv" || Ext(XLSX) != ".xlsx" {
+		t.Errorf("unexpected extensions: %s %s %s", Ext(TSV), Ext(CSV), Ext(XLSX))
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	tests := map[string]string{
+		"plain":         "plain",
+		`a\x09b`:        "a\tb",
+		`back\\slash`:   `back\slash`,
+		`bad\xZZescape`: `bad\xZZescape`,
+	}
+	for in, want := range tests {
+		if got := Unescape(in); got != want {
+			t.Errorf("Unescape(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCSV(t *testing.T) {
+	got := string(encode(t, CSV))
+	want := "uid,id.resp_p,duration,local_orig,service,tunnel_parents\n" +
+		"C1,443,1.500000,T,ssl,\"A,B\"\n" +
+		"C2,53,,F,a\tb,\n"
+	if got != want {
+		t.Errorf("csv =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	lines := strings.Split(strings.TrimSpace(string(encode(t, NDJSON))), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+	var first, second map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("line 1: %v", err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatalf("line 2: %v", err)
+	}
+	if first["id.resp_p"] != 443.0 || first["duration"] != 1.5 || first["local_orig"] != true {
+		t.Errorf("typed values wrong: %v", first)
+	}
+	if parents, ok := first["tunnel_parents"].([]interface{}); !ok || len(parents) != 2 || parents[1] != "B" {
+		t.Errorf("tunnel_parents = %v", first["tunnel_parents"])
+	}
+	if _, ok := second["duration"]; ok {
+		t.Error("unset field should be omitted")
+	}
+	if second["service"] != "a\tb" {
+		t.Errorf("service = %q, want unescaped tab", second["service"])
+	}
+	if parents, ok := second["tunnel_parents"].([]interface{}); !ok || len(parents) != 0 {
+		t.Errorf("empty set = %v, want []", second["tunnel_parents"])
+	}
+}
+
+func TestXLSX(t *testing.T) {
+	data := encode(t, XLSX)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("not a zip archive: %v", err)
+	}
+	parts := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		parts[f.Name] = string(b)
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("missing part %s", name)
+		}
+	}
+	if !strings.Contains(parts["xl/workbook.xml"], `name="conn"`) {
+		t.Errorf("sheet not named after the log: %s", parts["xl/workbook.xml"])
+	}
+
+	var sheet struct {
+		Rows []struct {
+			Cells []struct {
+				Ref    string `xml:"r,attr"`
+				Type   string `xml:"t,attr"`
+				Value  string `xml:"v"`
+				Inline string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.Unmarshal([]byte(parts["xl/worksheets/sheet1.xml"]), &sheet); err != nil {
+		t.Fatalf("sheet XML: %v", err)
+	}
+	if len(sheet.Rows) != 3 {
+		t.Fatalf("got %d rows, want header + 2", len(sheet.Rows))
+	}
+	if c := sheet.Rows[0].Cells[1]; c.Ref != "B1" || c.Inline != "id.resp_p" {
+		t.Errorf("header cell = %+v", c)
+	}
+	if c := sheet.Rows[1].Cells[1]; c.Type != "" || c.Value != "443" {
+		t.Errorf("port should be numeric: %+v", c)
+	}
+	if c := sheet.Rows[1].Cells[5]; c.Inline != "A,B" {
+		t.Errorf("set cell = %+v", c)
+	}
+	// Unset duration is skipped, so row 3's third cell is local_orig in column D.
+	if c := sheet.Rows[2].Cells[2]; c.Ref != "D3" || c.Inline != "F" {
+		t.Errorf("row 3 cell = %+v", c)
+	}
+}
+
+func TestXLSX_Split(t *testing.T) {
+	rows := make([][]string, 500)
+	for i := range rows {
+		rows[i] = []string{fmt.Sprintf("C%d", i), strconv.Itoa(i), "1.5", "T", `a"b<c>`, "A,B"}
+	}
+	var buf bytes.Buffer
+	if err := (xlsxEncoder{}).Encode(&buf, testHeader, &sliceRows{rows: rows}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	var parts []*bytes.Buffer
+	err := Split(XLSX, bytes.NewReader(data), int64(len(data)), int64(len(data))/3, func() (io.Writer, error) {
+		parts = append(parts, new(bytes.Buffer))
+		return parts[len(parts)-1], nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) < 3 {
+		t.Fatalf("got %d parts, want at least 3", len(parts))
+	}
+	type cell struct {
+		Ref    string `xml:"r,attr"`
+		Value  string `xml:"v"`
+		Inline string `xml:"is>t"`
+	}
+	next := 0
+	for i, part := range parts {
+		zr, err := zip.NewReader(bytes.NewReader(part.Bytes()), int64(part.Len()))
+		if err != nil {
+			t.Fatalf("part %d: %v", i, err)
+		}
+		var sheet struct {
+			Rows []struct {
+				Ref   string `xml:"r,attr"`
+				Cells []cell `xml:"c"`
+			} `xml:"sheetData>row"`
+		}
+		for _, f := range zr.File {
+			if f.Name != "xl/worksheets/sheet1.xml" {
+				continue
+			}
+			rc, _ := f.Open()
+			err := xml.NewDecoder(rc).Decode(&sheet)
+			rc.Close()
+			if err != nil {
+				t.Fatalf("part %d sheet: %v", i, err)
+			}
+		}
+		if len(sheet.Rows) < 2 || sheet.Rows[0].Cells[0].Inline != "uid" {
+			t.Fatalf("part %d has no header or no rows: %+v", i, sheet.Rows)
+		}
+		for r, row := range sheet.Rows[1:] {
+			ref := strconv.Itoa(r + 2)
+			if row.Ref != ref || row.Cells[1].Ref != "B"+ref {
+				t.Fatalf("part %d row %d numbered %s/%s", i, r, row.Ref, row.Cells[1].Ref)
+			}
+			if row.Cells[0].Inline != rows[next][0] || row.Cells[1].Value != rows[next][1] || row.Cells[4].Inline != `a"b<c>` {
+				t.Fatalf("part %d row %d = %+v, want %v", i, r, row.Cells, rows[next])
+			}
+			next++
+		}
+	}
+	if next != len(rows) {
+		t.Errorf("parts hold %d rows, want %d", next, len(rows))
+	}
+	if CanSplit(CSV) || !CanSplit(XLSX) || !CanSplit(PARQUET) {
+		t.Error("only the binary encodings split")
+	}
+}
+
+func TestTruncateRunes(t *testing.T) {
+	long := strings.Repeat("é", xlsxMaxCellChars+10)
+	got := truncateRunes(long, xlsxMaxCellChars)
+	if !utf8.ValidString(got) || utf8.RuneCountInString(got) != xlsxMaxCellChars {
+		t.Errorf("truncated to %d bytes, %d runes, valid %v", len(got), utf8.RuneCountInString(got), utf8.ValidString(got))
+	}
+	// Under the limit in characters, over it in bytes: kept whole.
+	short := strings.Repeat("é", xlsxMaxCellChars)
+	if got := truncateRunes(short, xlsxMaxCellChars); got != short {
+		t.Errorf("%d-character string truncated to %d bytes", xlsxMaxCellChars, len(got))
+	}
+	for s, want := range map[string]string{"": "", "abc": "abc", "abcdef": "abcd", "aé€x": "aé€x", "aé€xy": "aé€x"} {
+		if got := truncateRunes(s, 4); got != want {
+			t.Errorf("truncateRunes(%q, 4) = %q, want %q", s, got, want)
+		}
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"} {
+		if got := columnName(i); got != want {
+			t.Errorf("columnName(%d) = %q, want %q", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package logenc
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+func init() { Register(ndjsonEncoder{}) }
+
+// ndjsonEncoder writes one JSON object per row, following Zeek's own JSON
+// writer: keys are the flat field names ("id.orig_h"), unset fields are
+// omitted, numbers and booleans are typed, and set/vector columns are arrays
+// (empty containers are []).
+type ndjsonEncoder struct{}
+
+func (ndjsonEncoder) Name() string { return NDJSON }
+func (ndjsonEncoder) Ext() string  { return ".ndjson" }
+
+func (ndjsonEncoder) Encode(w io.Writer, h Header, rows RowReader) error {
+	bw := bufio.NewWriter(w)
+	kinds := make([]kind, len(h.Fields))
+	containers := make([]bool, len(h.Fields))
+	keys := make([][]byte, len(h.Fields))
+	for i, f := range h.Fields {
+		kinds[i], containers[i] = columnType(h.typeAt(i))
+		keys[i], _ = json.Marshal(f)
+	}
+	var line []byte
+	for {
+		cols, err := rows.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		line = append(line[:0], '{')
+		first := true
+		for i := range h.Fields {
+			if i >= len(cols) || cols[i] == unsetValue || cols[i] == "" {
+				continue
+			}
+			if !first {
+				line = append(line, ',')
+			}
+			first = false
+			line = append(line, keys[i]...)
+			line = append(line, ':')
+			if containers[i] {
+				line = append(line, '[')
+				for j, e := range elements(cols[i], h.SetSep) {
+					if j > 0 {
+						line = append(line, ',')
+					}
+					line = appendValue(line, e, kinds[i])
+				}
+				line = append(line, ']')
+				continue
+			}
+			line = appendValue(line, text(cols[i], h.SetSep, false), kinds[i])
+		}
+		line = append(line, '}', '\n')
+		if _, err := bw.Write(line); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// appendValue appends v as a JSON value of kind k, falling back to a string
+// when it does not parse as that kind.
+func appendValue(dst []byte, v string, k kind) []byte {
+	switch k {
+	case kindInt:
+		if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return append(dst, v...)
+		}
+		if _, err := strconv.ParseUint(v, 10, 64); err == nil {
+			return append(dst, v...)
+		}
+	case kindFloat:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return strconv.AppendFloat(dst, f, 'f', -1, 64)
+		}
+	case kindBool:
+		switch v {
+		case "T":
+			return append(dst, "true"...)
+		case "F":
+			return append(dst, "false"...)
+		}
+	}
+	b, _ := json.Marshal(v)
+	return append(dst, b...)
+}
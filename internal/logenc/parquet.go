@@ -0,0 +1,305 @@
+package logenc
+
+import (
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+	"github.com/parquet-go/parquet-go/encoding"
+)
+
+func init() { Register(parquetEncoder{}) }
+
+// Writer tuning. Row groups bound memory: parquet-go buffers a group in full
+// before it is written, so one is flushed at parquetRowGroupRows rows or when
+// its buffered values reach the memory limit (parquetRowGroupBytes unless
+// set with WithMemoryLimit).
+const (
+	parquetRowGroupRows  = 65536
+	parquetRowGroupBytes = 32 << 20
+	parquetCreatedBy     = "enigma-go-sensor logenc"
+)
+
+// parquetValueOverhead approximates the per-value bookkeeping (value header
+// and levels) on top of the value bytes when sizing a buffered row group.
+const parquetValueOverhead = 32
+
+// parquetEncoder writes an Apache Parquet file through parquet-go, with one
+// OPTIONAL column per Zeek field, typed from #types:
+//
+//	time            INT64  TIMESTAMP(MICROS, UTC)
+//	interval/double DOUBLE
+//	count           INT64  INTEGER(64, unsigned)
+//	int             INT64  INTEGER(64, signed)
+//	port            INT32  INTEGER(16, unsigned)
+//	bool            BOOLEAN
+//	enum            BYTE_ARRAY ENUM
+//	addr/string/... BYTE_ARRAY STRING
+//	set/vector[T]   LIST of T (three-level layout, required elements)
+//
+// Unset values are nulls and empty containers are empty lists. Columns of
+// values that repeat (strings, enums, ports, counts and ints) are dictionary
+// encoded; times, doubles and booleans are PLAIN. Pages are gzip-compressed
+// and version 2, parquet-go's default: its version 1 pages carry repetition
+// levels in columns that have none. A value that does not parse as its
+// declared type is written as null.
+type parquetEncoder struct {
+	maxBufferBytes int64 // 0 = parquetRowGroupBytes
+}
+
+func (parquetEncoder) Name() string { return PARQUET }
+func (parquetEncoder) Ext() string  { return ".parquet" }
+
+func (parquetEncoder) withMemoryLimit(bytes int64) Encoder {
+	return parquetEncoder{maxBufferBytes: bytes}
+}
+
+// parquetWriterConfig is the configuration of every file written, including
+// the parts of a split one.
+func parquetWriterConfig() *parquet.WriterConfig {
+	return &parquet.WriterConfig{
+		CreatedBy:   parquetCreatedBy,
+		Compression: &parquet.Gzip,
+	}
+}
+
+func (e parquetEncoder) Encode(w io.Writer, h Header, rows RowReader) error {
+	limit := e.maxBufferBytes
+	if limit <= 0 {
+		limit = parquetRowGroupBytes
+	}
+	cols := make([]*parquetColumn, len(h.Fields))
+	root := make(parquetGroup, len(h.Fields))
+	for i, f := range h.Fields {
+		cols[i] = newParquetColumn(h.typeAt(i))
+		root[i] = parquetField{Node: cols[i].node(), name: f}
+	}
+	pw := parquet.NewWriter(w, parquet.NewSchema("schema", root), parquetWriterConfig())
+	row := make(parquet.Row, 0, len(cols))
+	n, buffered := 0, int64(0)
+	for {
+		cells, err := rows.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		row = row[:0]
+		for i, c := range cols {
+			cell := unsetValue
+			if i < len(cells) {
+				cell = cells[i]
+			}
+			var size int64
+			row, size = c.appendValues(row, i, cell, h.SetSep)
+			buffered += size
+		}
+		if _, err := pw.WriteRows([]parquet.Row{row}); err != nil {
+			return err
+		}
+		if n++; n == parquetRowGroupRows || buffered >= limit {
+			if err := pw.Flush(); err != nil {
+				return err
+			}
+			n, buffered = 0, 0
+		}
+	}
+	return pw.Close()
+}
+
+// parquetColumn describes the type of one Zeek field.
+type parquetColumn struct {
+	zeekType string // the element type of a container
+	list     bool
+}
+
+func newParquetColumn(zeekType string) *parquetColumn {
+	c := &parquetColumn{zeekType: zeekType}
+	if open := strings.IndexByte(zeekType, '['); open >= 0 && strings.HasSuffix(zeekType, "]") {
+		c.list = true
+		c.zeekType = zeekType[open+1 : len(zeekType)-1]
+	}
+	return c
+}
+
+// node returns the column's schema node: an optional leaf, or an optional
+// LIST of required elements.
+func (c *parquetColumn) node() parquet.Node {
+	var leaf parquet.Node
+	dict := true
+	switch c.zeekType {
+	case "time":
+		leaf, dict = parquet.Timestamp(parquet.Microsecond), false
+	case "interval", "double":
+		leaf, dict = parquet.Leaf(parquet.DoubleType), false
+	case "count":
+		leaf = parquet.Uint(64)
+	case "int":
+		leaf = parquet.Int(64)
+	case "port":
+		leaf = parquet.Uint(16)
+	case "bool":
+		leaf, dict = parquet.Leaf(parquet.BooleanType), false
+	case "enum":
+		leaf = parquet.Enum()
+	default:
+		leaf = parquet.String()
+	}
+	if dict {
+		leaf = parquet.Encoded(leaf, &parquet.RLEDictionary)
+	}
+	if c.list {
+		return parquet.Optional(parquet.List(leaf))
+	}
+	return parquet.Optional(leaf)
+}
+
+// appendValues appends one row's cell to row as the values of column index
+// and returns roughly how many bytes of memory they take until the row
+// group is written.
+func (c *parquetColumn) appendValues(row parquet.Row, index int, cell, setSep string) (parquet.Row, int64) {
+	if !c.list {
+		switch cell {
+		case unsetValue, "":
+			return append(row, parquet.NullValue().Level(0, 0, index)), parquetValueOverhead
+		case emptyValue:
+			cell = ""
+		default:
+			cell = Unescape(cell)
+		}
+		v, ok := c.value(cell)
+		if !ok {
+			return append(row, parquet.NullValue().Level(0, 0, index)), parquetValueOverhead
+		}
+		return append(row, v.Level(0, 1, index)), parquetValueSize(v)
+	}
+	switch cell {
+	case unsetValue, "":
+		return append(row, parquet.NullValue().Level(0, 0, index)), parquetValueOverhead
+	case emptyValue:
+		return append(row, parquet.NullValue().Level(0, 1, index)), parquetValueOverhead
+	}
+	// Elements are REQUIRED, so ones that do not parse are skipped; a list
+	// left with no elements is recorded as empty.
+	var rep int
+	var size int64
+	for _, e := range elements(cell, setSep) {
+		v, ok := c.value(e)
+		if !ok {
+			continue
+		}
+		row = append(row, v.Level(rep, 2, index))
+		size += parquetValueSize(v)
+		rep = 1
+	}
+	if rep == 0 {
+		row = append(row, parquet.NullValue().Level(0, 1, index))
+		size += parquetValueOverhead
+	}
+	return row, size
+}
+
+// value returns a single set value as the column's type, or false when it
+// does not parse as it.
+func (c *parquetColumn) value(s string) (parquet.Value, bool) {
+	switch c.zeekType {
+	case "time":
+		us, ok := parseMicros(s)
+		return parquet.Int64Value(us), ok
+	case "interval", "double":
+		f, err := strconv.ParseFloat(s, 64)
+		return parquet.DoubleValue(f), err == nil
+	case "count":
+		u, err := strconv.ParseUint(s, 10, 64)
+		return parquet.Int64Value(int64(u)), err == nil
+	case "int":
+		i, err := strconv.ParseInt(s, 10, 64)
+		return parquet.Int64Value(i), err == nil
+	case "port":
+		u, err := strconv.ParseUint(s, 10, 16)
+		return parquet.Int32Value(int32(u)), err == nil
+	case "bool":
+		return parquet.BooleanValue(s == "T"), s == "T" || s == "F"
+	}
+	return parquet.ByteArrayValue([]byte(s)), true
+}
+
+// parquetValueSize approximates the memory a buffered value takes: its PLAIN
+// encoding and parquetValueOverhead.
+func parquetValueSize(v parquet.Value) int64 {
+	if v.Kind() == parquet.ByteArray {
+		return 4 + int64(len(v.ByteArray())) + parquetValueOverhead
+	}
+	return 8 + parquetValueOverhead
+}
+
+// parseMicros converts a Zeek time ("1700000000.123456") to microseconds
+// since the epoch without going through float64, so no precision is lost.
+func parseMicros(s string) (int64, bool) {
+	whole, frac, _ := strings.Cut(s, ".")
+	neg := strings.HasPrefix(whole, "-")
+	secs, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	if len(frac) > 6 {
+		frac = frac[:6]
+	}
+	var us int64
+	if frac != "" {
+		f, err := strconv.ParseUint(frac, 10, 32)
+		if err != nil {
+			return 0, false
+		}
+		us = int64(f)
+		for i := len(frac); i < 6; i++ {
+			us *= 10
+		}
+	}
+	if neg {
+		us = -us
+	}
+	return secs*1e6 + us, true
+}
+
+// parquetGroup is the schema's root group. parquet.Group orders its fields
+// by name; a Zeek log's columns keep their order.
+type parquetGroup []parquet.Field
+
+// parquetField is a named column of a parquetGroup.
+type parquetField struct {
+	parquet.Node
+	name string
+}
+
+func (f parquetField) Name() string { return f.name }
+
+func (f parquetField) Value(base reflect.Value) reflect.Value {
+	return base.MapIndex(reflect.ValueOf(f.name))
+}
+
+// group returns g as a parquet.Group, for the methods that do not depend on
+// field order.
+func (g parquetGroup) group() parquet.Group {
+	m := make(parquet.Group, len(g))
+	for _, f := range g {
+		m[f.Name()] = f
+	}
+	return m
+}
+
+func (parquetGroup) ID() int                     { return 0 }
+func (g parquetGroup) String() string            { return g.group().String() }
+func (g parquetGroup) Type() parquet.Type        { return g.group().Type() }
+func (parquetGroup) Optional() bool              { return false }
+func (parquetGroup) Repeated() bool              { return false }
+func (parquetGroup) Required() bool              { return true }
+func (parquetGroup) Leaf() bool                  { return false }
+func (g parquetGroup) Fields() []parquet.Field   { return g }
+func (parquetGroup) Encoding() encoding.Encoding { return nil }
+func (parquetGroup) Compression() compress.Codec { return nil }
+func (g parquetGroup) GoType() reflect.Type      { return g.group().GoType() }
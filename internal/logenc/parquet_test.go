@@ -0,0 +1,757 @@
+package logenc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// The tests read files back with a minimal Parquet reader, independent of
+// parquet-go: a Thrift compact protocol decoder for the metadata and a hybrid
+// RLE decoder for levels and dictionary indices.
+
+// Thrift compact protocol type ids.
+const (
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftByte   = 3
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// Parquet enum values checked by the tests (parquet.thrift).
+const (
+	pqBoolean   = 0
+	pqInt32     = 1
+	pqInt64     = 2
+	pqDouble    = 5
+	pqByteArray = 6
+
+	pqRequired = 0
+
+	pqConvEnum      = 4
+	pqConvTimestamp = 10 // TIMESTAMP_MICROS
+
+	pqEncRLEDictionary = 8
+
+	pqPageDictionary = 2
+)
+
+type tstruct map[int16]interface{}
+
+type thriftReader struct {
+	b []byte
+	p int
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b[r.p:])
+	r.p += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	u := r.uvarint()
+	return int64(u>>1) ^ -int64(u&1)
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case thriftTrue:
+		return true
+	case thriftFalse:
+		return false
+	case thriftByte:
+		r.p++
+		return int64(int8(r.b[r.p-1]))
+	case 4, thriftI32, thriftI64:
+		return r.zigzag()
+	case thriftBinary:
+		n := int(r.uvarint())
+		r.p += n
+		return string(r.b[r.p-n : r.p])
+	case thriftList:
+		h := r.b[r.p]
+		r.p++
+		size, et := int(h>>4), h&0x0F
+		if size == 15 {
+			size = int(r.uvarint())
+		}
+		out := make([]interface{}, size)
+		for i := range out {
+			out[i] = r.value(et)
+		}
+		return out
+	case thriftStruct:
+		return r.structure()
+	}
+	panic(fmt.Sprintf("unsupported thrift type %d", typ))
+}
+
+func (r *thriftReader) structure() tstruct {
+	m := tstruct{}
+	var last int16
+	for {
+		h := r.b[r.p]
+		r.p++
+		if h == 0 {
+			return m
+		}
+		id := last + int16(h>>4)
+		if h>>4 == 0 {
+			id = int16(r.zigzag())
+		}
+		last = id
+		m[id] = r.value(h & 0x0F)
+	}
+}
+
+func decodeHybrid(b []byte, width, n int) []uint32 {
+	var out []uint32
+	for len(out) < n {
+		h, k := binary.Uvarint(b)
+		b = b[k:]
+		if h&1 == 1 {
+			count := int(h>>1) * 8
+			nbytes := int(h>>1) * width
+			for i := 0; i < count; i++ {
+				var v uint32
+				for j := 0; j < width; j++ {
+					bit := i*width + j
+					v |= uint32(b[bit/8]>>(bit%8)&1) << j
+				}
+				out = append(out, v)
+			}
+			b = b[nbytes:]
+			continue
+		}
+		var v uint32
+		bw := (width + 7) / 8
+		for j := 0; j < bw; j++ {
+			v |= uint32(b[j]) << (8 * j)
+		}
+		b = b[bw:]
+		for i := 0; i < int(h>>1); i++ {
+			out = append(out, v)
+		}
+	}
+	return out[:n]
+}
+
+// readPage returns the header of the page at off, its content with the
+// values decompressed, and the offset of the next page. The levels of a
+// version 2 data page, which are not compressed, are kept in front.
+func readPage(t *testing.T, data []byte, off int64) (tstruct, []byte, int64) {
+	t.Helper()
+	r := &thriftReader{b: data, p: int(off)}
+	hdr := r.structure()
+	body := data[r.p : r.p+int(hdr[3].(int64))]
+	var levels []byte
+	if v2, ok := hdr[8].(tstruct); ok {
+		n := int(v2[5].(int64) + v2[6].(int64))
+		levels, body = body[:n:n], body[n:]
+		if v2[7] == false {
+			return hdr, append(levels, body...), int64(r.p) + hdr[3].(int64)
+		}
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("page at %d: %v", off, err)
+	}
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw = append(levels, raw...)
+	if int64(len(raw)) != hdr[2].(int64) {
+		t.Fatalf("page at %d: uncompressed size %d, header says %d", off, len(raw), hdr[2])
+	}
+	return hdr, raw, int64(r.p) + hdr[3].(int64)
+}
+
+// decodePlain decodes n PLAIN values of a physical type.
+func decodePlain(b []byte, ptype int64, n int) ([]interface{}, []byte) {
+	out := make([]interface{}, n)
+	for i := range out {
+		switch ptype {
+		case pqBoolean:
+			out[i] = b[i/8]>>(i%8)&1 == 1
+		case pqInt32:
+			out[i], b = int64(int32(binary.LittleEndian.Uint32(b))), b[4:]
+		case pqInt64:
+			out[i], b = int64(binary.LittleEndian.Uint64(b)), b[8:]
+		case pqDouble:
+			out[i], b = math.Float64frombits(binary.LittleEndian.Uint64(b)), b[8:]
+		case pqByteArray:
+			l := int(binary.LittleEndian.Uint32(b))
+			out[i], b = string(b[4:4+l]), b[4+l:]
+		}
+	}
+	return out, b
+}
+
+// readColumn returns the rows of one column chunk: nil for null, the value
+// for a leaf, or a []interface{} for a list column.
+func readColumn(t *testing.T, data []byte, chunk tstruct, list bool) []interface{} {
+	t.Helper()
+	meta := chunk[3].(tstruct)
+	ptype := meta[1].(int64)
+	var dict []interface{}
+	if off := dictionaryOffset(meta); off != 0 {
+		hdr, raw, _ := readPage(t, data, off)
+		if hdr[1].(int64) != pqPageDictionary {
+			t.Fatalf("page at dictionary_page_offset has type %d", hdr[1])
+		}
+		dict, _ = decodePlain(raw, ptype, int(hdr[7].(tstruct)[1].(int64)))
+	}
+	maxDef := uint32(1)
+	if list {
+		maxDef = 2
+	}
+	var rows []interface{}
+	off := meta[9].(int64)
+	for read := 0; read < int(meta[5].(int64)); {
+		hdr, raw, next := readPage(t, data, off)
+		off = next
+		var n int
+		var encoding int64
+		var defs, reps []uint32
+		if v2, ok := hdr[8].(tstruct); ok {
+			n, encoding = int(v2[1].(int64)), v2[4].(int64)
+			rl, dl := int(v2[6].(int64)), int(v2[5].(int64))
+			if list {
+				reps = decodeHybrid(raw[:rl], 1, n)
+			}
+			defs = decodeHybrid(raw[rl:rl+dl], bitWidth(maxDef), n)
+			raw = raw[rl+dl:]
+		} else {
+			dph := hdr[5].(tstruct)
+			n, encoding = int(dph[1].(int64)), dph[2].(int64)
+			levels := func(width int) []uint32 {
+				l := int(binary.LittleEndian.Uint32(raw))
+				out := decodeHybrid(raw[4:4+l], width, n)
+				raw = raw[4+l:]
+				return out
+			}
+			if list {
+				reps = levels(1)
+			}
+			defs = levels(bitWidth(maxDef))
+		}
+		read += n
+		if reps == nil {
+			reps = make([]uint32, n)
+		}
+		present := 0
+		for _, d := range defs {
+			if d == maxDef {
+				present++
+			}
+		}
+		var values []interface{}
+		if encoding == pqEncRLEDictionary {
+			width := int(raw[0])
+			for _, idx := range decodeHybrid(raw[1:], width, present) {
+				values = append(values, dict[idx])
+			}
+		} else {
+			values, _ = decodePlain(raw, ptype, present)
+		}
+
+		for i, d := range defs {
+			var v interface{}
+			if d == maxDef {
+				v, values = values[0], values[1:]
+			}
+			if !list {
+				rows = append(rows, v)
+				continue
+			}
+			if reps[i] == 1 {
+				last := rows[len(rows)-1].([]interface{})
+				rows[len(rows)-1] = append(last, v)
+				continue
+			}
+			switch d {
+			case 0:
+				rows = append(rows, nil)
+			case 1:
+				rows = append(rows, []interface{}{})
+			default:
+				rows = append(rows, []interface{}{v})
+			}
+		}
+	}
+	return rows
+}
+
+// dictionaryOffset returns the dictionary_page_offset of a ColumnMetaData,
+// or 0 when the chunk has no dictionary page.
+func dictionaryOffset(meta tstruct) int64 {
+	off, _ := meta[11].(int64)
+	return off
+}
+
+// bitWidth is the number of bits needed to encode levels up to max.
+func bitWidth(max uint32) int { return bits.Len32(max) }
+
+func readParquet(t *testing.T, data []byte) tstruct {
+	t.Helper()
+	if string(data[:4]) != "PAR1" || string(data[len(data)-4:]) != "PAR1" {
+		t.Fatal("missing PAR1 magic")
+	}
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	r := &thriftReader{b: data[len(data)-8-footerLen : len(data)-8]}
+	fmd := r.structure()
+	if r.p != footerLen {
+		t.Fatalf("footer decoded %d of %d bytes", r.p, footerLen)
+	}
+	return fmd
+}
+
+var parquetHeader = Header{
+	Path:   "conn",
+	Fields: []string{"ts", "uid", "id.resp_p", "orig_bytes", "duration", "local_orig", "proto", "tunnel_parents"},
+	Types:  []string{"time", "string", "port", "count", "interval", "bool", "enum", "set[string]"},
+	SetSep: ",",
+}
+
+func parquetRows(n int) [][]string {
+	rows := make([][]string, n)
+	for i := range rows {
+		port, bytes, local := "443", "-", "F"
+		if i%2 == 0 {
+			port, bytes = "53", fmt.Sprint(i*100)
+		}
+		if i%3 == 0 {
+			local = "T"
+		}
+		parents := []string{"-", "(empty)", "A", `A,B\x2cC`}[i%4]
+		rows[i] = []string{fmt.Sprintf("1700000000.%06d", i), fmt.Sprintf("C%d", i), port, bytes, "0.500000", local, "tcp", parents}
+	}
+	return rows
+}
+
+func TestParquet(t *testing.T) {
+	const n = 40
+	enc, ok := Lookup(PARQUET)
+	if !ok || enc.Ext() != ".parquet" {
+		t.Fatal("parquet encoder not registered")
+	}
+	var buf bytes.Buffer
+	if err := enc.Encode(&buf, parquetHeader, &sliceRows{rows: parquetRows(n)}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	fmd := readParquet(t, data)
+	if fmd[3].(int64) != n {
+		t.Errorf("num_rows = %v, want %d", fmd[3], n)
+	}
+
+	schema := fmd[2].([]interface{})
+	var names []string
+	leaves := map[string]tstruct{}
+	for _, e := range schema[1:] {
+		el := e.(tstruct)
+		names = append(names, el[4].(string))
+		if _, ok := el[1]; ok {
+			leaves[el[4].(string)] = el
+		}
+	}
+	wantNames := []string{"ts", "uid", "id.resp_p", "orig_bytes", "duration", "local_orig", "proto", "tunnel_parents", "list", "element"}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("schema names = %v, want %v", names, wantNames)
+	}
+	ts := leaves["ts"]
+	if ts[1].(int64) != pqInt64 || ts[6].(int64) != pqConvTimestamp {
+		t.Errorf("ts element = %v", ts)
+	}
+	if tsl := ts[10].(tstruct)[8].(tstruct); tsl[1] != true || tsl[2].(tstruct)[2] == nil {
+		t.Errorf("ts logical type = %v, want TIMESTAMP(MICROS, UTC)", tsl)
+	}
+	port := leaves["id.resp_p"][10].(tstruct)[10].(tstruct)
+	if port[1].(int64) != 16 || port[2] != false {
+		t.Errorf("port logical type = %v, want INTEGER(16, unsigned)", port)
+	}
+	if leaves["duration"][1].(int64) != pqDouble || leaves["local_orig"][1].(int64) != pqBoolean {
+		t.Error("duration/local_orig physical types wrong")
+	}
+	if leaves["proto"][6].(int64) != pqConvEnum || leaves["element"][3].(int64) != pqRequired {
+		t.Error("proto/element annotations wrong")
+	}
+
+	rg := fmd[4].([]interface{})[0].(tstruct)
+	chunks := rg[1].([]interface{})
+	col := func(i int) []interface{} {
+		return readColumn(t, data, chunks[i].(tstruct), i == 7)
+	}
+	tsCol, uid, ports, bytesCol, dur, local, proto, parents := col(0), col(1), col(2), col(3), col(4), col(5), col(6), col(7)
+	for i := 0; i < n; i++ {
+		if tsCol[i] != int64(1700000000000000+i) {
+			t.Errorf("row %d ts = %v", i, tsCol[i])
+		}
+		if uid[i] != fmt.Sprintf("C%d", i) || dur[i] != 0.5 || proto[i] != "tcp" || local[i] != (i%3 == 0) {
+			t.Errorf("row %d = %v %v %v %v", i, uid[i], dur[i], proto[i], local[i])
+		}
+		wantPort, wantBytes := int64(443), interface{}(nil)
+		if i%2 == 0 {
+			wantPort, wantBytes = 53, int64(i*100)
+		}
+		if ports[i] != wantPort || bytesCol[i] != wantBytes {
+			t.Errorf("row %d port/bytes = %v/%v", i, ports[i], bytesCol[i])
+		}
+		want := []interface{}{nil, []interface{}{}, []interface{}{"A"}, []interface{}{"A", "B,C"}}[i%4]
+		if !reflect.DeepEqual(parents[i], want) {
+			t.Errorf("row %d tunnel_parents = %#v, want %#v", i, parents[i], want)
+		}
+	}
+
+	meta := func(i int) tstruct { return chunks[i].(tstruct)[3].(tstruct) }
+	if dictionaryOffset(meta(2)) == 0 || dictionaryOffset(meta(6)) == 0 {
+		t.Error("port and enum columns should be dictionary encoded")
+	}
+	if dictionaryOffset(meta(0)) != 0 || dictionaryOffset(meta(4)) != 0 {
+		t.Error("time and interval columns should be PLAIN")
+	}
+}
+
+func TestParquet_RowGroups(t *testing.T) {
+	n := parquetRowGroupRows + 10
+	var buf bytes.Buffer
+	h := Header{Path: "dns", Fields: []string{"qtype"}, Types: []string{"count"}}
+	rows := make([][]string, n)
+	for i := range rows {
+		rows[i] = []string{fmt.Sprint(i % 3)}
+	}
+	if err := (parquetEncoder{}).Encode(&buf, h, &sliceRows{rows: rows}); err != nil {
+		t.Fatal(err)
+	}
+	fmd := readParquet(t, buf.Bytes())
+	groups := fmd[4].([]interface{})
+	if len(groups) != 2 || fmd[3].(int64) != int64(n) {
+		t.Fatalf("got %d row groups, %v rows", len(groups), fmd[3])
+	}
+	last := readColumn(t, buf.Bytes(), groups[1].(tstruct)[1].([]interface{})[0].(tstruct), false)
+	if len(last) != 10 || last[0] != int64(parquetRowGroupRows%3) {
+		t.Errorf("second row group = %v", last)
+	}
+}
+
+func TestParquet_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := (parquetEncoder{}).Encode(&buf, parquetHeader, &sliceRows{}); err != nil {
+		t.Fatal(err)
+	}
+	fmd := readParquet(t, buf.Bytes())
+	if fmd[3].(int64) != 0 || len(fmd[2].([]interface{})) != 11 {
+		t.Errorf("empty file metadata = %v", fmd)
+	}
+}
+
+func TestParseMicros(t *testing.T) {
+	tests := map[string]int64{
+		"1700000000.123456":    1700000000123456,
+		"1700000000.5":         1700000000500000,
+		"1700000000":           1700000000000000,
+		"1700000000.123456789": 1700000000123456,
+	}
+	for in, want := range tests {
+		if got, ok := parseMicros(in); !ok || got != want {
+			t.Errorf("parseMicros(%q) = %d, %v; want %d", in, got, ok, want)
+		}
+	}
+	if _, ok := parseMicros("soon"); ok {
+		t.Error("parseMicros accepted garbage")
+	}
+}
+
+func TestParquet_MemoryLimitFlushesRowGroups(t *testing.T) {
+	h := Header{Path: "conn", Fields: []string{"uid"}, Types: []string{"string"}}
+	rows := make([][]string, 1000)
+	for i := range rows {
+		rows[i] = []string{fmt.Sprintf("C%039d", i)}
+	}
+	enc := WithMemoryLimit(parquetEncoder{}, 100*(4+40+parquetValueOverhead))
+	var buf bytes.Buffer
+	if err := enc.Encode(&buf, h, &sliceRows{rows: rows}); err != nil {
+		t.Fatal(err)
+	}
+	fmd := readParquet(t, buf.Bytes())
+	if groups := len(fmd[4].([]interface{})); groups != 10 {
+		t.Errorf("got %d row groups, want 10 with a 100-row budget", groups)
+	}
+	if fmd[3].(int64) != 1000 {
+		t.Errorf("num_rows = %v", fmd[3])
+	}
+	if WithMemoryLimit(csvEncoder{}, 1) != (csvEncoder{}) {
+		t.Error("streaming encoders should be returned unchanged")
+	}
+}
+
+func TestParquet_Split(t *testing.T) {
+	h := Header{Path: "conn", Fields: []string{"uid", "tunnel_parents"}, Types: []string{"string", "set[string]"}, SetSep: ","}
+	rows := make([][]string, 1000)
+	for i := range rows {
+		rows[i] = []string{fmt.Sprintf("C%039d", i), fmt.Sprintf("P%d,Q%d", i%7, i)}
+	}
+	enc := WithMemoryLimit(parquetEncoder{}, 100*(4+40+parquetValueOverhead))
+	var buf bytes.Buffer
+	if err := enc.Encode(&buf, h, &sliceRows{rows: rows}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	var parts []*bytes.Buffer
+	err := Split(PARQUET, bytes.NewReader(data), int64(len(data)), int64(len(data))/4, func() (io.Writer, error) {
+		parts = append(parts, new(bytes.Buffer))
+		return parts[len(parts)-1], nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) < 4 || len(parts) > 10 {
+		t.Fatalf("got %d parts of 10 row groups", len(parts))
+	}
+	var uids, parents []interface{}
+	for i, part := range parts {
+		if part.Len() > len(data)/4 {
+			t.Errorf("part %d is %d bytes, over %d", i, part.Len(), len(data)/4)
+		}
+		fmd := readParquet(t, part.Bytes())
+		n := 0
+		for _, g := range fmd[4].([]interface{}) {
+			chunks := g.(tstruct)[1].([]interface{})
+			uids = append(uids, readColumn(t, part.Bytes(), chunks[0].(tstruct), false)...)
+			parents = append(parents, readColumn(t, part.Bytes(), chunks[1].(tstruct), true)...)
+			n += int(g.(tstruct)[3].(int64))
+		}
+		if fmd[3].(int64) != int64(n) {
+			t.Errorf("part %d: num_rows %v, row groups hold %d", i, fmd[3], n)
+		}
+	}
+	if len(uids) != len(rows) || len(parents) != len(rows) {
+		t.Fatalf("parts hold %d and %d values, want %d", len(uids), len(parents), len(rows))
+	}
+	for i, r := range rows {
+		want := []interface{}{fmt.Sprintf("P%d", i%7), fmt.Sprintf("Q%d", i)}
+		if uids[i] != r[0] || !reflect.DeepEqual(parents[i], want) {
+			t.Fatalf("row %d = %v %v, want %v", i, uids[i], parents[i], r)
+		}
+	}
+}
+
+// update rewrites the golden files of TestParquet_Golden from the encoder.
+var update = flag.Bool("update", false, "rewrite testdata/golden.parquet and testdata/golden.json")
+
+// goldenHeader and goldenRows cover every column type, nulls, empty and
+// escaped sets, and a value that does not parse as its type.
+var goldenHeader = Header{
+	Path: "conn",
+	Fields: []string{"ts", "uid", "id.orig_h", "id.resp_p", "proto", "duration",
+		"orig_bytes", "missed", "local_orig", "tunnel_parents", "orig_pkts_hist"},
+	Types: []string{"time", "string", "addr", "port", "enum", "interval",
+		"count", "int", "bool", "set[string]", "vector[count]"},
+	SetSep: ",",
+}
+
+var goldenRows = [][]string{
+	{"1700000000.000001", "CgA1", "192.168.1.10", "443", "tcp", "0.500000", "1024", "0", "T", "Cx1,Cx2", "1,2,3"},
+	{"1700000001.250000", "CgA2", "fe80::1", "53", "udp", "-", "-", "-", "F", "(empty)", "(empty)"},
+	{"1700000002.000000", "CgA3", "10.0.0.1", "x", "tcp", "12.125000", "0", "-5", "-", `A\x2cB`, "-"},
+	{"-", "-", "-", "-", "-", "-", "-", "-", "-", "-", "-"},
+}
+
+// TestParquet_Golden pins the encoder's output to testdata/golden.parquet
+// and the values a reader must find in it to testdata/golden.json, which
+// TestParquet_GoldenParquetGo and testdata/check_parquet.py check against
+// parquet-go's and pyarrow's reading of the same file. After an intended
+// change to the output, run the test with -update and re-run the script:
+//
+//	python3 testdata/check_parquet.py testdata/golden.parquet testdata/golden.json
+func TestParquet_Golden(t *testing.T) {
+	var buf bytes.Buffer
+	if err := (parquetEncoder{}).Encode(&buf, goldenHeader, &sliceRows{rows: goldenRows}); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.Bytes()
+
+	// The rows as this package's reader decodes them, in the JSON form the
+	// script prints: times in microseconds, lists as arrays, nulls as null.
+	fmd := readParquet(t, got)
+	chunks := fmd[4].([]interface{})[0].(tstruct)[1].([]interface{})
+	rows := make([]map[string]interface{}, len(goldenRows))
+	for i := range rows {
+		rows[i] = map[string]interface{}{}
+	}
+	for c, name := range goldenHeader.Fields {
+		container := strings.HasPrefix(goldenHeader.Types[c], "set[") || strings.HasPrefix(goldenHeader.Types[c], "vector[")
+		for i, v := range readColumn(t, got, chunks[c].(tstruct), container) {
+			rows[i][name] = v
+		}
+	}
+	decoded, err := json.MarshalIndent(rows, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *update {
+		if err := os.WriteFile(filepath.Join("testdata", "golden.parquet"), got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join("testdata", "golden.json"), append(decoded, '\n'), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(filepath.Join("testdata", "golden.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("encoder output (%d bytes) differs from testdata/golden.parquet (%d bytes)", len(got), len(want))
+	}
+	wantJSON, err := os.ReadFile(filepath.Join("testdata", "golden.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wantRows, gotRows interface{}
+	if err := json.Unmarshal(wantJSON, &wantRows); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(decoded, &gotRows); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotRows, wantRows) {
+		t.Errorf("decoded rows differ from testdata/golden.json:\n%s", decoded)
+	}
+}
+
+// goldenLeafTypes is the type parquet-go reads each leaf column of
+// testdata/golden.parquet as.
+var goldenLeafTypes = map[string]string{
+	"ts":                          "TIMESTAMP(isAdjustedToUTC=true,unit=MICROS)",
+	"uid":                         "STRING",
+	"id.orig_h":                   "STRING",
+	"id.resp_p":                   "INT(16,false)",
+	"proto":                       "ENUM",
+	"duration":                    "DOUBLE",
+	"orig_bytes":                  "INT(64,false)",
+	"missed":                      "INT(64,true)",
+	"local_orig":                  "BOOLEAN",
+	"tunnel_parents.list.element": "STRING",
+	"orig_pkts_hist.list.element": "INT(64,false)",
+}
+
+// TestParquet_GoldenParquetGo reads testdata/golden.parquet back with
+// parquet-go's reader, which the Zeek type mapping must round-trip through,
+// and compares its column types and rows with testdata/golden.json.
+func TestParquet_GoldenParquetGo(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "golden.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := f.Schema()
+	names := make([]string, len(schema.Columns()))
+	lists := make([]bool, len(schema.Columns()))
+	for i, path := range schema.Columns() {
+		leaf, _ := schema.Lookup(path...)
+		name := strings.Join(path, ".")
+		if got := leaf.Node.Type().String(); got != goldenLeafTypes[name] {
+			t.Errorf("column %s has type %s, want %s", name, got, goldenLeafTypes[name])
+		}
+		names[i], lists[i] = path[0], len(path) > 1
+	}
+	if strings.Join(names, " ") != strings.Join(goldenHeader.Fields, " ") {
+		t.Fatalf("columns %v, want %v", names, goldenHeader.Fields)
+	}
+
+	// The rows in golden.json's form. A list column is null at definition
+	// level 0, empty at 1 and has an element at each value of level 2.
+	var rows []map[string]interface{}
+	for _, rg := range f.RowGroups() {
+		r := rg.Rows()
+		buf := make([]parquet.Row, 16)
+		for {
+			n, err := r.ReadRows(buf)
+			for _, row := range buf[:n] {
+				out := make(map[string]interface{})
+				for _, v := range row {
+					name := names[v.Column()]
+					var x interface{}
+					switch v.Kind() {
+					case parquet.Boolean:
+						x = v.Boolean()
+					case parquet.Int32:
+						x = v.Int32()
+					case parquet.Int64:
+						x = v.Int64()
+					case parquet.Double:
+						x = v.Double()
+					case parquet.ByteArray:
+						x = string(v.ByteArray())
+					}
+					if lists[v.Column()] {
+						list, _ := out[name].([]interface{})
+						switch v.DefinitionLevel() {
+						case 0:
+							out[name] = nil
+						case 1:
+							out[name] = []interface{}{}
+						default:
+							out[name] = append(list, x)
+						}
+						continue
+					}
+					out[name] = x
+				}
+				rows = append(rows, out)
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		r.Close()
+	}
+
+	decoded, err := json.Marshal(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantJSON, err := os.ReadFile(filepath.Join("testdata", "golden.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wantRows, gotRows interface{}
+	if err := json.Unmarshal(wantJSON, &wantRows); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(decoded, &gotRows); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotRows, wantRows) {
+		t.Errorf("parquet-go rows differ from testdata/golden.json:\n%s", decoded)
+	}
+}
@@ -0,0 +1,260 @@
+package logenc
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// splitter is implemented by encoders whose files cannot be cut between
+// lines, as the text encodings can, but can be rewritten as several smaller
+// files of the same encoding (XLSX, Parquet).
+type splitter interface {
+	split(r io.ReaderAt, size, maxBytes int64, next func() (io.Writer, error)) error
+}
+
+// CanSplit reports whether files of an encoding can be split with Split.
+func CanSplit(name string) bool {
+	_, ok := registry[name].(splitter)
+	return ok
+}
+
+// Split rewrites the encoded log in r, size bytes long, as parts of about
+// maxBytes or less, each a complete file of the same encoding holding a run
+// of the log's rows; next is called for the writer of each part in turn. A
+// part holds at least one row (XLSX) or row group (Parquet), so it may still
+// be larger than maxBytes. Only files written by this package's encoders are
+// understood.
+func Split(name string, r io.ReaderAt, size, maxBytes int64, next func() (io.Writer, error)) error {
+	s, ok := registry[name].(splitter)
+	if !ok {
+		return fmt.Errorf("%s files cannot be split", name)
+	}
+	return s.split(r, size, maxBytes, next)
+}
+
+// xlsxMaxRowBytes bounds the XML of one row read back when splitting a
+// workbook.
+const xlsxMaxRowBytes = 16 << 20
+
+// xlsxRowRef matches the row number in the references of a row and its
+// cells. Cell text is escaped, so a quote only ends an attribute.
+var xlsxRowRef = regexp.MustCompile(`(<row r="|<c r="[A-Z]+)[0-9]+"`)
+
+// split copies the sheet's rows into workbooks of the same sheet name, each
+// starting with the header row and with its rows renumbered. The parts are
+// cut by uncompressed sheet size, scaled by how well the whole sheet
+// compressed.
+func (xlsxEncoder) split(r io.ReaderAt, size, maxBytes int64, next func() (io.Writer, error)) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	var sheet, workbook *zip.File
+	for _, f := range zr.File {
+		switch f.Name {
+		case xlsxSheetPart:
+			sheet = f
+		case "xl/workbook.xml":
+			workbook = f
+		}
+	}
+	if sheet == nil || workbook == nil {
+		return errors.New("not a single-sheet workbook")
+	}
+	sheetName, err := xlsxSheetName(workbook)
+	if err != nil {
+		return err
+	}
+	budget := maxBytes
+	if sheet.CompressedSize64 > 0 {
+		budget = int64(float64(maxBytes) * float64(sheet.UncompressedSize64) / float64(sheet.CompressedSize64))
+	}
+
+	rc, err := sheet.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	scanner := bufio.NewScanner(rc)
+	scanner.Buffer(make([]byte, 0, 64*1024), xlsxMaxRowBytes)
+	scanner.Split(scanXLSXRows)
+	var header []byte
+	var part *xlsxPart
+	for scanner.Scan() {
+		row := scanner.Bytes()
+		i := bytes.Index(row, []byte("<row "))
+		if i < 0 {
+			continue // the closing tags
+		}
+		row = row[i:]
+		if header == nil {
+			header = append([]byte(nil), row...)
+			continue
+		}
+		if part != nil && part.rows > 0 && part.size+int64(len(row)) > budget {
+			if err := part.close(); err != nil {
+				return err
+			}
+			part = nil
+		}
+		if part == nil {
+			if part, err = newXLSXPart(next, sheetName, header); err != nil {
+				return err
+			}
+		}
+		part.add(row)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if header == nil {
+		return errors.New("sheet has no header row")
+	}
+	if part == nil {
+		if part, err = newXLSXPart(next, sheetName, header); err != nil {
+			return err
+		}
+	}
+	return part.close()
+}
+
+// xlsxSheetName returns the name of the workbook's sheet.
+func xlsxSheetName(workbook *zip.File) (string, error) {
+	rc, err := workbook.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	var wb struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.NewDecoder(rc).Decode(&wb); err != nil {
+		return "", err
+	}
+	if len(wb.Sheets) != 1 {
+		return "", fmt.Errorf("workbook has %d sheets, want 1", len(wb.Sheets))
+	}
+	return wb.Sheets[0].Name, nil
+}
+
+// scanXLSXRows is a bufio.SplitFunc returning the sheet XML up to and
+// including each "</row>"; what follows the last row is returned as is.
+func scanXLSXRows(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.Index(data, []byte("</row>")); i >= 0 {
+		return i + len("</row>"), data[:i+len("</row>")], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// xlsxPart is a workbook being written by split.
+type xlsxPart struct {
+	zw   *zip.Writer
+	bw   *bufio.Writer
+	rows int
+	size int64
+}
+
+func newXLSXPart(next func() (io.Writer, error), sheetName string, header []byte) (*xlsxPart, error) {
+	w, err := next()
+	if err != nil {
+		return nil, err
+	}
+	zw := zip.NewWriter(w)
+	fw, err := createWorkbook(zw, sheetName)
+	if err != nil {
+		return nil, err
+	}
+	p := &xlsxPart{zw: zw, bw: bufio.NewWriter(fw)}
+	p.bw.WriteString(xlsxSheetStart)
+	p.bw.Write(header)
+	p.size = int64(len(xlsxSheetStart) + len(header))
+	return p, nil
+}
+
+// add appends a row, renumbered to follow the part's previous row.
+func (p *xlsxPart) add(row []byte) {
+	p.rows++
+	row = xlsxRowRef.ReplaceAll(row, []byte("${1}"+strconv.Itoa(p.rows+1)+`"`))
+	p.bw.Write(row)
+	p.size += int64(len(row))
+}
+
+func (p *xlsxPart) close() error {
+	p.bw.WriteString(xlsxSheetEnd)
+	if err := p.bw.Flush(); err != nil {
+		return err
+	}
+	return p.zw.Close()
+}
+
+// split rewrites runs of consecutive row groups as files of their own,
+// written as Encode writes them. A part is sized as the metadata of a file
+// with no rows plus, for each row group, its column chunks and an even share
+// of the rest of the file's metadata.
+func (parquetEncoder) split(r io.ReaderAt, size, maxBytes int64, next func() (io.Writer, error)) error {
+	f, err := parquet.OpenFile(r, size)
+	if err != nil {
+		return err
+	}
+	var empty byteCount
+	if err := parquet.NewWriter(&empty, f.Schema(), parquetWriterConfig()).Close(); err != nil {
+		return err
+	}
+	groups := f.RowGroups()
+	sizes := make([]int64, len(groups))
+	rest := size - int64(empty)
+	for i, rg := range f.Metadata().RowGroups {
+		for _, c := range rg.Columns {
+			sizes[i] += c.MetaData.TotalCompressedSize
+		}
+		rest -= sizes[i]
+	}
+	for i := range sizes {
+		sizes[i] += max(rest, 0) / int64(len(sizes))
+	}
+
+	for i := 0; i < len(groups) || i == 0; {
+		j, total := i, int64(empty)
+		for j < len(groups) && (j == i || total+sizes[j] <= maxBytes) {
+			total += sizes[j]
+			j++
+		}
+		w, err := next()
+		if err != nil {
+			return err
+		}
+		pw := parquet.NewWriter(w, f.Schema(), parquetWriterConfig())
+		for _, rg := range groups[i:j] {
+			if _, err := pw.WriteRowGroup(rg); err != nil {
+				return err
+			}
+		}
+		if err := pw.Close(); err != nil {
+			return err
+		}
+		i = max(j, 1)
+	}
+	return nil
+}
+
+// byteCount is an io.Writer that only counts the bytes written to it.
+type byteCount int64
+
+func (c *byteCount) Write(p []byte) (int, error) {
+	*c += byteCount(len(p))
+	return len(p), nil
+}
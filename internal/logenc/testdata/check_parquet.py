@@ -0,0 +1,75 @@
+#!/usr/bin/env python3
+"""Check golden.parquet with pyarrow, an independent Parquet implementation.
+
+Reads the file written by the logenc Parquet encoder, checks each column's
+Arrow type, and compares the rows with golden.json, the values the Go test
+decodes. Usage:
+
+    pip install pyarrow
+    python3 check_parquet.py golden.parquet golden.json
+"""
+
+import datetime
+import json
+import sys
+
+import pyarrow as pa
+import pyarrow.parquet as pq
+
+EPOCH = datetime.datetime(1970, 1, 1, tzinfo=datetime.timezone.utc)
+
+# Expected Arrow type of each column, as a predicate. ENUM byte arrays have
+# no Arrow string annotation, so either binary or string is accepted.
+TYPES = {
+    "ts": lambda t: pa.types.is_timestamp(t) and t.unit == "us" and t.tz in ("UTC", "+00:00"),
+    "uid": pa.types.is_string,
+    "id.orig_h": pa.types.is_string,
+    "id.resp_p": pa.types.is_uint16,
+    "proto": lambda t: pa.types.is_binary(t) or pa.types.is_string(t),
+    "duration": pa.types.is_float64,
+    "orig_bytes": pa.types.is_uint64,
+    "missed": pa.types.is_int64,
+    "local_orig": pa.types.is_boolean,
+    "tunnel_parents": lambda t: pa.types.is_list(t) and pa.types.is_string(t.value_type),
+    "orig_pkts_hist": lambda t: pa.types.is_list(t) and pa.types.is_uint64(t.value_type),
+}
+
+
+def normalize(v):
+    """Returns v in golden.json's form: times as microseconds since the epoch."""
+    if isinstance(v, datetime.datetime):
+        return (v - EPOCH) // datetime.timedelta(microseconds=1)
+    if isinstance(v, bytes):
+        return v.decode()
+    if isinstance(v, list):
+        return [normalize(x) for x in v]
+    return v
+
+
+def main(parquet_path, json_path):
+    table = pq.read_table(parquet_path)
+    ok = True
+    if table.schema.names != list(TYPES):
+        print("columns %s, want %s" % (table.schema.names, list(TYPES)))
+        ok = False
+    for field in table.schema:
+        check = TYPES.get(field.name)
+        if check is None or not check(field.type):
+            print("column %s has type %s" % (field.name, field.type))
+            ok = False
+
+    got = [{k: normalize(v) for k, v in row.items()} for row in table.to_pylist()]
+    with open(json_path) as f:
+        want = json.load(f)
+    if got != want:
+        print("rows differ:\n got %s\nwant %s" % (json.dumps(got), json.dumps(want)))
+        ok = False
+    if not ok:
+        sys.exit(1)
+    print("%s: %d rows match %s" % (parquet_path, len(got), json_path))
+
+
+if __name__ == "__main__":
+    if len(sys.argv) != 3:
+        sys.exit(__doc__)
+    main(sys.argv[1], sys.argv[2])
@@ -0,0 +1,182 @@
+package logenc
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+func init() { Register(xlsxEncoder{}) }
+
+// Spreadsheet limits imposed by the XLSX format (and Excel).
+const (
+	xlsxMaxRows      = 1048576
+	xlsxMaxCellChars = 32767
+	xlsxMaxSheetName = 31
+)
+
+// xlsxEncoder writes a genuine Office Open XML workbook with a single sheet
+// named after the log. The first row holds the field names; numeric columns
+// are written as numbers and everything else as inline strings, so the sheet
+// streams row by row without a shared-string table. A log with more rows than
+// a worksheet can hold is an error rather than silently truncated.
+type xlsxEncoder struct{}
+
+func (xlsxEncoder) Name() string { return XLSX }
+func (xlsxEncoder) Ext() string  { return ".xlsx" }
+
+func (xlsxEncoder) Encode(w io.Writer, h Header, rows RowReader) error {
+	zw := zip.NewWriter(w)
+	sheetName := h.Path
+	if sheetName == "" {
+		sheetName = "log"
+	}
+	sheetName = truncateRunes(sheetName, xlsxMaxSheetName)
+	fw, err := createWorkbook(zw, sheetName)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(fw)
+	bw.WriteString(xlsxSheetStart)
+
+	kinds := make([]kind, len(h.Fields))
+	containers := make([]bool, len(h.Fields))
+	colRefs := make([]string, len(h.Fields))
+	for i := range h.Fields {
+		kinds[i], containers[i] = columnType(h.typeAt(i))
+		colRefs[i] = columnName(i)
+	}
+
+	rowNum := 1
+	writeRow := func(values []string, typed bool) {
+		r := strconv.Itoa(rowNum)
+		fmt.Fprintf(bw, `<row r="%s">`, r)
+		for i, v := range values {
+			if v == "" {
+				continue
+			}
+			ref := colRefs[i] + r
+			if typed && !containers[i] && (kinds[i] == kindInt || kinds[i] == kindFloat) {
+				if _, err := strconv.ParseFloat(v, 64); err == nil {
+					fmt.Fprintf(bw, `<c r="%s"><v>%s</v></c>`, ref, v)
+					continue
+				}
+			}
+			v = truncateRunes(v, xlsxMaxCellChars)
+			fmt.Fprintf(bw, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, xmlEscape(v))
+		}
+		bw.WriteString("</row>")
+		rowNum++
+	}
+
+	writeRow(h.Fields, false)
+	values := make([]string, len(h.Fields))
+	for {
+		cols, err := rows.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if rowNum > xlsxMaxRows {
+			return fmt.Errorf("log %s has more than %d rows, the XLSX worksheet limit", sheetName, xlsxMaxRows-1)
+		}
+		for i := range values {
+			values[i] = ""
+			if i < len(cols) {
+				values[i] = text(cols[i], h.SetSep, containers[i])
+			}
+		}
+		writeRow(values, true)
+	}
+	bw.WriteString(xlsxSheetEnd)
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// createWorkbook writes the parts of a workbook with a single sheet named
+// sheetName and returns the writer for the sheet's XML.
+func createWorkbook(zw *zip.Writer, sheetName string) (io.Writer, error) {
+	static := []struct{ name, body string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, xmlEscape(sheetName))},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	}
+	for _, f := range static {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(fw, f.body); err != nil {
+			return nil, err
+		}
+	}
+	return zw.Create(xlsxSheetPart)
+}
+
+// columnName converts a 0-based column index to spreadsheet letters (A, B,
+// ..., Z, AA, ...).
+func columnName(i int) string {
+	var b []byte
+	for i++; i > 0; i = (i - 1) / 26 {
+		b = append([]byte{byte('A' + (i-1)%26)}, b...)
+	}
+	return string(b)
+}
+
+// truncateRunes returns s cut to its first n characters (runes); the
+// spreadsheet limits count characters, and cutting inside a multi-byte
+// character would leave invalid UTF-8.
+func truncateRunes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
+
+// xmlEscape escapes text for XML character data; characters that XML 1.0
+// cannot represent are replaced with U+FFFD.
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// The worksheet part and the XML around its rows.
+const (
+	xlsxSheetPart  = "xl/worksheets/sheet1.xml"
+	xlsxSheetStart = xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetEnd   = "</sheetData></worksheet>"
+)
+
+const xlsxContentTypes = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`</Types>`
+
+const xlsxRootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const xlsxWorkbook = xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+const xlsxWorkbookRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`</Relationships>`
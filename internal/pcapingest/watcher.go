@@ -30,8 +30,8 @@ type WatcherConfig struct {
 	WatchDir          string
 	PollInterval      time.Duration
 	FileStableSeconds int
-	SamplingPct       float64
-	ExcludedSubnets   []string
+	// ProcessOptions are passed unchanged to every ProcessPCAP call.
+	ProcessOptions types.ProcessOptions
 }
 
 // Watcher polls a directory for incoming PCAP files and feeds them through
@@ -42,8 +42,7 @@ type Watcher struct {
 	fileStableSeconds int
 	processor         Processor
 	uploader          Uploader
-	samplingPct       float64
-	excludedSubnets   []string
+	processOptions    types.ProcessOptions
 }
 
 // NewWatcher creates a new PCAP directory watcher.
@@ -54,8 +53,7 @@ func NewWatcher(cfg WatcherConfig, proc Processor, uploader Uploader) *Watcher {
 		fileStableSeconds: cfg.FileStableSeconds,
 		processor:         proc,
 		uploader:          uploader,
-		samplingPct:       cfg.SamplingPct,
-		excludedSubnets:   cfg.ExcludedSubnets,
+		processOptions:    cfg.ProcessOptions,
 	}
 }
 
@@ -174,12 +172,14 @@ func (w *Watcher) processFile(ctx context.Context, srcPath, processingDir, proce
 
 	log.Printf("[pcap-ingest] Processing %s", fileName)
 
-	result, err := w.processor.ProcessPCAP(procPath, types.ProcessOptions{
-		SamplingPercentage: w.samplingPct,
-		ExcludedSubnets:    w.excludedSubnets,
-	})
+	result, err := w.processor.ProcessPCAP(procPath, w.processOptions)
 	if err != nil {
 		log.Printf("[pcap-ingest] Processing failed for %s: %v", fileName, err)
+		var schemaErr *types.SchemaError
+		if errors.As(err, &schemaErr) && schemaErr.Quarantine != "" {
+			// The PCAP was quarantined with its logs.
+			return nil
+		}
 		// Move to failed
 		failPath := filepath.Join(failedDir, fileName)
 		if moveErr := os.Rename(procPath, failPath); moveErr != nil {
@@ -190,11 +190,19 @@ func (w *Watcher) processFile(ctx context.Context, srcPath, processingDir, proce
 
 	if w.uploader != nil {
 		uploadErr := w.uploader.UploadLogs(ctx, api.LogFiles{
-			DNSPath:    result.DNSPath,
-			ConnPath:   result.ConnPath,
-			DHCPPath:   result.DHCPPath,
-			JA3JA4Path: result.JA3JA4Path,
-			JA4SPath:   result.JA4SPath,
+			DNSPath:          result.DNSPath,
+			ConnPath:         result.ConnPath,
+			DHCPPath:         result.DHCPPath,
+			JA3JA4Path:       result.JA3JA4Path,
+			JA4SPath:         result.JA4SPath,
+			AssetsPath:       result.AssetsPath,
+			DeviceEventsPath: result.DeviceEventsPath,
+			BeaconsPath:      result.BeaconsPath,
+			DNSAnomaliesPath: result.DNSAnomaliesPath,
+			IntelPath:        result.IntelPath,
+			EncryptedDNSPath: result.EncryptedDNSPath,
+			SummaryPath:      result.SummaryPath,
+			Encoding:         result.Encoding,
 		})
 		if uploadErr != nil {
 			if uploadErr == api.ErrAPIGone {
@@ -50,7 +50,7 @@ func newTestWatcher(t *testing.T, proc Processor, up Uploader) (*Watcher, string
 		WatchDir:          dir,
 		PollInterval:      50 * time.Millisecond,
 		FileStableSeconds: 0, // no wait in tests
-		SamplingPct:       100,
+		ProcessOptions:    types.ProcessOptions{SamplingPercentage: 100},
 	}, proc, up)
 	return w, dir
 }
@@ -237,6 +237,48 @@ func TestWatcher_MoveToFailed(t *testing.T) {
 	}
 }
 
+// quarantineProcessor moves every PCAP to dir and fails schema validation,
+// as ProcessPCAP does with validation enabled.
+type quarantineProcessor struct{ dir string }
+
+func (q *quarantineProcessor) ProcessPCAP(pcapPath string, opts types.ProcessOptions) (types.ProcessedData, error) {
+	if err := os.Rename(pcapPath, filepath.Join(q.dir, filepath.Base(pcapPath))); err != nil {
+		return types.ProcessedData{}, err
+	}
+	return types.ProcessedData{}, &types.SchemaError{Problems: []string{"conn.log: no #close footer"}, Quarantine: q.dir}
+}
+
+func TestWatcher_Quarantined(t *testing.T) {
+	proc := &quarantineProcessor{dir: t.TempDir()}
+	up := &mockUploader{}
+	w, dir := newTestWatcher(t, proc, up)
+
+	incomingDir := filepath.Join(dir, "incoming")
+	os.MkdirAll(incomingDir, 0755)
+	createTestPCAP(t, incomingDir, "cut.pcap")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- w.Run(ctx)
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+	<-done
+
+	// The file stays in quarantine rather than being moved to failed
+	if _, err := os.Stat(filepath.Join(proc.dir, "cut.pcap")); err != nil {
+		t.Errorf("Expected file in quarantine: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "failed", "cut.pcap")); !os.IsNotExist(err) {
+		t.Errorf("Expected no file in failed dir, got: %v", err)
+	}
+	if up.calls != 0 {
+		t.Errorf("Expected 0 uploader calls for a quarantined file, got %d", up.calls)
+	}
+}
+
 func TestWatcher_IgnoresNonPCAP(t *testing.T) {
 	proc := &mockProcessor{}
 	up := &mockUploader{}
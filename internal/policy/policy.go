@@ -0,0 +1,98 @@
+// Package policy defines the entries of the zeek.excluded_subnets and
+// zeek.excluded_domains options: how an entry is split into its target and
+// action, and which targets and actions are valid. The processor applies the
+// policies; configuration loading validates them with the same definitions.
+package policy
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Subnet policy actions. Each excluded_subnets entry may carry an action
+// suffix ("10.0.0.0/8=mask"); entries without one default to SubnetDrop,
+// which is the original behavior of the feature.
+const (
+	// SubnetDrop removes every row that references the subnet.
+	SubnetDrop = "drop"
+	// SubnetMask keeps the row but replaces the address with the
+	// unspecified address (0.0.0.0 or ::), so the row still parses as addr.
+	SubnetMask = "mask"
+	// SubnetTruncate keeps the row but replaces the address with its
+	// network address (/24 for IPv4, /64 for IPv6).
+	SubnetTruncate = "truncate-to-prefix"
+)
+
+// SplitSubnet splits an excluded_subnets entry of the form "CIDR[=action]"
+// into its CIDR and lowercase action. The action defaults to SubnetDrop when
+// absent. Neither part is validated here.
+func SplitSubnet(entry string) (cidr, action string) {
+	cidr, action, found := strings.Cut(strings.TrimSpace(entry), "=")
+	cidr = strings.TrimSpace(cidr)
+	action = strings.ToLower(strings.TrimSpace(action))
+	if !found || action == "" {
+		action = SubnetDrop
+	}
+	return cidr, action
+}
+
+// ValidSubnetAction reports whether action is one of the supported policies.
+func ValidSubnetAction(action string) bool {
+	switch action {
+	case SubnetDrop, SubnetMask, SubnetTruncate:
+		return true
+	}
+	return false
+}
+
+// Domain rule actions. Each excluded_domains entry may carry an action suffix
+// ("*.hr.corp=redact"); entries without one default to DomainDrop.
+const (
+	// DomainDrop removes every row that names a matching domain.
+	DomainDrop = "drop"
+	// DomainRedact keeps the row but replaces the matching name with a
+	// redaction marker. A redacted dns.log query also has its whole answers
+	// set redacted, since the answers reveal where the sensitive name
+	// resolves.
+	DomainRedact = "redact"
+)
+
+// domainPattern restricts excluded_domains patterns to DNS name characters
+// plus the path.Match wildcards: *, ? and bracket classes such as [0-9] or
+// [^a-c]. Backslash escapes are not accepted.
+var domainPattern = regexp.MustCompile(`^([a-z0-9_*?-]|\[\^?[a-z0-9_-]+\])+(\.([a-z0-9_*?-]|\[\^?[a-z0-9_-]+\])+)*$`)
+
+// SplitDomain splits an excluded_domains entry of the form "pattern[=action]"
+// into its normalized pattern and lowercase action. The action defaults to
+// DomainDrop when absent. Neither part is validated here.
+func SplitDomain(entry string) (pattern, action string) {
+	pattern, action, found := strings.Cut(strings.TrimSpace(entry), "=")
+	pattern = NormalizeDomain(pattern)
+	action = strings.ToLower(strings.TrimSpace(action))
+	if !found || action == "" {
+		action = DomainDrop
+	}
+	return pattern, action
+}
+
+// NormalizeDomain lowercases a name and strips surrounding space and the
+// trailing root dot, so "WWW.Example.COM." and "www.example.com" compare equal.
+func NormalizeDomain(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
+
+// ValidDomainPattern reports whether a normalized pattern is a DNS name or a
+// path.Match glob over DNS name characters.
+func ValidDomainPattern(pattern string) bool {
+	if !domainPattern.MatchString(pattern) {
+		return false
+	}
+	_, err := path.Match(pattern, "")
+	return err == nil
+}
+
+// ValidDomainAction reports whether action is one of the supported actions.
+func ValidDomainAction(action string) bool {
+	return action == DomainDrop || action == DomainRedact
+}
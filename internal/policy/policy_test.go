@@ -0,0 +1,55 @@
+package policy
+
+import "testing"
+
+func TestSplitSubnet(t *testing.T) {
+	tests := []struct {
+		entry, cidr, action string
+	}{
+		{"10.0.0.0/8", "10.0.0.0/8", SubnetDrop},
+		{" 10.0.0.0/8 = Mask ", "10.0.0.0/8", SubnetMask},
+		{"fd00::/8=truncate-to-prefix", "fd00::/8", SubnetTruncate},
+		{"10.0.0.0/8=", "10.0.0.0/8", SubnetDrop},
+	}
+	for _, tt := range tests {
+		cidr, action := SplitSubnet(tt.entry)
+		if cidr != tt.cidr || action != tt.action {
+			t.Errorf("SplitSubnet(%q) = (%q, %q), want (%q, %q)", tt.entry, cidr, action, tt.cidr, tt.action)
+		}
+	}
+	for action, want := range map[string]bool{SubnetDrop: true, SubnetMask: true, SubnetTruncate: true, "redact": false, "": false} {
+		if ValidSubnetAction(action) != want {
+			t.Errorf("ValidSubnetAction(%q) = %v", action, !want)
+		}
+	}
+}
+
+func TestSplitDomain(t *testing.T) {
+	pattern, action := SplitDomain(" WWW.Example.COM. = Redact ")
+	if pattern != "www.example.com" || action != DomainRedact {
+		t.Errorf("SplitDomain = (%q, %q)", pattern, action)
+	}
+	if _, action := SplitDomain("hr.corp"); action != DomainDrop {
+		t.Errorf("default action = %q, want %q", action, DomainDrop)
+	}
+}
+
+func TestValidDomainPattern(t *testing.T) {
+	for pattern, want := range map[string]bool{
+		"hr.corp":         true,
+		"*.hr.corp":       true,
+		"portal?.hr.corp": true,
+		"db[0-9].corp":    true,
+		"db[^a-c].corp":   true,
+		"db[0-9.corp":     false,
+		"db[].corp":       false,
+		`db\*.corp`:       false,
+		"hr..corp":        false,
+		"hr corp":         false,
+		"":                false,
+	} {
+		if got := ValidDomainPattern(pattern); got != want {
+			t.Errorf("ValidDomainPattern(%q) = %v, want %v", pattern, got, want)
+		}
+	}
+}
@@ -0,0 +1,420 @@
+package types
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AssetsLogFile is the log of asset inventory changes a run writes beside the
+// Zeek logs when asset uploads are enabled. It is encoded and uploaded with
+// them but, being derived from them, is not filtered or enriched.
+const AssetsLogFile = "assets.log"
+
+// OutputLogFiles returns the logs EncodeZeekLogs should encode for upload:
+// ZeekLogFiles plus the logs derived from them, which are only present when
+// their features are enabled and produced something.
+func OutputLogFiles() []string {
+	return append(append([]string(nil), ZeekLogFiles...), AssetsLogFile, DeviceEventsLogFile, BeaconsLogFile, DNSAnomaliesLogFile, EncryptedDNSLogFile, SummaryLogFile)
+}
+
+// Asset is one local device in the asset inventory, keyed by MAC address.
+// IPs and Hostnames are most recent first.
+type Asset struct {
+	MAC             string   `json:"mac"`
+	Vendor          string   `json:"vendor,omitempty"`
+	IPs             []string `json:"ips,omitempty"`
+	Hostnames       []string `json:"hostnames,omitempty"`
+	DHCPFingerprint string   `json:"dhcp_fingerprint,omitempty"`
+	// DHCPHostname is the name the device last announced in DHCP, as
+	// opposed to the names DNS gives its addresses.
+	DHCPHostname string `json:"dhcp_hostname,omitempty"`
+	// DHCPVendorClass is the vendor class (DHCP option 60) the device last
+	// announced, such as "MSFT 5.0" or "android-dhcp-13". Vendor is looked
+	// up from the MAC address; this is what the device says it is.
+	DHCPVendorClass string    `json:"dhcp_vendor_class,omitempty"`
+	FirstSeen       time.Time `json:"first_seen"`
+	LastSeen        time.Time `json:"last_seen"`
+}
+
+// Sources of an AssetObservation.
+const (
+	AssetSourceDHCP = "dhcp"
+	AssetSourceDNS  = "dns"
+	AssetSourceConn = "conn"
+)
+
+// AssetObservation is one fact about a local device taken from a run's logs.
+// MAC is empty when only the address is known (DNS names and conn activity),
+// in which case the inventory attributes it to the device last seen holding
+// IP.
+type AssetObservation struct {
+	Time            time.Time
+	Source          string // AssetSourceDHCP, AssetSourceDNS or AssetSourceConn
+	MAC             string
+	IP              string
+	Hostname        string
+	DHCPFingerprint string
+	DHCPVendorClass string
+	Vendor          string
+}
+
+// AssetRecorder is a persistent asset inventory (see the assets package).
+type AssetRecorder interface {
+	// RecordAssets merges a run's observations and returns the assets that
+	// are new or whose addresses, names, fingerprint, vendor class or vendor
+	// changed, and
+	// the device events those changes raise. Assets that were only seen
+	// again are updated but not returned.
+	RecordAssets(obs []AssetObservation) ([]Asset, []DeviceEvent, error)
+}
+
+// UpdateAssetInventory folds the DHCP, DNS and conn observations of the logs
+// in runDir into opts.Assets. When opts.UploadAssets is set it writes the
+// changed assets to AssetsLogFile, and when opts.DeviceEvents is set the
+// device events to DeviceEventsLogFile, each only if there are any. It runs
+// after FilterLogs so excluded and masked addresses never reach the
+// inventory, and does nothing when opts.Assets is nil.
+func UpdateAssetInventory(runDir string, opts ProcessOptions) error {
+	if opts.Assets == nil {
+		return nil
+	}
+	obs, err := CollectAssetObservations(runDir, opts.MonitoredSubnets, opts.MemoryLimit)
+	if err != nil {
+		return err
+	}
+	changed, events, err := opts.Assets.RecordAssets(obs)
+	if err != nil {
+		return fmt.Errorf("record assets: %w", err)
+	}
+	log.Printf("[processor] Asset inventory: %d observations, %d assets new or changed, %d device events", len(obs), len(changed), len(events))
+	if opts.UploadAssets && len(changed) > 0 {
+		if err := WriteAssetsLog(filepath.Join(runDir, AssetsLogFile), changed); err != nil {
+			return err
+		}
+	}
+	if opts.DeviceEvents && len(events) > 0 {
+		for _, e := range events {
+			log.Printf("[processor] Device event: %s", e)
+		}
+		if err := WriteDeviceEventsLog(filepath.Join(runDir, DeviceEventsLogFile), events); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assetLocal reports whether a is a local device address the inventory
+// should track: private, link-local or inside a monitored subnet. Masked and
+// other unspecified addresses are not.
+func assetLocal(a netip.Addr, monitored []*net.IPNet) bool {
+	a = a.Unmap()
+	if !a.IsValid() || a.IsUnspecified() || a.IsLoopback() || a.IsMulticast() {
+		return false
+	}
+	if a.IsPrivate() || a.IsLinkLocalUnicast() {
+		return true
+	}
+	for _, n := range monitored {
+		if n.Contains(a.AsSlice()) {
+			return true
+		}
+	}
+	return false
+}
+
+// assetCollector aggregates observations per distinct fact, keeping the
+// latest time, so memory grows with the number of local devices rather than
+// with the size of the logs.
+type assetCollector struct {
+	monitored []*net.IPNet
+	obs       map[AssetObservation]time.Time
+}
+
+func (c *assetCollector) add(ts time.Time, o AssetObservation) {
+	if t, ok := c.obs[o]; !ok || ts.After(t) {
+		c.obs[o] = ts
+	}
+}
+
+// localIP returns the normalized form of value when it is a local address.
+func (c *assetCollector) localIP(value string) (string, bool) {
+	if zeekUnsetMarkers[value] {
+		return "", false
+	}
+	a, err := netip.ParseAddr(value)
+	if err != nil || !assetLocal(a, c.monitored) {
+		return "", false
+	}
+	return a.Unmap().String(), true
+}
+
+// CollectAssetObservations reads the asset facts in the logs of runDir:
+// MAC, address, host name, fingerprint, vendor class and vendor bindings
+// from dhcp.log,
+// names of local addresses from dns.log (A/AAAA answers and PTR lookups),
+// and activity of local addresses from conn.log. Only local addresses are
+// kept (see assetLocal); monitoredSubnets count as local. limit is the worker
+// memory budget in bytes (0 = DefaultMemoryLimit).
+func CollectAssetObservations(runDir string, monitoredSubnets []string, limit int64) ([]AssetObservation, error) {
+	c := &assetCollector{monitored: parseMonitoredSubnets(monitoredSubnets), obs: make(map[AssetObservation]time.Time)}
+	for name, build := range map[string]func(h *logHeader) func([]string){
+		"dhcp.log": c.dhcpRows,
+		"dns.log":  c.dnsRows,
+		"conn.log": c.connRows,
+	} {
+		if _, err := scanLog(filepath.Join(runDir, name), limit, build); err != nil {
+			return nil, fmt.Errorf("assets %s: %w", name, err)
+		}
+	}
+	out := make([]AssetObservation, 0, len(c.obs))
+	for o, ts := range c.obs {
+		o.Time = ts
+		out = append(out, o)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+	return out, nil
+}
+
+func (c *assetCollector) dhcpRows(h *logHeader) func([]string) {
+	tsIdx, macIdx := h.index("ts"), h.index("mac")
+	if macIdx < 0 {
+		return nil
+	}
+	addrIdx := []int{h.index("assigned_addr"), h.index("client_addr"), h.index("requested_addr")}
+	nameIdx := []int{h.index("host_name"), h.index("client_fqdn")}
+	fpIdx, vendorIdx := h.index("param_req_list"), h.index("mac_vendor")
+	// Zeek logs the vendor class option as client_software.
+	classIdx := h.index("client_software")
+	return func(cols []string) {
+		hw, err := net.ParseMAC(column(cols, macIdx))
+		if err != nil {
+			return
+		}
+		o := AssetObservation{Source: AssetSourceDHCP, MAC: hw.String()}
+		for _, i := range addrIdx {
+			if ip, ok := c.localIP(column(cols, i)); ok {
+				o.IP = ip
+				break
+			}
+		}
+		for _, i := range nameIdx {
+			if name := hostName(column(cols, i)); name != "" {
+				o.Hostname = name
+				break
+			}
+		}
+		if fp := column(cols, fpIdx); !zeekUnsetMarkers[fp] {
+			o.DHCPFingerprint = strings.ReplaceAll(fp, h.setSep, ",")
+		}
+		if class := column(cols, classIdx); !zeekUnsetMarkers[class] {
+			o.DHCPVendorClass = class
+		}
+		if v := column(cols, vendorIdx); !zeekUnsetMarkers[v] && !strings.HasPrefix(v, "(") {
+			o.Vendor = v
+		}
+		c.add(zeekTime(column(cols, tsIdx)), o)
+	}
+}
+
+func (c *assetCollector) dnsRows(h *logHeader) func([]string) {
+	tsIdx, queryIdx, typeIdx, answersIdx := h.index("ts"), h.index("query"), h.index("qtype_name"), h.index("answers")
+	if queryIdx < 0 || typeIdx < 0 || answersIdx < 0 {
+		return nil
+	}
+	return func(cols []string) {
+		answers := column(cols, answersIdx)
+		if zeekUnsetMarkers[answers] {
+			return
+		}
+		ts := zeekTime(column(cols, tsIdx))
+		query := column(cols, queryIdx)
+		switch column(cols, typeIdx) {
+		case "A", "AAAA":
+			name := hostName(query)
+			if name == "" {
+				return
+			}
+			for _, ans := range strings.Split(answers, h.setSep) {
+				if ip, ok := c.localIP(ans); ok {
+					c.add(ts, AssetObservation{Source: AssetSourceDNS, IP: ip, Hostname: name})
+				}
+			}
+		case "PTR":
+			ip, ok := c.localIP(reverseName(query))
+			if !ok {
+				return
+			}
+			for _, ans := range strings.Split(answers, h.setSep) {
+				if name := hostName(ans); name != "" {
+					c.add(ts, AssetObservation{Source: AssetSourceDNS, IP: ip, Hostname: name})
+				}
+			}
+		}
+	}
+}
+
+// connRows records activity only: link-layer addresses in conn.log are those
+// of the last hop, which for routed traffic is the router, so they are not
+// bound to the endpoint addresses.
+func (c *assetCollector) connRows(h *logHeader) func([]string) {
+	tsIdx, origIdx, respIdx := h.index("ts"), h.index("id.orig_h"), h.index("id.resp_h")
+	if origIdx < 0 && respIdx < 0 {
+		return nil
+	}
+	return func(cols []string) {
+		ts := zeekTime(column(cols, tsIdx))
+		for _, i := range []int{origIdx, respIdx} {
+			if ip, ok := c.localIP(column(cols, i)); ok {
+				c.add(ts, AssetObservation{Source: AssetSourceConn, IP: ip})
+			}
+		}
+	}
+}
+
+// column returns cols[i], or "-" when the column is absent.
+func column(cols []string, i int) string {
+	if i < 0 || i >= len(cols) {
+		return "-"
+	}
+	return cols[i]
+}
+
+// zeekTime parses a Zeek time column (epoch seconds), or returns the zero
+// time.
+func zeekTime(value string) time.Time {
+	secs, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(secs*float64(time.Second))).UTC()
+}
+
+// hostName normalizes a DNS or DHCP host name, or returns "" for an unset or
+// unusable one.
+func hostName(value string) string {
+	if zeekUnsetMarkers[value] {
+		return ""
+	}
+	name := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(value), "."))
+	if name == "" || strings.ContainsAny(name, " \t/\\") || strings.HasSuffix(name, ".arpa") {
+		return ""
+	}
+	return name
+}
+
+// reverseName returns the address a PTR query name (in-addr.arpa or
+// ip6.arpa) looks up, or "" when it is not a complete reverse name.
+func reverseName(query string) string {
+	q := strings.ToLower(strings.TrimSuffix(query, "."))
+	if rest, ok := strings.CutSuffix(q, ".in-addr.arpa"); ok {
+		labels := strings.Split(rest, ".")
+		if len(labels) != 4 {
+			return ""
+		}
+		for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+			labels[i], labels[j] = labels[j], labels[i]
+		}
+		return strings.Join(labels, ".")
+	}
+	if rest, ok := strings.CutSuffix(q, ".ip6.arpa"); ok {
+		nibbles := strings.Split(rest, ".")
+		if len(nibbles) != 32 {
+			return ""
+		}
+		var b strings.Builder
+		for i := len(nibbles) - 1; i >= 0; i-- {
+			b.WriteString(nibbles[i])
+			if i%4 == 0 && i > 0 {
+				b.WriteByte(':')
+			}
+		}
+		return b.String()
+	}
+	return ""
+}
+
+// assetsLogFields are the columns of AssetsLogFile.
+var assetsLogFields = []struct{ name, typ string }{
+	{"ts", "time"},
+	{"mac", "string"},
+	{"vendor", "string"},
+	{"ips", "vector[addr]"},
+	{"hostnames", "vector[string]"},
+	{"dhcp_fingerprint", "string"},
+	{"dhcp_vendor_class", "string"},
+	{"first_seen", "time"},
+	{"last_seen", "time"},
+}
+
+// WriteAssetsLog writes assets as a Zeek TSV log at path, so it is encoded
+// and uploaded like the Zeek logs.
+func WriteAssetsLog(path string, assets []Asset) error {
+	var b strings.Builder
+	writeZeekHeader(&b, "assets", assetsLogFields)
+	now := zeekTimeString(time.Now())
+	for _, a := range assets {
+		row := []string{
+			now,
+			escapeZeekValue(a.MAC, "\t"),
+			zeekString(a.Vendor),
+			zeekVector(a.IPs),
+			zeekVector(a.Hostnames),
+			zeekString(a.DHCPFingerprint),
+			zeekString(a.DHCPVendorClass),
+			zeekTimeString(a.FirstSeen),
+			zeekTimeString(a.LastSeen),
+		}
+		b.WriteString(strings.Join(row, "\t") + "\n")
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// writeZeekHeader writes the header of a tab-separated Zeek log with the
+// given #path and columns.
+func writeZeekHeader(b *strings.Builder, path string, fields []struct{ name, typ string }) {
+	names := make([]string, len(fields))
+	typs := make([]string, len(fields))
+	for i, f := range fields {
+		names[i], typs[i] = f.name, f.typ
+	}
+	b.WriteString("#separator \\x09\n#set_separator\t,\n#empty_field\t(empty)\n#unset_field\t-\n")
+	b.WriteString("#path\t" + path + "\n")
+	b.WriteString("#fields\t" + strings.Join(names, "\t") + "\n")
+	b.WriteString("#types\t" + strings.Join(typs, "\t") + "\n")
+}
+
+func zeekString(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return escapeZeekValue(s, "\t")
+}
+
+func zeekVector(values []string) string {
+	if len(values) == 0 {
+		return "(empty)"
+	}
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = strings.ReplaceAll(escapeZeekValue(v, "\t"), ",", `\x2c`)
+	}
+	return strings.Join(out, ",")
+}
+
+func zeekTimeString(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return strconv.FormatFloat(float64(t.UnixNano())/float64(time.Second), 'f', 6, 64)
+}
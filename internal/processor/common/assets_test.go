@@ -0,0 +1,168 @@
+package types
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// assetRunDir writes the dhcp.log, dns.log and conn.log assets are
+// collected from to a new run directory.
+func assetRunDir(t *testing.T) string {
+	t.Helper()
+	runDir := t.TempDir()
+	writeLog(t, runDir, "dhcp.log", zeekHeader("dhcp", "ts", "uids", "client_addr", "assigned_addr", "mac", "host_name", "param_req_list", "client_software", "mac_vendor"),
+		row("100.0", "C1", "-", "192.168.1.10", "00:50:56:AA:BB:CC", "VM", "1,3,6", "MSFT 5.0", "VMware, Inc."),
+		row("200.0", "C2", "-", "192.168.1.10", "00:50:56:aa:bb:cc", "vm", "1,3,6", "MSFT 5.0", "VMware, Inc."),
+		row("300.0", "C3", "-", "-", "da:a1:19:12:34:56", "phone", "-", "android-dhcp-13", "(randomized)"),
+		row("400.0", "C4", "0.0.0.0", "-", "-", "nomac", "-", "-", "-"))
+	writeLog(t, runDir, "dns.log", zeekHeader("dns", "ts", "uid", "id.orig_h", "query", "qtype_name", "answers"),
+		row("110.0", "D1", "192.168.1.10", "printer.lan", "A", "192.168.1.50,8.8.8.8"),
+		row("120.0", "D2", "192.168.1.10", "50.1.168.192.in-addr.arpa", "PTR", "Printer.lan."),
+		row("130.0", "D3", "192.168.1.10", "example.com", "A", "93.184.216.34"),
+		row("140.0", "D4", "192.168.1.10", "nx.lan", "A", "-"))
+	writeLog(t, runDir, "conn.log", zeekHeader("conn", "ts", "uid", "id.orig_h", "id.resp_h"),
+		row("150.0", "C1", "192.168.1.10", "93.184.216.34"),
+		row("500.0", "C2", "192.168.1.10", "100.64.0.1"),
+		row("160.0", "C3", "0.0.0.0", "10.0.0.1"))
+	return runDir
+}
+
+func TestCollectAssetObservations(t *testing.T) {
+	obs, err := CollectAssetObservations(assetRunDir(t), []string{"100.64.0.0/10"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]bool)
+	for _, o := range obs {
+		got[strings.Join([]string{zeekTimeString(o.Time), o.MAC, o.IP, o.Hostname, o.DHCPFingerprint, o.DHCPVendorClass, o.Vendor}, "|")] = true
+	}
+	for _, want := range []string{
+		// Repeated DHCP rows collapse to the latest.
+		"200.000000|00:50:56:aa:bb:cc|192.168.1.10|vm|1,3,6|MSFT 5.0|VMware, Inc.",
+		"300.000000|da:a1:19:12:34:56||phone||android-dhcp-13|",
+		// The A answer and the PTR lookup name the printer alike.
+		"120.000000||192.168.1.50|printer.lan|||",
+		"500.000000||192.168.1.10||||",
+		"500.000000||100.64.0.1||||",
+		"160.000000||10.0.0.1||||",
+	} {
+		if !got[want] {
+			t.Errorf("missing observation %s", want)
+		}
+	}
+	if len(obs) != 6 {
+		t.Errorf("got %d observations, want 6: %v", len(obs), got)
+	}
+	for i := 1; i < len(obs); i++ {
+		if obs[i].Time.Before(obs[i-1].Time) {
+			t.Fatal("observations are not in time order")
+		}
+	}
+}
+
+// fakeRecorder reports every observation with a MAC as a changed asset, and
+// raises events.
+type fakeRecorder struct {
+	obs    []AssetObservation
+	events []DeviceEvent
+}
+
+func (r *fakeRecorder) RecordAssets(obs []AssetObservation) ([]Asset, []DeviceEvent, error) {
+	r.obs = obs
+	var out []Asset
+	for _, o := range obs {
+		if o.MAC != "" {
+			out = append(out, Asset{MAC: o.MAC, Vendor: o.Vendor, IPs: []string{o.IP}, Hostnames: []string{o.Hostname}, DHCPFingerprint: o.DHCPFingerprint, DHCPVendorClass: o.DHCPVendorClass, FirstSeen: o.Time, LastSeen: o.Time})
+		}
+	}
+	return out, r.events, nil
+}
+
+func TestUpdateAssetInventory(t *testing.T) {
+	runDir := assetRunDir(t)
+	rec := &fakeRecorder{}
+	if err := UpdateAssetInventory(runDir, ProcessOptions{Assets: rec}); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.obs) == 0 {
+		t.Fatal("no observations recorded")
+	}
+	if _, err := os.Stat(filepath.Join(runDir, AssetsLogFile)); !os.IsNotExist(err) {
+		t.Error("assets.log written without UploadAssets")
+	}
+
+	if err := UpdateAssetInventory(runDir, ProcessOptions{Assets: rec, UploadAssets: true}); err != nil {
+		t.Fatal(err)
+	}
+	lines := readLines(t, filepath.Join(runDir, AssetsLogFile))
+	if lines[5] != "#fields\tts\tmac\tvendor\tips\thostnames\tdhcp_fingerprint\tdhcp_vendor_class\tfirst_seen\tlast_seen" {
+		t.Errorf("#fields = %q", lines[5])
+	}
+	rows := lines[7:]
+	if len(rows) != 2 {
+		t.Fatalf("rows = %q", rows)
+	}
+	cols := strings.Split(rows[0], "\t")
+	if cols[1] != "00:50:56:aa:bb:cc" || cols[2] != "VMware, Inc." || cols[5] != "1,3,6" || cols[6] != "MSFT 5.0" || cols[7] != "200.000000" {
+		t.Errorf("row = %q", rows[0])
+	}
+
+	if _, err := os.Stat(filepath.Join(runDir, DeviceEventsLogFile)); !os.IsNotExist(err) {
+		t.Error("device_events.log written without events")
+	}
+
+	// The assets log is encoded with the Zeek logs.
+	paths, _, err := EncodeZeekLogs(runDir, OutputLogFiles(), "ndjson", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(paths[AssetsLogFile], "assets.ndjson") {
+		t.Errorf("encoded assets path = %q", paths[AssetsLogFile])
+	}
+}
+
+func TestUpdateAssetInventory_DeviceEvents(t *testing.T) {
+	runDir := assetRunDir(t)
+	rec := &fakeRecorder{events: []DeviceEvent{
+		{Time: zeekTime("200.0"), Kind: DeviceFingerprintChanged, MAC: "00:50:56:aa:bb:cc", IP: "192.168.1.10", Hostname: "vm", Vendor: "VMware, Inc.", DHCPFingerprint: "1,3,6", Old: "1,121", New: "1,3,6"},
+		{Time: zeekTime("300.0"), Kind: DeviceNew, MAC: "da:a1:19:12:34:56"},
+	}}
+	if err := UpdateAssetInventory(runDir, ProcessOptions{Assets: rec}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(runDir, DeviceEventsLogFile)); !os.IsNotExist(err) {
+		t.Error("device_events.log written without DeviceEvents")
+	}
+
+	if err := UpdateAssetInventory(runDir, ProcessOptions{Assets: rec, DeviceEvents: true}); err != nil {
+		t.Fatal(err)
+	}
+	lines := readLines(t, filepath.Join(runDir, DeviceEventsLogFile))
+	want := []string{
+		"#path\tdevice_events",
+		"#fields\tts\tevent\tmac\tip\thostname\tvendor\tdhcp_fingerprint\told_value\tnew_value",
+		"#types\ttime\tstring\tstring\taddr\tstring\tstring\tstring\tstring\tstring",
+		"200.000000\tfingerprint_changed\t00:50:56:aa:bb:cc\t192.168.1.10\tvm\tVMware, Inc.\t1,3,6\t1,121\t1,3,6",
+		"300.000000\tnew_device\tda:a1:19:12:34:56\t-\t-\t-\t-\t-\t-",
+	}
+	if !reflect.DeepEqual(lines[4:], want) {
+		t.Errorf("device_events.log:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestReverseName(t *testing.T) {
+	for query, want := range map[string]string{
+		"50.1.168.192.in-addr.arpa":  "192.168.1.50",
+		"50.1.168.192.in-addr.arpa.": "192.168.1.50",
+		"1.168.192.in-addr.arpa":     "",
+		"b.a.9.8.7.6.5.0.4.0.0.0.3.0.0.0.2.0.0.0.1.0.0.0.0.0.0.0.1.2.3.4.ip6.arpa": "4321:0000:0001:0002:0003:0004:0567:89ab",
+		"example.com": "",
+	} {
+		if got := reverseName(query); got != want {
+			t.Errorf("reverseName(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+// Package beacon detects beaconing: a host connecting to the same service
+// over and over at a regular interval, as malware calling home to its
+// command-and-control server does. A check-in every few minutes is a handful
+// of connections per capture window and indistinguishable from normal traffic
+// within one; the pattern only shows over hours. A Tracker therefore keeps a
+// rolling history of connection times per (originator, responder, port)
+// across windows and scores how periodic each history is.
+//
+// The score combines three measures of the gaps between connections, each in
+// [0, 1]:
+//
+//   - regularity: 1 - MAD/median, where MAD is the median absolute deviation
+//     of the gaps from their median (jitter relative to the interval);
+//   - symmetry: 1 - |Bowley skewness| of the gaps, so a few long pauses in
+//     otherwise regular traffic count against it. Gaps whose interquartile
+//     range is within skewSpread of the median are regular whatever their
+//     shape and count as symmetric;
+//   - fill: connections seen over those expected at the median interval
+//     across the history's span, so a short regular burst in long silence is
+//     not a beacon.
+package beacon
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"math"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Key identifies a connection series.
+type Key struct {
+	Orig, Resp netip.Addr
+	Port       uint16 // responder port
+}
+
+// Config bounds a Tracker.
+type Config struct {
+	// Lookback is how much connection history is kept and scored per pair.
+	Lookback time.Duration
+	// MinConnections is the fewest connections a series needs to be scored.
+	MinConnections int
+	// Threshold is the score at or above which a series is a beacon.
+	Threshold float64
+	// MaxPairs caps the number of series kept; the least recently active are
+	// dropped beyond it.
+	MaxPairs int
+}
+
+// MaxTimestamps caps the connection times kept per series (the most recent
+// are kept), so memory is bounded by MaxPairs x MaxTimestamps x 4 bytes.
+const MaxTimestamps = 256
+
+// burstGap is the gap below which connections are one check-in: a beacon that
+// opens a few connections at once must not look like a 1-second interval.
+const burstGap = 2
+
+// skewSpread is the interquartile range of the gaps, relative to their median,
+// below which their skewness is not scored: within it a few seconds of jitter
+// would swing the skewness between -1 and 1.
+const skewSpread = 0.2
+
+// Beacon is a series that scored as beaconing.
+type Beacon struct {
+	Key
+	Connections int           // check-ins in the history
+	First, Last time.Time     // first and last check-in in the history
+	Interval    time.Duration // median gap between check-ins
+	Jitter      float64       // MAD of the gaps relative to Interval
+	Skew        float64       // Bowley skewness of the gaps
+	Score       float64
+}
+
+// series is the sorted connection times of one Key, in Unix seconds.
+type series []uint32
+
+// Tracker keeps connection histories across capture windows. It is safe for
+// concurrent use. Time is taken from the connections, never the clock, so
+// replaying old captures works: the lookback ends at the latest connection
+// seen.
+type Tracker struct {
+	mu    sync.Mutex
+	cfg   Config
+	pairs map[Key]series
+	first uint32 // earliest connection seen, Unix seconds
+	high  uint32 // latest connection seen, Unix seconds
+}
+
+// New returns an empty Tracker.
+func New(cfg Config) *Tracker {
+	return &Tracker{cfg: cfg, pairs: make(map[Key]series)}
+}
+
+// Len returns the number of series tracked.
+func (t *Tracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.pairs)
+}
+
+// Observe adds a connection of k at ts.
+func (t *Tracker) Observe(k Key, ts time.Time) {
+	if ts.Unix() <= 0 || ts.Unix() > math.MaxUint32 {
+		return
+	}
+	sec := uint32(ts.Unix())
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.first == 0 || sec < t.first {
+		t.first = sec
+	}
+	if sec > t.high {
+		t.high = sec
+	}
+	s, ok := t.pairs[k]
+	if !ok && t.cfg.MaxPairs > 0 && len(t.pairs) >= t.cfg.MaxPairs {
+		t.evict(t.cfg.MaxPairs * 9 / 10)
+	}
+	t.pairs[k] = s.insert(sec)
+}
+
+// insert adds sec in order, merging it into a check-in within burstGap.
+func (s series) insert(sec uint32) series {
+	i := sort.Search(len(s), func(i int) bool { return s[i] >= sec })
+	if (i < len(s) && s[i]-sec < burstGap) || (i > 0 && sec-s[i-1] < burstGap) {
+		return s
+	}
+	s = append(s, 0)
+	copy(s[i+1:], s[i:])
+	s[i] = sec
+	if len(s) > MaxTimestamps {
+		s = s[len(s)-MaxTimestamps:]
+	}
+	return s
+}
+
+// evict drops the least recently active series until n remain. t.mu must
+// be held.
+func (t *Tracker) evict(n int) {
+	if len(t.pairs) <= n {
+		return
+	}
+	keys := make([]Key, 0, len(t.pairs))
+	for k := range t.pairs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return t.pairs[keys[i]][len(t.pairs[keys[i]])-1] < t.pairs[keys[j]][len(t.pairs[keys[j]])-1]
+	})
+	for _, k := range keys[:len(keys)-n] {
+		delete(t.pairs, k)
+	}
+}
+
+// Detect drops history older than the lookback and returns the series among
+// keys (typically those active in the window just observed) that score at or
+// above the threshold, highest score first.
+func (t *Tracker) Detect(keys []Key) []Beacon {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prune()
+	var out []Beacon
+	for _, k := range keys {
+		s := t.pairs[k]
+		if len(s) < t.cfg.MinConnections || len(s) < 3 {
+			continue
+		}
+		b := score(s)
+		b.Key = k
+		if b.Score >= t.cfg.Threshold {
+			out = append(out, b)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Score > out[j].Score })
+	return out
+}
+
+// prune drops connection times older than the lookback. t.mu must be held.
+func (t *Tracker) prune() {
+	if t.cfg.Lookback <= 0 {
+		return
+	}
+	cutoff := int64(t.high) - int64(t.cfg.Lookback/time.Second)
+	if cutoff <= int64(t.first) {
+		return
+	}
+	for k, s := range t.pairs {
+		i := sort.Search(len(s), func(i int) bool { return int64(s[i]) >= cutoff })
+		switch {
+		case i == len(s):
+			delete(t.pairs, k)
+		case i > 0:
+			t.pairs[k] = append(series(nil), s[i:]...)
+		}
+	}
+	t.first = uint32(cutoff)
+}
+
+// score scores a series of at least three check-ins.
+func score(s series) Beacon {
+	gaps := make([]float64, len(s)-1)
+	for i := 1; i < len(s); i++ {
+		gaps[i-1] = float64(s[i] - s[i-1])
+	}
+	sort.Float64s(gaps)
+	median := quantile(gaps, 0.5)
+	dev := make([]float64, len(gaps))
+	for i, g := range gaps {
+		dev[i] = math.Abs(g - median)
+	}
+	sort.Float64s(dev)
+	jitter := quantile(dev, 0.5) / median
+
+	q1, q3 := quantile(gaps, 0.25), quantile(gaps, 0.75)
+	skew := 0.0
+	if q3-q1 > skewSpread*median {
+		skew = (q3 + q1 - 2*median) / (q3 - q1)
+	}
+	span := float64(s[len(s)-1] - s[0])
+	fill := float64(len(s)) / (span/median + 1)
+
+	return Beacon{
+		Connections: len(s),
+		First:       time.Unix(int64(s[0]), 0).UTC(),
+		Last:        time.Unix(int64(s[len(s)-1]), 0).UTC(),
+		Interval:    time.Duration(median * float64(time.Second)),
+		Jitter:      jitter,
+		Skew:        skew,
+		Score:       (clamp(1-jitter) + clamp(1-math.Abs(skew)) + clamp(fill)) / 3,
+	}
+}
+
+// quantile returns the q-quantile of sorted values by linear interpolation.
+func quantile(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	i := int(pos)
+	if i+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[i] + (pos-float64(i))*(sorted[i+1]-sorted[i])
+}
+
+func clamp(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+// snapshot is the gob form of a Tracker's history.
+type snapshot struct {
+	First, High uint32
+	Keys        []Key
+	Series      [][]uint32
+}
+
+// Save writes the tracker's history to w, so it survives a restart.
+func (t *Tracker) Save(w io.Writer) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	snap := snapshot{First: t.first, High: t.high}
+	for k, s := range t.pairs {
+		snap.Keys = append(snap.Keys, k)
+		snap.Series = append(snap.Series, s)
+	}
+	return gob.NewEncoder(w).Encode(&snap)
+}
+
+// Load replaces the tracker's history with one written by Save.
+func (t *Tracker) Load(r io.Reader) error {
+	var snap snapshot
+	if err := gob.NewDecoder(r).Decode(&snap); err != nil {
+		return fmt.Errorf("beacon history: %w", err)
+	}
+	if len(snap.Keys) != len(snap.Series) {
+		return fmt.Errorf("beacon history: %d keys for %d series", len(snap.Keys), len(snap.Series))
+	}
+	pairs := make(map[Key]series, len(snap.Keys))
+	for i, k := range snap.Keys {
+		s := series(snap.Series[i])
+		if len(s) == 0 || len(s) > MaxTimestamps || !sort.SliceIsSorted(s, func(a, b int) bool { return s[a] < s[b] }) {
+			return fmt.Errorf("beacon history: invalid series for %v", k)
+		}
+		pairs[k] = s
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.first, t.high, t.pairs = snap.First, snap.High, pairs
+	if t.cfg.MaxPairs > 0 {
+		t.evict(t.cfg.MaxPairs)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package beacon
+
+import (
+	"bytes"
+	"math/rand"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+var (
+	start = time.Unix(1_700_000_000, 0).UTC()
+	key   = Key{Orig: netip.MustParseAddr("192.168.1.10"), Resp: netip.MustParseAddr("203.0.113.7"), Port: 443}
+	cfg   = Config{Lookback: 24 * time.Hour, MinConnections: 10, Threshold: 0.8, MaxPairs: 1000}
+)
+
+// observe adds a connection of k after each offset from start.
+func observe(tr *Tracker, k Key, offsets []time.Duration) {
+	for _, off := range offsets {
+		tr.Observe(k, start.Add(off))
+	}
+}
+
+// every returns n offsets interval apart, each shifted by jitter[i%len(jitter)].
+func every(n int, interval time.Duration, jitter ...time.Duration) []time.Duration {
+	out := make([]time.Duration, n)
+	for i := range out {
+		out[i] = time.Duration(i) * interval
+		if len(jitter) > 0 {
+			out[i] += jitter[i%len(jitter)]
+		}
+	}
+	return out
+}
+
+func TestDetect_Periodic(t *testing.T) {
+	tr := New(cfg)
+	observe(tr, key, every(40, time.Minute, 0, 3*time.Second, -2*time.Second, 5*time.Second, -4*time.Second))
+	beacons := tr.Detect([]Key{key})
+	if len(beacons) != 1 {
+		t.Fatalf("got %d beacons, want 1", len(beacons))
+	}
+	b := beacons[0]
+	if b.Key != key || b.Connections != 40 || b.Score < 0.8 {
+		t.Errorf("beacon = %+v", b)
+	}
+	if b.Interval < 55*time.Second || b.Interval > 65*time.Second {
+		t.Errorf("interval = %v, want about 1m", b.Interval)
+	}
+	if !b.First.Equal(start) || !b.Last.Equal(start.Add(39*time.Minute-4*time.Second)) {
+		t.Errorf("first/last = %v/%v", b.First, b.Last)
+	}
+}
+
+func TestDetect_NotPeriodic(t *testing.T) {
+	tr := New(cfg)
+	// Exponentially distributed gaps, as for connections made on demand.
+	rng := rand.New(rand.NewSource(1))
+	var random []time.Duration
+	var at time.Duration
+	for i := 0; i < 60; i++ {
+		at += time.Duration(rng.ExpFloat64() * float64(5*time.Minute))
+		random = append(random, at)
+	}
+	observe(tr, key, random)
+
+	// A regular burst followed by hours of silence and another burst.
+	burst := Key{Orig: key.Orig, Resp: key.Resp, Port: 8443}
+	observe(tr, burst, every(15, time.Minute))
+	observe(tr, burst, every(15, time.Minute, 6*time.Hour))
+
+	// Too few connections to tell.
+	few := Key{Orig: key.Orig, Resp: key.Resp, Port: 22}
+	observe(tr, few, every(5, time.Minute))
+
+	if beacons := tr.Detect([]Key{key, burst, few}); len(beacons) != 0 {
+		t.Errorf("got beacons %+v", beacons)
+	}
+}
+
+func TestDetect_OnlyKeys(t *testing.T) {
+	tr := New(cfg)
+	observe(tr, key, every(20, time.Minute))
+	if beacons := tr.Detect(nil); len(beacons) != 0 {
+		t.Errorf("got beacons %+v for no keys", beacons)
+	}
+}
+
+func TestObserve_MergesBursts(t *testing.T) {
+	tr := New(cfg)
+	for _, off := range every(20, time.Minute) {
+		// Each check-in opens three connections at once, in any order.
+		observe(tr, key, []time.Duration{off + time.Second, off, off + 500*time.Millisecond})
+	}
+	if got := len(tr.pairs[key]); got != 20 {
+		t.Errorf("series has %d check-ins, want 20", got)
+	}
+	if beacons := tr.Detect([]Key{key}); len(beacons) != 1 {
+		t.Errorf("got %d beacons, want 1", len(beacons))
+	}
+}
+
+func TestObserve_CapsSeries(t *testing.T) {
+	tr := New(cfg)
+	observe(tr, key, every(MaxTimestamps+10, time.Minute))
+	s := tr.pairs[key]
+	if len(s) != MaxTimestamps || int64(s[0]) != start.Add(10*time.Minute).Unix() {
+		t.Errorf("series has %d check-ins from %d", len(s), s[0])
+	}
+}
+
+func TestDetect_Lookback(t *testing.T) {
+	tr := New(Config{Lookback: time.Hour, MinConnections: 10, Threshold: 0.8, MaxPairs: 1000})
+	observe(tr, key, every(30, time.Minute))
+	other := Key{Orig: key.Orig, Resp: key.Resp, Port: 80}
+	observe(tr, other, []time.Duration{0})
+	// Time moves with the traffic, not the clock.
+	observe(tr, Key{Orig: key.Orig, Resp: key.Resp, Port: 53}, []time.Duration{90 * time.Minute})
+	tr.Detect(nil)
+	if _, ok := tr.pairs[other]; ok {
+		t.Error("pair older than the lookback was kept")
+	}
+	if s := tr.pairs[key]; len(s) != 0 && int64(s[0]) < start.Add(30*time.Minute).Unix() {
+		t.Errorf("history older than the lookback was kept: %v", s)
+	}
+}
+
+func TestObserve_MaxPairs(t *testing.T) {
+	tr := New(Config{Lookback: 24 * time.Hour, MinConnections: 10, Threshold: 0.8, MaxPairs: 100})
+	for i := 0; i < 150; i++ {
+		k := Key{Orig: key.Orig, Resp: key.Resp, Port: uint16(i)}
+		tr.Observe(k, start.Add(time.Duration(i)*time.Second*2))
+	}
+	if n := tr.Len(); n > 100 {
+		t.Fatalf("tracking %d pairs, want at most 100", n)
+	}
+	// The most recently active pairs are the ones kept.
+	if _, ok := tr.pairs[Key{Orig: key.Orig, Resp: key.Resp, Port: 149}]; !ok {
+		t.Error("most recent pair was evicted")
+	}
+	if _, ok := tr.pairs[Key{Orig: key.Orig, Resp: key.Resp, Port: 0}]; ok {
+		t.Error("oldest pair was kept")
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	tr := New(cfg)
+	observe(tr, key, every(20, time.Minute))
+	var buf bytes.Buffer
+	if err := tr.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := New(cfg)
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != 1 || len(loaded.pairs[key]) != 20 {
+		t.Fatalf("loaded %d pairs", loaded.Len())
+	}
+	if beacons := loaded.Detect([]Key{key}); len(beacons) != 1 {
+		t.Errorf("got %d beacons after reload, want 1", len(beacons))
+	}
+
+	if err := New(cfg).Load(bytes.NewReader([]byte("not a history"))); err == nil {
+		t.Error("expected an error loading garbage")
+	}
+}
@@ -0,0 +1,121 @@
+package types
+
+import (
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"EnigmaNetz/Enigma-Go-Sensor/internal/processor/common/beacon"
+)
+
+// BeaconsLogFile is the log of beaconing connection pairs a run writes beside
+// the Zeek logs when beacon detection is enabled, with the interval, jitter
+// and score of each pair's history across windows.
+const BeaconsLogFile = "beacons.log"
+
+// DetectBeacons adds the connections of runDir's conn.log to opts.Beacons and
+// writes the pairs active in this run whose history now scores as beaconing
+// to BeaconsLogFile, if there are any. It returns the number of beacons. It
+// runs after FilterLogs so excluded traffic is never tracked, and does
+// nothing when opts.Beacons is nil.
+func DetectBeacons(runDir string, opts ProcessOptions) (int, error) {
+	if opts.Beacons == nil {
+		return 0, nil
+	}
+	active := make(map[beacon.Key]struct{})
+	present, err := scanLog(filepath.Join(runDir, "conn.log"), opts.MemoryLimit, func(h *logHeader) func([]string) {
+		tsIdx, origIdx, respIdx, portIdx := h.index("ts"), h.index("id.orig_h"), h.index("id.resp_h"), h.index("id.resp_p")
+		if tsIdx < 0 || origIdx < 0 || respIdx < 0 || portIdx < 0 {
+			return nil
+		}
+		return func(cols []string) {
+			k, ok := beaconKey(column(cols, origIdx), column(cols, respIdx), column(cols, portIdx))
+			ts := zeekTime(column(cols, tsIdx))
+			if !ok || ts.IsZero() {
+				return
+			}
+			opts.Beacons.Observe(k, ts)
+			active[k] = struct{}{}
+		}
+	})
+	if err != nil || !present {
+		return 0, err
+	}
+	keys := make([]beacon.Key, 0, len(active))
+	for k := range active {
+		keys = append(keys, k)
+	}
+	beacons := opts.Beacons.Detect(keys)
+	log.Printf("[processor] Beacon detection: %d pairs active, %d tracked, %d beaconing", len(keys), opts.Beacons.Len(), len(beacons))
+	if len(beacons) == 0 {
+		return 0, nil
+	}
+	if err := WriteBeaconsLog(filepath.Join(runDir, BeaconsLogFile), beacons); err != nil {
+		return 0, err
+	}
+	return len(beacons), nil
+}
+
+// beaconKey builds the key of a conn.log row; masked (unspecified) addresses
+// have no key.
+func beaconKey(orig, resp, port string) (beacon.Key, bool) {
+	o, err := netip.ParseAddr(orig)
+	if err != nil || o.IsUnspecified() {
+		return beacon.Key{}, false
+	}
+	r, err := netip.ParseAddr(resp)
+	if err != nil || r.IsUnspecified() {
+		return beacon.Key{}, false
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return beacon.Key{}, false
+	}
+	return beacon.Key{Orig: o.Unmap(), Resp: r.Unmap(), Port: uint16(p)}, true
+}
+
+// beaconsLogFields are the columns of BeaconsLogFile.
+var beaconsLogFields = []struct{ name, typ string }{
+	{"ts", "time"},
+	{"orig_h", "addr"},
+	{"resp_h", "addr"},
+	{"resp_p", "port"},
+	{"connections", "count"},
+	{"first_seen", "time"},
+	{"last_seen", "time"},
+	{"interval", "interval"},
+	{"jitter", "double"},
+	{"skew", "double"},
+	{"score", "double"},
+}
+
+// WriteBeaconsLog writes beacons as a Zeek TSV log at path. ts is the last
+// connection of each beacon.
+func WriteBeaconsLog(path string, beacons []beacon.Beacon) error {
+	var b strings.Builder
+	writeZeekHeader(&b, "beacons", beaconsLogFields)
+	for _, bc := range beacons {
+		row := []string{
+			zeekTimeString(bc.Last),
+			bc.Orig.String(),
+			bc.Resp.String(),
+			strconv.Itoa(int(bc.Port)),
+			strconv.Itoa(bc.Connections),
+			zeekTimeString(bc.First),
+			zeekTimeString(bc.Last),
+			strconv.FormatFloat(bc.Interval.Seconds(), 'f', 6, 64),
+			strconv.FormatFloat(bc.Jitter, 'f', 4, 64),
+			strconv.FormatFloat(bc.Skew, 'f', 4, 64),
+			strconv.FormatFloat(bc.Score, 'f', 4, 64),
+		}
+		b.WriteString(strings.Join(row, "\t") + "\n")
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
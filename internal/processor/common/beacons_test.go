@@ -0,0 +1,85 @@
+package types
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"EnigmaNetz/Enigma-Go-Sensor/internal/processor/common/beacon"
+)
+
+// beaconConnLog returns a conn.log with a check-in every 5 minutes from
+// 192.168.1.10 to 203.0.113.7:443 starting at start, interleaved with one-off
+// connections and masked rows.
+func beaconConnLog(start float64, checkIns int) string {
+	var b strings.Builder
+	b.WriteString("#separator \\x09\n#path\tconn\n#fields\tts\tuid\tid.orig_h\tid.orig_p\tid.resp_h\tid.resp_p\tproto\n#types\ttime\tstring\taddr\tport\taddr\tport\tenum\n")
+	for i := 0; i < checkIns; i++ {
+		ts := start + float64(i*300)
+		fmt.Fprintf(&b, "%.6f\tC%d\t192.168.1.10\t%d\t203.0.113.7\t443\ttcp\n", ts, i, 50000+i)
+		fmt.Fprintf(&b, "%.6f\tD%d\t192.168.1.20\t%d\t198.51.100.%d\t80\ttcp\n", ts+17, i, 40000+i, i)
+		fmt.Fprintf(&b, "%.6f\tM%d\t0.0.0.0\t%d\t203.0.113.7\t443\ttcp\n", ts+30, i, 30000+i)
+	}
+	return b.String()
+}
+
+func TestDetectBeacons(t *testing.T) {
+	tracker := beacon.New(beacon.Config{Lookback: 24 * time.Hour, MinConnections: 10, Threshold: 0.8, MaxPairs: 1000})
+	opts := ProcessOptions{Beacons: tracker}
+
+	// Six check-ins per window: too few to score in the first, a beacon once
+	// the second adds to the history.
+	runDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(runDir, "conn.log"), []byte(beaconConnLog(1_700_000_000, 6)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := DetectBeacons(runDir, opts); err != nil || n != 0 {
+		t.Fatalf("first window: %d beacons, err %v", n, err)
+	}
+	if _, err := os.Stat(filepath.Join(runDir, BeaconsLogFile)); !os.IsNotExist(err) {
+		t.Error("beacons.log written without beacons")
+	}
+
+	runDir = t.TempDir()
+	if err := os.WriteFile(filepath.Join(runDir, "conn.log"), []byte(beaconConnLog(1_700_001_800, 6)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	n, err := DetectBeacons(runDir, opts)
+	if err != nil || n != 1 {
+		t.Fatalf("second window: %d beacons, err %v", n, err)
+	}
+	lines := readLines(t, filepath.Join(runDir, BeaconsLogFile))
+	if lines[5] != "#fields\tts\torig_h\tresp_h\tresp_p\tconnections\tfirst_seen\tlast_seen\tinterval\tjitter\tskew\tscore" {
+		t.Errorf("#fields = %q", lines[5])
+	}
+	cols := strings.Split(lines[7], "\t")
+	want := []string{"1700003300.000000", "192.168.1.10", "203.0.113.7", "443", "12", "1700000000.000000", "1700003300.000000", "300.000000", "0.0000", "0.0000", "1.0000"}
+	if strings.Join(cols, "|") != strings.Join(want, "|") {
+		t.Errorf("row = %q, want %q", cols, want)
+	}
+
+	// The beacons log is encoded with the Zeek logs.
+	paths, _, err := EncodeZeekLogs(runDir, OutputLogFiles(), "ndjson", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(paths[BeaconsLogFile], "beacons.ndjson") {
+		t.Errorf("encoded beacons path = %q", paths[BeaconsLogFile])
+	}
+}
+
+func TestDetectBeacons_Disabled(t *testing.T) {
+	runDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(runDir, "conn.log"), []byte(beaconConnLog(1_700_000_000, 20)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := DetectBeacons(runDir, ProcessOptions{}); err != nil || n != 0 {
+		t.Fatalf("%d beacons, err %v", n, err)
+	}
+	if _, err := os.Stat(filepath.Join(runDir, BeaconsLogFile)); !os.IsNotExist(err) {
+		t.Error("beacons.log written without a tracker")
+	}
+}
@@ -0,0 +1,192 @@
+package types
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net/netip"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// communityIDField is the column AddCommunityID appends to every log that
+// carries a Zeek conn_id (id.orig_h, id.orig_p, id.resp_h, id.resp_p).
+const communityIDField = "community_id"
+
+// IP protocol numbers Community ID hashes with ports.
+const (
+	protoICMP   = 1
+	protoTCP    = 6
+	protoUDP    = 17
+	protoICMP6  = 58
+	protoSCTP   = 132
+	communityV1 = "1:"
+)
+
+// ICMP message types that form a request/response pair. Community ID treats
+// these as bidirectional, using the counterpart type as the "destination
+// port"; any other type is one-way and uses its code.
+var (
+	icmp4Counterparts = map[uint16]uint16{
+		8: 0, 0: 8, // echo
+		13: 14, 14: 13, // timestamp
+		15: 16, 16: 15, // information
+		10: 9, 9: 10, // router solicitation/advertisement
+		17: 18, 18: 17, // address mask
+	}
+	icmp6Counterparts = map[uint16]uint16{
+		128: 129, 129: 128, // echo
+		130: 131, 131: 130, // multicast listener query/report
+		133: 134, 134: 133, // router solicitation/advertisement
+		135: 136, 136: 135, // neighbor solicitation/advertisement
+		139: 140, 140: 139, // node information query/response
+		144: 145, 145: 144, // home agent address discovery
+	}
+)
+
+// CommunityID returns the Community ID v1 flow hash ("1:" + base64 SHA-1) of
+// a flow, as computed by Suricata, Zeek's community-id package and most EDRs
+// for the same seed. For ICMP and ICMPv6, srcPort and dstPort are the message
+// type and code (Zeek's id.orig_p and id.resp_p). Ports are ignored for
+// protocols that have none.
+func CommunityID(seed uint16, proto uint8, src, dst netip.Addr, srcPort, dstPort uint16) string {
+	src, dst = src.Unmap(), dst.Unmap()
+	hasPorts := true
+	oneWay := false
+	switch proto {
+	case protoICMP:
+		srcPort, dstPort, oneWay = icmpPorts(icmp4Counterparts, srcPort, dstPort)
+	case protoICMP6:
+		srcPort, dstPort, oneWay = icmpPorts(icmp6Counterparts, srcPort, dstPort)
+	case protoTCP, protoUDP, protoSCTP:
+	default:
+		hasPorts = false
+	}
+	if !oneWay {
+		c := src.Compare(dst)
+		if c > 0 || (c == 0 && hasPorts && srcPort > dstPort) {
+			src, dst = dst, src
+			srcPort, dstPort = dstPort, srcPort
+		}
+	}
+
+	buf := make([]byte, 0, 2+16+16+2+4)
+	buf = binary.BigEndian.AppendUint16(buf, seed)
+	buf = append(buf, src.AsSlice()...)
+	buf = append(buf, dst.AsSlice()...)
+	buf = append(buf, proto, 0)
+	if hasPorts {
+		buf = binary.BigEndian.AppendUint16(buf, srcPort)
+		buf = binary.BigEndian.AppendUint16(buf, dstPort)
+	}
+	sum := sha1.Sum(buf)
+	return communityV1 + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// icmpPorts maps an ICMP type/code to Community ID's port equivalents and
+// reports whether the message is one-way (and so never reordered).
+func icmpPorts(counterparts map[uint16]uint16, msgType, code uint16) (uint16, uint16, bool) {
+	if peer, ok := counterparts[msgType]; ok {
+		return msgType, peer, false
+	}
+	return msgType, code, true
+}
+
+// transportProto converts a Zeek transport_proto value ("tcp", "udp",
+// "icmp") to an IP protocol number; ICMP over IPv6 is ICMPv6.
+func transportProto(name string, v6 bool) (uint8, bool) {
+	switch name {
+	case "tcp":
+		return protoTCP, true
+	case "udp":
+		return protoUDP, true
+	case "icmp":
+		if v6 {
+			return protoICMP6, true
+		}
+		return protoICMP, true
+	}
+	return 0, false
+}
+
+// AddCommunityID appends a community_id column to each of the given Zeek
+// logs in runDir that carries a conn_id, computed from the unmodified
+// addresses (so it must run before any address masking). The protocol comes
+// from the log's proto column; logs without one (the TLS fingerprint logs and
+// intel.log) take it from the conn.log row of the same uid, so conn.log must
+// come first in logFiles. Logs that already have the column, or no conn_id,
+// are left untouched; a row whose flow cannot be parsed, or whose uid is not
+// in conn.log, gets "-". limit is the worker memory budget in bytes
+// (0 = DefaultMemoryLimit).
+func AddCommunityID(runDir string, logFiles []string, seed uint16, limit int64) error {
+	protos := make(map[string]string)
+	for _, name := range logFiles {
+		added := 0
+		_, _, err := rewriteLogWith(filepath.Join(runDir, name), limit, func(h *logHeader) *logRewrite {
+			return communityIDRewrite(h, seed, protos, &added)
+		})
+		if err != nil {
+			return fmt.Errorf("community id %s: %w", name, err)
+		}
+		if added > 0 {
+			log.Printf("[processor] Added community_id to %d rows of %s", added, name)
+		}
+	}
+	return nil
+}
+
+// communityIDRewrite builds the rewrite adding community_id to one log, or
+// returns nil when the log has no conn_id or already has the column. It
+// records the proto of each conn.log uid in protos, and looks the proto of
+// logs without the column up there.
+func communityIDRewrite(h *logHeader, seed uint16, protos map[string]string, added *int) *logRewrite {
+	origH, respH := h.index("id.orig_h"), h.index("id.resp_h")
+	origP, respP := h.index("id.orig_p"), h.index("id.resp_p")
+	if origH < 0 || respH < 0 || origP < 0 || respP < 0 || h.index(communityIDField) >= 0 {
+		return nil
+	}
+	protoIdx, uidIdx := h.index("proto"), h.index("uid")
+	collect := h.path == "conn" && protoIdx >= 0 && uidIdx >= 0
+
+	row := func(line string) (string, bool) {
+		cols := strings.Split(line, h.sep)
+		at := func(i int) string {
+			if i >= 0 && i < len(cols) {
+				return cols[i]
+			}
+			return ""
+		}
+		if collect {
+			protos[at(uidIdx)] = at(protoIdx)
+		}
+		id := "-"
+		src, err1 := netip.ParseAddr(at(origH))
+		dst, err2 := netip.ParseAddr(at(respH))
+		sport, err3 := strconv.ParseUint(at(origP), 10, 16)
+		dport, err4 := strconv.ParseUint(at(respP), 10, 16)
+		if err1 == nil && err2 == nil && err3 == nil && err4 == nil {
+			name := at(protoIdx)
+			if protoIdx < 0 {
+				name = protos[at(uidIdx)]
+			}
+			if proto, ok := transportProto(name, src.Unmap().Is6()); ok {
+				id = CommunityID(seed, proto, src, dst, uint16(sport), uint16(dport))
+				*added++
+			}
+		}
+		return line + h.sep + id, true
+	}
+	meta := func(line string) string {
+		switch {
+		case strings.HasPrefix(line, "#fields"+h.sep):
+			return line + h.sep + communityIDField
+		case strings.HasPrefix(line, "#types"+h.sep) && len(h.types) > 0:
+			return line + h.sep + "string"
+		}
+		return line
+	}
+	return &logRewrite{row: row, meta: meta}
+}
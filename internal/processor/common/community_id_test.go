@@ -0,0 +1,142 @@
+package types
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommunityID(t *testing.T) {
+	a, b := netip.MustParseAddr("128.232.110.120"), netip.MustParseAddr("66.35.250.204")
+	// Reference values from the Community ID specification.
+	if got := CommunityID(0, protoTCP, a, b, 34855, 80); got != "1:LQU9qZlK+B5F3KDmev6m5PMibrg=" {
+		t.Errorf("tcp, seed 0 = %s", got)
+	}
+	if got := CommunityID(0, protoTCP, b, a, 80, 34855); got != "1:LQU9qZlK+B5F3KDmev6m5PMibrg=" {
+		t.Errorf("reversed direction = %s, want the same hash", got)
+	}
+	if got := CommunityID(1, protoTCP, a, b, 34855, 80); got != "1:3V71V58M3Ksw/yuFALMcW0LAHvc=" {
+		t.Errorf("tcp, seed 1 = %s", got)
+	}
+	if CommunityID(0, protoUDP, a, b, 34855, 80) == CommunityID(0, protoTCP, a, b, 34855, 80) {
+		t.Error("protocol must be part of the hash")
+	}
+	mapped := netip.MustParseAddr("::ffff:128.232.110.120")
+	if CommunityID(0, protoTCP, mapped, b, 34855, 80) != CommunityID(0, protoTCP, a, b, 34855, 80) {
+		t.Error("IPv4-mapped addresses should hash as IPv4")
+	}
+}
+
+func TestCommunityID_ICMP(t *testing.T) {
+	a, b := netip.MustParseAddr("192.168.0.89"), netip.MustParseAddr("192.168.0.1")
+	// Echo request (8) and reply (0) are the same flow.
+	if CommunityID(0, protoICMP, a, b, 8, 0) != CommunityID(0, protoICMP, b, a, 0, 8) {
+		t.Error("echo request and reply should share a community id")
+	}
+	// Destination unreachable (3) is one-way and is never reordered.
+	if CommunityID(0, protoICMP, a, b, 3, 1) == CommunityID(0, protoICMP, b, a, 3, 1) {
+		t.Error("one-way ICMP should keep its direction")
+	}
+	c, d := netip.MustParseAddr("fe80::1"), netip.MustParseAddr("fe80::2")
+	if CommunityID(0, protoICMP6, c, d, 128, 129) != CommunityID(0, protoICMP6, d, c, 129, 128) {
+		t.Error("ICMPv6 echo request and reply should share a community id")
+	}
+}
+
+const cidConnLog = "#separator \\x09\n" +
+	"#set_separator\t,\n" +
+	"#path\tconn\n" +
+	"#fields\tts\tuid\tid.orig_h\tid.orig_p\tid.resp_h\tid.resp_p\tproto\tservice\n" +
+	"#types\ttime\tstring\taddr\tport\taddr\tport\tenum\tstring\n" +
+	"1.0\tC1\t128.232.110.120\t34855\t66.35.250.204\t80\ttcp\thttp\n" +
+	"2.0\tC2\t10.0.0.1\t50000\t10.0.0.2\t443\tudp\tquic,ssl\n" +
+	"3.0\tC3\t10.0.0.1\t-\t10.0.0.2\t-\tunknown_transport\t-\n" +
+	"4.0\tC4\t10.0.0.1\t53000\t10.0.0.53\t53\tudp\tdns\n" +
+	"#close\t2024-01-01-00-01-00\n"
+
+const cidJA3Log = "#separator \\x09\n" +
+	"#path\tja3_ja4\n" +
+	"#fields\tts\tuid\tid.orig_h\tid.orig_p\tid.resp_h\tid.resp_p\tja3\n" +
+	"#types\ttime\tstring\taddr\tport\taddr\tport\tstring\n" +
+	"1.0\tC9\t10.0.0.1\t50001\t10.0.0.2\t443\tabc\n" +
+	"2.0\tC2\t10.0.0.1\t50000\t10.0.0.2\t443\tdef\n" +
+	"3.0\tC1\t128.232.110.120\t34855\t66.35.250.204\t80\tghi\n"
+
+// cidIntelLog is a hit on a DNS query sent over UDP.
+const cidIntelLog = "#separator \\x09\n" +
+	"#path\tintel\n" +
+	"#fields\tts\tuid\tid.orig_h\tid.orig_p\tid.resp_h\tid.resp_p\tseen.indicator\tseen.where\n" +
+	"#types\ttime\tstring\taddr\tport\taddr\tport\tstring\tenum\n" +
+	"4.0\tC4\t10.0.0.1\t53000\t10.0.0.53\t53\tc2.example\tDNS::IN_REQUEST\n"
+
+func TestAddCommunityID(t *testing.T) {
+	runDir := t.TempDir()
+	files := map[string]string{
+		"conn.log":    cidConnLog,
+		"ja3_ja4.log": cidJA3Log,
+		"intel.log":   cidIntelLog,
+		"dhcp.log":    sampleDHCPLog,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(runDir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := AddCommunityID(runDir, ZeekLogFiles, 0, 0); err != nil {
+		t.Fatalf("AddCommunityID: %v", err)
+	}
+
+	read := func(name string) []string {
+		data, err := os.ReadFile(filepath.Join(runDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Split(string(data), "\n")
+	}
+	conn := read("conn.log")
+	if !strings.HasSuffix(conn[3], "\tservice\tcommunity_id") || !strings.HasSuffix(conn[4], "\tstring\tstring") {
+		t.Errorf("conn.log header not extended:\n%s\n%s", conn[3], conn[4])
+	}
+	if !strings.HasSuffix(conn[5], "\thttp\t1:LQU9qZlK+B5F3KDmev6m5PMibrg=") {
+		t.Errorf("tcp row = %q", conn[5])
+	}
+	if !strings.HasSuffix(conn[7], "\t-\t-") {
+		t.Errorf("row without ports should get an unset community_id: %q", conn[7])
+	}
+	if conn[9] != "#close\t2024-01-01-00-01-00" {
+		t.Errorf("footer changed: %q", conn[9])
+	}
+
+	src, dst := netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("10.0.0.2")
+	ja3 := read("ja3_ja4.log")
+	if !strings.HasSuffix(ja3[4], "\tabc\t-") {
+		t.Errorf("row of a uid not in conn.log should get an unset community_id: %q", ja3[4])
+	}
+	if !strings.HasSuffix(ja3[6], "\t1:LQU9qZlK+B5F3KDmev6m5PMibrg=") {
+		t.Errorf("TLS row of a TCP flow should hash as TCP: %q", ja3[6])
+	}
+	quic := CommunityID(0, protoUDP, src, dst, 50000, 443)
+	if !strings.HasSuffix(ja3[5], "\t"+quic) || !strings.HasSuffix(conn[6], "\t"+quic) {
+		t.Errorf("QUIC flow should hash as UDP in both logs:\n%q\n%q", conn[6], ja3[5])
+	}
+
+	dns := CommunityID(0, protoUDP, src, netip.MustParseAddr("10.0.0.53"), 53000, 53)
+	if intel := read("intel.log"); !strings.HasSuffix(intel[4], "\t"+dns) || !strings.HasSuffix(conn[8], "\t"+dns) {
+		t.Errorf("DNS over UDP should hash as UDP in both logs:\n%q\n%q", conn[8], intel[4])
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(runDir, "dhcp.log")); string(data) != sampleDHCPLog {
+		t.Error("dhcp.log has no conn_id and should be untouched")
+	}
+
+	// Running again must not add a second column.
+	before := read("conn.log")
+	if err := AddCommunityID(runDir, ZeekLogFiles, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if after := read("conn.log"); strings.Join(after, "\n") != strings.Join(before, "\n") {
+		t.Error("AddCommunityID is not idempotent")
+	}
+}
@@ -0,0 +1,324 @@
+package types
+
+import (
+	"fmt"
+	"log"
+	"net/netip"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Values of conn.log's window_truncated column.
+const (
+	// TruncatedStart marks a connection already open when its window began.
+	TruncatedStart = "start"
+	// TruncatedEnd marks a connection still open when its window ended.
+	TruncatedEnd = "end"
+	// TruncatedBoth marks a connection open across both edges of its window.
+	TruncatedBoth = "both"
+)
+
+// continuityColumns are the columns AddWindowContinuity adds to conn.log.
+var continuityColumns = []struct{ name, typ string }{
+	{"continuity_id", "string"},
+	{"window_truncated", "string"},
+}
+
+// continuityHorizon is how long a truncated connection waits for its other
+// half. Windows are processed concurrently, so the next window's half may be
+// seen a few windows late, or before this one.
+const continuityHorizon = 10 * time.Minute
+
+// tcpOpenStates are the conn_state values of a TCP connection Zeek had not
+// seen closed when the capture ended.
+var tcpOpenStates = map[string]bool{"S1": true, "S2": true, "S3": true, "OTH": true}
+
+// continuityKey identifies a connection regardless of which side Zeek took
+// for the originator, which it can only guess for a connection it joined
+// midstream.
+type continuityKey struct {
+	proto string
+	a, b  netip.AddrPort
+}
+
+// continuityMark is one truncated half waiting for the other: the
+// continuity ID it was uploaded with and the edge of its window it was cut
+// at.
+type continuityMark struct {
+	id   string
+	edge time.Time
+}
+
+// ContinuityTracker links the halves of connections cut by a window
+// boundary across the runs of one sensor. It is safe for concurrent use.
+type ContinuityTracker struct {
+	edge   time.Duration
+	maxGap time.Duration
+
+	mu     sync.Mutex
+	ends   map[continuityKey][]continuityMark // halves cut at the end of a window
+	starts map[continuityKey][]continuityMark // halves cut at the start of a window
+	latest time.Time
+}
+
+// NewContinuityTracker returns a tracker treating UDP and ICMP flows active
+// within edge of a window's first or last packet as cut there, and windows
+// at most maxGap apart as consecutive.
+func NewContinuityTracker(edge, maxGap time.Duration) *ContinuityTracker {
+	return &ContinuityTracker{
+		edge:   edge,
+		maxGap: maxGap,
+		ends:   make(map[continuityKey][]continuityMark),
+		starts: make(map[continuityKey][]continuityMark),
+	}
+}
+
+// Len returns the number of truncated halves waiting for the other.
+func (t *ContinuityTracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := 0
+	for _, m := range t.ends {
+		n += len(m)
+	}
+	for _, m := range t.starts {
+		n += len(m)
+	}
+	return n
+}
+
+// link returns the continuity ID of a connection half cut at the start
+// and/or end of the window [start, end]: the ID of the matching half of the
+// adjacent window if that was already seen, else uid. The half is then kept
+// for the adjacent window it did not match.
+func (t *ContinuityTracker) link(k continuityKey, uid string, cutStart, cutEnd bool, start, end time.Time) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id := ""
+	if cutStart {
+		id = t.take(t.ends, k, start)
+	}
+	matchedStart := id != ""
+	matchedEnd := false
+	if cutEnd && id == "" {
+		id = t.take(t.starts, k, end)
+		matchedEnd = id != ""
+	}
+	if id == "" {
+		id = uid
+	}
+	if cutStart && !matchedStart {
+		t.starts[k] = append(t.starts[k], continuityMark{id, start})
+	}
+	if cutEnd && !matchedEnd {
+		t.ends[k] = append(t.ends[k], continuityMark{id, end})
+	}
+	return id
+}
+
+// take removes and returns the ID of the mark of k within maxGap of edge,
+// or returns "".
+func (t *ContinuityTracker) take(marks map[continuityKey][]continuityMark, k continuityKey, edge time.Time) string {
+	for i, m := range marks[k] {
+		if d := m.edge.Sub(edge); d <= t.maxGap && d >= -t.maxGap {
+			rest := append(marks[k][:i:i], marks[k][i+1:]...)
+			if len(rest) == 0 {
+				delete(marks, k)
+			} else {
+				marks[k] = rest
+			}
+			return m.id
+		}
+	}
+	return ""
+}
+
+// expire drops the halves cut more than continuityHorizon before the
+// latest window seen.
+func (t *ContinuityTracker) expire(end time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if end.After(t.latest) {
+		t.latest = end
+	}
+	cutoff := t.latest.Add(-continuityHorizon)
+	for _, marks := range []map[continuityKey][]continuityMark{t.ends, t.starts} {
+		for k, m := range marks {
+			kept := m[:0]
+			for _, mark := range m {
+				if mark.edge.After(cutoff) {
+					kept = append(kept, mark)
+				}
+			}
+			if len(kept) == 0 {
+				delete(marks, k)
+			} else {
+				marks[k] = kept
+			}
+		}
+	}
+}
+
+// AddWindowContinuity adds the continuity_id and window_truncated columns to
+// runDir's conn.log. Replaying one capture window at a time, Zeek sees a
+// connection open across a window boundary as two partial connections with
+// different UIDs. A TCP connection Zeek had not seen closed is cut at the
+// end of its window, and one without a SYN at its start; a UDP or ICMP flow
+// is cut at an edge when it was active within the tracker's edge of it.
+// window_truncated says which edges a connection was cut at, and its halves
+// in consecutive windows share a continuity_id (the UID of the half seen
+// first) so their durations and byte counts can be added up. It returns the
+// number of halves tagged, and does nothing when opts.Continuity is nil.
+// It runs before FilterLogs, as it keys connections by their real addresses.
+func AddWindowContinuity(runDir string, opts ProcessOptions) (int, error) {
+	t := opts.Continuity
+	if t == nil {
+		return 0, nil
+	}
+	path := filepath.Join(runDir, "conn.log")
+
+	// The window's edges are its first and last packet.
+	var start, end time.Time
+	present, err := scanLog(path, opts.MemoryLimit, func(h *logHeader) func([]string) {
+		tsIdx, durIdx := h.index("ts"), h.index("duration")
+		if tsIdx < 0 {
+			return nil
+		}
+		return func(cols []string) {
+			ts := zeekTime(column(cols, tsIdx))
+			if ts.IsZero() {
+				return
+			}
+			last := ts.Add(zeekDuration(column(cols, durIdx)))
+			if start.IsZero() || ts.Before(start) {
+				start = ts
+			}
+			if last.After(end) {
+				end = last
+			}
+		}
+	})
+	if err != nil || !present || start.IsZero() {
+		return 0, err
+	}
+
+	tagged := 0
+	_, changed, err := rewriteLogWith(path, opts.MemoryLimit, func(h *logHeader) *logRewrite {
+		return continuityRewrite(h, t, start, end, &tagged)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("window continuity: %w", err)
+	}
+	if !changed {
+		return 0, nil
+	}
+	t.expire(end)
+	log.Printf("[processor] Window continuity: %d connections cut by the window edges, %d halves awaiting a match", tagged, t.Len())
+	return tagged, nil
+}
+
+// continuityRewrite builds the rewrite adding the continuity columns to
+// conn.log, or returns nil when it lacks the columns needed or already has
+// them.
+func continuityRewrite(h *logHeader, t *ContinuityTracker, start, end time.Time, tagged *int) *logRewrite {
+	idx := map[string]int{}
+	for _, name := range []string{"ts", "uid", "id.orig_h", "id.orig_p", "id.resp_h", "id.resp_p", "proto", "duration", "conn_state", "history"} {
+		if idx[name] = h.index(name); idx[name] < 0 && name != "conn_state" && name != "history" {
+			return nil
+		}
+	}
+	if h.index(continuityColumns[0].name) >= 0 {
+		return nil
+	}
+
+	row := func(line string) (string, bool) {
+		cols := strings.Split(line, h.sep)
+		get := func(name string) string { return column(cols, idx[name]) }
+		k, ok := newContinuityKey(get("proto"), get("id.orig_h"), get("id.orig_p"), get("id.resp_h"), get("id.resp_p"))
+		ts := zeekTime(get("ts"))
+		if !ok || ts.IsZero() {
+			return line + h.sep + "-" + h.sep + "-", true
+		}
+		var cutStart, cutEnd bool
+		if k.proto == "tcp" {
+			history := get("history")
+			cutStart = !zeekUnsetMarkers[history] && !strings.ContainsAny(history, "Ss")
+			cutEnd = tcpOpenStates[get("conn_state")]
+		} else {
+			cutStart = ts.Sub(start) <= t.edge
+			cutEnd = end.Sub(ts.Add(zeekDuration(get("duration")))) <= t.edge
+		}
+		truncated := ""
+		switch {
+		case cutStart && cutEnd:
+			truncated = TruncatedBoth
+		case cutStart:
+			truncated = TruncatedStart
+		case cutEnd:
+			truncated = TruncatedEnd
+		default:
+			return line + h.sep + "-" + h.sep + "-", true
+		}
+		*tagged++
+		id := t.link(k, get("uid"), cutStart, cutEnd, start, end)
+		return strings.Join([]string{line, escapeZeekValue(id, h.sep), truncated}, h.sep), true
+	}
+	meta := func(line string) string {
+		var add []string
+		switch {
+		case strings.HasPrefix(line, "#fields"+h.sep):
+			for _, c := range continuityColumns {
+				add = append(add, c.name)
+			}
+		case strings.HasPrefix(line, "#types"+h.sep) && len(h.types) > 0:
+			for _, c := range continuityColumns {
+				add = append(add, c.typ)
+			}
+		default:
+			return line
+		}
+		return line + h.sep + strings.Join(add, h.sep)
+	}
+	return &logRewrite{row: row, meta: meta}
+}
+
+// newContinuityKey builds the key of a conn.log row, ordering its endpoints.
+func newContinuityKey(proto, origH, origP, respH, respP string) (continuityKey, bool) {
+	orig, ok := addrPort(origH, origP)
+	if !ok {
+		return continuityKey{}, false
+	}
+	resp, ok := addrPort(respH, respP)
+	if !ok {
+		return continuityKey{}, false
+	}
+	if resp.Compare(orig) < 0 {
+		orig, resp = resp, orig
+	}
+	return continuityKey{proto: proto, a: orig, b: resp}, true
+}
+
+// addrPort parses a Zeek address and port column pair.
+func addrPort(host, port string) (netip.AddrPort, bool) {
+	a, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.AddrPort{}, false
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return netip.AddrPort{}, false
+	}
+	return netip.AddrPortFrom(a.Unmap(), uint16(p)), true
+}
+
+// zeekDuration parses a Zeek interval column (seconds), or returns 0.
+func zeekDuration(value string) time.Duration {
+	secs, err := strconv.ParseFloat(value, 64)
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs * float64(time.Second))
+}
@@ -0,0 +1,117 @@
+package types
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var continuityTestHeader = zeekHeader("conn", "ts", "uid", "id.orig_h", "id.orig_p", "id.resp_h", "id.resp_p", "proto", "duration", "conn_state", "history")
+
+// Two consecutive windows: a TCP session and a UDP flow open across the
+// boundary, which Zeek took the wrong way round in the second window.
+var (
+	continuityTestWindow1 = []string{
+		row("1000.000000", "Ca", "10.0.0.1", "50000", "192.0.2.1", "443", "tcp", "59.500000", "S1", "ShADad"),
+		row("1010.000000", "Cb", "10.0.0.1", "50001", "192.0.2.1", "443", "tcp", "2.000000", "SF", "ShADadFf"),
+		row("1030.000000", "Cc", "10.0.0.2", "40000", "192.0.2.9", "4500", "udp", "29.600000", "SF", "Dd"),
+		row("1000.200000", "Cd", "10.0.0.3", "123", "192.0.2.5", "123", "udp", "0.100000", "SF", "Dd"),
+	}
+	continuityTestWindow2 = []string{
+		row("1061.000000", "Cx", "192.0.2.1", "443", "10.0.0.1", "50000", "tcp", "10.000000", "SF", "^dDaAFf"),
+		row("1061.100000", "Cy", "192.0.2.9", "4500", "10.0.0.2", "40000", "udp", "1.000000", "SF", "Dd"),
+		row("1090.000000", "Cz", "10.0.0.4", "50000", "192.0.2.1", "443", "tcp", "30.000000", "S1", "ShAD"),
+	}
+)
+
+func writeContinuityWindow(t *testing.T, rows []string) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeLog(t, dir, "conn.log", continuityTestHeader, rows...)
+	return dir
+}
+
+// continuityTags returns the continuity_id and window_truncated columns of
+// each conn.log row by UID.
+func continuityTags(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	tags := make(map[string]string)
+	for _, line := range readLines(t, filepath.Join(dir, "conn.log")) {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		cols := strings.Split(line, "\t")
+		tags[cols[1]] = cols[len(cols)-2] + " " + cols[len(cols)-1]
+	}
+	return tags
+}
+
+func TestAddWindowContinuity(t *testing.T) {
+	opts := ProcessOptions{Continuity: NewContinuityTracker(time.Second, 10*time.Second)}
+	first := writeContinuityWindow(t, continuityTestWindow1)
+	second := writeContinuityWindow(t, continuityTestWindow2)
+
+	if n, err := AddWindowContinuity(first, opts); err != nil || n != 3 {
+		t.Fatalf("first window: %d tagged, err %v", n, err)
+	}
+	connPath := filepath.Join(first, "conn.log")
+	lines := readLines(t, connPath)
+	if !strings.HasSuffix(readHeaderLine(t, connPath, "fields"), "\tconn_state\thistory\tcontinuity_id\twindow_truncated") ||
+		!strings.HasSuffix(readHeaderLine(t, connPath, "types"), "\tstring\tstring\tstring\tstring") || !strings.HasPrefix(lines[len(lines)-1], "#close\t") {
+		t.Errorf("conn.log header =\n%s", strings.Join(lines, "\n"))
+	}
+	if n, err := AddWindowContinuity(second, opts); err != nil || n != 3 {
+		t.Fatalf("second window: %d tagged, err %v", n, err)
+	}
+
+	got := continuityTags(t, first)
+	for uid, want := range map[string]string{"Ca": "Ca end", "Cb": "- -", "Cc": "Cc end", "Cd": "Cd start"} {
+		if got[uid] != want {
+			t.Errorf("first window %s = %q, want %q", uid, got[uid], want)
+		}
+	}
+	got = continuityTags(t, second)
+	for uid, want := range map[string]string{"Cx": "Ca start", "Cy": "Cc start", "Cz": "Cz end"} {
+		if got[uid] != want {
+			t.Errorf("second window %s = %q, want %q", uid, got[uid], want)
+		}
+	}
+
+	// Windows processed out of order are linked all the same.
+	opts.Continuity = NewContinuityTracker(time.Second, 10*time.Second)
+	first = writeContinuityWindow(t, continuityTestWindow1)
+	second = writeContinuityWindow(t, continuityTestWindow2)
+	for _, dir := range []string{second, first} {
+		if _, err := AddWindowContinuity(dir, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := continuityTags(t, first)["Ca"]; got != "Cx end" {
+		t.Errorf("out of order Ca = %q, want %q", got, "Cx end")
+	}
+
+	// Windows further apart than the maximum gap are not linked.
+	opts.Continuity = NewContinuityTracker(time.Second, 100*time.Millisecond)
+	first = writeContinuityWindow(t, continuityTestWindow1)
+	second = writeContinuityWindow(t, continuityTestWindow2)
+	for _, dir := range []string{first, second} {
+		if _, err := AddWindowContinuity(dir, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := continuityTags(t, second)["Cx"]; got != "Cx start" {
+		t.Errorf("distant Cx = %q, want %q", got, "Cx start")
+	}
+
+	// Tagging twice, or without a tracker, changes nothing.
+	before := readLines(t, filepath.Join(second, "conn.log"))
+	for _, o := range []ProcessOptions{opts, {}} {
+		if n, err := AddWindowContinuity(second, o); err != nil || n != 0 {
+			t.Errorf("retag: %d tagged, err %v", n, err)
+		}
+	}
+	if after := readLines(t, filepath.Join(second, "conn.log")); strings.Join(after, "\n") != strings.Join(before, "\n") {
+		t.Errorf("conn.log changed on retagging")
+	}
+}
@@ -0,0 +1,85 @@
+package types
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DeviceEventsLogFile is the log of device events a run writes beside the
+// Zeek logs when device events are enabled: the new devices and changed DHCP
+// identities the asset inventory reported for the window.
+const DeviceEventsLogFile = "device_events.log"
+
+// Kinds of DeviceEvent. The change events compare what a device announces in
+// DHCP with what the inventory last recorded for its MAC address, so one
+// firing for a device that has not been replaced may mean its address is
+// being spoofed.
+const (
+	DeviceNew                = "new_device"
+	DeviceFingerprintChanged = "fingerprint_changed"
+	DeviceHostnameChanged    = "hostname_changed"
+	DeviceVendorChanged      = "vendor_changed"
+)
+
+// DeviceEvent is a new device, or a change to a known one, detected by the
+// asset inventory.
+type DeviceEvent struct {
+	Time time.Time
+	Kind string // DeviceNew, DeviceFingerprintChanged, ...
+	// The device after the change.
+	MAC             string
+	IP              string
+	Hostname        string
+	Vendor          string
+	DHCPFingerprint string
+	// Old and New are the changed value; both are empty for DeviceNew.
+	Old, New string
+}
+
+func (e DeviceEvent) String() string {
+	s := fmt.Sprintf("%s mac=%s ip=%s hostname=%s vendor=%q", e.Kind, e.MAC, e.IP, e.Hostname, e.Vendor)
+	if e.Kind != DeviceNew {
+		s += fmt.Sprintf(" old=%q new=%q", e.Old, e.New)
+	}
+	return s
+}
+
+// deviceEventsLogFields are the columns of DeviceEventsLogFile.
+var deviceEventsLogFields = []struct{ name, typ string }{
+	{"ts", "time"},
+	{"event", "string"},
+	{"mac", "string"},
+	{"ip", "addr"},
+	{"hostname", "string"},
+	{"vendor", "string"},
+	{"dhcp_fingerprint", "string"},
+	{"old_value", "string"},
+	{"new_value", "string"},
+}
+
+// WriteDeviceEventsLog writes events as a Zeek TSV log at path.
+func WriteDeviceEventsLog(path string, events []DeviceEvent) error {
+	var b strings.Builder
+	writeZeekHeader(&b, "device_events", deviceEventsLogFields)
+	for _, e := range events {
+		row := []string{
+			zeekTimeString(e.Time),
+			e.Kind,
+			zeekString(e.MAC),
+			zeekString(e.IP),
+			zeekString(e.Hostname),
+			zeekString(e.Vendor),
+			zeekString(e.DHCPFingerprint),
+			zeekString(e.Old),
+			zeekString(e.New),
+		}
+		b.WriteString(strings.Join(row, "\t") + "\n")
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
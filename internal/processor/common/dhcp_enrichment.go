@@ -15,8 +15,9 @@ import (
 // EnrichDHCPLog parses DHCP option 55 (parameter request list) from the
 // pcapng file and writes the values into the param_req_list column of the
 // Zeek-generated dhcp.log. Non-fatal: errors are logged and the function
-// returns nil so the main processing path is never interrupted.
-func EnrichDHCPLog(pcapPath, dhcpLogPath string) error {
+// returns nil so the main processing path is never interrupted. limit is the
+// worker memory budget in bytes (0 = DefaultMemoryLimit).
+func EnrichDHCPLog(pcapPath, dhcpLogPath string, limit int64) error {
 	fingerprints, err := ExtractDHCPFingerprints(pcapPath)
 	if err != nil {
 		log.Printf("[processor] Warning: DHCP fingerprint extraction failed: %v", err)
@@ -25,7 +26,7 @@ func EnrichDHCPLog(pcapPath, dhcpLogPath string) error {
 	if len(fingerprints) == 0 {
 		return nil
 	}
-	if err := PatchDHCPLog(dhcpLogPath, fingerprints); err != nil {
+	if err := PatchDHCPLog(dhcpLogPath, fingerprints, limit); err != nil {
 		log.Printf("[processor] Warning: DHCP log enrichment failed: %v", err)
 	}
 	return nil
@@ -37,6 +38,23 @@ type packetReader interface {
 	LinkType() layers.LinkType
 }
 
+// openPacketReader returns a reader for the pcap or pcapng file f. pcapng is
+// tried first (Windows pktmon output); regular pcap (Linux tcpdump output)
+// is the fallback.
+func openPacketReader(f *os.File) (packetReader, error) {
+	if ngr, err := pcapgo.NewNgReader(f, pcapgo.DefaultNgReaderOptions); err == nil {
+		return ngr, nil
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return nil, fmt.Errorf("seek pcap: %w", err)
+	}
+	r, err := pcapgo.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("pcap reader: %w", err)
+	}
+	return r, nil
+}
+
 // ExtractDHCPFingerprints reads a pcap or pcapng file and returns a map from
 // client MAC address to comma-separated DHCP option 55 (parameter request list).
 // Only BOOTREQUEST packets are examined; the first fingerprint seen per MAC
@@ -47,20 +65,9 @@ func ExtractDHCPFingerprints(pcapPath string) (map[string]string, error) {
 		return nil, fmt.Errorf("open pcap: %w", err)
 	}
 	defer f.Close()
-
-	// Try pcapng first (Windows pktmon output); fall back to regular pcap (Linux tcpdump output).
-	var reader packetReader
-	if ngr, err := pcapgo.NewNgReader(f, pcapgo.DefaultNgReaderOptions); err == nil {
-		reader = ngr
-	} else {
-		if _, err := f.Seek(0, 0); err != nil {
-			return nil, fmt.Errorf("seek pcap: %w", err)
-		}
-		r, err := pcapgo.NewReader(f)
-		if err != nil {
-			return nil, fmt.Errorf("pcap reader: %w", err)
-		}
-		reader = r
+	reader, err := openPacketReader(f)
+	if err != nil {
+		return nil, err
 	}
 
 	result := make(map[string]string)
@@ -94,56 +101,30 @@ func ExtractDHCPFingerprints(pcapPath string) (map[string]string, error) {
 	return result, nil
 }
 
-// PatchDHCPLog reads the Zeek dhcp.log TSV, fills in the param_req_list
-// column for any row whose MAC address appears in fingerprints, and writes
-// the file back in place.
-func PatchDHCPLog(logPath string, fingerprints map[string]string) error {
-	data, err := os.ReadFile(logPath)
-	if err != nil {
-		if os.IsNotExist(err) {
+// PatchDHCPLog streams the Zeek dhcp.log TSV, fills in the param_req_list
+// column for any row whose MAC address appears in fingerprints, and replaces
+// the file when a row changed. limit is the worker memory budget in bytes
+// (0 = DefaultMemoryLimit).
+func PatchDHCPLog(logPath string, fingerprints map[string]string, limit int64) error {
+	_, _, err := rewriteLog(logPath, limit, func(h *logHeader) func(string) (string, bool) {
+		macIdx, paramIdx := h.index("mac"), h.index("param_req_list")
+		if macIdx < 0 || paramIdx < 0 {
 			return nil
 		}
-		return fmt.Errorf("read dhcp log: %w", err)
-	}
-
-	lines := strings.Split(string(data), "\n")
-
-	macIdx, paramIdx := -1, -1
-	for _, line := range lines {
-		if strings.HasPrefix(line, "#fields\t") {
-			fields := strings.Split(line, "\t")[1:] // drop "#fields" prefix so indices match data columns
-			for i, f := range fields {
-				switch f {
-				case "mac":
-					macIdx = i
-				case "param_req_list":
-					paramIdx = i
-				}
+		return func(line string) (string, bool) {
+			cols := strings.Split(line, h.sep)
+			if macIdx >= len(cols) || paramIdx >= len(cols) {
+				return line, true
 			}
-			break
-		}
-	}
-	if macIdx < 0 || paramIdx < 0 {
-		return nil
-	}
-
-	changed := false
-	for i, line := range lines {
-		if strings.HasPrefix(line, "#") || line == "" {
-			continue
-		}
-		cols := strings.Split(line, "\t")
-		if macIdx >= len(cols) || paramIdx >= len(cols) {
-			continue
-		}
-		if fp, ok := fingerprints[cols[macIdx]]; ok && cols[paramIdx] == "-" {
-			cols[paramIdx] = fp
-			lines[i] = strings.Join(cols, "\t")
-			changed = true
+			if fp, ok := fingerprints[cols[macIdx]]; ok && cols[paramIdx] == "-" {
+				cols[paramIdx] = fp
+				return strings.Join(cols, h.sep), true
+			}
+			return line, true
 		}
+	})
+	if err != nil {
+		return fmt.Errorf("patch dhcp log: %w", err)
 	}
-	if !changed {
-		return nil
-	}
-	return os.WriteFile(logPath, []byte(strings.Join(lines, "\n")), 0644)
+	return nil
 }
@@ -0,0 +1,372 @@
+package types
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// DNSAnomaliesLogFile is the log of likely DNS tunneling and DGA activity a
+// run writes beside the Zeek logs when DNS anomaly detection is enabled: one
+// row per registered domain or client whose queries crossed a threshold.
+const DNSAnomaliesLogFile = "dns_anomalies.log"
+
+// Kinds of DNSAnomaly.
+const (
+	// DNSAnomalyTunneling is a registered domain whose subdomains carry data:
+	// many distinct, long or random-looking names, or a volume of TXT/NULL
+	// queries.
+	DNSAnomalyTunneling = "tunneling"
+	// DNSAnomalyDGA is a client looking up many random-looking domains that do
+	// not exist, as malware with a domain generation algorithm does while
+	// searching for the one its operator registered.
+	DNSAnomalyDGA = "dga"
+)
+
+// DNSAnomalyThresholds are the limits at which DetectDNSAnomalies flags a
+// registered domain as tunneling or a client as running a DGA.
+type DNSAnomalyThresholds struct {
+	// MinUniqueNames is the fewest distinct query names under a registered
+	// domain before it is considered for tunneling.
+	MinUniqueNames int
+	// Entropy is the mean Shannon entropy, in bits per character, of a
+	// domain's subdomain labels at or above which they look like encoded data.
+	Entropy float64
+	// QueryLength is the mean query name length at or above which a domain's
+	// names look like encoded data.
+	QueryLength float64
+	// TXTQueries is the number of TXT and NULL queries to a domain at or
+	// above which it looks like a tunnel's downstream.
+	TXTQueries int
+	// MinNXDomains is the fewest distinct registered domains answered
+	// NXDOMAIN for one client before it is considered for DGA activity.
+	MinNXDomains int
+	// NXDomainRatio is the share of a client's queries answered NXDOMAIN at or
+	// above which it may be running a DGA.
+	NXDomainRatio float64
+	// DGAEntropy is the mean Shannon entropy, in bits per character, of the
+	// NXDOMAIN domains' names at or above which they look generated.
+	DGAEntropy float64
+}
+
+// DNSAnomaly is a registered domain or client flagged by DetectDNSAnomalies,
+// with the features it was flagged on.
+type DNSAnomaly struct {
+	Time time.Time // last query involved
+	Kind string    // DNSAnomalyTunneling or DNSAnomalyDGA
+	// Client is the flagged client (dga), or the client that queried the
+	// flagged domain most (tunneling).
+	Client string
+	// Domain is the flagged registered domain; empty for dga.
+	Domain  string
+	Queries int
+	// UniqueNames is the distinct query names under the domain (tunneling),
+	// or the distinct registered domains answered NXDOMAIN (dga).
+	UniqueNames   int
+	TXTQueries    int     // TXT and NULL queries
+	NXDomainRatio float64 // share of Queries answered NXDOMAIN
+	// Entropy is the mean entropy of the subdomain labels (tunneling), or of
+	// the NXDOMAIN domains' names (dga), in bits per character.
+	Entropy     float64
+	QueryLength float64  // mean query name length
+	Reasons     []string // the thresholds crossed
+	Example     string   // a query name involved
+}
+
+// DNS anomaly features are kept for at most this many distinct registered
+// domains, and names per domain or client, in a window, so a flood of
+// generated names cannot exhaust memory. Counts saturate at the caps, which
+// are far above the thresholds.
+const (
+	maxDNSDomains = 100000
+	maxDNSNames   = 4096
+	maxDNSClients = 256
+)
+
+// dnsDomainStats are the tunneling features of one registered domain.
+type dnsDomainStats struct {
+	queries, txt, nx      int
+	names                 map[string]struct{}
+	entropySum, lengthSum float64 // over names
+	clients               map[string]int
+	last                  time.Time
+	example               string // longest name
+}
+
+// dnsClientStats are the DGA features of one client.
+type dnsClientStats struct {
+	queries, txt, nx int
+	lengthSum        float64 // over queries
+	nxDomains        map[string]struct{}
+	entropySum       float64 // over nxDomains
+	last             time.Time
+	example          string
+}
+
+// DetectDNSAnomalies computes per registered domain and per client features
+// of runDir's dns.log (subdomain entropy, query length, distinct names,
+// TXT/NULL volume, NXDOMAIN ratio) and writes the domains and clients that
+// cross thresholds to DNSAnomaliesLogFile, if there are any. It returns the
+// number of anomalies. It runs after FilterLogs so excluded domains and
+// clients are never flagged, and does nothing when opts.DNSAnomalies is nil.
+// Reverse (.arpa), mDNS (.local) and single-label names are ignored.
+func DetectDNSAnomalies(runDir string, opts ProcessOptions) (int, error) {
+	thresholds := opts.DNSAnomalies
+	if thresholds == nil {
+		return 0, nil
+	}
+	domains := make(map[string]*dnsDomainStats)
+	clients := make(map[string]*dnsClientStats)
+	present, err := scanLog(filepath.Join(runDir, "dns.log"), opts.MemoryLimit, func(h *logHeader) func([]string) {
+		tsIdx, clientIdx, queryIdx := h.index("ts"), h.index("id.orig_h"), h.index("query")
+		typeIdx, rcodeIdx := h.index("qtype_name"), h.index("rcode_name")
+		if clientIdx < 0 || queryIdx < 0 {
+			return nil
+		}
+		return func(cols []string) {
+			addr, err := netip.ParseAddr(column(cols, clientIdx))
+			name := strings.ToLower(strings.TrimSuffix(column(cols, queryIdx), "."))
+			if err != nil || addr.IsUnspecified() || zeekUnsetMarkers[name] {
+				return
+			}
+			client := addr.Unmap().String()
+			reg, sub := registeredDomain(name)
+			if reg == "" {
+				return
+			}
+			ts := zeekTime(column(cols, tsIdx))
+			qtype := column(cols, typeIdx)
+			txt := qtype == "TXT" || qtype == "NULL"
+			nx := column(cols, rcodeIdx) == "NXDOMAIN"
+
+			c := clients[client]
+			if c == nil {
+				c = &dnsClientStats{nxDomains: make(map[string]struct{})}
+				clients[client] = c
+			}
+			c.queries++
+			c.lengthSum += float64(len(name))
+			if ts.After(c.last) {
+				c.last = ts
+			}
+			if txt {
+				c.txt++
+			}
+			if nx {
+				c.nx++
+				if _, ok := c.nxDomains[reg]; !ok && len(c.nxDomains) < maxDNSNames {
+					c.nxDomains[reg] = struct{}{}
+					c.entropySum += labelEntropy(reg[:strings.IndexByte(reg, '.')])
+					c.example = name
+				}
+			}
+
+			d := domains[reg]
+			if d == nil {
+				if len(domains) >= maxDNSDomains {
+					return
+				}
+				d = &dnsDomainStats{names: make(map[string]struct{}), clients: make(map[string]int)}
+				domains[reg] = d
+			}
+			d.queries++
+			if ts.After(d.last) {
+				d.last = ts
+			}
+			if txt {
+				d.txt++
+			}
+			if nx {
+				d.nx++
+			}
+			if _, ok := d.clients[client]; ok || len(d.clients) < maxDNSClients {
+				d.clients[client]++
+			}
+			if _, ok := d.names[name]; !ok && len(d.names) < maxDNSNames {
+				d.names[name] = struct{}{}
+				d.entropySum += labelEntropy(strings.ReplaceAll(sub, ".", ""))
+				d.lengthSum += float64(len(name))
+				if len(name) > len(d.example) {
+					d.example = name
+				}
+			}
+		}
+	})
+	if err != nil || !present {
+		return 0, err
+	}
+
+	var anomalies []DNSAnomaly
+	for reg, d := range domains {
+		if a, ok := d.tunneling(reg, thresholds); ok {
+			anomalies = append(anomalies, a)
+		}
+	}
+	for client, c := range clients {
+		if a, ok := c.dga(client, thresholds); ok {
+			anomalies = append(anomalies, a)
+		}
+	}
+	log.Printf("[processor] DNS anomaly detection: %d domains, %d clients, %d anomalies", len(domains), len(clients), len(anomalies))
+	if len(anomalies) == 0 {
+		return 0, nil
+	}
+	sort.Slice(anomalies, func(i, j int) bool {
+		if anomalies[i].Kind != anomalies[j].Kind {
+			return anomalies[i].Kind > anomalies[j].Kind
+		}
+		return anomalies[i].Queries > anomalies[j].Queries
+	})
+	for _, a := range anomalies {
+		log.Printf("[processor] DNS anomaly: %s client=%s domain=%s reasons=%s example=%s", a.Kind, a.Client, a.Domain, strings.Join(a.Reasons, ","), a.Example)
+	}
+	if err := WriteDNSAnomaliesLog(filepath.Join(runDir, DNSAnomaliesLogFile), anomalies); err != nil {
+		return 0, err
+	}
+	return len(anomalies), nil
+}
+
+func (d *dnsDomainStats) tunneling(reg string, t *DNSAnomalyThresholds) (DNSAnomaly, bool) {
+	if len(d.names) < t.MinUniqueNames {
+		return DNSAnomaly{}, false
+	}
+	a := DNSAnomaly{
+		Time:          d.last,
+		Kind:          DNSAnomalyTunneling,
+		Domain:        reg,
+		Queries:       d.queries,
+		UniqueNames:   len(d.names),
+		TXTQueries:    d.txt,
+		NXDomainRatio: float64(d.nx) / float64(d.queries),
+		Entropy:       d.entropySum / float64(len(d.names)),
+		QueryLength:   d.lengthSum / float64(len(d.names)),
+		Example:       d.example,
+	}
+	for client, n := range d.clients {
+		if n > d.clients[a.Client] || (n == d.clients[a.Client] && client < a.Client) {
+			a.Client = client
+		}
+	}
+	if a.Entropy >= t.Entropy {
+		a.Reasons = append(a.Reasons, "high_entropy")
+	}
+	if a.QueryLength >= t.QueryLength {
+		a.Reasons = append(a.Reasons, "long_names")
+	}
+	if a.TXTQueries >= t.TXTQueries {
+		a.Reasons = append(a.Reasons, "txt_null_volume")
+	}
+	return a, len(a.Reasons) > 0
+}
+
+func (c *dnsClientStats) dga(client string, t *DNSAnomalyThresholds) (DNSAnomaly, bool) {
+	if len(c.nxDomains) < t.MinNXDomains {
+		return DNSAnomaly{}, false
+	}
+	a := DNSAnomaly{
+		Time:          c.last,
+		Kind:          DNSAnomalyDGA,
+		Client:        client,
+		Queries:       c.queries,
+		UniqueNames:   len(c.nxDomains),
+		TXTQueries:    c.txt,
+		NXDomainRatio: float64(c.nx) / float64(c.queries),
+		Entropy:       c.entropySum / float64(len(c.nxDomains)),
+		QueryLength:   c.lengthSum / float64(c.queries),
+		Reasons:       []string{"nxdomain_volume", "nxdomain_ratio", "high_entropy"},
+		Example:       c.example,
+	}
+	if a.NXDomainRatio < t.NXDomainRatio || a.Entropy < t.DGAEntropy {
+		return DNSAnomaly{}, false
+	}
+	return a, true
+}
+
+// labelEntropy returns the Shannon entropy of s in bits per character.
+func labelEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	var counts [256]int
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+	var h float64
+	for _, n := range counts {
+		if n > 0 {
+			p := float64(n) / float64(len(s))
+			h -= p * math.Log2(p)
+		}
+	}
+	return h
+}
+
+// registeredDomain splits a query name into its registered domain (the
+// public suffix plus one label, from the public suffix list) and the
+// subdomain part before it. Hosting suffixes such as cloudfront.net or
+// github.io are public suffixes, so each tenant is its own registered domain
+// rather than one domain with many random-looking subdomains. reg is "" for
+// names that are not anomaly candidates: single labels, public suffixes,
+// reverse lookups and mDNS.
+func registeredDomain(name string) (reg, sub string) {
+	if !strings.Contains(name, ".") || strings.HasSuffix(name, ".arpa") || strings.HasSuffix(name, ".local") {
+		return "", ""
+	}
+	reg, err := publicsuffix.EffectiveTLDPlusOne(name)
+	if err != nil {
+		return "", ""
+	}
+	return reg, strings.TrimSuffix(strings.TrimSuffix(name, reg), ".")
+}
+
+// dnsAnomaliesLogFields are the columns of DNSAnomaliesLogFile.
+var dnsAnomaliesLogFields = []struct{ name, typ string }{
+	{"ts", "time"},
+	{"anomaly", "string"},
+	{"client", "addr"},
+	{"domain", "string"},
+	{"queries", "count"},
+	{"unique_names", "count"},
+	{"txt_null_queries", "count"},
+	{"nxdomain_ratio", "double"},
+	{"entropy", "double"},
+	{"mean_length", "double"},
+	{"reasons", "set[string]"},
+	{"example", "string"},
+}
+
+// WriteDNSAnomaliesLog writes anomalies as a Zeek TSV log at path.
+func WriteDNSAnomaliesLog(path string, anomalies []DNSAnomaly) error {
+	var b strings.Builder
+	writeZeekHeader(&b, "dns_anomalies", dnsAnomaliesLogFields)
+	for _, a := range anomalies {
+		row := []string{
+			zeekTimeString(a.Time),
+			a.Kind,
+			zeekString(a.Client),
+			zeekString(a.Domain),
+			strconv.Itoa(a.Queries),
+			strconv.Itoa(a.UniqueNames),
+			strconv.Itoa(a.TXTQueries),
+			strconv.FormatFloat(a.NXDomainRatio, 'f', 4, 64),
+			strconv.FormatFloat(a.Entropy, 'f', 4, 64),
+			strconv.FormatFloat(a.QueryLength, 'f', 1, 64),
+			zeekVector(a.Reasons),
+			zeekString(a.Example),
+		}
+		b.WriteString(strings.Join(row, "\t") + "\n")
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testDNSAnomalyThresholds = DNSAnomalyThresholds{
+	MinUniqueNames: 100,
+	Entropy:        3.5,
+	QueryLength:    60,
+	TXTQueries:     50,
+	MinNXDomains:   25,
+	NXDomainRatio:  0.25,
+	DGAEntropy:     3.0,
+}
+
+// randomLabel returns n characters drawn from alphabet.
+func randomLabel(rng *rand.Rand, alphabet string, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = alphabet[rng.Intn(len(alphabet))]
+	}
+	return string(b)
+}
+
+// dnsAnomalyLog returns a synthetic dns.log with:
+//   - 192.168.1.20 tunneling through tunnel.example (hex-encoded labels,
+//     TXT queries);
+//   - 192.168.1.30 running a DGA (random .com names, all NXDOMAIN);
+//   - 192.168.1.40 browsing normally, including a CDN with many low-entropy
+//     names and a few typos;
+//   - 192.168.1.50 fetching from cloud hosting (CloudFront distributions, S3
+//     buckets, GitHub Pages sites), whose random-looking names are tenants of
+//     public suffixes, not subdomains of one domain;
+//   - reverse, mDNS and masked lookups that must be ignored.
+func dnsAnomalyLog() string {
+	rng := rand.New(rand.NewSource(7))
+	var b strings.Builder
+	b.WriteString("#separator \\x09\n#set_separator\t,\n#path\tdns\n" +
+		"#fields\tts\tuid\tid.orig_h\tid.resp_h\tquery\tqtype_name\trcode_name\tanswers\n" +
+		"#types\ttime\tstring\taddr\taddr\tstring\tstring\tstring\tvector[string]\n")
+	ts := 1000.0
+	row := func(client, query, qtype, rcode string) {
+		ts++
+		fmt.Fprintf(&b, "%.6f\tC\t%s\t192.168.1.1\t%s\t%s\t%s\t-\n", ts, client, query, qtype, rcode)
+	}
+	for i := 0; i < 150; i++ {
+		qtype := "A"
+		if i%2 == 0 {
+			qtype = "TXT"
+		}
+		row("192.168.1.20", randomLabel(rng, "0123456789abcdef", 30)+"."+randomLabel(rng, "0123456789abcdef", 20)+".tunnel.example", qtype, "NOERROR")
+	}
+	for i := 0; i < 40; i++ {
+		row("192.168.1.30", randomLabel(rng, "abcdefghijklmnopqrstuvwxyz0123456789", 14)+".com", "A", "NXDOMAIN")
+		row("192.168.1.30", "www.example.com", "A", "NOERROR")
+	}
+	for i := 0; i < 150; i++ {
+		row("192.168.1.40", fmt.Sprintf("img%d.cdn.example.net", i), "A", "NOERROR")
+		row("192.168.1.40", "www.example.co.uk", "A", "NOERROR")
+	}
+	for i := 0; i < 120; i++ {
+		row("192.168.1.50", "d"+randomLabel(rng, "0123456789abcdefghijklmnopqrstuvwxyz", 13)+".cloudfront.net", "A", "NOERROR")
+		row("192.168.1.50", randomLabel(rng, "0123456789abcdefghijklmnopqrstuvwxyz-", 20)+".s3.amazonaws.com", "A", "NOERROR")
+		row("192.168.1.50", randomLabel(rng, "0123456789abcdefghijklmnopqrstuvwxyz", 12)+".github.io", "A", "NOERROR")
+	}
+	for _, typo := range []string{"gogle.com", "exmaple.com", "wikipeda.org"} {
+		row("192.168.1.40", typo, "A", "NXDOMAIN")
+	}
+	for i := 0; i < 200; i++ {
+		row("192.168.1.40", fmt.Sprintf("%d.1.168.192.in-addr.arpa", i), "PTR", "NXDOMAIN")
+		row("192.168.1.40", randomLabel(rng, "abcdef0123456789", 32)+".local", "A", "NXDOMAIN")
+		row("0.0.0.0", randomLabel(rng, "abcdefghijklmnopqrstuvwxyz", 14)+".net", "A", "NXDOMAIN")
+	}
+	return b.String()
+}
+
+func TestDetectDNSAnomalies(t *testing.T) {
+	runDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(runDir, "dns.log"), []byte(dnsAnomalyLog()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	n, err := DetectDNSAnomalies(runDir, ProcessOptions{DNSAnomalies: &testDNSAnomalyThresholds})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("got %d anomalies, want 2", n)
+	}
+	lines := readLines(t, filepath.Join(runDir, DNSAnomaliesLogFile))
+	if lines[5] != "#fields\tts\tanomaly\tclient\tdomain\tqueries\tunique_names\ttxt_null_queries\tnxdomain_ratio\tentropy\tmean_length\treasons\texample" {
+		t.Errorf("#fields = %q", lines[5])
+	}
+	rows := lines[7:]
+	if len(rows) != 2 {
+		t.Fatalf("rows = %q", rows)
+	}
+
+	tunnel := strings.Split(rows[0], "\t")
+	if tunnel[1] != DNSAnomalyTunneling || tunnel[2] != "192.168.1.20" || tunnel[3] != "tunnel.example" ||
+		tunnel[4] != "150" || tunnel[5] != "150" || tunnel[6] != "75" || tunnel[10] != "high_entropy,long_names,txt_null_volume" {
+		t.Errorf("tunneling row = %q", tunnel)
+	}
+	if !strings.HasSuffix(tunnel[11], ".tunnel.example") {
+		t.Errorf("tunneling example = %q", tunnel[11])
+	}
+
+	dga := strings.Split(rows[1], "\t")
+	if dga[1] != DNSAnomalyDGA || dga[2] != "192.168.1.30" || dga[3] != "-" ||
+		dga[4] != "80" || dga[5] != "40" || dga[7] != "0.5000" {
+		t.Errorf("dga row = %q", dga)
+	}
+	if !strings.HasSuffix(dga[11], ".com") {
+		t.Errorf("dga example = %q", dga[11])
+	}
+
+	// The DNS anomalies log is encoded with the Zeek logs.
+	paths, _, err := EncodeZeekLogs(runDir, OutputLogFiles(), "ndjson", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(paths[DNSAnomaliesLogFile], "dns_anomalies.ndjson") {
+		t.Errorf("encoded dns_anomalies path = %q", paths[DNSAnomaliesLogFile])
+	}
+}
+
+func TestDetectDNSAnomalies_Thresholds(t *testing.T) {
+	runDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(runDir, "dns.log"), []byte(dnsAnomalyLog()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Disabled: nothing is written.
+	if n, err := DetectDNSAnomalies(runDir, ProcessOptions{}); err != nil || n != 0 {
+		t.Fatalf("disabled: %d anomalies, err %v", n, err)
+	}
+	if _, err := os.Stat(filepath.Join(runDir, DNSAnomaliesLogFile)); !os.IsNotExist(err) {
+		t.Error("dns_anomalies.log written while disabled")
+	}
+
+	// Raised thresholds flag neither.
+	strict := testDNSAnomalyThresholds
+	strict.MinUniqueNames = 200
+	strict.NXDomainRatio = 0.9
+	if n, err := DetectDNSAnomalies(runDir, ProcessOptions{DNSAnomalies: &strict}); err != nil || n != 0 {
+		t.Errorf("strict: %d anomalies, err %v", n, err)
+	}
+
+	// A lowered entropy threshold also flags the CDN's many names.
+	loose := testDNSAnomalyThresholds
+	loose.Entropy = 2.0
+	n, err := DetectDNSAnomalies(runDir, ProcessOptions{DNSAnomalies: &loose})
+	if err != nil || n != 3 {
+		t.Fatalf("loose: %d anomalies, err %v", n, err)
+	}
+	if log := strings.Join(readLines(t, filepath.Join(runDir, DNSAnomaliesLogFile)), "\n"); !strings.Contains(log, "\texample.net\t") {
+		t.Errorf("CDN not flagged with a low entropy threshold:\n%s", log)
+	}
+}
+
+func TestRegisteredDomain(t *testing.T) {
+	for name, want := range map[string][2]string{
+		"www.example.com":                   {"example.com", "www"},
+		"a.b.example.co.uk":                 {"example.co.uk", "a.b"},
+		"example.com":                       {"example.com", ""},
+		"co.uk":                             {"", ""},
+		"d111111abcdef8.cloudfront.net":     {"d111111abcdef8.cloudfront.net", ""},
+		"img.d111111abcdef8.cloudfront.net": {"d111111abcdef8.cloudfront.net", "img"},
+		"my-bucket.s3.amazonaws.com":        {"my-bucket.s3.amazonaws.com", ""},
+		"octocat.github.io":                 {"octocat.github.io", ""},
+		"www.tunnel.example":                {"tunnel.example", "www"},
+		"localhost":                         {"", ""},
+		"printer.local":                     {"", ""},
+		"1.1.168.192.in-addr.arpa":          {"", ""},
+		"bad..com":                          {"", ""},
+	} {
+		reg, sub := registeredDomain(name)
+		if reg != want[0] || sub != want[1] {
+			t.Errorf("registeredDomain(%q) = %q, %q, want %q, %q", name, reg, sub, want[0], want[1])
+		}
+	}
+}
+
+func TestLabelEntropy(t *testing.T) {
+	for s, want := range map[string]float64{
+		"":                 0,
+		"aaaa":             0,
+		"ab":               1,
+		"0123456789abcdef": 4,
+	} {
+		if got := labelEntropy(s); math.Abs(got-want) > 1e-9 {
+			t.Errorf("labelEntropy(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
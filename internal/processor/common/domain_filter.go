@@ -0,0 +1,178 @@
+package types
+
+import (
+	"log"
+	"path"
+	"strings"
+
+	"EnigmaNetz/Enigma-Go-Sensor/internal/policy"
+)
+
+// redactedValue replaces a redacted name. It follows Zeek's "(empty)" marker
+// style so it can never be mistaken for a real hostname.
+const redactedValue = "(redacted)"
+
+// domainFields names Zeek columns that hold a single DNS name we filter on:
+//   - dns: query
+//   - ja3_ja4, ja4s: server_name (TLS SNI)
+//   - intel: seen.indicator (the matched domain for domain indicators)
+var domainFields = map[string]bool{
+	"query":          true,
+	"server_name":    true,
+	"seen.indicator": true,
+}
+
+// domainSetFields names set-valued columns whose elements may be DNS names.
+// dns.log "answers" mixes IPs and names (CNAME/MX/PTR targets); only the names
+// can match a domain rule.
+var domainSetFields = map[string]bool{
+	"answers": true,
+}
+
+// domainRule is one parsed excluded_domains entry. A pattern containing glob
+// metacharacters is matched with path.Match against the whole name (so
+// "*.hr.corp" matches any subdomain but not hr.corp itself); a plain name is a
+// suffix rule matching the name and every subdomain of it.
+type domainRule struct {
+	pattern string
+	glob    bool
+	action  string
+}
+
+// parseDomainRules converts "pattern[=action]" entries to domain rules.
+// Malformed entries are skipped with a warning; config validation is the
+// authoritative gate.
+func parseDomainRules(entries []string) []domainRule {
+	var rules []domainRule
+	for _, e := range entries {
+		if strings.TrimSpace(e) == "" {
+			continue
+		}
+		pattern, action := policy.SplitDomain(e)
+		if pattern == "" {
+			continue
+		}
+		if !policy.ValidDomainPattern(pattern) {
+			log.Printf("[processor] Warning: skipping invalid excluded domain %q", e)
+			continue
+		}
+		if !policy.ValidDomainAction(action) {
+			log.Printf("[processor] Warning: skipping excluded domain %q: unknown action %q", e, action)
+			continue
+		}
+		rules = append(rules, domainRule{pattern: pattern, glob: strings.ContainsAny(pattern, "*?["), action: action})
+	}
+	return rules
+}
+
+// matchDomain returns the action of the first rule matching name, preferring
+// drop over redact when several rules match. It returns "" for no match and
+// for Zeek unset markers.
+func matchDomain(name string, rules []domainRule) string {
+	if name == "" || zeekUnsetMarkers[name] || name == redactedValue {
+		return ""
+	}
+	name = policy.NormalizeDomain(name)
+	matched := ""
+	for _, r := range rules {
+		var ok bool
+		if r.glob {
+			ok, _ = path.Match(r.pattern, name)
+		} else {
+			ok = name == r.pattern || strings.HasSuffix(name, "."+r.pattern)
+		}
+		if !ok {
+			continue
+		}
+		if r.action == policy.DomainDrop {
+			return policy.DomainDrop
+		}
+		matched = r.action
+	}
+	return matched
+}
+
+// domainFilter is the rowFilter for excluded_domains rules.
+type domainFilter struct {
+	rules []domainRule
+}
+
+// bind locates the name and set-of-name columns of a log by name.
+func (f domainFilter) bind(h *logHeader, _ *FilterStats) func([]string) rowAction {
+	var nameIdx []int
+	var setIdx []int
+	for i, name := range h.fields {
+		switch {
+		case domainFields[name]:
+			nameIdx = append(nameIdx, i)
+		case domainSetFields[name]:
+			setIdx = append(setIdx, i)
+		}
+	}
+	if len(nameIdx) == 0 && len(setIdx) == 0 {
+		return nil
+	}
+	queryIdx := h.index("query")
+	return func(cols []string) rowAction {
+		return applyDomainRules(cols, nameIdx, setIdx, queryIdx, h.setSep, f.rules)
+	}
+}
+
+// applyDomainRules checks every name column (nameIdx) and every element of
+// every set-valued column (setIdx, split on setSep) against the rules. Any drop
+// match drops the row; redact matches are replaced with redactedValue in cols.
+// When the dns query itself (queryIdx) is redacted, the set-valued columns are
+// redacted wholesale.
+func applyDomainRules(cols []string, nameIdx, setIdx []int, queryIdx int, setSep string, rules []domainRule) rowAction {
+	redactSets := false
+	var redactIdx []int
+	for _, idx := range nameIdx {
+		if idx >= len(cols) {
+			continue
+		}
+		switch matchDomain(cols[idx], rules) {
+		case policy.DomainDrop:
+			return rowDropped
+		case policy.DomainRedact:
+			redactIdx = append(redactIdx, idx)
+			if idx == queryIdx {
+				redactSets = true
+			}
+		}
+	}
+	type elemEdit struct{ col, elem int }
+	var elemEdits []elemEdit
+	for _, idx := range setIdx {
+		if idx >= len(cols) || cols[idx] == "" || zeekUnsetMarkers[cols[idx]] {
+			continue
+		}
+		for i, v := range strings.Split(cols[idx], setSep) {
+			switch matchDomain(v, rules) {
+			case policy.DomainDrop:
+				return rowDropped
+			case policy.DomainRedact:
+				elemEdits = append(elemEdits, elemEdit{col: idx, elem: i})
+			}
+		}
+	}
+	if len(redactIdx) == 0 && len(elemEdits) == 0 {
+		return rowPassed
+	}
+	for _, idx := range redactIdx {
+		cols[idx] = redactedValue
+	}
+	if redactSets {
+		for _, idx := range setIdx {
+			if idx < len(cols) && cols[idx] != "" && !zeekUnsetMarkers[cols[idx]] {
+				cols[idx] = redactedValue
+			}
+		}
+		return rowRedacted
+	}
+	for _, e := range elemEdits {
+		elems := strings.Split(cols[e.col], setSep)
+		elems[e.elem] = redactedValue
+		cols[e.col] = strings.Join(elems, setSep)
+	}
+	return rowRedacted
+}
@@ -0,0 +1,138 @@
+package types
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"EnigmaNetz/Enigma-Go-Sensor/internal/policy"
+)
+
+func TestFilterLogs_DNSQueryDropAndRedact(t *testing.T) {
+	dir := t.TempDir()
+	hdr := zeekHeader("dns", "ts", "uid", "id.orig_h", "id.resp_h", "query", "qtype_name", "answers")
+	path := writeLog(t, dir, "dns.log", hdr,
+		row("1", "Q1", "192.168.1.10", "192.168.1.1", "payroll.hr.corp", "A", "10.8.0.4"),              // drop
+		row("2", "Q2", "192.168.1.10", "192.168.1.1", "MyChart.Health.Example.", "A", "93.184.216.34"), // redact
+		row("3", "Q3", "192.168.1.10", "192.168.1.1", "www.example.com", "A", "93.184.216.34"),         // keep
+		row("4", "Q4", "192.168.1.10", "192.168.1.1", "hr.corp", "A", "10.8.0.5"),                      // not a subdomain of *.hr.corp
+	)
+
+	report, err := FilterLogs(dir, []string{"dns.log"}, FilterOptions{
+		ExcludedDomains: []string{"*.hr.corp", "health.example=redact"},
+	})
+	if err != nil {
+		t.Fatalf("FilterLogs: %v", err)
+	}
+
+	want := []string{
+		row("2", "Q2", "192.168.1.10", "192.168.1.1", "(redacted)", "A", "(redacted)"),
+		row("3", "Q3", "192.168.1.10", "192.168.1.1", "www.example.com", "A", "93.184.216.34"),
+		row("4", "Q4", "192.168.1.10", "192.168.1.1", "hr.corp", "A", "10.8.0.5"),
+	}
+	rows := readDataRows(t, path)
+	if strings.Join(rows, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected rows:\n got %v\nwant %v", rows, want)
+	}
+	if got := report["dns.log"]; !reflect.DeepEqual(got, FilterStats{Dropped: 1, Redacted: 1, Passed: 2}) {
+		t.Errorf("unexpected stats %+v", got)
+	}
+}
+
+func TestFilterLogs_DNSAnswerNames(t *testing.T) {
+	dir := t.TempDir()
+	hdr := zeekHeader("dns", "ts", "uid", "query", "answers")
+	path := writeLog(t, dir, "dns.log", hdr,
+		// CNAME into a redacted domain: only that element is redacted
+		row("1", "A1", "login.example.com", "login.sso.hr.corp,10.8.0.4"),
+		// CNAME into a dropped domain drops the row
+		row("2", "A2", "cdn.example.com", "edge.legal.corp,1.2.3.4"),
+	)
+
+	if _, err := FilterLogs(dir, []string{"dns.log"}, FilterOptions{
+		ExcludedDomains: []string{"hr.corp=redact", "legal.corp"},
+	}); err != nil {
+		t.Fatalf("FilterLogs: %v", err)
+	}
+
+	rows := readDataRows(t, path)
+	want := row("1", "A1", "login.example.com", "(redacted),10.8.0.4")
+	if len(rows) != 1 || rows[0] != want {
+		t.Fatalf("expected only %q, got %v", want, rows)
+	}
+}
+
+func TestFilterLogs_TLSServerName(t *testing.T) {
+	dir := t.TempDir()
+	hdr := zeekHeader("ja3_ja4", "ts", "uid", "id.orig_h", "id.resp_h", "ja3", "server_name")
+	path := writeLog(t, dir, "ja3_ja4.log", hdr,
+		row("1", "T1", "192.168.1.10", "1.1.1.1", "abc", "benefits.hr.corp"),
+		row("2", "T2", "192.168.1.10", "1.1.1.1", "abc", "portal.health.example"),
+		row("3", "T3", "192.168.1.10", "1.1.1.1", "abc", "-"),
+	)
+
+	if _, err := FilterLogs(dir, []string{"ja3_ja4.log"}, FilterOptions{
+		ExcludedDomains: []string{"*.hr.corp", "health.example=redact"},
+	}); err != nil {
+		t.Fatalf("FilterLogs: %v", err)
+	}
+
+	want := []string{
+		row("2", "T2", "192.168.1.10", "1.1.1.1", "abc", "(redacted)"),
+		row("3", "T3", "192.168.1.10", "1.1.1.1", "abc", "-"),
+	}
+	rows := readDataRows(t, path)
+	if strings.Join(rows, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected rows:\n got %v\nwant %v", rows, want)
+	}
+}
+
+func TestFilterLogs_SubnetsAndDomainsInOnePass(t *testing.T) {
+	dir := t.TempDir()
+	hdr := zeekHeader("dns", "ts", "uid", "id.orig_h", "id.resp_h", "query", "answers")
+	path := writeLog(t, dir, "dns.log", hdr,
+		row("1", "B1", "10.1.1.1", "192.168.1.1", "intranet.hr.corp", "10.8.0.4"),
+		row("2", "B2", "192.168.1.10", "192.168.1.1", "www.example.com", "93.184.216.34"),
+	)
+
+	report, err := FilterLogs(dir, []string{"dns.log"}, FilterOptions{
+		ExcludedSubnets: []string{"10.0.0.0/8=mask"},
+		ExcludedDomains: []string{"hr.corp=redact"},
+	})
+	if err != nil {
+		t.Fatalf("FilterLogs: %v", err)
+	}
+
+	rows := readDataRows(t, path)
+	if rows[0] != row("1", "B1", "0.0.0.0", "192.168.1.1", "(redacted)", "(redacted)") {
+		t.Errorf("expected masked and redacted row, got %q", rows[0])
+	}
+	if got := report["dns.log"]; !reflect.DeepEqual(got, FilterStats{Masked: 1, Redacted: 1, Passed: 1}) {
+		t.Errorf("unexpected stats %+v", got)
+	}
+}
+
+func TestMatchDomain(t *testing.T) {
+	rules := parseDomainRules([]string{"hr.corp", "*.legal.corp=redact", "portal?.health.example=redact", "db[0-9].corp", "[bad"})
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"hr.corp", policy.DomainDrop},
+		{"PAYROLL.HR.CORP.", policy.DomainDrop},
+		{"nothr.corp", ""},
+		{"a.b.legal.corp", policy.DomainRedact},
+		{"legal.corp", ""},
+		{"portal1.health.example", policy.DomainRedact},
+		{"portal12.health.example", ""},
+		{"db7.corp", policy.DomainDrop},
+		{"dbx.corp", ""},
+		{"-", ""},
+		{"10.1.2.3", ""},
+	}
+	for _, tt := range tests {
+		if got := matchDomain(tt.name, rules); got != tt.want {
+			t.Errorf("matchDomain(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
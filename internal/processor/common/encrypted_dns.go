@@ -0,0 +1,317 @@
+package types
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"EnigmaNetz/Enigma-Go-Sensor/internal/processor/common/resolvers"
+)
+
+// EncryptedDNSLogFile is the log of DNS over TLS, HTTPS and QUIC connections
+// a run writes beside the Zeek logs when encrypted DNS detection is enabled,
+// with the resolver's provider and whether the connection bypassed the internal
+// resolvers.
+const EncryptedDNSLogFile = "encrypted_dns.log"
+
+// Encrypted DNS transports of EncryptedDNSConn.
+const (
+	EncryptedDNSDoT = "dot" // DNS over TLS (RFC 7858)
+	EncryptedDNSDoH = "doh" // DNS over HTTPS (RFC 8484), over TLS or QUIC
+	EncryptedDNSDoQ = "doq" // DNS over QUIC (RFC 9250)
+)
+
+// Evidence an EncryptedDNSConn was identified on.
+const (
+	encryptedDNSPort853     = "port_853"     // TCP or UDP port 853, reserved for DoT and DoQ
+	encryptedDNSALPNDoT     = "alpn_dot"     // the client offered ALPN "dot"
+	encryptedDNSALPNDoQ     = "alpn_doq"     // the client offered ALPN "doq"
+	encryptedDNSResolverIP  = "resolver_ip"  // the responder is a listed resolver
+	encryptedDNSResolverSNI = "resolver_sni" // the TLS server name is a listed resolver's
+)
+
+// Encrypted DNS detection keeps at most this many TLS client hellos of a
+// window for matching against conn.log, only those that could identify
+// encrypted DNS at all, and logs at most this many connections, so a flood
+// of them cannot exhaust memory.
+const (
+	maxEncryptedDNSHellos = 100000
+	maxEncryptedDNSConns  = 100000
+)
+
+// EncryptedDNSConn is a connection DetectEncryptedDNS identified as
+// encrypted DNS.
+type EncryptedDNSConn struct {
+	Time       time.Time
+	UID        string
+	OrigH      string
+	OrigP      string
+	RespH      string
+	RespP      string
+	Proto      string // transport protocol (tcp, udp)
+	Transport  string // EncryptedDNSDoT, EncryptedDNSDoH or EncryptedDNSDoQ
+	Provider   string // resolver provider; empty when the resolver is not listed
+	ServerName string // TLS server name (SNI)
+	JA4        string
+	Evidence   []string
+	// Bypass is "T" when the resolver is not an internal address, so the
+	// client resolves names past the corporate DNS, "F" when it is, and ""
+	// when the address was masked.
+	Bypass    string
+	OrigBytes int64
+	RespBytes int64
+}
+
+// resolverCache holds the list loaded from a local resolver file.
+var resolverCache fileCache[*resolvers.List]
+
+// loadResolverList returns the list to identify resolvers with: the file at
+// path over the embedded list, or the embedded list alone when path is
+// empty. The file is re-read when its size or modification time changes; if
+// it is missing or unreadable the last good copy, or the embedded list, is
+// used.
+func loadResolverList(path string) *resolvers.List {
+	if path == "" {
+		return resolvers.Embedded()
+	}
+	list, ok, err := resolverCache.load(path, func() ([]string, error) {
+		return []string{path}, nil
+	}, func([]string) (*resolvers.List, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		list, err := resolvers.Parse(f)
+		if err != nil {
+			return nil, err
+		}
+		list.Fill(resolvers.Embedded())
+		return list, nil
+	}, func(list *resolvers.List, reloaded bool) {
+		log.Printf("[processor] %s %d resolver entries from %s", loadedVerb(reloaded), list.Len(), path)
+	})
+	if !ok {
+		list = resolvers.Embedded()
+	}
+	if err != nil {
+		log.Printf("[processor] Warning: resolver list %s unavailable (%v); using the %s list", path, err, resolverListName(list))
+	}
+	return list
+}
+
+func resolverListName(l *resolvers.List) string {
+	if l == resolvers.Embedded() {
+		return "embedded"
+	}
+	return "previously loaded"
+}
+
+// tlsHello is what ja3_ja4.log recorded of a connection's TLS client hello.
+type tlsHello struct {
+	serverName, ja4 string
+}
+
+// ja4ALPN returns the ALPN part of a JA4 fingerprint: the first and last
+// characters of the first protocol the client offered ("h2", "dt" for "dot",
+// "dq" for "doq"), or "" when there is none.
+func ja4ALPN(ja4 string) string {
+	if len(ja4) < 10 || ja4[8:10] == "00" {
+		return ""
+	}
+	return ja4[8:10]
+}
+
+// DetectEncryptedDNS finds the DNS over TLS, HTTPS and QUIC connections of
+// runDir's conn.log and writes them to EncryptedDNSLogFile, if there are any.
+// It returns their number. DoT and DoQ are identified by port 853 or the
+// client's ALPN in ja3_ja4.log; DoH, which shares port 443 with the web, by
+// a responder address or TLS server name in the resolver list (the embedded
+// one, or opts.ResolversPath over it). Each connection is flagged as a
+// bypass when the resolver is not internal (see SummarizeTraffic). It runs
+// after FilterLogs, and does nothing unless opts.EncryptedDNS is set.
+func DetectEncryptedDNS(runDir string, opts ProcessOptions) (int, error) {
+	if !opts.EncryptedDNS {
+		return 0, nil
+	}
+	list := loadResolverList(opts.ResolversPath)
+	internal := internalAddrFunc(opts.MonitoredSubnets)
+
+	hellos := make(map[string]tlsHello)
+	if _, err := scanLog(filepath.Join(runDir, "ja3_ja4.log"), opts.MemoryLimit, func(h *logHeader) func([]string) {
+		uidIdx, respIdx := h.index("uid"), h.index("id.resp_h")
+		sniIdx, ja4Idx := h.index("server_name"), h.index("ja4")
+		if uidIdx < 0 {
+			return nil
+		}
+		return func(cols []string) {
+			hello := tlsHello{serverName: column(cols, sniIdx), ja4: column(cols, ja4Idx)}
+			if zeekUnsetMarkers[hello.serverName] {
+				hello.serverName = ""
+			}
+			if zeekUnsetMarkers[hello.ja4] {
+				hello.ja4 = ""
+			}
+			_, bySNI := list.ByName(hello.serverName)
+			resp, ok := summaryAddr(column(cols, respIdx))
+			byIP := false
+			if ok {
+				_, byIP = list.ByAddr(resp)
+			}
+			alpn := ja4ALPN(hello.ja4)
+			if (bySNI || byIP || alpn == "dt" || alpn == "dq") && len(hellos) < maxEncryptedDNSHellos {
+				hellos[column(cols, uidIdx)] = hello
+			}
+		}
+	}); err != nil {
+		log.Printf("[processor] Warning: encrypted DNS detection could not read ja3_ja4.log: %v", err)
+	}
+
+	var conns []EncryptedDNSConn
+	dropped := 0
+	present, err := scanLog(filepath.Join(runDir, "conn.log"), opts.MemoryLimit, func(h *logHeader) func([]string) {
+		tsIdx, uidIdx := h.index("ts"), h.index("uid")
+		origIdx, origPortIdx := h.index("id.orig_h"), h.index("id.orig_p")
+		respIdx, respPortIdx := h.index("id.resp_h"), h.index("id.resp_p")
+		protoIdx, serviceIdx := h.index("proto"), h.index("service")
+		origBytesIdx, respBytesIdx := h.index("orig_bytes"), h.index("resp_bytes")
+		if respIdx < 0 || respPortIdx < 0 {
+			return nil
+		}
+		return func(cols []string) {
+			c := EncryptedDNSConn{
+				UID:   column(cols, uidIdx),
+				OrigH: column(cols, origIdx),
+				OrigP: column(cols, origPortIdx),
+				RespH: column(cols, respIdx),
+				RespP: column(cols, respPortIdx),
+				Proto: column(cols, protoIdx),
+			}
+			hello, tls := hellos[c.UID]
+			c.ServerName, c.JA4 = hello.serverName, hello.ja4
+			resp, respOK := summaryAddr(c.RespH)
+			if provider, ok := list.ByName(c.ServerName); ok {
+				c.Provider = provider
+				c.Evidence = append(c.Evidence, encryptedDNSResolverSNI)
+			}
+			if respOK {
+				if provider, ok := list.ByAddr(resp); ok {
+					if c.Provider == "" {
+						c.Provider = provider
+					}
+					c.Evidence = append(c.Evidence, encryptedDNSResolverIP)
+				}
+			}
+			service := column(cols, serviceIdx)
+			encrypted := tls || c.RespP == "443" || strings.Contains(service, "ssl") || strings.Contains(service, "quic")
+			switch alpn := ja4ALPN(c.JA4); {
+			case alpn == "dt":
+				c.Transport = EncryptedDNSDoT
+				c.Evidence = append(c.Evidence, encryptedDNSALPNDoT)
+			case alpn == "dq":
+				c.Transport = EncryptedDNSDoQ
+				c.Evidence = append(c.Evidence, encryptedDNSALPNDoQ)
+			case c.RespP == "853" && c.Proto == "tcp":
+				c.Transport = EncryptedDNSDoT
+				c.Evidence = append(c.Evidence, encryptedDNSPort853)
+			case c.RespP == "853" && c.Proto == "udp":
+				c.Transport = EncryptedDNSDoQ
+				c.Evidence = append(c.Evidence, encryptedDNSPort853)
+			case len(c.Evidence) > 0 && encrypted:
+				c.Transport = EncryptedDNSDoH
+			default:
+				return
+			}
+			if len(conns) >= maxEncryptedDNSConns {
+				dropped++
+				return
+			}
+			c.Time = zeekTime(column(cols, tsIdx))
+			if respOK {
+				c.Bypass = "F"
+				if !internal(resp) {
+					c.Bypass = "T"
+				}
+			}
+			c.OrigBytes = zeekCount(column(cols, origBytesIdx))
+			c.RespBytes = zeekCount(column(cols, respBytesIdx))
+			conns = append(conns, c)
+		}
+	})
+	if err != nil || !present {
+		return 0, err
+	}
+
+	transports := make(map[string]int)
+	clients := make(map[string]bool)
+	for _, c := range conns {
+		transports[c.Transport]++
+		if c.Bypass == "T" {
+			clients[c.OrigH] = true
+		}
+	}
+	if dropped > 0 {
+		log.Printf("[processor] Warning: encrypted DNS log capped at %d connections; %d more were not logged", maxEncryptedDNSConns, dropped)
+	}
+	log.Printf("[processor] Encrypted DNS: %d connections (%d dot, %d doh, %d doq), %d hosts bypassing internal resolvers", len(conns), transports[EncryptedDNSDoT], transports[EncryptedDNSDoH], transports[EncryptedDNSDoQ], len(clients))
+	if len(conns) == 0 {
+		return 0, nil
+	}
+	if err := WriteEncryptedDNSLog(filepath.Join(runDir, EncryptedDNSLogFile), conns); err != nil {
+		return 0, err
+	}
+	return len(conns), nil
+}
+
+// encryptedDNSLogFields are the columns of EncryptedDNSLogFile.
+var encryptedDNSLogFields = []struct{ name, typ string }{
+	{"ts", "time"},
+	{"uid", "string"},
+	{"id.orig_h", "addr"},
+	{"id.orig_p", "port"},
+	{"id.resp_h", "addr"},
+	{"id.resp_p", "port"},
+	{"proto", "enum"},
+	{"transport", "string"},
+	{"provider", "string"},
+	{"server_name", "string"},
+	{"ja4", "string"},
+	{"evidence", "set[string]"},
+	{"bypass", "bool"},
+	{"orig_bytes", "count"},
+	{"resp_bytes", "count"},
+}
+
+// WriteEncryptedDNSLog writes conns as a Zeek TSV log at path.
+func WriteEncryptedDNSLog(path string, conns []EncryptedDNSConn) error {
+	var b strings.Builder
+	writeZeekHeader(&b, "encrypted_dns", encryptedDNSLogFields)
+	for _, c := range conns {
+		row := []string{
+			zeekTimeString(c.Time),
+			zeekString(c.UID),
+			zeekString(c.OrigH),
+			zeekString(c.OrigP),
+			zeekString(c.RespH),
+			zeekString(c.RespP),
+			zeekString(c.Proto),
+			c.Transport,
+			zeekString(c.Provider),
+			zeekString(c.ServerName),
+			zeekString(c.JA4),
+			zeekVector(c.Evidence),
+			zeekString(c.Bypass),
+			strconv.FormatInt(c.OrigBytes, 10),
+			strconv.FormatInt(c.RespBytes, 10),
+		}
+		b.WriteString(strings.Join(row, "\t") + "\n")
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package types
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const encryptedDNSTestHellos = "#separator \\x09\n#set_separator\t,\n#path\tja3_ja4\n" +
+	"#fields\tts\tuid\tid.orig_h\tid.orig_p\tid.resp_h\tid.resp_p\tja4\tserver_name\n" +
+	"#types\ttime\tstring\taddr\tport\taddr\tport\tstring\tstring\n" +
+	"1000.000000\tC1\t192.168.1.10\t50000\t104.16.248.249\t443\tt13d1516h2_8daaf6152771_e5627efa2ab1\tmozilla.cloudflare-dns.com\n" +
+	"1001.000000\tC2\t192.168.1.10\t50001\t93.184.216.34\t443\tt13d1516h2_8daaf6152771_e5627efa2ab1\twww.example.com\n" +
+	"1002.000000\tC3\t192.168.1.20\t50002\t198.51.100.7\t8853\tt13d0303dt_8daaf6152771_e5627efa2ab1\t-\n"
+
+// encryptedDNSTestConn has DoH by server name and by address, DoT by ALPN
+// and port, DoQ, a corporate resolver, and web and plain DNS traffic that
+// must not be flagged.
+const encryptedDNSTestConn = "#separator \\x09\n#set_separator\t,\n#path\tconn\n" +
+	"#fields\tts\tuid\tid.orig_h\tid.orig_p\tid.resp_h\tid.resp_p\tproto\tservice\torig_bytes\tresp_bytes\n" +
+	"#types\ttime\tstring\taddr\tport\taddr\tport\tenum\tstring\tcount\tcount\n" +
+	"1000.000000\tC1\t192.168.1.10\t50000\t104.16.248.249\t443\ttcp\tssl\t900\t4000\n" +
+	"1001.000000\tC2\t192.168.1.10\t50001\t93.184.216.34\t443\ttcp\tssl\t800\t90000\n" +
+	"1002.000000\tC3\t192.168.1.20\t50002\t198.51.100.7\t8853\ttcp\t-\t300\t600\n" +
+	"1003.000000\tC4\t192.168.1.20\t50003\t9.9.9.9\t853\ttcp\t-\t200\t400\n" +
+	"1004.000000\tC5\t192.168.1.30\t50004\t8.8.8.8\t443\tudp\tquic\t1200\t2400\n" +
+	"1005.000000\tC6\t192.168.1.30\t50005\t8.8.8.8\t53\tudp\tdns\t40\t80\n" +
+	"1006.000000\tC7\t192.168.1.40\t50006\t192.168.1.53\t853\ttcp\t-\t100\t200\n" +
+	"1007.000000\tC8\t192.168.1.40\t50007\t192.168.1.53\t853\tudp\t-\t100\t200\n"
+
+func TestDetectEncryptedDNS(t *testing.T) {
+	runDir := t.TempDir()
+	writeTestFile(t, runDir, "ja3_ja4.log", encryptedDNSTestHellos)
+	writeTestFile(t, runDir, "conn.log", encryptedDNSTestConn)
+
+	if n, err := DetectEncryptedDNS(runDir, ProcessOptions{}); n != 0 || err != nil {
+		t.Fatalf("disabled: %d, %v", n, err)
+	}
+	n, err := DetectEncryptedDNS(runDir, ProcessOptions{EncryptedDNS: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// uid, transport, provider, server_name, evidence, bypass
+	want := []string{
+		"C1 doh Cloudflare mozilla.cloudflare-dns.com resolver_sni T",
+		"C3 dot - - alpn_dot T",
+		"C4 dot Quad9 - resolver_ip,port_853 T",
+		"C5 doh Google - resolver_ip T",
+		"C7 dot - - port_853 F",
+		"C8 doq - - port_853 F",
+	}
+	if got := encryptedDNSRows(t, runDir); !reflect.DeepEqual(got, want) {
+		t.Errorf("rows =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if n != len(want) {
+		t.Errorf("returned %d connections, want %d", n, len(want))
+	}
+
+	// A local list adds the corporate resolver over the embedded one.
+	resolversPath := filepath.Join(t.TempDir(), "resolvers.csv")
+	writeTestFile(t, filepath.Dir(resolversPath), "resolvers.csv", "provider,type,value\nCorp,ip,192.168.1.53\n")
+	if _, err := DetectEncryptedDNS(runDir, ProcessOptions{EncryptedDNS: true, ResolversPath: resolversPath}); err != nil {
+		t.Fatal(err)
+	}
+	rows := encryptedDNSRows(t, runDir)
+	if rows[3] != "C5 doh Google - resolver_ip T" || rows[4] != "C7 dot Corp - resolver_ip,port_853 F" {
+		t.Errorf("with local list: %v", rows)
+	}
+}
+
+// encryptedDNSRows returns the identifying columns of runDir's
+// EncryptedDNSLogFile.
+func encryptedDNSRows(t *testing.T, runDir string) []string {
+	t.Helper()
+	lines := readLines(t, filepath.Join(runDir, EncryptedDNSLogFile))
+	var rows []string
+	for _, l := range lines[7:] {
+		cols := strings.Split(l, "\t")
+		rows = append(rows, strings.Join([]string{cols[1], cols[7], cols[8], cols[9], cols[11], cols[12]}, " "))
+	}
+	return rows
+}
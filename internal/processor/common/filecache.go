@@ -0,0 +1,77 @@
+package types
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// fileCache holds a value read from local files (intel feeds, GeoIP
+// databases, OUI and resolver lists), so workers share one copy and the
+// files are only read again when they change.
+type fileCache[T any] struct {
+	mu     sync.Mutex
+	key    string // what the value was read for, e.g. the configured path
+	state  string // the files read, with their sizes and modification times
+	value  T
+	loaded bool
+}
+
+// load returns the value for key, read from the files listFiles returns. The
+// files are read with read the first time, and again whenever one of them is
+// added, removed, or changes size or modification time; onLoad is then called
+// with the new value and whether it replaces an earlier one. When the files
+// cannot be listed, stated or read, the error is returned with the last value
+// read for key, and ok reports whether there is one.
+func (c *fileCache[T]) load(key string, listFiles func() ([]string, error), read func(files []string) (T, error), onLoad func(v T, reloaded bool)) (v T, ok bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var previous T
+	hasPrevious := c.loaded && c.key == key
+	if hasPrevious {
+		previous = c.value
+	}
+	files, err := listFiles()
+	if err != nil {
+		return previous, hasPrevious, err
+	}
+	state, err := filesState(files)
+	if err != nil {
+		return previous, hasPrevious, err
+	}
+	if hasPrevious && c.state == state {
+		return previous, true, nil
+	}
+	value, err := read(files)
+	if err != nil {
+		return previous, hasPrevious, err
+	}
+	c.key, c.state, c.value, c.loaded = key, state, value, true
+	if onLoad != nil {
+		onLoad(value, hasPrevious)
+	}
+	return value, true, nil
+}
+
+// filesState describes files by name, size and modification time, so it
+// changes whenever one of them does.
+func filesState(files []string) (string, error) {
+	var sb strings.Builder
+	for _, f := range files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&sb, "%s %d %d\n", f, fi.Size(), fi.ModTime().UnixNano())
+	}
+	return sb.String(), nil
+}
+
+// loadedVerb is the word logs use for a value onLoad is called with.
+func loadedVerb(reloaded bool) string {
+	if reloaded {
+		return "Reloaded"
+	}
+	return "Loaded"
+}
@@ -0,0 +1,68 @@
+package types
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileCache_ReloadsOnChange(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "list.txt")
+	writeTestFile(t, dir, "list.txt", "one")
+
+	var c fileCache[string]
+	reads, reloads := 0, 0
+	list := func() ([]string, error) { return []string{path}, nil }
+	read := func(files []string) (string, error) {
+		reads++
+		b, err := os.ReadFile(files[0])
+		if string(b) == "bad" {
+			return "", errors.New("unparsable")
+		}
+		return string(b), err
+	}
+	onLoad := func(_ string, reloaded bool) {
+		if reloaded {
+			reloads++
+		}
+	}
+	load := func() (string, bool, error) { return c.load(path, list, read, onLoad) }
+
+	for i := 0; i < 2; i++ {
+		if v, ok, err := load(); v != "one" || !ok || err != nil {
+			t.Fatalf("load = %q, %v, %v", v, ok, err)
+		}
+	}
+	if reads != 1 {
+		t.Errorf("unchanged file read %d times", reads)
+	}
+
+	writeTestFile(t, dir, "list.txt", "two!")
+	if v, _, _ := load(); v != "two!" || reads != 2 || reloads != 1 {
+		t.Errorf("changed file: %q after %d reads, %d reloads", v, reads, reloads)
+	}
+
+	// A file that cannot be read or parsed leaves the last good value.
+	writeTestFile(t, dir, "list.txt", "bad")
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok, err := load(); v != "two!" || !ok || err == nil {
+		t.Errorf("unparsable file: load = %q, %v, %v", v, ok, err)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok, err := load(); v != "two!" || !ok || !os.IsNotExist(err) {
+		t.Errorf("missing file: load = %q, %v, %v", v, ok, err)
+	}
+
+	// Nothing is returned for another key.
+	if v, ok, err := c.load("other", list, read, onLoad); v != "" || ok || err == nil {
+		t.Errorf("other key: load = %q, %v, %v", v, ok, err)
+	}
+}
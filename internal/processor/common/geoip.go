@@ -0,0 +1,325 @@
+package types
+
+import (
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"EnigmaNetz/Enigma-Go-Sensor/internal/processor/common/mmdb"
+)
+
+// geoIPColumns are the columns EnrichGeoIP appends, with their Zeek types.
+var geoIPColumns = []struct{ name, typ string }{
+	{"orig_cc", "string"},
+	{"resp_cc", "string"},
+	{"resp_asn", "count"},
+	{"resp_as_org", "string"},
+}
+
+// geoIPLogs are the log streams (#path) EnrichGeoIP adds the columns to:
+// conn.log and the TLS fingerprint logs.
+var geoIPLogs = map[string]bool{"conn": true, "ja3_ja4": true, "ja4s": true}
+
+// nonPublicPrefixes are the special-purpose ranges, beyond those netip
+// already classifies as private or non-unicast, that no database places.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local-use NAT64
+}
+
+// geoIPEligible reports whether a is a public address worth looking up.
+func geoIPEligible(a netip.Addr) bool {
+	a = a.Unmap()
+	if !a.IsGlobalUnicast() || a.IsPrivate() {
+		return false
+	}
+	for _, p := range nonPublicPrefixes {
+		if p.Contains(a) {
+			return false
+		}
+	}
+	return true
+}
+
+// geoIPDatabase is one loaded .mmdb file.
+type geoIPDatabase struct {
+	path   string
+	reader *mmdb.Reader
+}
+
+// String describes the database for logs and upload metadata, e.g.
+// "GeoLite2-ASN 2026-10-14".
+func (d *geoIPDatabase) String() string {
+	name := d.reader.Metadata.DatabaseType
+	if name == "" {
+		name = filepath.Base(d.path)
+	}
+	built := time.Unix(int64(d.reader.Metadata.BuildEpoch), 0).UTC().Format("2006-01-02")
+	return name + " " + built
+}
+
+// geoIPCache holds the databases loaded so far, by file path.
+var geoIPCache = struct {
+	sync.Mutex
+	dbs map[string]*fileCache[*geoIPDatabase]
+}{dbs: make(map[string]*fileCache[*geoIPDatabase])}
+
+// loadGeoIPDatabases returns the databases at path: a single .mmdb file, or
+// every .mmdb file in a directory. A file whose size or modification time has
+// changed since it was loaded is read again; if the new copy is unreadable
+// (e.g. still being replaced) the previous one keeps being used. A missing
+// path is not an error: it yields no databases.
+func loadGeoIPDatabases(path string) ([]*geoIPDatabase, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	files := []string{path}
+	if fi.IsDir() {
+		if files, err = filepath.Glob(filepath.Join(path, "*.mmdb")); err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+	}
+
+	var dbs []*geoIPDatabase
+	for _, f := range files {
+		geoIPCache.Lock()
+		cache := geoIPCache.dbs[f]
+		if cache == nil {
+			cache = &fileCache[*geoIPDatabase]{}
+			geoIPCache.dbs[f] = cache
+		}
+		geoIPCache.Unlock()
+		db, ok, err := cache.load(f, func() ([]string, error) {
+			return []string{f}, nil
+		}, func([]string) (*geoIPDatabase, error) {
+			r, err := mmdb.Open(f)
+			if err != nil {
+				return nil, err
+			}
+			return &geoIPDatabase{path: f, reader: r}, nil
+		}, func(db *geoIPDatabase, reloaded bool) {
+			log.Printf("[processor] %s GeoIP database %s (%s)", loadedVerb(reloaded), f, db)
+		})
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue // removed since the directory was listed
+			}
+			log.Printf("[processor] Warning: could not load GeoIP database %s: %v", f, err)
+		}
+		if ok {
+			dbs = append(dbs, db)
+		}
+	}
+	return dbs, nil
+}
+
+// geoInfo is what the databases say about one address; empty = unknown.
+type geoInfo struct {
+	country string
+	asn     string
+	asOrg   string
+}
+
+// geoIPLookup resolves addresses against a set of databases for one run.
+// Decoded records are cached by their location in the database: many
+// networks share a record, so the cache stays small.
+type geoIPLookup struct {
+	dbs   []*geoIPDatabase
+	cache map[geoIPRecordKey]geoInfo
+}
+
+type geoIPRecordKey struct {
+	db     int
+	offset int
+}
+
+func newGeoIPLookup(dbs []*geoIPDatabase) *geoIPLookup {
+	return &geoIPLookup{dbs: dbs, cache: make(map[geoIPRecordKey]geoInfo)}
+}
+
+// lookup merges what each database knows about a, the first database (in
+// file name order) to supply a value winning. Country databases supply the
+// country and ASN databases the AS; a city database supplies the country too.
+func (g *geoIPLookup) lookup(a netip.Addr) geoInfo {
+	var info geoInfo
+	for i, db := range g.dbs {
+		offset, ok, err := db.reader.LookupOffset(a)
+		if !ok || err != nil {
+			continue
+		}
+		key := geoIPRecordKey{i, offset}
+		rec, ok := g.cache[key]
+		if !ok {
+			v, err := db.reader.Decode(offset)
+			if err == nil {
+				rec = geoRecord(v)
+			}
+			g.cache[key] = rec
+		}
+		if info.country == "" {
+			info.country = rec.country
+		}
+		if info.asn == "" {
+			info.asn, info.asOrg = rec.asn, rec.asOrg
+		}
+	}
+	return info
+}
+
+// geoRecord extracts the fields the sensor uses from a GeoIP2/GeoLite2
+// country, city or ASN record.
+func geoRecord(v any) geoInfo {
+	m, _ := v.(map[string]any)
+	var info geoInfo
+	for _, k := range []string{"country", "registered_country"} {
+		if c, ok := m[k].(map[string]any); ok {
+			if cc, ok := c["iso_code"].(string); ok && cc != "" {
+				info.country = cc
+				break
+			}
+		}
+	}
+	if n, ok := m["autonomous_system_number"].(uint64); ok {
+		info.asn = strconv.FormatUint(n, 10)
+		info.asOrg, _ = m["autonomous_system_organization"].(string)
+	}
+	return info
+}
+
+// EnrichGeoIP appends orig_cc, resp_cc, resp_asn and resp_as_org columns to
+// conn.log and the TLS fingerprint logs in runDir, looked up in the MaxMind
+// format (.mmdb) databases at dbPath: one file, or a directory of them (e.g.
+// GeoLite2-Country.mmdb and GeoLite2-ASN.mmdb). Private and other non-public
+// addresses, and addresses no database places, get "-". It must run before
+// any address masking.
+//
+// dbPath empty disables enrichment. A missing or unreadable database is not an
+// error: the logs are left unenriched. The returned descriptions of the
+// databases used (name and build date) are for the upload metadata; nil means
+// nothing was enriched. limit is the worker memory budget in bytes
+// (0 = DefaultMemoryLimit); the databases themselves are shared by all
+// workers and held outside it.
+func EnrichGeoIP(runDir string, logFiles []string, dbPath string, limit int64) ([]string, error) {
+	if dbPath == "" {
+		return nil, nil
+	}
+	dbs, err := loadGeoIPDatabases(dbPath)
+	if err != nil {
+		log.Printf("[processor] Warning: GeoIP databases at %s unavailable (%v); logs are not enriched", dbPath, err)
+		return nil, nil
+	}
+	if len(dbs) == 0 {
+		log.Printf("[processor] Warning: no GeoIP database found at %s; logs are not enriched", dbPath)
+		return nil, nil
+	}
+	lookup := newGeoIPLookup(dbs)
+	for _, name := range logFiles {
+		enriched := 0
+		_, _, err := rewriteLogWith(filepath.Join(runDir, name), limit, func(h *logHeader) *logRewrite {
+			return geoIPRewrite(h, lookup, &enriched)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("geoip %s: %w", name, err)
+		}
+		if enriched > 0 {
+			log.Printf("[processor] Added GeoIP columns to %d rows of %s", enriched, name)
+		}
+	}
+	described := make([]string, len(dbs))
+	for i, db := range dbs {
+		described[i] = db.String()
+	}
+	return described, nil
+}
+
+// geoIPRewrite builds the rewrite adding the GeoIP columns to one log, or
+// returns nil when the log is not enriched or already has them.
+func geoIPRewrite(h *logHeader, lookup *geoIPLookup, enriched *int) *logRewrite {
+	origH, respH := h.index("id.orig_h"), h.index("id.resp_h")
+	if !geoIPLogs[h.path] || origH < 0 || respH < 0 || h.index(geoIPColumns[0].name) >= 0 {
+		return nil
+	}
+	info := func(s string) geoInfo {
+		a, err := netip.ParseAddr(s)
+		if err != nil || !geoIPEligible(a) {
+			return geoInfo{}
+		}
+		return lookup.lookup(a)
+	}
+	value := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return escapeZeekValue(s, h.sep)
+	}
+
+	row := func(line string) (string, bool) {
+		cols := strings.Split(line, h.sep)
+		var orig, resp geoInfo
+		if origH < len(cols) {
+			orig = info(cols[origH])
+		}
+		if respH < len(cols) {
+			resp = info(cols[respH])
+		}
+		if orig != (geoInfo{}) || resp != (geoInfo{}) {
+			*enriched++
+		}
+		return strings.Join([]string{line, value(orig.country), value(resp.country), value(resp.asn), value(resp.asOrg)}, h.sep), true
+	}
+	meta := func(line string) string {
+		var add []string
+		switch {
+		case strings.HasPrefix(line, "#fields"+h.sep):
+			for _, c := range geoIPColumns {
+				add = append(add, c.name)
+			}
+		case strings.HasPrefix(line, "#types"+h.sep) && len(h.types) > 0:
+			for _, c := range geoIPColumns {
+				add = append(add, c.typ)
+			}
+		default:
+			return line
+		}
+		return line + h.sep + strings.Join(add, h.sep)
+	}
+	return &logRewrite{row: row, meta: meta}
+}
+
+// escapeZeekValue \xNN-escapes the separator and line breaks in a value, as
+// Zeek's ASCII writer does, so a database string cannot corrupt the log's
+// framing.
+func escapeZeekValue(s, sep string) string {
+	if !strings.Contains(s, sep) && !strings.ContainsAny(s, "\n\r") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\n' || c == '\r' || strings.HasPrefix(s[i:], sep) {
+			fmt.Fprintf(&b, `\x%02x`, c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
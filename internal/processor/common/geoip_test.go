@@ -0,0 +1,230 @@
+package types
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"EnigmaNetz/Enigma-Go-Sensor/internal/processor/common/mmdb"
+)
+
+// writeMMDB writes a test database mapping each prefix to its record.
+func writeMMDB(t *testing.T, path, dbType string, records map[string]map[string]any) {
+	t.Helper()
+	b := &mmdb.Builder{DatabaseType: dbType}
+	for prefix, rec := range records {
+		if err := b.Insert(netip.MustParsePrefix(prefix), rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := b.WriteTo(f); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func country(cc string) map[string]any {
+	return map[string]any{"country": map[string]any{"iso_code": cc}}
+}
+
+func asn(n uint32, org string) map[string]any {
+	return map[string]any{"autonomous_system_number": n, "autonomous_system_organization": org}
+}
+
+// geoIPRunDir writes a conn.log, dns.log and ja4s.log to a new run
+// directory. Only conn.log and ja4s.log are GeoIP logs.
+func geoIPRunDir(t *testing.T) string {
+	t.Helper()
+	runDir := t.TempDir()
+	writeLog(t, runDir, "conn.log", zeekHeader("conn", "ts", "uid", "id.orig_h", "id.orig_p", "id.resp_h", "id.resp_p", "proto"),
+		row("1.0", "C1", "192.168.1.10", "50000", "8.8.8.8", "443", "tcp"),
+		row("2.0", "C2", "81.2.69.160", "50001", "2a00:1450::1", "443", "tcp"),
+		row("3.0", "C3", "10.0.0.1", "50002", "10.0.0.2", "53", "udp"))
+	writeLog(t, runDir, "dns.log", zeekHeader("dns", "ts", "uid", "id.orig_h", "id.orig_p", "id.resp_h", "id.resp_p", "query"),
+		row("1.0", "D1", "192.168.1.10", "50000", "8.8.8.8", "53", "example.com"))
+	writeLog(t, runDir, "ja4s.log", zeekHeader("ja4s", "ts", "uid", "id.orig_h", "id.orig_p", "id.resp_h", "id.resp_p", "ja4s"),
+		row("1.0", "C1", "192.168.1.10", "50000", "8.8.8.8", "443", "t13_1301_abc"))
+	return runDir
+}
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func TestEnrichGeoIP(t *testing.T) {
+	dbDir := t.TempDir()
+	writeMMDB(t, filepath.Join(dbDir, "GeoLite2-ASN.mmdb"), "GeoLite2-ASN", map[string]map[string]any{
+		"8.8.8.0/24":     asn(15169, "GOOGLE"),
+		"2a00:1450::/32": asn(15169, "GOOGLE\tLLC"),
+	})
+	writeMMDB(t, filepath.Join(dbDir, "GeoLite2-Country.mmdb"), "GeoLite2-Country", map[string]map[string]any{
+		"8.8.8.0/24":     country("US"),
+		"81.2.69.0/24":   country("GB"),
+		"2a00:1450::/32": country("IE"),
+		"10.0.0.0/8":     country("ZZ"), // private: must never be looked up
+	})
+	runDir := geoIPRunDir(t)
+	dns, err := os.ReadFile(filepath.Join(runDir, "dns.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbs, err := EnrichGeoIP(runDir, ZeekLogFiles, dbDir, 0)
+	if err != nil {
+		t.Fatalf("EnrichGeoIP: %v", err)
+	}
+	if len(dbs) != 2 || !strings.HasPrefix(dbs[0], "GeoLite2-ASN ") || !strings.HasPrefix(dbs[1], "GeoLite2-Country ") {
+		t.Errorf("databases = %v", dbs)
+	}
+
+	connPath := filepath.Join(runDir, "conn.log")
+	if fields, types := readHeaderLine(t, connPath, "fields"), readHeaderLine(t, connPath, "types"); !strings.HasSuffix(fields, "\tproto\torig_cc\tresp_cc\tresp_asn\tresp_as_org") ||
+		!strings.HasSuffix(types, "\tstring\tstring\tstring\tcount\tstring") {
+		t.Errorf("conn.log header not extended:\n%s\n%s", fields, types)
+	}
+	conn := readDataRows(t, connPath)
+	want := []string{
+		"\ttcp\t-\tUS\t15169\tGOOGLE",
+		"\ttcp\tGB\tIE\t15169\tGOOGLE\\x09LLC",
+		"\tudp\t-\t-\t-\t-",
+	}
+	for i, suffix := range want {
+		if !strings.HasSuffix(conn[i], suffix) {
+			t.Errorf("conn row %d = %q, want suffix %q", i, conn[i], suffix)
+		}
+	}
+	if ja4s := readDataRows(t, filepath.Join(runDir, "ja4s.log")); !strings.HasSuffix(ja4s[0], "\tt13_1301_abc\t-\tUS\t15169\tGOOGLE") {
+		t.Errorf("ja4s row = %q", ja4s[0])
+	}
+	if data, _ := os.ReadFile(filepath.Join(runDir, "dns.log")); string(data) != string(dns) {
+		t.Error("dns.log is not a GeoIP log and should be untouched")
+	}
+
+	// Already enriched logs are not extended twice.
+	before, _ := os.ReadFile(filepath.Join(runDir, "conn.log"))
+	if _, err := EnrichGeoIP(runDir, ZeekLogFiles, dbDir, 0); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := os.ReadFile(filepath.Join(runDir, "conn.log")); string(after) != string(before) {
+		t.Error("EnrichGeoIP is not idempotent")
+	}
+}
+
+// TestEnrichGeoIP_MaskedEndpoints checks that the GeoIP columns of an
+// endpoint a subnet policy masked or truncated are unset, while those of the
+// other endpoint are kept.
+func TestEnrichGeoIP_MaskedEndpoints(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "geo.mmdb")
+	writeMMDB(t, dbPath, "GeoLite2-City", map[string]map[string]any{
+		"8.8.8.0/24":     {"country": map[string]any{"iso_code": "US"}, "autonomous_system_number": uint32(15169), "autonomous_system_organization": "GOOGLE"},
+		"81.2.69.0/24":   country("GB"),
+		"2a00:1450::/32": country("IE"),
+	})
+	runDir := geoIPRunDir(t)
+	if _, err := EnrichGeoIP(runDir, []string{"conn.log"}, dbPath, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FilterExcludedSubnets(runDir, []string{"conn.log"},
+		[]string{"8.8.8.0/24=truncate-to-prefix", "81.2.69.0/24=mask"}); err != nil {
+		t.Fatal(err)
+	}
+	conn := readDataRows(t, filepath.Join(runDir, "conn.log"))
+	want := []string{
+		"\t8.8.8.0\t443\ttcp\t-\t-\t-\t-",
+		"\t0.0.0.0\t50001\t2a00:1450::1\t443\ttcp\t-\tIE\t-\t-",
+	}
+	for i, suffix := range want {
+		if !strings.HasSuffix(conn[i], suffix) {
+			t.Errorf("conn row %d = %q, want suffix %q", i, conn[i], suffix)
+		}
+	}
+}
+
+func TestEnrichGeoIP_ReloadsChangedDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "country.mmdb")
+	writeMMDB(t, dbPath, "GeoLite2-Country", map[string]map[string]any{"8.8.8.0/24": country("US")})
+
+	runDir := geoIPRunDir(t)
+	if _, err := EnrichGeoIP(runDir, []string{"conn.log"}, dbPath, 0); err != nil {
+		t.Fatal(err)
+	}
+	if conn := readDataRows(t, filepath.Join(runDir, "conn.log")); !strings.HasSuffix(conn[0], "\t-\tUS\t-\t-") {
+		t.Fatalf("first run row = %q", conn[0])
+	}
+
+	writeMMDB(t, dbPath, "GeoLite2-Country", map[string]map[string]any{"8.8.8.0/24": country("CA"), "81.2.69.0/24": country("GB")})
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(dbPath, later, later); err != nil {
+		t.Fatal(err)
+	}
+	runDir = geoIPRunDir(t)
+	if _, err := EnrichGeoIP(runDir, []string{"conn.log"}, dbPath, 0); err != nil {
+		t.Fatal(err)
+	}
+	if conn := readDataRows(t, filepath.Join(runDir, "conn.log")); !strings.HasSuffix(conn[0], "\t-\tCA\t-\t-") {
+		t.Errorf("row after reload = %q", conn[0])
+	}
+
+	// A corrupt replacement keeps the previously loaded copy in use.
+	if err := os.WriteFile(dbPath, []byte("not a database"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runDir = geoIPRunDir(t)
+	if dbs, err := EnrichGeoIP(runDir, []string{"conn.log"}, dbPath, 0); err != nil || len(dbs) != 1 {
+		t.Fatalf("EnrichGeoIP with corrupt file = %v, %v", dbs, err)
+	}
+	if conn := readDataRows(t, filepath.Join(runDir, "conn.log")); !strings.HasSuffix(conn[0], "\t-\tCA\t-\t-") {
+		t.Errorf("row with corrupt replacement = %q", conn[0])
+	}
+}
+
+func TestEnrichGeoIP_MissingDatabase(t *testing.T) {
+	runDir := geoIPRunDir(t)
+	conn, err := os.ReadFile(filepath.Join(runDir, "conn.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"", filepath.Join(t.TempDir(), "missing.mmdb"), t.TempDir()} {
+		dbs, err := EnrichGeoIP(runDir, ZeekLogFiles, path, 0)
+		if err != nil || dbs != nil {
+			t.Errorf("EnrichGeoIP(%q) = %v, %v; want nil, nil", path, dbs, err)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(runDir, "conn.log")); string(data) != string(conn) {
+		t.Error("conn.log should be untouched without a database")
+	}
+}
+
+func TestGeoIPEligible(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"8.8.8.8":         true,
+		"2a00:1450::1":    true,
+		"::ffff:8.8.8.8":  true,
+		"10.1.2.3":        false,
+		"192.168.0.1":     false,
+		"100.64.0.1":      false,
+		"127.0.0.1":       false,
+		"169.254.1.1":     false,
+		"224.0.0.251":     false,
+		"255.255.255.255": false,
+		"fe80::1":         false,
+		"fd00::1":         false,
+		"2001:db8::1":     false,
+	} {
+		if got := geoIPEligible(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("geoIPEligible(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
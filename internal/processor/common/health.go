@@ -0,0 +1,219 @@
+package types
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ZeekOutputFile keeps the stdout and stderr of the Zeek that wrote a run's
+// logs, beside them, for the health report.
+const ZeekOutputFile = "zeek.out"
+
+const (
+	// healthMaxErrors is how many distinct reporter errors a report quotes.
+	healthMaxErrors = 5
+	// healthTopWeirds is how many weird names a report ranks.
+	healthTopWeirds = 5
+	// healthOutputTail is how many of Zeek's last output lines a report
+	// quotes, read from at most healthOutputBytes at the end of the output.
+	healthOutputTail  = 5
+	healthOutputBytes = 4096
+)
+
+// HealthThresholds are the limits beyond which ZeekHealthReport warns that
+// a run's logs are incomplete.
+type HealthThresholds struct {
+	// CaptureLossPercent is the share of TCP ACKs for data never seen, in
+	// percent, above which packets were missing. 0 = warn on any loss.
+	CaptureLossPercent float64
+	// ReporterErrors is the number of errors Zeek may report.
+	ReporterErrors int
+}
+
+// WeirdCount is how often Zeek logged one weird (protocol anomaly) name.
+type WeirdCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// ZeekHealth summarizes Zeek's own diagnostics for one run: reporter.log,
+// weird.log, capture_loss.log and stats.log (see the embedded
+// diagnostics.zeek), and its output.
+type ZeekHealth struct {
+	ReporterErrors   int          `json:"reporter_errors"`
+	ReporterWarnings int          `json:"reporter_warnings"`
+	Errors           []string     `json:"errors,omitempty"` // the first distinct reporter errors
+	Weirds           int          `json:"weirds"`
+	TopWeirds        []WeirdCount `json:"top_weirds,omitempty"`
+	// CaptureLossPercent is the share of TCP ACKs for data Zeek never saw,
+	// over CaptureLossACKs ACKs; 0 ACKs means it was not measured.
+	CaptureLossPercent float64 `json:"capture_loss_percent"`
+	CaptureLossACKs    int64   `json:"capture_loss_acks"`
+	// PacketsProcessed and PacketsDropped are from stats.log; drops are only
+	// known when reading an interface.
+	PacketsProcessed int64    `json:"packets_processed"`
+	PacketsDropped   int64    `json:"packets_dropped,omitempty"`
+	OutputTail       []string `json:"output_tail,omitempty"` // Zeek's last lines of output
+}
+
+// OpenZeekOutput creates logDir's ZeekOutputFile and returns writers copying
+// Zeek's stdout and stderr both to the sensor's and to it, and a function
+// closing it once Zeek exited. When the file cannot be created Zeek's output
+// just goes to the sensor's.
+func OpenZeekOutput(logDir string) (stdout, stderr io.Writer, closeOutput func()) {
+	f, err := os.Create(filepath.Join(logDir, ZeekOutputFile))
+	if err != nil {
+		log.Printf("[processor] Warning: could not keep Zeek's output: %v", err)
+		return os.Stdout, os.Stderr, func() {}
+	}
+	return io.MultiWriter(os.Stdout, f), io.MultiWriter(os.Stderr, f), func() { f.Close() }
+}
+
+// ZeekHealthReport summarizes the diagnostics Zeek left in runDir, logging a
+// warning when capture loss or reporter errors exceed opts.Health. Missing
+// logs count as nothing to report.
+func ZeekHealthReport(runDir string, opts ProcessOptions) ZeekHealth {
+	var health ZeekHealth
+	limit := opts.MemoryLimit
+
+	seenErrors := make(map[string]bool)
+	_, err := scanLog(filepath.Join(runDir, "reporter.log"), limit, func(h *logHeader) func([]string) {
+		levelIdx, msgIdx := h.index("level"), h.index("message")
+		if levelIdx < 0 {
+			return nil
+		}
+		return func(cols []string) {
+			switch column(cols, levelIdx) {
+			case "Reporter::ERROR", "Reporter::FATAL":
+				health.ReporterErrors++
+				msg := column(cols, msgIdx)
+				if len(health.Errors) < healthMaxErrors && !seenErrors[msg] {
+					seenErrors[msg] = true
+					health.Errors = append(health.Errors, msg)
+				}
+			case "Reporter::WARNING":
+				health.ReporterWarnings++
+			}
+		}
+	})
+	if err != nil {
+		log.Printf("[processor] Warning: could not read reporter.log: %v", err)
+	}
+
+	weirds := make(map[string]int)
+	_, err = scanLog(filepath.Join(runDir, "weird.log"), limit, func(h *logHeader) func([]string) {
+		nameIdx := h.index("name")
+		if nameIdx < 0 {
+			return nil
+		}
+		return func(cols []string) {
+			health.Weirds++
+			weirds[column(cols, nameIdx)]++
+		}
+	})
+	if err != nil {
+		log.Printf("[processor] Warning: could not read weird.log: %v", err)
+	}
+	for name, count := range weirds {
+		health.TopWeirds = append(health.TopWeirds, WeirdCount{name, count})
+	}
+	sort.Slice(health.TopWeirds, func(i, j int) bool {
+		a, b := health.TopWeirds[i], health.TopWeirds[j]
+		return a.Count > b.Count || (a.Count == b.Count && a.Name < b.Name)
+	})
+	if len(health.TopWeirds) > healthTopWeirds {
+		health.TopWeirds = health.TopWeirds[:healthTopWeirds]
+	}
+
+	var gaps int64
+	_, err = scanLog(filepath.Join(runDir, "capture_loss.log"), limit, func(h *logHeader) func([]string) {
+		gapsIdx, acksIdx := h.index("gaps"), h.index("acks")
+		if gapsIdx < 0 || acksIdx < 0 {
+			return nil
+		}
+		return func(cols []string) {
+			gaps += zeekCount(column(cols, gapsIdx))
+			health.CaptureLossACKs += zeekCount(column(cols, acksIdx))
+		}
+	})
+	if err != nil {
+		log.Printf("[processor] Warning: could not read capture_loss.log: %v", err)
+	}
+	if health.CaptureLossACKs > 0 {
+		health.CaptureLossPercent = float64(gaps) / float64(health.CaptureLossACKs) * 100
+	}
+
+	_, err = scanLog(filepath.Join(runDir, "stats.log"), limit, func(h *logHeader) func([]string) {
+		procIdx, dropIdx := h.index("pkts_proc"), h.index("pkts_dropped")
+		if procIdx < 0 {
+			return nil
+		}
+		return func(cols []string) {
+			health.PacketsProcessed += zeekCount(column(cols, procIdx))
+			health.PacketsDropped += zeekCount(column(cols, dropIdx))
+		}
+	})
+	if err != nil {
+		log.Printf("[processor] Warning: could not read stats.log: %v", err)
+	}
+
+	health.OutputTail = zeekOutputTail(filepath.Join(runDir, ZeekOutputFile))
+
+	log.Printf("[processor] Zeek health: %d packets processed, %.2f%% capture loss over %d ACKs, %d reporter errors, %d reporter warnings, %d weirds %v",
+		health.PacketsProcessed, health.CaptureLossPercent, health.CaptureLossACKs, health.ReporterErrors, health.ReporterWarnings, health.Weirds, health.TopWeirds)
+	if t := opts.Health.CaptureLossPercent; health.CaptureLossPercent > t {
+		log.Printf("[processor] WARNING: Zeek capture loss of %.2f%% in %s exceeds %.2f%%; its logs are missing traffic (the sensor or capture may be overloaded)", health.CaptureLossPercent, runDir, t)
+	}
+	if health.ReporterErrors > opts.Health.ReporterErrors {
+		log.Printf("[processor] WARNING: Zeek reported %d errors in %s (allowed %d); its logs may be incomplete: %q", health.ReporterErrors, runDir, opts.Health.ReporterErrors, health.Errors)
+	}
+	return health
+}
+
+// zeekCount parses a Zeek count column, or returns 0.
+func zeekCount(value string) int64 {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// zeekOutputTail returns the last non-empty lines of Zeek's output at path,
+// or nil when there is none.
+func zeekOutputTail(path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	// A read from the middle of the output starts with a partial line.
+	partial := false
+	if info, err := f.Stat(); err == nil && info.Size() > healthOutputBytes {
+		if _, err := f.Seek(-healthOutputBytes, io.SeekEnd); err != nil {
+			return nil
+		}
+		partial = true
+	}
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if partial {
+			partial = false
+			continue
+		}
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > healthOutputTail {
+		lines = lines[len(lines)-healthOutputTail:]
+	}
+	return lines
+}
@@ -0,0 +1,66 @@
+package types
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestZeekHealthReport(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "reporter.log", "#separator \\x09\n#path\treporter\n#fields\tts\tlevel\tmessage\tlocation\n"+
+		"1.0\tReporter::ERROR\tfield value missing\t-\n"+
+		"2.0\tReporter::ERROR\tfield value missing\t-\n"+
+		"3.0\tReporter::WARNING\tbad checksum\t-\n"+
+		"4.0\tReporter::INFO\tdone\t-\n")
+	writeTestFile(t, dir, "weird.log", "#separator \\x09\n#path\tweird\n#fields\tts\tuid\tname\n"+
+		"1.0\tCa\tbad_TCP_checksum\n2.0\tCb\tbad_TCP_checksum\n3.0\tCc\tdns_unmatched_msg\n")
+	writeTestFile(t, dir, "capture_loss.log", "#separator \\x09\n#path\tcapture_loss\n#fields\tts\tts_delta\tpeer\tgaps\tacks\tpercent_lost\n"+
+		"10.0\t10.0\tzeek\t3\t100\t3.0\n20.0\t10.0\tzeek\t1\t100\t1.0\n")
+	writeTestFile(t, dir, "stats.log", "#separator \\x09\n#path\tstats\n#fields\tts\tpeer\tpkts_proc\tpkts_dropped\n"+
+		"10.0\tzeek\t500\t-\n20.0\tzeek\t250\t-\n")
+	var out strings.Builder
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(&out, "line %d\n", i)
+	}
+	writeTestFile(t, dir, ZeekOutputFile, out.String()+"\nfatal error: out of memory\n\n")
+
+	h := ZeekHealthReport(dir, ProcessOptions{Health: HealthThresholds{CaptureLossPercent: 1}})
+	if h.ReporterErrors != 2 || h.ReporterWarnings != 1 || len(h.Errors) != 1 || h.Errors[0] != "field value missing" {
+		t.Errorf("reporter = %d errors %q, %d warnings", h.ReporterErrors, h.Errors, h.ReporterWarnings)
+	}
+	if h.Weirds != 3 || len(h.TopWeirds) != 2 || h.TopWeirds[0] != (WeirdCount{"bad_TCP_checksum", 2}) {
+		t.Errorf("weirds = %d %v", h.Weirds, h.TopWeirds)
+	}
+	if h.CaptureLossPercent != 2 || h.CaptureLossACKs != 200 {
+		t.Errorf("capture loss = %v%% of %d ACKs", h.CaptureLossPercent, h.CaptureLossACKs)
+	}
+	if h.PacketsProcessed != 750 || h.PacketsDropped != 0 {
+		t.Errorf("packets = %d processed, %d dropped", h.PacketsProcessed, h.PacketsDropped)
+	}
+	want := []string{"line 496", "line 497", "line 498", "line 499", "fatal error: out of memory"}
+	if strings.Join(h.OutputTail, "|") != strings.Join(want, "|") {
+		t.Errorf("output tail = %q", h.OutputTail)
+	}
+
+	// Without diagnostics there is nothing to report.
+	if h := ZeekHealthReport(t.TempDir(), ProcessOptions{}); h.ReporterErrors != 0 || h.PacketsProcessed != 0 || h.OutputTail != nil {
+		t.Errorf("empty run = %+v", h)
+	}
+}
+
+func TestRunZeekSharded_KeepsZeekOutput(t *testing.T) {
+	dir := t.TempDir()
+	path, _ := writeShardTestPCAP(t, dir)
+	run := func(pcap, logDir string) error {
+		writeTestFile(t, logDir, ZeekOutputFile, "warning in "+filepath.Base(logDir)+"\n")
+		return nil
+	}
+	if err := RunZeekSharded(path, dir, ProcessOptions{Shards: 2}, run); err != nil {
+		t.Fatal(err)
+	}
+	if lines := readLines(t, filepath.Join(dir, ZeekOutputFile)); strings.Join(lines, "|") != "warning in 00|warning in 01" {
+		t.Errorf("zeek.out = %q", lines)
+	}
+}
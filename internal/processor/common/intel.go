@@ -0,0 +1,269 @@
+package types
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"EnigmaNetz/Enigma-Go-Sensor/internal/processor/common/intel"
+	"EnigmaNetz/Enigma-Go-Sensor/internal/processor/common/zeekscripts"
+)
+
+// IntelLogFile is the log of threat-intel hits. Zeek's Intel framework writes
+// it for the indicators it matches in traffic, and MatchIntelFingerprints adds
+// the TLS fingerprint hits to it. It is one of ZeekLogFiles.
+const IntelLogFile = "intel.log"
+
+// Files IntelScripts writes into the run directory.
+const (
+	intelIndicatorsFile = "enigma-intel.dat"
+	intelFilesScript    = "intel-files.zeek"
+)
+
+// intelCache holds the indicators loaded from the intel directory.
+var intelCache fileCache[*intel.Set]
+
+// loadIntel returns the indicators of the feeds in dir. When a feed file has
+// been added, removed or changed since they were last loaded they are read
+// again; if that fails the previous indicators keep being used. It returns
+// nil when there are none.
+func loadIntel(dir string) *intel.Set {
+	nfiles := 0
+	set, _, err := intelCache.load(dir, func() ([]string, error) {
+		return intel.FeedFiles(dir)
+	}, func(files []string) (*intel.Set, error) {
+		nfiles = len(files)
+		return intel.LoadDir(dir)
+	}, func(set *intel.Set, reloaded bool) {
+		log.Printf("[processor] %s %d Zeek indicators and %d TLS fingerprints from %d intel feeds in %s (%d entries skipped)", loadedVerb(reloaded), len(set.Zeek), set.Fingerprints(), nfiles, dir, set.Skipped)
+	})
+	if err != nil {
+		log.Printf("[processor] Warning: could not load intel feeds from %s: %v", dir, err)
+	}
+	return set
+}
+
+// IntelScripts writes the Zeek indicators of the feeds in opts.IntelDir into
+// runDir as a Zeek intel file and returns the scripts to add to the Zeek
+// command line: the embedded intel.zeek, which loads the Intel framework, and
+// a generated script adding the file to Intel::read_files. The feeds are
+// checked for changes on every call, so updated feeds apply from the next
+// window. It returns nil when the feature is off, there are no Zeek
+// indicators, or the files cannot be written.
+func IntelScripts(runDir string, opts ProcessOptions) []string {
+	if opts.IntelDir == "" {
+		return nil
+	}
+	set := loadIntel(opts.IntelDir)
+	if set == nil || len(set.Zeek) == 0 {
+		return nil
+	}
+	scripts, err := writeIntelScripts(runDir, set)
+	if err != nil {
+		log.Printf("[processor] Warning: could not write intel indicators (%v); Zeek intel matching is off for this run", err)
+		return nil
+	}
+	log.Printf("[processor] Added %d intel indicators from %s", len(set.Zeek), opts.IntelDir)
+	return scripts
+}
+
+func writeIntelScripts(runDir string, set *intel.Set) ([]string, error) {
+	dir, err := filepath.Abs(runDir)
+	if err != nil {
+		return nil, err
+	}
+	dataPath := filepath.Join(dir, intelIndicatorsFile)
+	f, err := os.Create(dataPath)
+	if err != nil {
+		return nil, err
+	}
+	err = set.WriteZeek(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	loader, err := zeekscripts.Materialize(dir, zeekscripts.Intel)
+	if err != nil {
+		return nil, err
+	}
+	// Zeek takes forward slashes on every platform; the path is absolute
+	// because Zeek may not run in the sensor's working directory.
+	quoted := strings.ReplaceAll(filepath.ToSlash(dataPath), `"`, `\"`)
+	script := "# Generated by enigma-sensor from zeek.intel_dir; do not edit.\n" +
+		"redef Intel::read_files += { \"" + quoted + "\" };\n"
+	scriptPath := filepath.Join(dir, intelFilesScript)
+	if err := os.WriteFile(scriptPath, []byte(script), 0o600); err != nil {
+		return nil, err
+	}
+	return []string{loader, scriptPath}, nil
+}
+
+// intelLogFields are the columns of the intel.log MatchIntelFingerprints
+// writes when Zeek wrote none; they are those of Zeek's intel.log.
+var intelLogFields = []struct{ name, typ string }{
+	{"ts", "time"},
+	{"uid", "string"},
+	{"id.orig_h", "addr"},
+	{"id.orig_p", "port"},
+	{"id.resp_h", "addr"},
+	{"id.resp_p", "port"},
+	{"seen.indicator", "string"},
+	{"seen.indicator_type", "enum"},
+	{"seen.where", "enum"},
+	{"seen.node", "string"},
+	{"matched", "set[enum]"},
+	{"sources", "set[string]"},
+}
+
+// intelFingerprintColumns are the fingerprint columns of each TLS log
+// MatchIntelFingerprints checks, with the indicator type they hold and the
+// seen.where its hits are logged with.
+var intelFingerprintColumns = []struct {
+	log, where string
+	columns    []string
+	types      []intel.Type
+}{
+	{"ja3_ja4.log", "Enigma::IN_JA3_JA4_LOG", []string{"ja3_hash", "ja3", "ja4", "ja4_hash"}, []intel.Type{intel.JA3, intel.JA3, intel.JA4, intel.JA4}},
+	{"ja4s.log", "Enigma::IN_JA4S_LOG", []string{"ja4s", "ja4s_hash"}, []intel.Type{intel.JA4S, intel.JA4S}},
+}
+
+// MatchIntelFingerprints matches the JA3, JA4 and JA4S fingerprints in
+// runDir's TLS logs against the fingerprint indicators of the feeds in
+// opts.IntelDir, which Zeek's Intel framework cannot match, and adds the hits
+// to IntelLogFile in Zeek's intel.log format. It returns the number of hits.
+// It runs before FilterLogs so the hits are filtered with the rest of
+// intel.log, and does nothing when opts.IntelDir is empty.
+func MatchIntelFingerprints(runDir string, opts ProcessOptions) (int, error) {
+	if opts.IntelDir == "" {
+		return 0, nil
+	}
+	set := loadIntel(opts.IntelDir)
+	if set == nil || set.Fingerprints() == 0 {
+		return 0, nil
+	}
+	var hits []map[string]string
+	for _, src := range intelFingerprintColumns {
+		_, err := scanLog(filepath.Join(runDir, src.log), opts.MemoryLimit, func(h *logHeader) func([]string) {
+			idx := make([]int, len(src.columns))
+			for i, c := range src.columns {
+				idx[i] = h.index(c)
+			}
+			copied := []string{"ts", "uid", "id.orig_h", "id.orig_p", "id.resp_h", "id.resp_p"}
+			copiedIdx := make([]int, len(copied))
+			for i, c := range copied {
+				copiedIdx[i] = h.index(c)
+			}
+			return func(cols []string) {
+				matched := make(map[intel.Type]bool)
+				for i, t := range src.types {
+					v := column(cols, idx[i])
+					if matched[t] || zeekUnsetMarkers[v] {
+						continue
+					}
+					ind, ok := set.Match(t, v)
+					if !ok {
+						continue
+					}
+					matched[t] = true
+					hit := map[string]string{
+						"seen.indicator":      ind.Value,
+						"seen.indicator_type": string(ind.Type),
+						"seen.where":          src.where,
+						"seen.node":           "enigma-sensor",
+						"matched":             string(ind.Type),
+						"sources":             ind.Source,
+					}
+					for j, c := range copied {
+						hit[c] = column(cols, copiedIdx[j])
+					}
+					hits = append(hits, hit)
+				}
+			}
+		})
+		if err != nil {
+			return 0, fmt.Errorf("intel %s: %w", src.log, err)
+		}
+	}
+	if len(hits) == 0 {
+		return 0, nil
+	}
+	if err := appendIntelHits(filepath.Join(runDir, IntelLogFile), hits, opts.MemoryLimit); err != nil {
+		return 0, err
+	}
+	log.Printf("[processor] Added %d TLS fingerprint intel hits to %s", len(hits), IntelLogFile)
+	return len(hits), nil
+}
+
+// appendIntelHits adds hits to the intel.log at path, laid out by its
+// #fields, before Zeek's #close footer; it creates the log when Zeek wrote
+// none.
+func appendIntelHits(path string, hits []map[string]string, limit int64) error {
+	format := func(h *logHeader) string {
+		var b strings.Builder
+		for _, hit := range hits {
+			row := make([]string, len(h.fields))
+			for i, name := range h.fields {
+				v, ok := hit[name]
+				switch {
+				case !ok || v == "":
+					row[i] = "-"
+				case name == "sources":
+					row[i] = strings.ReplaceAll(escapeZeekValue(v, h.sep), h.setSep, fmt.Sprintf(`\x%02x`, h.setSep[0]))
+				default:
+					row[i] = escapeZeekValue(v, h.sep)
+				}
+			}
+			b.WriteString(strings.Join(row, h.sep) + "\n")
+		}
+		return b.String()
+	}
+
+	var rows string
+	inserted := false
+	present, _, err := rewriteLogWith(path, limit, func(h *logHeader) *logRewrite {
+		rows = format(h)
+		return &logRewrite{
+			row: func(line string) (string, bool) { return line, true },
+			meta: func(line string) string {
+				if inserted || !strings.HasPrefix(line, "#close") {
+					return line
+				}
+				inserted = true
+				return rows + line
+			},
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("write %s: %w", filepath.Base(path), err)
+	}
+	if present && inserted {
+		return nil
+	}
+	if present {
+		// Zeek did not close the log: append after its last row.
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+		if err != nil {
+			return fmt.Errorf("write %s: %w", filepath.Base(path), err)
+		}
+		_, err = f.WriteString(rows)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("write %s: %w", filepath.Base(path), err)
+		}
+		return nil
+	}
+	var b strings.Builder
+	writeZeekHeader(&b, "intel", intelLogFields)
+	h := parseLogHeader(strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n"))
+	b.WriteString(format(h))
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
@@ -0,0 +1,504 @@
+// Package intel loads threat-intelligence indicator feeds exported as flat
+// files (CSV, STIX-lite JSON or Zeek intel files) into a Set. Indicator types
+// Zeek's Intel framework knows (addresses, subnets, domains, URLs, email
+// addresses, certificate and file hashes) are written back out as one Zeek
+// intel file for Zeek to match in traffic; TLS fingerprints (JA3, JA4, JA4S),
+// which it does not know, are kept for the sensor to match itself.
+package intel
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Type is an indicator type, named as in Zeek's Intel::Type enum.
+type Type string
+
+// Indicator types matched by Zeek.
+const (
+	Addr     Type = "Intel::ADDR"
+	Subnet   Type = "Intel::SUBNET"
+	Domain   Type = "Intel::DOMAIN"
+	URL      Type = "Intel::URL"
+	Email    Type = "Intel::EMAIL"
+	CertHash Type = "Intel::CERT_HASH"
+	FileHash Type = "Intel::FILE_HASH"
+)
+
+// Fingerprint indicator types, matched by the sensor. Zeek has no such
+// Intel::Type; the names only appear in intel.log rows the sensor writes.
+const (
+	JA3  Type = "Intel::JA3"
+	JA4  Type = "Intel::JA4"
+	JA4S Type = "Intel::JA4S"
+)
+
+// Fingerprint reports whether t is matched by the sensor rather than Zeek.
+func (t Type) Fingerprint() bool {
+	return t == JA3 || t == JA4 || t == JA4S
+}
+
+// typeNames maps the type names accepted in feeds (CSV type columns, STIX
+// object types, Zeek enum names without the "Intel::" prefix) to a Type.
+var typeNames = map[string]Type{
+	"ip": Addr, "ipv4": Addr, "ipv6": Addr, "addr": Addr, "address": Addr,
+	"ipv4-addr": Addr, "ipv6-addr": Addr, "subnet": Subnet, "cidr": Subnet,
+	"domain": Domain, "domain-name": Domain, "hostname": Domain, "fqdn": Domain,
+	"url": URL, "uri": URL,
+	"email": Email, "email-addr": Email,
+	"cert_hash": CertHash, "cert_sha1": CertHash, "cert_sha256": CertHash, "x509-certificate": CertHash,
+	"file_hash": FileHash, "file": FileHash, "hash": FileHash, "md5": FileHash, "sha1": FileHash, "sha256": FileHash,
+	"ja3": JA3, "ja4": JA4, "ja4s": JA4S,
+}
+
+// ParseType returns the Type a feed names, accepting Zeek enum names
+// ("Intel::DOMAIN"), STIX object types ("domain-name", "x-ja4") and common
+// aliases ("ip", "md5"), case-insensitively.
+func ParseType(name string) (Type, bool) {
+	n := strings.ToLower(strings.TrimSpace(name))
+	n = strings.TrimPrefix(n, "intel::")
+	n = strings.TrimSuffix(strings.TrimPrefix(n, "x-"), "-fingerprint")
+	t, ok := typeNames[n]
+	return t, ok
+}
+
+// Indicator is one indicator of compromise.
+type Indicator struct {
+	Value  string
+	Type   Type
+	Source string // the feed it came from
+	Desc   string
+}
+
+// ja4Pattern matches a JA4 or JA4S fingerprint, e.g.
+// t13d1516h2_8daaf6152771_e5627efa2ab1 or t130200_1301_234ea6891581.
+var ja4Pattern = regexp.MustCompile(`^[tqd][0-9]{2}[a-z0-9]{3,7}_[0-9a-f]{4,12}_[0-9a-f]{12}$`)
+
+// normalize validates v as a t indicator and returns it in the form it is
+// matched in, with the type refined (an address with a prefix length is a
+// subnet). Hashes and fingerprints are lowercased, URLs lose their scheme as
+// Zeek matches them without it.
+func normalize(v string, t Type) (string, Type, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" || strings.ContainsAny(v, "\t\r\n") {
+		return "", t, false
+	}
+	switch t {
+	case Addr, Subnet:
+		if p, err := netip.ParsePrefix(v); err == nil {
+			if p.IsSingleIP() {
+				return p.Addr().Unmap().String(), Addr, true
+			}
+			return p.Masked().String(), Subnet, true
+		}
+		if a, err := netip.ParseAddr(v); err == nil {
+			return a.Unmap().String(), Addr, true
+		}
+		return "", t, false
+	case Domain:
+		v = strings.ToLower(strings.TrimSuffix(v, "."))
+		return v, t, strings.Contains(v, ".") && !strings.ContainsAny(v, " /@")
+	case URL:
+		lower := strings.ToLower(v)
+		for _, scheme := range []string{"http://", "https://"} {
+			if strings.HasPrefix(lower, scheme) {
+				v = v[len(scheme):]
+			}
+		}
+		return v, t, v != ""
+	case Email:
+		return strings.ToLower(v), t, strings.Contains(v, "@")
+	case CertHash, FileHash, JA3:
+		v = strings.ToLower(v)
+		return v, t, isHash(v)
+	case JA4, JA4S:
+		return strings.ToLower(v), t, true
+	}
+	return "", t, false
+}
+
+// isHash reports whether s is a lowercase hex digest of at least 128 bits.
+func isHash(s string) bool {
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return len(s) >= 32
+}
+
+// inferType guesses the type of an indicator given without one. Hashes are
+// ambiguous (a 32-digit hex string may be a JA3 or an MD5 file hash) and are
+// not guessed.
+func inferType(v string) (Type, bool) {
+	v = strings.TrimSpace(v)
+	switch {
+	case strings.Contains(v, "/") && strings.Contains(v, "://"):
+		return URL, true
+	case strings.Contains(v, "/"):
+		if _, err := netip.ParsePrefix(v); err == nil {
+			return Subnet, true
+		}
+		return URL, true
+	case strings.Contains(v, "@"):
+		return Email, true
+	case ja4Pattern.MatchString(strings.ToLower(v)):
+		// JA4's first part is 10 characters, JA4S's 7.
+		if len(strings.SplitN(v, "_", 2)[0]) == 10 {
+			return JA4, true
+		}
+		return JA4S, true
+	}
+	if _, err := netip.ParseAddr(v); err == nil {
+		return Addr, true
+	}
+	if isHash(strings.ToLower(v)) {
+		return "", false
+	}
+	if strings.Contains(v, ".") {
+		return Domain, true
+	}
+	return "", false
+}
+
+// ParseCSV reads indicators from a CSV feed. A first row naming an
+// "indicator" (or "value"/"ioc") column is a header, whose "type", "source"
+// and "description" columns are also used; otherwise the columns are
+// value[,type[,source[,description]]]. Lines starting with "#" are comments.
+// source is used for rows without one. skipped counts rows that are not
+// valid indicators.
+func ParseCSV(r io.Reader, source string) (indicators []Indicator, skipped int, err error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	col := map[string]int{"value": 0, "type": 1, "source": 2, "desc": 3}
+	first := true
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if first {
+			first = false
+			if header := csvHeader(rec); header != nil {
+				col = header
+				continue
+			}
+		}
+		field := func(name string) string {
+			if i, ok := col[name]; ok && i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+		ind, ok := indicator(field("value"), field("type"), field("source"), field("desc"), source)
+		if !ok {
+			skipped++
+			continue
+		}
+		indicators = append(indicators, ind)
+	}
+	return indicators, skipped, nil
+}
+
+// csvHeader returns the column positions named by a header row, or nil when
+// rec is not a header.
+func csvHeader(rec []string) map[string]int {
+	aliases := map[string]string{
+		"indicator": "value", "value": "value", "ioc": "value",
+		"type": "type", "indicator_type": "type",
+		"source": "source", "meta.source": "source", "feed": "source",
+		"description": "desc", "desc": "desc", "meta.desc": "desc", "comment": "desc",
+	}
+	col := make(map[string]int)
+	for i, name := range rec {
+		if a, ok := aliases[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))]; ok {
+			if _, dup := col[a]; !dup {
+				col[a] = i
+			}
+		}
+	}
+	if _, ok := col["value"]; !ok {
+		return nil
+	}
+	return col
+}
+
+// indicator builds an indicator from feed fields, inferring the type when
+// typ is empty.
+func indicator(value, typ, source, desc, defaultSource string) (Indicator, bool) {
+	var t Type
+	var ok bool
+	if typ != "" {
+		t, ok = ParseType(typ)
+	} else {
+		t, ok = inferType(value)
+	}
+	if !ok {
+		return Indicator{}, false
+	}
+	value, t, ok = normalize(value, t)
+	if !ok {
+		return Indicator{}, false
+	}
+	if source == "" {
+		source = defaultSource
+	}
+	return Indicator{Value: value, Type: t, Source: source, Desc: desc}, true
+}
+
+// stixComparison matches one comparison of a STIX pattern,
+// "[domain-name:value = 'evil.example']" or "[file:hashes.'SHA-256' = '...']".
+var stixComparison = regexp.MustCompile(`([a-z0-9-]+):([A-Za-z0-9_.'-]+)\s*=\s*'((?:[^'\\]|\\.)*)'`)
+
+// stixObject is the subset of a STIX 2 object ParseSTIX reads.
+type stixObject struct {
+	Type        string `json:"type"`
+	Pattern     string `json:"pattern"`
+	PatternType string `json:"pattern_type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Value       string `json:"value"`
+}
+
+// ParseSTIX reads indicators from a STIX-lite JSON feed: a STIX 2 bundle (or
+// a bare array of objects) whose "indicator" objects carry STIX patterns of
+// equality comparisons, such as "[ipv4-addr:value = '198.51.100.7']" (several
+// joined by OR yield one indicator each), or whose cyber-observables carry a
+// "value" directly. Custom fingerprint objects are accepted as
+// "x-ja3:value", "x-ja4:value" and "x-ja4s:value". source is the indicators'
+// source; skipped counts comparisons and objects that are not valid
+// indicators.
+func ParseSTIX(r io.Reader, source string) (indicators []Indicator, skipped int, err error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	var objects []stixObject
+	var bundle struct {
+		Objects []stixObject `json:"objects"`
+	}
+	if err := json.Unmarshal(data, &bundle); err == nil && bundle.Objects != nil {
+		objects = bundle.Objects
+	} else if err := json.Unmarshal(data, &objects); err != nil {
+		return nil, 0, fmt.Errorf("not a STIX bundle or array of objects: %w", err)
+	}
+	for _, o := range objects {
+		desc := o.Name
+		if o.Description != "" {
+			desc = strings.TrimSpace(desc + " " + o.Description)
+		}
+		switch {
+		case o.Type == "indicator":
+			if o.PatternType != "" && o.PatternType != "stix" {
+				skipped++
+				continue
+			}
+			matches := stixComparison.FindAllStringSubmatch(o.Pattern, -1)
+			if len(matches) == 0 {
+				skipped++
+			}
+			for _, m := range matches {
+				objType, prop, value := m[1], m[2], strings.ReplaceAll(m[3], `\'`, `'`)
+				if prop != "value" && !strings.HasPrefix(prop, "hashes.") {
+					skipped++
+					continue
+				}
+				ind, ok := indicator(value, objType, "", desc, source)
+				if !ok {
+					skipped++
+					continue
+				}
+				indicators = append(indicators, ind)
+			}
+		case o.Value != "":
+			ind, ok := indicator(o.Value, o.Type, "", desc, source)
+			if !ok {
+				skipped++
+				continue
+			}
+			indicators = append(indicators, ind)
+		}
+	}
+	return indicators, skipped, nil
+}
+
+// ParseZeek reads indicators from a Zeek intel file: tab-separated, with a
+// "#fields" line naming the indicator, indicator_type and optional
+// meta.source and meta.desc columns.
+func ParseZeek(r io.Reader, source string) (indicators []Indicator, skipped int, err error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	col := map[string]int{}
+	for sc.Scan() {
+		line := sc.Text()
+		if rest, ok := strings.CutPrefix(line, "#fields\t"); ok {
+			col = map[string]int{}
+			for i, name := range strings.Split(rest, "\t") {
+				col[name] = i
+			}
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		cols := strings.Split(line, "\t")
+		field := func(name string) string {
+			if i, ok := col[name]; ok && i < len(cols) && cols[i] != "-" {
+				return cols[i]
+			}
+			return ""
+		}
+		if _, ok := col["indicator"]; !ok {
+			return nil, 0, fmt.Errorf("no #fields line naming the indicator column")
+		}
+		ind, ok := indicator(field("indicator"), field("indicator_type"), field("meta.source"), field("meta.desc"), source)
+		if !ok {
+			skipped++
+			continue
+		}
+		indicators = append(indicators, ind)
+	}
+	return indicators, skipped, sc.Err()
+}
+
+// Set is the indicators loaded from a feed directory.
+type Set struct {
+	// Zeek are the indicators for Zeek to match, in feed order.
+	Zeek         []Indicator
+	fingerprints map[Type]map[string]Indicator
+	// Skipped counts feed entries that were not valid indicators.
+	Skipped int
+}
+
+// NewSet returns a Set of indicators, dropping duplicates.
+func NewSet(indicators []Indicator) *Set {
+	s := &Set{fingerprints: make(map[Type]map[string]Indicator)}
+	seen := make(map[Indicator]bool)
+	for _, ind := range indicators {
+		if seen[ind] {
+			continue
+		}
+		seen[ind] = true
+		if !ind.Type.Fingerprint() {
+			s.Zeek = append(s.Zeek, ind)
+			continue
+		}
+		if s.fingerprints[ind.Type] == nil {
+			s.fingerprints[ind.Type] = make(map[string]Indicator)
+		}
+		if _, ok := s.fingerprints[ind.Type][ind.Value]; !ok {
+			s.fingerprints[ind.Type][ind.Value] = ind
+		}
+	}
+	return s
+}
+
+// Fingerprints returns the number of fingerprint indicators.
+func (s *Set) Fingerprints() int {
+	n := 0
+	for _, m := range s.fingerprints {
+		n += len(m)
+	}
+	return n
+}
+
+// Match returns the fingerprint indicator of type t with value, compared
+// case-insensitively.
+func (s *Set) Match(t Type, value string) (Indicator, bool) {
+	ind, ok := s.fingerprints[t][strings.ToLower(value)]
+	return ind, ok
+}
+
+// WriteZeek writes the Zeek indicators as a Zeek intel file.
+func (s *Set) WriteZeek(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("#fields\tindicator\tindicator_type\tmeta.source\tmeta.desc\n")
+	for _, ind := range s.Zeek {
+		fmt.Fprintf(bw, "%s\t%s\t%s\t%s\n", ind.Value, ind.Type, zeekField(ind.Source), zeekField(ind.Desc))
+	}
+	return bw.Flush()
+}
+
+// zeekField makes s safe for a tab-separated intel file column.
+func zeekField(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// FeedFiles returns the feed files in dir that LoadDir reads, sorted.
+func FeedFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(e.Name())) {
+		case ".csv", ".txt", ".json", ".intel", ".dat":
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// LoadDir loads every feed file in dir: .csv and .txt files as CSV, .json
+// files as STIX-lite, and .intel and .dat files as Zeek intel files. Each
+// file's name, without extension, is the source of indicators that do not
+// name one. A file that cannot be parsed is an error.
+func LoadDir(dir string) (*Set, error) {
+	files, err := FeedFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	var all []Indicator
+	skipped := 0
+	for _, path := range files {
+		inds, n, err := loadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		all = append(all, inds...)
+		skipped += n
+	}
+	s := NewSet(all)
+	s.Skipped = skipped
+	return s, nil
+}
+
+func loadFile(path string) ([]Indicator, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	source := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return ParseSTIX(f, source)
+	case ".intel", ".dat":
+		return ParseZeek(f, source)
+	default:
+		return ParseCSV(f, source)
+	}
+}
@@ -0,0 +1,168 @@
+package intel
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseCSV(t *testing.T) {
+	feed := "\ufeffIndicator,Type,Source,Description\n" +
+		"# comment\n" +
+		"198.51.100.7,ip,tip,C2 server\n" +
+		"203.0.113.0/24,,tip,bad range\n" +
+		"Evil.Example.,domain,,phishing\n" +
+		"https://evil.example/payload,url,,\n" +
+		"E7D705A3286E19EA42F587B344EE6865,ja3,,\n" +
+		"t13d1516h2_8daaf6152771_e5627efa2ab1,,,\n" +
+		"t130200_1301_234ea6891581,,,\n" +
+		"not an indicator,,,\n" +
+		"d41d8cd98f00b204e9800998ecf8427e,,,\n"
+	inds, skipped, err := ParseCSV(strings.NewReader(feed), "feed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Indicator{
+		{"198.51.100.7", Addr, "tip", "C2 server"},
+		{"203.0.113.0/24", Subnet, "tip", "bad range"},
+		{"evil.example", Domain, "feed", "phishing"},
+		{"evil.example/payload", URL, "feed", ""},
+		{"e7d705a3286e19ea42f587b344ee6865", JA3, "feed", ""},
+		{"t13d1516h2_8daaf6152771_e5627efa2ab1", JA4, "feed", ""},
+		{"t130200_1301_234ea6891581", JA4S, "feed", ""},
+	}
+	if len(inds) != len(want) {
+		t.Fatalf("got %d indicators %v, want %d", len(inds), inds, len(want))
+	}
+	for i := range want {
+		if inds[i] != want[i] {
+			t.Errorf("indicator %d = %+v, want %+v", i, inds[i], want[i])
+		}
+	}
+	// The untyped hash is ambiguous and the free text is no indicator.
+	if skipped != 2 {
+		t.Errorf("skipped = %d, want 2", skipped)
+	}
+}
+
+func TestParseCSV_Positional(t *testing.T) {
+	inds, skipped, err := ParseCSV(strings.NewReader("10.0.0.1\nbad.example,Intel::DOMAIN,other\n"), "feed")
+	if err != nil || skipped != 0 || len(inds) != 2 {
+		t.Fatalf("got %v, skipped %d, err %v", inds, skipped, err)
+	}
+	if inds[0] != (Indicator{"10.0.0.1", Addr, "feed", ""}) || inds[1] != (Indicator{"bad.example", Domain, "other", ""}) {
+		t.Errorf("indicators = %+v", inds)
+	}
+}
+
+func TestParseSTIX(t *testing.T) {
+	bundle := `{"type": "bundle", "objects": [
+		{"type": "indicator", "name": "C2", "pattern_type": "stix",
+		 "pattern": "[ipv4-addr:value = '198.51.100.7'] OR [domain-name:value = 'c2.example']"},
+		{"type": "indicator", "pattern": "[file:hashes.'SHA-256' = 'AABBCCDDEEFF00112233445566778899AABBCCDDEEFF00112233445566778899']"},
+		{"type": "indicator", "pattern": "[x-ja4:value = 't13d1516h2_8daaf6152771_e5627efa2ab1']"},
+		{"type": "indicator", "pattern": "[network-traffic:dst_port = 443]"},
+		{"type": "indicator", "pattern_type": "sigma", "pattern": "title: x"},
+		{"type": "url", "value": "http://bad.example/x"},
+		{"type": "identity", "name": "Vendor"}
+	]}`
+	inds, skipped, err := ParseSTIX(strings.NewReader(bundle), "stix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Indicator{
+		{"198.51.100.7", Addr, "stix", "C2"},
+		{"c2.example", Domain, "stix", "C2"},
+		{"aabbccddeeff00112233445566778899aabbccddeeff00112233445566778899", FileHash, "stix", ""},
+		{"t13d1516h2_8daaf6152771_e5627efa2ab1", JA4, "stix", ""},
+		{"bad.example/x", URL, "stix", ""},
+	}
+	if len(inds) != len(want) {
+		t.Fatalf("got %v, want %v", inds, want)
+	}
+	for i := range want {
+		if inds[i] != want[i] {
+			t.Errorf("indicator %d = %+v, want %+v", i, inds[i], want[i])
+		}
+	}
+	if skipped != 2 {
+		t.Errorf("skipped = %d, want 2", skipped)
+	}
+
+	if _, _, err := ParseSTIX(strings.NewReader(`{"objects": 1}`), "stix"); err == nil {
+		t.Error("expected an error for a malformed feed")
+	}
+}
+
+func TestSet_WriteZeekAndMatch(t *testing.T) {
+	set := NewSet([]Indicator{
+		{"198.51.100.7", Addr, "tip", "C2\tserver"},
+		{"198.51.100.7", Addr, "tip", "C2\tserver"},
+		{"e7d705a3286e19ea42f587b344ee6865", JA3, "tip", ""},
+		{"t13d1516h2_8daaf6152771_e5627efa2ab1", JA4, "tip", ""},
+	})
+	if len(set.Zeek) != 1 || set.Fingerprints() != 2 {
+		t.Fatalf("Zeek = %v, fingerprints = %d", set.Zeek, set.Fingerprints())
+	}
+	var b bytes.Buffer
+	if err := set.WriteZeek(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := "#fields\tindicator\tindicator_type\tmeta.source\tmeta.desc\n198.51.100.7\tIntel::ADDR\ttip\tC2 server\n"
+	if b.String() != want {
+		t.Errorf("WriteZeek = %q, want %q", b.String(), want)
+	}
+	// The written file reads back.
+	inds, _, err := ParseZeek(&b, "x")
+	if err != nil || len(inds) != 1 || inds[0] != (Indicator{"198.51.100.7", Addr, "tip", "C2 server"}) {
+		t.Errorf("ParseZeek = %v, %v", inds, err)
+	}
+
+	if _, ok := set.Match(JA3, "E7D705A3286E19EA42F587B344EE6865"); !ok {
+		t.Error("JA3 not matched case-insensitively")
+	}
+	if _, ok := set.Match(JA4S, "t13d1516h2_8daaf6152771_e5627efa2ab1"); ok {
+		t.Error("JA4 indicator matched as JA4S")
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"ips.csv":     "198.51.100.7\n",
+		"bundle.json": `[{"type": "domain-name", "value": "c2.example"}]`,
+		"zeek.intel":  "#fields\tindicator\tindicator_type\n10.9.9.9\tIntel::ADDR\n",
+		"notes.md":    "198.51.100.8\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	set, err := LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, ind := range set.Zeek {
+		got[ind.Value] = ind.Source
+	}
+	want := map[string]string{"198.51.100.7": "ips", "c2.example": "bundle", "10.9.9.9": "zeek"}
+	if len(got) != len(want) {
+		t.Fatalf("loaded %v, want %v", got, want)
+	}
+	for v, src := range want {
+		if got[v] != src {
+			t.Errorf("%s source = %q, want %q", v, got[v], src)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadDir(dir); err == nil || !strings.Contains(err.Error(), "broken.json") {
+		t.Errorf("expected an error naming broken.json, got %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package types
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const intelTestJA3Log = "#separator \\x09\n#set_separator\t,\n#path\tja3_ja4\n" +
+	"#fields\tts\tuid\tid.orig_h\tid.orig_p\tid.resp_h\tid.resp_p\tserver_name\tja3\tja4\n" +
+	"#types\ttime\tstring\taddr\tport\taddr\tport\tstring\tstring\tstring\n" +
+	"1700000000.000000\tCa\t192.168.1.10\t50000\t203.0.113.7\t443\tc2.example\tE7D705A3286E19EA42F587B344EE6865\tt13d1516h2_8daaf6152771_e5627efa2ab1\n" +
+	"1700000001.000000\tCb\t192.168.1.11\t50001\t198.51.100.1\t443\tgood.example\t0123456789abcdef0123456789abcdef\t-\n"
+
+func TestIntelScripts(t *testing.T) {
+	feeds := t.TempDir()
+	writeTestFile(t, feeds, "tip.csv", "indicator,type\n198.51.100.7,ip\nc2.example,domain\ne7d705a3286e19ea42f587b344ee6865,ja3\n")
+	runDir := t.TempDir()
+
+	if scripts := IntelScripts(runDir, ProcessOptions{}); scripts != nil {
+		t.Fatalf("scripts without an intel dir: %v", scripts)
+	}
+	scripts := IntelScripts(runDir, ProcessOptions{IntelDir: feeds})
+	if len(scripts) != 2 || filepath.Base(scripts[0]) != "intel.zeek" || filepath.Base(scripts[1]) != intelFilesScript {
+		t.Fatalf("scripts = %v", scripts)
+	}
+	redef, err := os.ReadFile(scripts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataPath := filepath.Join(runDir, intelIndicatorsFile)
+	if !strings.Contains(string(redef), `redef Intel::read_files += { "`+filepath.ToSlash(dataPath)+`" };`) {
+		t.Errorf("read_files script = %q", redef)
+	}
+	data, err := os.ReadFile(dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The JA3 indicator is matched by the sensor, not Zeek.
+	want := "#fields\tindicator\tindicator_type\tmeta.source\tmeta.desc\n198.51.100.7\tIntel::ADDR\ttip\t-\nc2.example\tIntel::DOMAIN\ttip\t-\n"
+	if string(data) != want {
+		t.Errorf("intel file = %q, want %q", data, want)
+	}
+
+	// Feed changes apply from the next run.
+	writeTestFile(t, feeds, "more.csv", "evil.example\n")
+	runDir = t.TempDir()
+	if scripts := IntelScripts(runDir, ProcessOptions{IntelDir: feeds}); len(scripts) != 2 {
+		t.Fatalf("scripts = %v", scripts)
+	}
+	data, err = os.ReadFile(filepath.Join(runDir, intelIndicatorsFile))
+	if err != nil || !strings.Contains(string(data), "evil.example\tIntel::DOMAIN\tmore") {
+		t.Errorf("reloaded intel file = %q, err %v", data, err)
+	}
+
+	// A broken feed keeps the previous indicators in use.
+	writeTestFile(t, feeds, "broken.json", "{")
+	runDir = t.TempDir()
+	if scripts := IntelScripts(runDir, ProcessOptions{IntelDir: feeds}); len(scripts) != 2 {
+		t.Fatalf("scripts after a broken feed = %v", scripts)
+	}
+	data, err = os.ReadFile(filepath.Join(runDir, intelIndicatorsFile))
+	if err != nil || !strings.Contains(string(data), "evil.example") {
+		t.Errorf("intel file after a broken feed = %q, err %v", data, err)
+	}
+}
+
+func TestMatchIntelFingerprints(t *testing.T) {
+	feeds := t.TempDir()
+	writeTestFile(t, feeds, "tip.csv", "indicator,type\ne7d705a3286e19ea42f587b344ee6865,ja3\nt13d1516h2_8daaf6152771_e5627efa2ab1,ja4\n")
+	opts := ProcessOptions{IntelDir: feeds}
+
+	// Without a Zeek intel.log one is created.
+	runDir := t.TempDir()
+	writeTestFile(t, runDir, "ja3_ja4.log", intelTestJA3Log)
+	n, err := MatchIntelFingerprints(runDir, opts)
+	if err != nil || n != 2 {
+		t.Fatalf("%d hits, err %v", n, err)
+	}
+	lines := readLines(t, filepath.Join(runDir, IntelLogFile))
+	if lines[5] != "#fields\tts\tuid\tid.orig_h\tid.orig_p\tid.resp_h\tid.resp_p\tseen.indicator\tseen.indicator_type\tseen.where\tseen.node\tmatched\tsources" {
+		t.Errorf("#fields = %q", lines[5])
+	}
+	want := []string{
+		"1700000000.000000\tCa\t192.168.1.10\t50000\t203.0.113.7\t443\te7d705a3286e19ea42f587b344ee6865\tIntel::JA3\tEnigma::IN_JA3_JA4_LOG\tenigma-sensor\tIntel::JA3\ttip",
+		"1700000000.000000\tCa\t192.168.1.10\t50000\t203.0.113.7\t443\tt13d1516h2_8daaf6152771_e5627efa2ab1\tIntel::JA4\tEnigma::IN_JA3_JA4_LOG\tenigma-sensor\tIntel::JA4\ttip",
+	}
+	if got := strings.Join(lines[7:], "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("rows =\n%s\nwant\n%s", got, strings.Join(want, "\n"))
+	}
+
+	// Hits are added to Zeek's intel.log before its #close footer, laid out
+	// by its columns.
+	runDir = t.TempDir()
+	writeTestFile(t, runDir, "ja3_ja4.log", intelTestJA3Log)
+	zeekIntel := "#separator \\x09\n#set_separator\t,\n#path\tintel\n" +
+		"#fields\tts\tuid\tseen.indicator\tseen.indicator_type\tseen.where\tfuid\tsources\n" +
+		"#types\ttime\tstring\tstring\tenum\tenum\tstring\tset[string]\n" +
+		"1700000002.000000\tCc\tc2.example\tIntel::DOMAIN\tDNS::IN_REQUEST\t-\ttip\n" +
+		"#close\t2023-11-14-22-13-20\n"
+	writeTestFile(t, runDir, IntelLogFile, zeekIntel)
+	if n, err := MatchIntelFingerprints(runDir, opts); err != nil || n != 2 {
+		t.Fatalf("%d hits, err %v", n, err)
+	}
+	lines = readLines(t, filepath.Join(runDir, IntelLogFile))
+	if len(lines) != 9 || lines[5] != "1700000002.000000\tCc\tc2.example\tIntel::DOMAIN\tDNS::IN_REQUEST\t-\ttip" ||
+		lines[6] != "1700000000.000000\tCa\te7d705a3286e19ea42f587b344ee6865\tIntel::JA3\tEnigma::IN_JA3_JA4_LOG\t-\ttip" ||
+		!strings.HasPrefix(lines[8], "#close") {
+		t.Errorf("intel.log =\n%s", strings.Join(lines, "\n"))
+	}
+
+	// No intel dir, no hits.
+	if n, err := MatchIntelFingerprints(runDir, ProcessOptions{}); err != nil || n != 0 {
+		t.Errorf("disabled: %d hits, err %v", n, err)
+	}
+}
@@ -0,0 +1,171 @@
+package types
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// FilterOptions selects the row-level privacy filters FilterLogs applies to
+// each uploaded log. All filters run in a single pass over every log; an empty
+// field turns the corresponding filter off.
+type FilterOptions struct {
+	// MonitoredSubnets is an allow-list of CIDRs; when set, rows with no
+	// endpoint inside one of them are dropped (see monitoredFilter).
+	MonitoredSubnets []string
+	// ExcludedSubnets holds "CIDR[=action]" entries (see FilterExcludedSubnets).
+	ExcludedSubnets []string
+	// ExcludedDomains holds "pattern[=action]" entries (see domain_filter.go).
+	ExcludedDomains []string
+	// Rules holds record filter rules in the rules package syntax
+	// (e.g. "drop conn where id.resp_p in (873, 445) and proto == tcp").
+	Rules []string
+	// MemoryLimit is the worker memory budget in bytes that bounds the
+	// longest log line a rewrite will hold (0 = DefaultMemoryLimit).
+	MemoryLimit int64
+}
+
+// FilterStats counts what the filters did to the data rows of one log. Masked
+// counts kept rows with at least one address masked or truncated, Redacted
+// counts kept rows with at least one domain name redacted (a row can count in
+// both), and Passed counts rows that were kept untouched. Unmonitored counts
+// the dropped rows that fell outside the monitored_subnets allow-list. RuleHits maps each
+// filter rule that applies to the log to the number of rows it dropped
+// (including zero, so a rule that never fires is visible).
+type FilterStats struct {
+	Dropped     int            `json:"dropped"`
+	Masked      int            `json:"masked"`
+	Redacted    int            `json:"redacted"`
+	Passed      int            `json:"passed"`
+	Unmonitored int            `json:"unmonitored,omitempty"`
+	RuleHits    map[string]int `json:"rule_hits,omitempty"`
+}
+
+// rowAction is what a row filter decided for one data row.
+type rowAction int
+
+const (
+	rowPassed   rowAction = iota // untouched
+	rowMasked                    // kept, one or more addresses rewritten
+	rowRedacted                  // kept, one or more domain names redacted
+	rowDropped                   // removed from the log
+)
+
+// rowFilter is one stage of the single filtering pass. bind is called once per
+// log with its parsed header and the log's stats (for filter-specific counters)
+// and returns the function applied to each data row, or nil when the log has
+// none of the columns the filter acts on. The row function may rewrite cols in
+// place; returning rowDropped discards the row and skips the remaining filters.
+type rowFilter interface {
+	bind(h *logHeader, stats *FilterStats) func(cols []string) rowAction
+}
+
+// rowFilters builds the enabled filters in the order they are applied:
+//
+//  1. the monitored_subnets allow-list, so out-of-scope rows are discarded
+//     before anything else looks at them;
+//  2. the record filter rules, which see the addresses and names Zeek wrote
+//     rather than the masked or redacted ones, so a rule on an excluded
+//     address still matches;
+//  3. excluded_subnets, which therefore still applies inside monitored ranges
+//     (an address that is both monitored and excluded gets its exclusion
+//     policy, so exclusions can carve holes in the allow-list);
+//  4. excluded_domains.
+func (o FilterOptions) rowFilters() []rowFilter {
+	var filters []rowFilter
+	if nets := parseMonitoredSubnets(o.MonitoredSubnets); len(nets) > 0 {
+		filters = append(filters, monitoredFilter{nets: nets})
+	}
+	if parsed := parseFilterRules(o.Rules); len(parsed) > 0 {
+		filters = append(filters, ruleFilter{rules: parsed})
+	}
+	if policies := parseSubnetPolicies(o.ExcludedSubnets); len(policies) > 0 {
+		filters = append(filters, subnetFilter{policies: policies})
+	}
+	if rules := parseDomainRules(o.ExcludedDomains); len(rules) > 0 {
+		filters = append(filters, domainFilter{rules: rules})
+	}
+	return filters
+}
+
+// FilterLogs rewrites each of the given Zeek TSV logs in runDir in place,
+// running every enabled filter in opts over each data row in one pass.
+// Header/footer lines (#separator, #fields, #types, #open, #close, ...) are
+// preserved verbatim. Missing log files are a no-op (JA3/JA4 may be absent,
+// e.g. on Linux). With no filters enabled nothing is read or written.
+//
+// The returned map holds per-log row counts keyed by log name, for logs that
+// were present. Filtering is a "do not upload it" guarantee, so any
+// read/parse/write failure on a present log is returned as an error rather
+// than swallowed — the caller aborts the capture window rather than risk
+// uploading unfiltered data.
+func FilterLogs(runDir string, logFiles []string, opts FilterOptions) (map[string]FilterStats, error) {
+	filters := opts.rowFilters()
+	if len(filters) == 0 {
+		return nil, nil
+	}
+	report := make(map[string]FilterStats)
+	for _, name := range logFiles {
+		stats, present, err := filterLogFile(filepath.Join(runDir, name), filters, opts.MemoryLimit)
+		if err != nil {
+			return nil, fmt.Errorf("filter %s: %w", name, err)
+		}
+		if present {
+			report[name] = stats
+		}
+	}
+	return report, nil
+}
+
+// filterLogFile applies the filters to a single Zeek TSV log, streaming it
+// through a temporary file and replacing it only when a row was dropped or
+// rewritten. present is false when the log does not exist.
+func filterLogFile(logPath string, filters []rowFilter, limit int64) (stats FilterStats, present bool, err error) {
+	present, changed, err := rewriteLog(logPath, limit, func(h *logHeader) func(string) (string, bool) {
+		var apply []func([]string) rowAction
+		for _, f := range filters {
+			if fn := f.bind(h, &stats); fn != nil {
+				apply = append(apply, fn)
+			}
+		}
+		return func(line string) (string, bool) {
+			cols := strings.Split(line, h.sep)
+			dropped, masked, redacted := false, false, false
+			for _, fn := range apply {
+				switch fn(cols) {
+				case rowDropped:
+					dropped = true
+				case rowMasked:
+					masked = true
+				case rowRedacted:
+					redacted = true
+				}
+				if dropped {
+					break
+				}
+			}
+			switch {
+			case dropped:
+				stats.Dropped++
+				return "", false
+			case masked || redacted:
+				if masked {
+					stats.Masked++
+				}
+				if redacted {
+					stats.Redacted++
+				}
+				return strings.Join(cols, h.sep), true
+			}
+			stats.Passed++
+			return line, true
+		}
+	})
+	if err != nil || !changed {
+		return stats, present, err
+	}
+	log.Printf("[processor] Log filter on %s: dropped=%d masked=%d redacted=%d passed=%d",
+		filepath.Base(logPath), stats.Dropped, stats.Masked, stats.Redacted, stats.Passed)
+	return stats, true, nil
+}
@@ -0,0 +1,282 @@
+package types
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultMemoryLimit is the per-worker memory budget for rewriting and
+// encoding logs when none is configured (capture.worker_memory_mb).
+const DefaultMemoryLimit int64 = 64 << 20
+
+// streamBufferSize is the read/write buffer used when streaming a log.
+const streamBufferSize = 64 << 10
+
+// maxLineBytes is the longest log line a worker will hold under limit. A line
+// is held together with its split columns and a rewritten copy, so it may use
+// a quarter of the budget.
+func maxLineBytes(limit int64) int {
+	if limit <= 0 {
+		limit = DefaultMemoryLimit
+	}
+	if n := limit / 4; n > streamBufferSize {
+		return int(n)
+	}
+	return streamBufferSize
+}
+
+// logLine is one line of a log without its newline; terminated records
+// whether it had one, so a rewrite round-trips the file's final byte.
+type logLine struct {
+	text       string
+	terminated bool
+}
+
+// logReader reads a Zeek TSV log one line at a time, so memory use does not
+// grow with the size of the log. The "#" preamble is read ahead and parsed
+// on construction; next still returns those lines, in order, before the data.
+type logReader struct {
+	r       *bufio.Reader
+	maxLine int
+	queued  []logLine
+	header  *logHeader
+}
+
+// newLogReader reads the header of the log in r. Lines longer than maxLine
+// bytes are an error rather than an unbounded allocation.
+func newLogReader(r io.Reader, maxLine int) (*logReader, error) {
+	lr := &logReader{r: bufio.NewReaderSize(r, streamBufferSize), maxLine: maxLine}
+	var preamble []string
+	for {
+		l, err := lr.readLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		lr.queued = append(lr.queued, l)
+		if l.text != "" && !strings.HasPrefix(l.text, "#") {
+			break
+		}
+		preamble = append(preamble, l.text)
+	}
+	lr.header = parseLogHeader(preamble)
+	return lr, nil
+}
+
+// next returns the next line of the log, or io.EOF after the last one.
+func (lr *logReader) next() (logLine, error) {
+	if len(lr.queued) > 0 {
+		l := lr.queued[0]
+		lr.queued = lr.queued[1:]
+		return l, nil
+	}
+	return lr.readLine()
+}
+
+func (lr *logReader) readLine() (logLine, error) {
+	var buf []byte
+	for {
+		frag, err := lr.r.ReadSlice('\n')
+		if len(buf)+len(frag) > lr.maxLine {
+			return logLine{}, fmt.Errorf("log line longer than %d bytes exceeds the worker memory limit", lr.maxLine)
+		}
+		switch err {
+		case nil:
+			buf = append(buf, frag[:len(frag)-1]...)
+			return logLine{text: string(buf), terminated: true}, nil
+		case bufio.ErrBufferFull:
+			buf = append(buf, frag...)
+		case io.EOF:
+			buf = append(buf, frag...)
+			if len(buf) == 0 {
+				return logLine{}, io.EOF
+			}
+			return logLine{text: string(buf)}, nil
+		default:
+			return logLine{}, err
+		}
+	}
+}
+
+// isDataLine reports whether a log line is a data row rather than a "#"
+// header/footer line or a blank line.
+func isDataLine(line string) bool {
+	return line != "" && !strings.HasPrefix(line, "#")
+}
+
+// rewriteLog streams the Zeek TSV log at logPath through a temporary file
+// beside it. build is called once with the parsed header and returns the
+// function applied to each data row: it returns the line to write, or false
+// to drop the row. Header and footer lines are copied verbatim. The original
+// is replaced only when a row was changed or dropped; otherwise the temporary
+// copy is discarded and the log is left untouched.
+//
+// present is false when the log does not exist; limit is the worker memory
+// budget in bytes (0 = DefaultMemoryLimit).
+func rewriteLog(logPath string, limit int64, build func(h *logHeader) func(line string) (string, bool)) (present, changed bool, err error) {
+	return rewriteLogWith(logPath, limit, func(h *logHeader) *logRewrite {
+		if row := build(h); row != nil {
+			return &logRewrite{row: row}
+		}
+		return nil
+	})
+}
+
+// logRewrite is what rewriteLogWith applies to a log.
+type logRewrite struct {
+	// row is applied to each data row, as in rewriteLog.
+	row func(line string) (string, bool)
+	// meta, when set, is applied to each "#" header/footer line, e.g. to
+	// add a column to #fields and #types.
+	meta func(line string) string
+}
+
+// rewriteLogWith is rewriteLog for rewrites that also change the header; it
+// leaves the log untouched when build returns nil.
+func rewriteLogWith(logPath string, limit int64, build func(h *logHeader) *logRewrite) (present, changed bool, err error) {
+	in, err := os.Open(logPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, false, nil
+		}
+		return false, false, fmt.Errorf("read: %w", err)
+	}
+	tmpPath, changed, err := rewriteTo(in, logPath, limit, build)
+	in.Close()
+	if tmpPath != "" {
+		defer os.Remove(tmpPath)
+	}
+	if err != nil || !changed {
+		return true, false, err
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return true, false, fmt.Errorf("write: %w", err)
+	}
+	if err := os.Rename(tmpPath, logPath); err != nil {
+		return true, false, fmt.Errorf("write: %w", err)
+	}
+	return true, true, nil
+}
+
+// rewriteTo does the streaming half of rewriteLogWith, returning the temporary
+// file it wrote (if any). The input is closed by the caller before the rename,
+// which Windows requires.
+func rewriteTo(in io.Reader, logPath string, limit int64, build func(h *logHeader) *logRewrite) (tmpPath string, changed bool, err error) {
+	lr, err := newLogReader(in, maxLineBytes(limit))
+	if err != nil {
+		return "", false, fmt.Errorf("read: %w", err)
+	}
+	h := lr.header
+	if h.path == "" {
+		h.path = strings.TrimSuffix(filepath.Base(logPath), ".log")
+	}
+	rw := build(h)
+	if rw == nil {
+		return "", false, nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(logPath), filepath.Base(logPath)+".tmp*")
+	if err != nil {
+		return "", false, fmt.Errorf("create: %w", err)
+	}
+	w := bufio.NewWriterSize(tmp, streamBufferSize)
+	for {
+		l, err := lr.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			tmp.Close()
+			return tmp.Name(), false, fmt.Errorf("read: %w", err)
+		}
+		text := l.text
+		switch {
+		case isDataLine(text):
+			out, keep := rw.row(text)
+			if !keep {
+				changed = true
+				continue
+			}
+			if out != text {
+				changed = true
+				text = out
+			}
+		case text != "" && rw.meta != nil:
+			if out := rw.meta(text); out != text {
+				changed = true
+				text = out
+			}
+		}
+		w.WriteString(text)
+		if l.terminated {
+			w.WriteByte('\n')
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return tmp.Name(), false, fmt.Errorf("write: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return tmp.Name(), false, fmt.Errorf("write: %w", err)
+	}
+	return tmp.Name(), changed, nil
+}
+
+// logRows is a logenc.RowReader over the data rows of a streaming log,
+// skipping header/footer and blank lines.
+type logRows struct {
+	lr  *logReader
+	sep string
+}
+
+func (r *logRows) Next() ([]string, error) {
+	for {
+		l, err := r.lr.next()
+		if err != nil {
+			return nil, err
+		}
+		if isDataLine(l.text) {
+			return strings.Split(l.text, r.sep), nil
+		}
+	}
+}
+
+// scanLog streams the data rows of the Zeek TSV log at logPath without
+// rewriting it. build is called once with the parsed header and returns the
+// function applied to each row's columns, or nil to skip the log. present is
+// false when the log does not exist; limit is as for rewriteLog.
+func scanLog(logPath string, limit int64, build func(h *logHeader) func(cols []string)) (present bool, err error) {
+	in, err := os.Open(logPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("read: %w", err)
+	}
+	defer in.Close()
+	lr, err := newLogReader(in, maxLineBytes(limit))
+	if err != nil {
+		return true, fmt.Errorf("read: %w", err)
+	}
+	fn := build(lr.header)
+	if fn == nil {
+		return true, nil
+	}
+	rows := &logRows{lr: lr, sep: lr.header.sep}
+	for {
+		cols, err := rows.Next()
+		if err == io.EOF {
+			return true, nil
+		}
+		if err != nil {
+			return true, fmt.Errorf("read: %w", err)
+		}
+		fn(cols)
+	}
+}
@@ -0,0 +1,109 @@
+package types
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const streamLog = "#separator \\x09\n" +
+	"#fields\tuid\tid.orig_h\n" +
+	"#types\tstring\taddr\n" +
+	"C1\t10.0.0.1\n" +
+	"C2\t10.0.0.2\n" +
+	"#close\t2024-01-01-00-01-00"
+
+func writeStreamLog(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "conn.log")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeTestFile writes data to the file name in dir.
+func writeTestFile(t *testing.T, dir, name, data string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRewriteLog_DropsAndPreservesFraming(t *testing.T) {
+	path := writeStreamLog(t, streamLog)
+	var gotPath string
+	present, changed, err := rewriteLog(path, 0, func(h *logHeader) func(string) (string, bool) {
+		gotPath = h.path
+		return func(line string) (string, bool) {
+			return line, !strings.HasPrefix(line, "C1")
+		}
+	})
+	if err != nil || !present || !changed {
+		t.Fatalf("rewriteLog = %v, %v, %v", present, changed, err)
+	}
+	if gotPath != "conn" {
+		t.Errorf("header path = %q, want filename fallback", gotPath)
+	}
+	data, _ := os.ReadFile(path)
+	want := strings.Replace(streamLog, "C1\t10.0.0.1\n", "", 1)
+	if string(data) != want {
+		t.Errorf("rewritten log =\n%q\nwant\n%q", data, want)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
+
+func TestRewriteLog_UnchangedLeavesFile(t *testing.T) {
+	path := writeStreamLog(t, streamLog)
+	before, _ := os.Stat(path)
+	_, changed, err := rewriteLog(path, 0, func(*logHeader) func(string) (string, bool) {
+		return func(line string) (string, bool) { return line, true }
+	})
+	if err != nil || changed {
+		t.Fatalf("rewriteLog changed=%v err=%v", changed, err)
+	}
+	after, _ := os.Stat(path)
+	if !os.SameFile(before, after) {
+		t.Error("unchanged log should not be replaced")
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
+
+func TestRewriteLog_Missing(t *testing.T) {
+	present, _, err := rewriteLog(filepath.Join(t.TempDir(), "dns.log"), 0, nil)
+	if present || err != nil {
+		t.Errorf("missing log: present=%v err=%v", present, err)
+	}
+}
+
+func TestRewriteLog_LineOverMemoryLimit(t *testing.T) {
+	limit := int64(16 * streamBufferSize)
+	long := "C1\t" + strings.Repeat("x", maxLineBytes(limit)) + "\n"
+	path := writeStreamLog(t, "#fields\tuid\tquery\n"+long)
+	_, _, err := rewriteLog(path, limit, func(*logHeader) func(string) (string, bool) {
+		return func(line string) (string, bool) { return line, true }
+	})
+	if err == nil || !strings.Contains(err.Error(), "memory limit") {
+		t.Errorf("expected memory limit error, got %v", err)
+	}
+
+	// A line spanning several read buffers but within the limit is fine.
+	ok := "C1\t" + strings.Repeat("x", 3*streamBufferSize) + "\n"
+	path = writeStreamLog(t, "#fields\tuid\tquery\n"+ok)
+	var got string
+	if _, _, err := rewriteLog(path, limit, func(*logHeader) func(string) (string, bool) {
+		return func(line string) (string, bool) { got = line; return line, true }
+	}); err != nil {
+		t.Fatalf("rewriteLog: %v", err)
+	}
+	if got != strings.TrimSuffix(ok, "\n") {
+		t.Errorf("long line read back with %d bytes, want %d", len(got), len(ok)-1)
+	}
+}
@@ -0,0 +1,212 @@
+package types
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"EnigmaNetz/Enigma-Go-Sensor/internal/processor/common/oui"
+)
+
+// macVendorColumns pairs each MAC address column with the vendor column
+// EnrichMACVendors appends for it: dhcp.log's mac, and conn.log's link-layer
+// addresses, which BuildZeekArgs has Zeek log with its mac-logging policy.
+var macVendorColumns = []struct{ mac, vendor string }{
+	{"mac", "mac_vendor"},
+	{"orig_l2_addr", "orig_mac_vendor"},
+	{"resp_l2_addr", "resp_mac_vendor"},
+}
+
+// Values written instead of a vendor for addresses the IEEE registry cannot
+// place. Randomized addresses are the per-network private MACs of phones and
+// laptops, so one device may appear under several of them.
+const (
+	macVendorRandomized = "(randomized)"
+	macVendorLocal      = "(locally administered)"
+	macVendorMulticast  = "(multicast)"
+)
+
+// ouiCache holds the registry loaded from the local OUI files.
+var ouiCache fileCache[*oui.Registry]
+
+// ouiFiles expands the configured OUI paths into the registry files to read:
+// a file as given, and the .csv and .txt files of a directory in name order.
+func ouiFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		n := 0
+		for _, e := range entries {
+			ext := strings.ToLower(filepath.Ext(e.Name()))
+			if !e.Type().IsRegular() || (ext != ".csv" && ext != ".txt") {
+				continue
+			}
+			files = append(files, filepath.Join(path, e.Name()))
+			n++
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("no .csv or .txt files in %s", path)
+		}
+	}
+	return files, nil
+}
+
+// loadOUIRegistry returns the registry to resolve vendors with: the files at
+// paths (IEEE oui.csv, mam.csv, oas.csv or oui.txt files, or directories of
+// them) over the built-in registry, or the built-in registry alone when paths
+// is empty. The files are re-read when one is added, removed or changes size
+// or modification time; if any is missing or unreadable the last good copy,
+// or the built-in registry, is used.
+func loadOUIRegistry(paths []string) *oui.Registry {
+	if len(paths) == 0 {
+		return oui.Embedded()
+	}
+	key := strings.Join(paths, ",")
+	reg, ok, err := ouiCache.load(key, func() ([]string, error) {
+		return ouiFiles(paths)
+	}, func(files []string) (*oui.Registry, error) {
+		reg := &oui.Registry{}
+		for _, file := range files {
+			r, err := parseOUIFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			reg.Fill(r)
+		}
+		reg.Fill(oui.Embedded())
+		return reg, nil
+	}, func(reg *oui.Registry, reloaded bool) {
+		log.Printf("[processor] %s %d OUI assignments from %s", loadedVerb(reloaded), reg.Len(), key)
+	})
+	if !ok {
+		reg = oui.Embedded()
+	}
+	if err != nil {
+		log.Printf("[processor] Warning: OUI files %s unavailable (%v); using the %s vendor table", key, err, ouiTableName(reg))
+	}
+	return reg
+}
+
+// parseOUIFile parses one IEEE registry file.
+func parseOUIFile(path string) (*oui.Registry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return oui.Parse(f)
+}
+
+func ouiTableName(r *oui.Registry) string {
+	if r == oui.Embedded() {
+		return "built-in"
+	}
+	return "previously loaded"
+}
+
+// macVendor returns the mac_vendor value for one MAC address column value.
+func macVendor(reg *oui.Registry, value string) string {
+	mac, err := net.ParseMAC(value)
+	if err != nil {
+		return "-"
+	}
+	switch oui.Classify(mac) {
+	case oui.Randomized:
+		return macVendorRandomized
+	case oui.LocallyAdministered:
+		return macVendorLocal
+	case oui.Multicast:
+		return macVendorMulticast
+	}
+	if vendor, ok := reg.Vendor(mac); ok {
+		return vendor
+	}
+	return "-"
+}
+
+// EnrichMACVendors appends a vendor column after the MAC address columns of
+// the given logs in runDir (mac_vendor for dhcp.log's mac, orig_mac_vendor
+// and resp_mac_vendor for conn.log's orig_l2_addr and resp_l2_addr). Vendors
+// come from the IEEE registry: the MA-L copy built into the sensor, under
+// the MA-L, MA-M and MA-S files or directories ouiPaths. Addresses the
+// registry cannot place are flagged "(randomized)", "(locally administered)"
+// or "(multicast)"; an unknown vendor or unset address is "-". limit is the
+// worker memory budget in bytes (0 = DefaultMemoryLimit).
+func EnrichMACVendors(runDir string, logFiles []string, ouiPaths []string, limit int64) error {
+	reg := loadOUIRegistry(ouiPaths)
+	for _, name := range logFiles {
+		enriched, randomized := 0, 0
+		_, _, err := rewriteLogWith(filepath.Join(runDir, name), limit, func(h *logHeader) *logRewrite {
+			return macVendorRewrite(h, reg, &enriched, &randomized)
+		})
+		if err != nil {
+			return fmt.Errorf("mac vendor %s: %w", name, err)
+		}
+		if enriched > 0 {
+			log.Printf("[processor] Added MAC vendors to %d rows of %s (%d randomized addresses)", enriched, name, randomized)
+		}
+	}
+	return nil
+}
+
+// macVendorRewrite builds the rewrite adding vendor columns to one log, or
+// returns nil when it has no MAC columns or already has the vendor columns.
+func macVendorRewrite(h *logHeader, reg *oui.Registry, enriched, randomized *int) *logRewrite {
+	var macIdx []int
+	var added []string
+	for _, c := range macVendorColumns {
+		if i := h.index(c.mac); i >= 0 && h.index(c.vendor) < 0 {
+			macIdx = append(macIdx, i)
+			added = append(added, c.vendor)
+		}
+	}
+	if len(macIdx) == 0 {
+		return nil
+	}
+
+	row := func(line string) (string, bool) {
+		cols := strings.Split(line, h.sep)
+		vendors := make([]string, len(macIdx))
+		hit := false
+		for j, i := range macIdx {
+			vendors[j] = "-"
+			if i < len(cols) && !zeekUnsetMarkers[cols[i]] {
+				vendors[j] = escapeZeekValue(macVendor(reg, cols[i]), h.sep)
+			}
+			if vendors[j] != "-" {
+				hit = true
+			}
+			if vendors[j] == macVendorRandomized {
+				*randomized++
+			}
+		}
+		if hit {
+			*enriched++
+		}
+		return line + h.sep + strings.Join(vendors, h.sep), true
+	}
+	meta := func(line string) string {
+		switch {
+		case strings.HasPrefix(line, "#fields"+h.sep):
+			return line + h.sep + strings.Join(added, h.sep)
+		case strings.HasPrefix(line, "#types"+h.sep) && len(h.types) > 0:
+			return line + strings.Repeat(h.sep+"string", len(added))
+		}
+		return line
+	}
+	return &logRewrite{row: row, meta: meta}
+}
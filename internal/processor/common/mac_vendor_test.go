@@ -0,0 +1,162 @@
+package types
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// macRunDir writes a dhcp.log and conn.log with MAC addresses, and a dns.log
+// without, to a new run directory.
+func macRunDir(t *testing.T) string {
+	t.Helper()
+	runDir := t.TempDir()
+	writeLog(t, runDir, "dhcp.log", zeekHeader("dhcp", "ts", "uids", "client_addr", "mac", "host_name"),
+		row("1.0", "C1", "192.168.1.10", "00:50:56:aa:bb:cc", "vm"),
+		row("2.0", "C2", "192.168.1.20", "da:a1:19:12:34:56", "phone"),
+		row("3.0", "C3", "192.168.1.30", "52:54:00:12:34:56", "kvm"),
+		row("4.0", "C4", "192.168.1.40", "9c:00:00:33:44:55", "unknown"),
+		row("5.0", "C5", "192.168.1.50", "-", "nomac"))
+	writeLog(t, runDir, "conn.log", zeekHeader("conn", "ts", "uid", "id.orig_h", "id.resp_h", "orig_l2_addr", "resp_l2_addr"),
+		row("1.0", "C1", "192.168.1.10", "192.168.1.255", "b8:27:eb:01:02:03", "ff:ff:ff:ff:ff:ff"))
+	writeLog(t, runDir, "dns.log", zeekHeader("dns", "ts", "uid", "id.orig_h", "query"),
+		row("1.0", "D1", "192.168.1.10", "example.com"))
+	return runDir
+}
+
+func TestEnrichMACVendors(t *testing.T) {
+	runDir := macRunDir(t)
+	dns, err := os.ReadFile(filepath.Join(runDir, "dns.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := EnrichMACVendors(runDir, ZeekLogFiles, nil, 0); err != nil {
+		t.Fatalf("EnrichMACVendors: %v", err)
+	}
+
+	dhcpPath := filepath.Join(runDir, "dhcp.log")
+	if fields, types := readHeaderLine(t, dhcpPath, "fields"), readHeaderLine(t, dhcpPath, "types"); !strings.HasSuffix(fields, "\thost_name\tmac_vendor") ||
+		!strings.HasSuffix(types, "\tstring\tstring\tstring") {
+		t.Errorf("dhcp.log header not extended:\n%s\n%s", fields, types)
+	}
+	dhcp := readDataRows(t, dhcpPath)
+	for i, want := range []string{"VMware, Inc.", "(randomized)", "(locally administered)", "-", "-"} {
+		if !strings.HasSuffix(dhcp[i], "\t"+want) {
+			t.Errorf("dhcp row %d = %q, want vendor %q", i, dhcp[i], want)
+		}
+	}
+
+	connPath := filepath.Join(runDir, "conn.log")
+	if fields := readHeaderLine(t, connPath, "fields"); !strings.HasSuffix(fields, "\tresp_l2_addr\torig_mac_vendor\tresp_mac_vendor") {
+		t.Errorf("conn.log #fields = %q", fields)
+	}
+	if conn := readDataRows(t, connPath); !strings.HasSuffix(conn[0], "\tRaspberry Pi Foundation\t(multicast)") {
+		t.Errorf("conn row = %q", conn[0])
+	}
+	if data, _ := os.ReadFile(filepath.Join(runDir, "dns.log")); string(data) != string(dns) {
+		t.Error("dns.log has no MAC columns and should be untouched")
+	}
+
+	// Already enriched logs are not extended twice.
+	before, _ := os.ReadFile(filepath.Join(runDir, "dhcp.log"))
+	if err := EnrichMACVendors(runDir, ZeekLogFiles, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := os.ReadFile(filepath.Join(runDir, "dhcp.log")); string(after) != string(before) {
+		t.Error("EnrichMACVendors is not idempotent")
+	}
+}
+
+func TestEnrichMACVendors_LocalOUIFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "oui.csv")
+	write := func(content string, mtime time.Time) {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	vendorOf := func(row int) string {
+		runDir := macRunDir(t)
+		if err := EnrichMACVendors(runDir, []string{"dhcp.log"}, []string{path}, 0); err != nil {
+			t.Fatal(err)
+		}
+		cols := strings.Split(readDataRows(t, filepath.Join(runDir, "dhcp.log"))[row], "\t")
+		return cols[len(cols)-1]
+	}
+	const header = "Registry,Assignment,Organization Name,Organization Address\n"
+	now := time.Now()
+
+	write(header+"MA-L,9C0000,Example Corp,\n", now)
+	if got := vendorOf(3); got != "Example Corp" {
+		t.Errorf("vendor from local file = %q", got)
+	}
+	if got := vendorOf(0); got != "VMware, Inc." {
+		t.Errorf("built-in table should fill gaps in the local file, got %q", got)
+	}
+
+	write(header+"MA-L,9C0000,Example Renamed,\n", now.Add(time.Hour))
+	if got := vendorOf(3); got != "Example Renamed" {
+		t.Errorf("changed file not reloaded, got %q", got)
+	}
+
+	// A broken or missing file keeps the last good copy.
+	write("garbage\n", now.Add(2*time.Hour))
+	if got := vendorOf(3); got != "Example Renamed" {
+		t.Errorf("broken file should keep the previous table, got %q", got)
+	}
+	os.Remove(path)
+	if got := vendorOf(3); got != "Example Renamed" {
+		t.Errorf("missing file should keep the previous table, got %q", got)
+	}
+}
+
+func TestEnrichMACVendors_OUIDirectory(t *testing.T) {
+	dir := t.TempDir()
+	const header = "Registry,Assignment,Organization Name,Organization Address\n"
+	for name, content := range map[string]string{
+		"oui.csv":   header + "MA-L,9C0000,Example Corp,\n",
+		"oas.csv":   header + "MA-S,9C0000334,Example Small Block,\n",
+		"README.md": "not a registry\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	extra := filepath.Join(t.TempDir(), "corp.txt")
+	if err := os.WriteFile(extra, []byte("52-54-00   (hex)\t\tNot Looked Up\nB8-27-EB   (hex)\t\tLocal Override\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	vendors := func(paths ...string) []string {
+		runDir := macRunDir(t)
+		if err := EnrichMACVendors(runDir, []string{"dhcp.log", "conn.log"}, paths, 0); err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, line := range readDataRows(t, filepath.Join(runDir, "dhcp.log")) {
+			cols := strings.Split(line, "\t")
+			out = append(out, cols[len(cols)-1])
+		}
+		// The conn.log row, for its orig_mac_vendor.
+		return append(out, readDataRows(t, filepath.Join(runDir, "conn.log"))[0])
+	}
+
+	got := vendors(dir, extra)
+	if got[3] != "Example Small Block" || got[0] != "VMware, Inc." || got[2] != macVendorLocal {
+		t.Errorf("dhcp vendors from directory = %v", got[:5])
+	}
+	if !strings.HasSuffix(got[5], "\tLocal Override\t(multicast)") {
+		t.Errorf("conn row with vendor from extra file = %q", got[5])
+	}
+
+	// Removing a file from the directory is noticed.
+	if err := os.Remove(filepath.Join(dir, "oas.csv")); err != nil {
+		t.Fatal(err)
+	}
+	if got := vendors(dir, extra); got[3] != "Example Corp" {
+		t.Errorf("vendor after removing oas.csv = %q", got[3])
+	}
+}
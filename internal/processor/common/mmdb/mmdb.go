@@ -0,0 +1,433 @@
+// Package mmdb reads MaxMind DB (.mmdb) files, the format of the GeoLite2 and
+// GeoIP2 country, city and ASN databases and of most third-party IP
+// intelligence feeds. It implements the binary search tree and data section
+// decoding of the MaxMind DB 2.0 specification
+// (https://maxmind.github.io/MaxMind-DB/) with no dependencies, so the sensor
+// can enrich logs offline without a vendored reader.
+//
+// A Reader holds the whole database in memory and is safe for concurrent use.
+// Decoded values are plain Go values: map[string]any, []any, string, float64,
+// float32, uint64 (all unsigned integers up to 64 bits), int32, bool, []byte
+// and *big.Int (uint128).
+package mmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/netip"
+	"os"
+)
+
+// metadataMarker precedes the metadata map at the end of every database.
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// metadataMaxSize is how far from the end of the file the marker is searched.
+const metadataMaxSize = 128 << 10
+
+// dataSectionSeparator is the run of zero bytes between the search tree and
+// the data section.
+const dataSectionSeparator = 16
+
+// Data section field types.
+const (
+	typeExtended  = 0
+	typePointer   = 1
+	typeString    = 2
+	typeDouble    = 3
+	typeBytes     = 4
+	typeUint16    = 5
+	typeUint32    = 6
+	typeMap       = 7
+	typeInt32     = 8
+	typeUint64    = 9
+	typeUint128   = 10
+	typeArray     = 11
+	typeContainer = 12
+	typeEnd       = 13
+	typeBool      = 14
+	typeFloat     = 15
+)
+
+// maxDepth bounds nested maps and arrays so a corrupt file cannot exhaust
+// the stack.
+const maxDepth = 64
+
+// Metadata describes a database, from the map at the end of the file.
+type Metadata struct {
+	DatabaseType string            // e.g. "GeoLite2-Country", "GeoLite2-ASN"
+	Description  map[string]string // by language code
+	Languages    []string
+	IPVersion    int // 4 or 6
+	RecordSize   int // bits per search tree record: 24, 28 or 32
+	NodeCount    int
+	BuildEpoch   uint64 // Unix time the database was built
+	MajorVersion int    // binary_format_major_version, always 2
+	MinorVersion int
+}
+
+// Reader looks addresses up in an in-memory MaxMind database.
+type Reader struct {
+	Metadata Metadata
+
+	tree      []byte
+	data      []byte
+	nodeBytes int
+	ipv4Start int
+	ipv4Depth int
+}
+
+// ErrInvalid is wrapped by every error reporting a malformed database.
+var ErrInvalid = errors.New("invalid MaxMind DB")
+
+func invalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalid, fmt.Sprintf(format, args...))
+}
+
+// Open reads the database at path.
+func Open(path string) (*Reader, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return FromBytes(b)
+}
+
+// FromBytes parses a database held in memory. b is retained, not copied.
+func FromBytes(b []byte) (*Reader, error) {
+	start := len(b) - metadataMaxSize
+	if start < 0 {
+		start = 0
+	}
+	i := bytes.LastIndex(b[start:], metadataMarker)
+	if i < 0 {
+		return nil, invalid("metadata marker not found")
+	}
+	metaStart := start + i + len(metadataMarker)
+	md := decoder{buf: b[metaStart:]}
+	v, _, err := md.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("metadata: %w", err)
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, invalid("metadata is not a map")
+	}
+	r := &Reader{Metadata: parseMetadata(m)}
+	meta := &r.Metadata
+	if meta.MajorVersion != 2 {
+		return nil, invalid("unsupported binary format version %d", meta.MajorVersion)
+	}
+	switch meta.RecordSize {
+	case 24, 28, 32:
+	default:
+		return nil, invalid("unsupported record size %d", meta.RecordSize)
+	}
+	if meta.IPVersion != 4 && meta.IPVersion != 6 {
+		return nil, invalid("unsupported IP version %d", meta.IPVersion)
+	}
+	r.nodeBytes = meta.RecordSize / 4
+	treeSize := meta.NodeCount * r.nodeBytes
+	if meta.NodeCount <= 0 || treeSize+dataSectionSeparator > metaStart-len(metadataMarker) {
+		return nil, invalid("search tree of %d nodes does not fit the file", meta.NodeCount)
+	}
+	r.tree = b[:treeSize]
+	r.data = b[treeSize+dataSectionSeparator : metaStart-len(metadataMarker)]
+
+	// IPv4 addresses live under ::/96 in an IPv6 tree; find that node once.
+	if meta.IPVersion == 6 {
+		node := 0
+		for i := 0; i < 96 && node < meta.NodeCount; i++ {
+			node = r.record(node, 0)
+		}
+		r.ipv4Start, r.ipv4Depth = node, 96
+	}
+	return r, nil
+}
+
+func parseMetadata(m map[string]any) Metadata {
+	num := func(k string) uint64 {
+		n, _ := m[k].(uint64)
+		return n
+	}
+	md := Metadata{
+		IPVersion:    int(num("ip_version")),
+		RecordSize:   int(num("record_size")),
+		NodeCount:    int(num("node_count")),
+		BuildEpoch:   num("build_epoch"),
+		MajorVersion: int(num("binary_format_major_version")),
+		MinorVersion: int(num("binary_format_minor_version")),
+	}
+	md.DatabaseType, _ = m["database_type"].(string)
+	if langs, ok := m["languages"].([]any); ok {
+		for _, l := range langs {
+			if s, ok := l.(string); ok {
+				md.Languages = append(md.Languages, s)
+			}
+		}
+	}
+	if desc, ok := m["description"].(map[string]any); ok {
+		md.Description = make(map[string]string, len(desc))
+		for k, v := range desc {
+			if s, ok := v.(string); ok {
+				md.Description[k] = s
+			}
+		}
+	}
+	return md
+}
+
+// record returns the left (bit 0) or right (bit 1) record of a tree node.
+func (r *Reader) record(node, bit int) int {
+	b := r.tree[node*r.nodeBytes:]
+	switch r.Metadata.RecordSize {
+	case 24:
+		b = b[bit*3:]
+		return int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+	case 28:
+		if bit == 0 {
+			return int(b[3]&0xf0)<<20 | int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+		}
+		return int(b[3]&0x0f)<<24 | int(b[4])<<16 | int(b[5])<<8 | int(b[6])
+	default:
+		return int(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// LookupOffset finds the data record for ip and returns its offset in the
+// data section, which identifies the record: many networks share one. ok is
+// false when the database has no entry for ip. An IPv6 address in an IPv4
+// database is never found.
+func (r *Reader) LookupOffset(ip netip.Addr) (offset int, ok bool, err error) {
+	ip = ip.Unmap()
+	if !ip.IsValid() {
+		return 0, false, nil
+	}
+	node, depth := 0, 0
+	if ip.Is4() && r.Metadata.IPVersion == 6 {
+		node, depth = r.ipv4Start, r.ipv4Depth
+	} else if ip.Is6() && r.Metadata.IPVersion == 4 {
+		return 0, false, nil
+	}
+	addr := ip.AsSlice()
+	count := r.Metadata.NodeCount
+	for i := 0; i < len(addr)*8 && node < count; i++ {
+		bit := int(addr[i/8]>>(7-uint(i%8))) & 1
+		node = r.record(node, bit)
+		depth++
+	}
+	switch {
+	case node == count:
+		return 0, false, nil
+	case node > count:
+		offset = node - count - dataSectionSeparator
+		if offset < 0 || offset >= len(r.data) {
+			return 0, false, invalid("record points outside the data section")
+		}
+		return offset, true, nil
+	}
+	return 0, false, invalid("search tree deeper than the address (depth %d)", depth)
+}
+
+// Lookup returns the decoded data record for ip, or nil when the database
+// has no entry for it.
+func (r *Reader) Lookup(ip netip.Addr) (any, error) {
+	offset, ok, err := r.LookupOffset(ip)
+	if !ok || err != nil {
+		return nil, err
+	}
+	return r.Decode(offset)
+}
+
+// Decode decodes the data section value at offset (see LookupOffset).
+func (r *Reader) Decode(offset int) (any, error) {
+	d := decoder{buf: r.data}
+	v, _, err := d.decode(offset, 0)
+	return v, err
+}
+
+// decoder decodes values from a data section (or the metadata map, which
+// uses the same encoding). Pointers are offsets into buf.
+type decoder struct {
+	buf []byte
+}
+
+// decode returns the value at offset and the offset just past it.
+func (d decoder) decode(offset, depth int) (any, int, error) {
+	if depth > maxDepth {
+		return nil, 0, invalid("data nested deeper than %d", maxDepth)
+	}
+	typ, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if typ == typePointer {
+		// size holds the pointer target. A pointer's value is decoded where
+		// it points; decoding continues after the pointer itself. Pointers
+		// to pointers are invalid.
+		if t, _, _, err := d.control(size); err != nil {
+			return nil, 0, err
+		} else if t == typePointer {
+			return nil, 0, invalid("pointer to a pointer at offset %d", size)
+		}
+		v, _, err := d.decode(size, depth+1)
+		return v, offset, err
+	}
+	switch typ {
+	case typeMap:
+		m := make(map[string]any, size)
+		for i := 0; i < size; i++ {
+			k, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, invalid("map key at offset %d is not a string", offset)
+			}
+			v, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+			offset = next
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]any, 0, min(size, 1024))
+		for i := 0; i < size; i++ {
+			v, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			offset = next
+		}
+		return a, offset, nil
+	case typeBool:
+		if size > 1 {
+			return nil, 0, invalid("boolean of size %d", size)
+		}
+		return size == 1, offset, nil
+	}
+
+	end := offset + size
+	if end > len(d.buf) {
+		return nil, 0, invalid("value at offset %d runs past the end of the data", offset)
+	}
+	b := d.buf[offset:end]
+	switch typ {
+	case typeString:
+		return string(b), end, nil
+	case typeBytes:
+		return append([]byte(nil), b...), end, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, invalid("double of size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), end, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, invalid("float of size %d", size)
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), end, nil
+	case typeUint16, typeUint32, typeUint64:
+		if max := map[int]int{typeUint16: 2, typeUint32: 4, typeUint64: 8}[typ]; size > max {
+			return nil, 0, invalid("unsigned integer of size %d", size)
+		}
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		return n, end, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, invalid("int32 of size %d", size)
+		}
+		var n uint32
+		for _, c := range b {
+			n = n<<8 | uint32(c)
+		}
+		return int32(n), end, nil
+	case typeUint128:
+		if size > 16 {
+			return nil, 0, invalid("uint128 of size %d", size)
+		}
+		return new(big.Int).SetBytes(b), end, nil
+	}
+	return nil, 0, invalid("unexpected type %d at offset %d", typ, offset)
+}
+
+// control reads the control byte(s) at offset and returns the field type, its
+// size (or, for pointers, the target offset) and the offset of the payload.
+func (d decoder) control(offset int) (typ, size, next int, err error) {
+	byteAt := func(i int) (int, error) {
+		if i >= len(d.buf) {
+			return 0, invalid("control byte at offset %d runs past the end of the data", i)
+		}
+		return int(d.buf[i]), nil
+	}
+	ctrl, err := byteAt(offset)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	offset++
+	typ = ctrl >> 5
+	if typ == typePointer {
+		n := (ctrl >> 3) & 0x3
+		v := ctrl & 0x7
+		if offset+n+1 > len(d.buf) {
+			return 0, 0, 0, invalid("pointer at offset %d runs past the end of the data", offset-1)
+		}
+		b := d.buf[offset : offset+n+1]
+		switch n {
+		case 0:
+			size = v<<8 | int(b[0])
+		case 1:
+			size = (v<<16 | int(b[0])<<8 | int(b[1])) + 2048
+		case 2:
+			size = (v<<24 | int(b[0])<<16 | int(b[1])<<8 | int(b[2])) + 526336
+		default:
+			size = int(binary.BigEndian.Uint32(b))
+		}
+		return typePointer, size, offset + n + 1, nil
+	}
+	if typ == typeExtended {
+		ext, err := byteAt(offset)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		offset++
+		typ = ext + 7
+		if typ <= typeMap || typ > typeFloat {
+			return 0, 0, 0, invalid("invalid extended type %d", typ)
+		}
+	}
+	size = ctrl & 0x1f
+	if size >= 29 {
+		n := size - 28
+		if offset+n > len(d.buf) {
+			return 0, 0, 0, invalid("size at offset %d runs past the end of the data", offset)
+		}
+		var ext int
+		for _, c := range d.buf[offset : offset+n] {
+			ext = ext<<8 | int(c)
+		}
+		switch n {
+		case 1:
+			size = 29 + ext
+		case 2:
+			size = 285 + ext
+		default:
+			size = 65821 + ext
+		}
+		offset += n
+	}
+	if typ == typeContainer || typ == typeEnd {
+		return 0, 0, 0, invalid("unexpected type %d in data", typ)
+	}
+	return typ, size, offset, nil
+}
@@ -0,0 +1,332 @@
+package mmdb
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func buildDB(t *testing.T, entries map[string]any, order ...string) []byte {
+	t.Helper()
+	b := &Builder{DatabaseType: "Test-DB", Description: "test"}
+	for _, p := range order {
+		if err := b.Insert(netip.MustParsePrefix(p), entries[p]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if _, err := b.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+var testEntries = map[string]any{
+	"8.8.0.0/16":     map[string]any{"country": map[string]any{"iso_code": "US"}},
+	"8.8.8.0/24":     map[string]any{"autonomous_system_number": uint32(15169), "autonomous_system_organization": "GOOGLE"},
+	"2a00:1450::/32": map[string]any{"country": map[string]any{"iso_code": "IE"}, "names": []any{"a", "b"}},
+	"81.2.69.0/24": map[string]any{
+		"bool": true, "double": 1.5, "float": float32(0.25), "int": int32(-7),
+		"u16": uint16(300), "u64": uint64(1) << 40, "long": string(bytes.Repeat([]byte("x"), 300)),
+	},
+}
+
+var testOrder = []string{"8.8.0.0/16", "8.8.8.0/24", "2a00:1450::/32", "81.2.69.0/24"}
+
+func TestLookup(t *testing.T) {
+	r, err := FromBytes(buildDB(t, testEntries, testOrder...))
+	if err != nil {
+		t.Fatalf("FromBytes: %v", err)
+	}
+	if r.Metadata.DatabaseType != "Test-DB" || r.Metadata.IPVersion != 6 || r.Metadata.RecordSize != 32 || r.Metadata.Description["en"] != "test" {
+		t.Errorf("metadata = %+v", r.Metadata)
+	}
+
+	cases := []struct {
+		ip   string
+		want any
+	}{
+		{"8.8.4.4", testEntries["8.8.0.0/16"]},
+		{"8.8.8.8", map[string]any{"autonomous_system_number": uint64(15169), "autonomous_system_organization": "GOOGLE"}},
+		{"::ffff:8.8.8.8", map[string]any{"autonomous_system_number": uint64(15169), "autonomous_system_organization": "GOOGLE"}},
+		{"2a00:1450:4001::1", testEntries["2a00:1450::/32"]},
+		{"81.2.69.160", map[string]any{
+			"bool": true, "double": 1.5, "float": float32(0.25), "int": int32(-7),
+			"u16": uint64(300), "u64": uint64(1) << 40, "long": string(bytes.Repeat([]byte("x"), 300)),
+		}},
+		{"1.1.1.1", nil},
+		{"2001:db8::1", nil},
+	}
+	for _, c := range cases {
+		got, err := r.Lookup(netip.MustParseAddr(c.ip))
+		if err != nil {
+			t.Errorf("Lookup(%s): %v", c.ip, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Lookup(%s) = %#v, want %#v", c.ip, got, c.want)
+		}
+	}
+
+	a, _, _ := r.LookupOffset(netip.MustParseAddr("8.8.4.4"))
+	b, _, _ := r.LookupOffset(netip.MustParseAddr("8.8.200.1"))
+	if a != b {
+		t.Error("addresses in the same network should share a record offset")
+	}
+}
+
+// repack rewrites a 32-bit-record database with a smaller record size.
+func repack(t *testing.T, db []byte, size int) []byte {
+	t.Helper()
+	r, err := FromBytes(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := r.Metadata.NodeCount
+	var tree []byte
+	for i := 0; i < n; i++ {
+		left, right := r.record(i, 0), r.record(i, 1)
+		switch size {
+		case 24:
+			tree = append(tree, byte(left>>16), byte(left>>8), byte(left), byte(right>>16), byte(right>>8), byte(right))
+		case 28:
+			tree = append(tree, byte(left>>16), byte(left>>8), byte(left), byte(left>>20&0xf0|right>>24&0x0f), byte(right>>16), byte(right>>8), byte(right))
+		}
+	}
+	rest := db[n*8:]
+	out := append(tree, rest...)
+	// Patch record_size in the metadata: the builder encodes it as a
+	// one-byte uint16 after its key.
+	key := append([]byte{0x40 | byte(len("record_size"))}, "record_size"...)
+	i := bytes.LastIndex(out, key) + len(key)
+	if !bytes.Equal(out[i:i+2], []byte{0xa1, 32}) {
+		t.Fatalf("unexpected record_size encoding % x", out[i:i+2])
+	}
+	out[i+1] = byte(size)
+	return out
+}
+
+func TestLookup_RecordSizes(t *testing.T) {
+	db := buildDB(t, testEntries, testOrder...)
+	for _, size := range []int{24, 28} {
+		r, err := FromBytes(repack(t, db, size))
+		if err != nil {
+			t.Fatalf("record size %d: %v", size, err)
+		}
+		if r.Metadata.RecordSize != size {
+			t.Fatalf("record size = %d", r.Metadata.RecordSize)
+		}
+		got, err := r.Lookup(netip.MustParseAddr("2a00:1450::1"))
+		if err != nil || !reflect.DeepEqual(got, testEntries["2a00:1450::/32"]) {
+			t.Errorf("record size %d: Lookup = %v, %v", size, got, err)
+		}
+	}
+}
+
+func TestInsert_Overlap(t *testing.T) {
+	db := buildDB(t, map[string]any{"10.0.0.0/8": "wide", "10.1.0.0/16": "narrow"}, "10.0.0.0/8", "10.1.0.0/16")
+	r, err := FromBytes(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ip, want := range map[string]any{"10.1.2.3": "narrow", "10.2.0.1": "wide", "10.255.0.1": "wide", "11.0.0.1": nil} {
+		if got, _ := r.Lookup(netip.MustParseAddr(ip)); got != want {
+			t.Errorf("Lookup(%s) = %v, want %v", ip, got, want)
+		}
+	}
+}
+
+func TestDecode_Pointers(t *testing.T) {
+	// {"a": "hi", "b": <pointer to "hi">}
+	data := []byte{
+		0xe2,
+		0x41, 'a', 0x42, 'h', 'i',
+		0x41, 'b', 0x20, 0x03,
+		0x01, 0x03, 0x11, // uint128 0x11 (extended type 7+3)
+	}
+	d := decoder{buf: data}
+	v, next, err := d.decode(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, map[string]any{"a": "hi", "b": "hi"}) || next != 10 {
+		t.Errorf("decode = %v (next %d)", v, next)
+	}
+	v, _, err = d.decode(10, 0)
+	if err != nil || v.(*big.Int).Int64() != 0x11 {
+		t.Errorf("uint128 = %v, %v", v, err)
+	}
+	// A pointer to a pointer is invalid.
+	if _, _, err := (decoder{buf: []byte{0x20, 0x02, 0x20, 0x00}}).decode(0, 0); !errors.Is(err, ErrInvalid) {
+		t.Errorf("pointer to pointer: err = %v", err)
+	}
+}
+
+func TestFromBytes_Invalid(t *testing.T) {
+	db := buildDB(t, testEntries, testOrder...)
+	if _, err := FromBytes(db[:len(db)/2]); !errors.Is(err, ErrInvalid) {
+		t.Errorf("truncated: err = %v", err)
+	}
+	// Metadata intact, but the search tree it describes is missing.
+	if _, err := FromBytes(db[len(db)-300:]); !errors.Is(err, ErrInvalid) {
+		t.Errorf("missing tree: err = %v", err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(path, buildDB(t, testEntries, testOrder...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := r.Lookup(netip.MustParseAddr("8.8.8.8")); got == nil {
+		t.Error("Lookup(8.8.8.8) = nil")
+	}
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.mmdb")); !os.IsNotExist(err) {
+		t.Errorf("missing file: err = %v", err)
+	}
+}
+
+// The databases in testdata are MaxMind's reader test data
+// (https://github.com/maxmind/MaxMind-DB, test-data), written by MaxMind's
+// own writer, so they check the reader against the specification
+// independently of Builder.
+
+func openTestData(t *testing.T, name string) *Reader {
+	t.Helper()
+	r, err := Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("Open(%s): %v", name, err)
+	}
+	return r
+}
+
+func TestMaxMindTestData_SearchTree(t *testing.T) {
+	for _, name := range []string{
+		"MaxMind-DB-test-ipv4-24.mmdb", "MaxMind-DB-test-ipv4-28.mmdb", "MaxMind-DB-test-ipv4-32.mmdb",
+		"MaxMind-DB-test-ipv6-24.mmdb", "MaxMind-DB-test-ipv6-28.mmdb", "MaxMind-DB-test-ipv6-32.mmdb",
+		"MaxMind-DB-test-mixed-24.mmdb",
+	} {
+		r := openTestData(t, name)
+		md := r.Metadata
+		if md.DatabaseType != "Test" || md.MajorVersion != 2 || md.Description["zh"] != "Test Database Chinese" || !reflect.DeepEqual(md.Languages, []string{"en", "zh"}) {
+			t.Errorf("%s: metadata = %+v", name, md)
+		}
+		var found map[string]string
+		switch {
+		case md.IPVersion == 4:
+			found = map[string]string{
+				"1.1.1.1": "1.1.1.1", "1.1.1.2": "1.1.1.2", "1.1.1.3": "1.1.1.2", "1.1.1.7": "1.1.1.4",
+				"1.1.1.15": "1.1.1.8", "1.1.1.31": "1.1.1.16", "1.1.1.32": "1.1.1.32",
+				"1.1.1.33": "", "255.254.253.123": "",
+			}
+		case name == "MaxMind-DB-test-mixed-24.mmdb":
+			// IPv4 data in an IPv6 tree, reached through ::/96 and the
+			// IPv4-mapped ::ffff:0:0/96.
+			found = map[string]string{
+				"1.1.1.1": "::1.1.1.1", "1.1.1.3": "::1.1.1.2", "::ffff:1.1.1.3": "::1.1.1.2",
+				"::2:0:41": "::2:0:40", "1.1.1.33": "",
+			}
+		default:
+			found = map[string]string{
+				"::1:ffff:ffff": "::1:ffff:ffff", "::2:0:1": "::2:0:0", "::2:0:39": "::2:0:0",
+				"::2:0:49": "::2:0:40", "::2:0:57": "::2:0:50", "::2:0:59": "::2:0:58",
+				"1.1.1.33": "", "89fa::": "",
+			}
+		}
+		for ip, want := range found {
+			got, err := r.Lookup(netip.MustParseAddr(ip))
+			if err != nil {
+				t.Errorf("%s: Lookup(%s): %v", name, ip, err)
+				continue
+			}
+			if want == "" {
+				if got != nil {
+					t.Errorf("%s: Lookup(%s) = %v, want nothing", name, ip, got)
+				}
+				continue
+			}
+			if !reflect.DeepEqual(got, map[string]any{"ip": want}) {
+				t.Errorf("%s: Lookup(%s) = %v, want ip %s", name, ip, got, want)
+			}
+		}
+	}
+}
+
+func TestMaxMindTestData_Decoder(t *testing.T) {
+	r := openTestData(t, "MaxMind-DB-test-decoder.mmdb")
+	got, err := r.Lookup(netip.MustParseAddr("1.1.1.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u128, _ := new(big.Int).SetString("1329227995784915872903807060280344576", 10)
+	want := map[string]any{
+		"array":   []any{uint64(1), uint64(2), uint64(3)},
+		"boolean": true,
+		"bytes":   []byte{0x00, 0x00, 0x00, 0x2a},
+		"double":  42.123456,
+		"float":   float32(1.1),
+		"int32":   int32(-268435456),
+		"map": map[string]any{
+			"mapX": map[string]any{"arrayX": []any{uint64(7), uint64(8), uint64(9)}, "utf8_stringX": "hello"},
+		},
+		"uint128":     u128,
+		"uint16":      uint64(100),
+		"uint32":      uint64(268435456),
+		"uint64":      uint64(1152921504606846976),
+		"utf8_string": "unicode! ☯ - ♫",
+	}
+	m, ok := got.(map[string]any)
+	if !ok {
+		t.Fatalf("Lookup(1.1.1.0) = %T", got)
+	}
+	for k, w := range want {
+		if u, ok := w.(*big.Int); ok {
+			if g, ok := m[k].(*big.Int); !ok || g.Cmp(u) != 0 {
+				t.Errorf("%s = %v, want %v", k, m[k], u)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(m[k], w) {
+			t.Errorf("%s = %#v, want %#v", k, m[k], w)
+		}
+	}
+	if len(m) != len(want) {
+		t.Errorf("record has %d keys, want %d: %v", len(m), len(want), m)
+	}
+}
+
+func TestMaxMindTestData_GeoIP(t *testing.T) {
+	country := openTestData(t, "GeoIP2-Country-Test.mmdb")
+	if country.Metadata.DatabaseType != "GeoIP2-Country" {
+		t.Errorf("country database type = %q", country.Metadata.DatabaseType)
+	}
+	for ip, want := range map[string]string{"81.2.69.160": "GB", "89.160.20.128": "SE", "2001:218::1": "JP", "216.160.83.56": "US"} {
+		got, err := country.Lookup(netip.MustParseAddr(ip))
+		if err != nil {
+			t.Fatalf("Lookup(%s): %v", ip, err)
+		}
+		iso, _ := got.(map[string]any)["country"].(map[string]any)["iso_code"].(string)
+		if iso != want {
+			t.Errorf("country of %s = %q, want %s", ip, iso, want)
+		}
+	}
+
+	asn := openTestData(t, "GeoLite2-ASN-Test.mmdb")
+	got, err := asn.Lookup(netip.MustParseAddr("1.128.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"autonomous_system_number": uint64(1221), "autonomous_system_organization": "Telstra Pty Ltd"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Lookup(1.128.0.1) = %v, want %v", got, want)
+	}
+}
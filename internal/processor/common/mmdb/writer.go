@@ -0,0 +1,221 @@
+package mmdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/netip"
+	"sort"
+	"time"
+)
+
+// Builder assembles a small IPv6 MaxMind database (IPv4 networks are stored
+// under ::/96, as in MaxMind's own databases). It is meant for tests and for
+// sites that publish their own address-to-site maps, not for databases the
+// size of GeoIP2: the whole tree is kept in memory and records are not
+// deduplicated.
+type Builder struct {
+	// DatabaseType and Description are written to the metadata.
+	DatabaseType string
+	Description  string
+
+	nodes [][2]builderRecord
+	data  []any
+}
+
+// builderRecord is a search tree record while building: a child node, a data
+// value or (the zero value) nothing.
+type builderRecord struct {
+	node int // child node index + 1
+	data int // data value index + 1
+}
+
+// Insert maps every address in prefix to value. value may be built from
+// map[string]any, []any, string, bool, float64, float32, int32, uint16,
+// uint32 and uint64. A later Insert of a more specific prefix overrides part
+// of an earlier one; inserting a wider prefix replaces everything under it.
+func (b *Builder) Insert(prefix netip.Prefix, value any) error {
+	if err := checkValue(value); err != nil {
+		return fmt.Errorf("%s: %w", prefix, err)
+	}
+	prefix = prefix.Masked()
+	addr, bits := prefix.Addr(), prefix.Bits()
+	ip := addr.As16()
+	if addr.Is4() {
+		// As16 gives ::ffff:a.b.c.d; IPv4 networks live under ::/96.
+		ip[10], ip[11] = 0, 0
+		bits += 96
+	}
+	if len(b.nodes) == 0 {
+		b.nodes = append(b.nodes, [2]builderRecord{})
+	}
+	b.data = append(b.data, value)
+	leaf := builderRecord{data: len(b.data)}
+	node := 0
+	for i := 0; i < bits; i++ {
+		bit := int(ip[i/8]>>(7-uint(i%8))) & 1
+		if i == bits-1 {
+			b.nodes[node][bit] = leaf
+			break
+		}
+		rec := b.nodes[node][bit]
+		if rec.node == 0 {
+			// Push an existing value (or nothing) down both branches of a
+			// new node so the rest of the old network keeps it.
+			b.nodes = append(b.nodes, [2]builderRecord{rec, rec})
+			rec = builderRecord{node: len(b.nodes)}
+			b.nodes[node][bit] = rec
+		}
+		node = rec.node - 1
+	}
+	return nil
+}
+
+// WriteTo writes the database with 32-bit records.
+func (b *Builder) WriteTo(w io.Writer) (int64, error) {
+	if len(b.nodes) == 0 {
+		b.nodes = append(b.nodes, [2]builderRecord{})
+	}
+	var data []byte
+	offsets := make([]int, len(b.data))
+	for i, v := range b.data {
+		offsets[i] = len(data)
+		data = appendValue(data, v)
+	}
+	count := len(b.nodes)
+	out := make([]byte, 0, count*8+dataSectionSeparator+len(data)+256)
+	for _, n := range b.nodes {
+		for _, rec := range n {
+			v := count // empty
+			switch {
+			case rec.node > 0:
+				v = rec.node - 1
+			case rec.data > 0:
+				v = count + dataSectionSeparator + offsets[rec.data-1]
+			}
+			out = binary.BigEndian.AppendUint32(out, uint32(v))
+		}
+	}
+	out = append(out, make([]byte, dataSectionSeparator)...)
+	out = append(out, data...)
+	out = append(out, metadataMarker...)
+	out = appendValue(out, map[string]any{
+		"node_count":                  uint32(count),
+		"record_size":                 uint16(32),
+		"ip_version":                  uint16(6),
+		"database_type":               b.DatabaseType,
+		"languages":                   []any{"en"},
+		"description":                 map[string]any{"en": b.Description},
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(time.Now().Unix()),
+	})
+	n, err := w.Write(out)
+	return int64(n), err
+}
+
+func checkValue(v any) error {
+	switch v := v.(type) {
+	case string, bool, float64, float32, int32, uint16, uint32, uint64:
+		return nil
+	case map[string]any:
+		for _, e := range v {
+			if err := checkValue(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []any:
+		for _, e := range v {
+			if err := checkValue(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported value type %T", v)
+}
+
+// appendValue appends the data section encoding of a value accepted by
+// checkValue.
+func appendValue(b []byte, v any) []byte {
+	switch v := v.(type) {
+	case string:
+		return append(appendControl(b, typeString, len(v)), v...)
+	case bool:
+		n := 0
+		if v {
+			n = 1
+		}
+		return appendControl(b, typeBool, n)
+	case float64:
+		return binary.BigEndian.AppendUint64(appendControl(b, typeDouble, 8), math.Float64bits(v))
+	case float32:
+		return binary.BigEndian.AppendUint32(appendControl(b, typeFloat, 4), math.Float32bits(v))
+	case int32:
+		return appendUint(b, typeInt32, uint64(uint32(v)))
+	case uint16:
+		return appendUint(b, typeUint16, uint64(v))
+	case uint32:
+		return appendUint(b, typeUint32, uint64(v))
+	case uint64:
+		return appendUint(b, typeUint64, v)
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b = appendControl(b, typeMap, len(v))
+		for _, k := range keys {
+			b = appendValue(appendValue(b, k), v[k])
+		}
+		return b
+	case []any:
+		b = appendControl(b, typeArray, len(v))
+		for _, e := range v {
+			b = appendValue(b, e)
+		}
+		return b
+	}
+	panic(fmt.Sprintf("mmdb: unsupported value type %T", v))
+}
+
+// appendUint appends an integer in the fewest big-endian bytes.
+func appendUint(b []byte, typ int, n uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], n)
+	i := 0
+	for i < 8 && buf[i] == 0 {
+		i++
+	}
+	return append(appendControl(b, typ, 8-i), buf[i:]...)
+}
+
+func appendControl(b []byte, typ, size int) []byte {
+	ctrl := byte(typ << 5)
+	if typ > typeMap {
+		ctrl = 0
+	}
+	var ext []byte
+	switch {
+	case size < 29:
+		ctrl |= byte(size)
+	case size < 285:
+		ctrl |= 29
+		ext = []byte{byte(size - 29)}
+	case size < 65821:
+		ctrl |= 30
+		ext = binary.BigEndian.AppendUint16(nil, uint16(size-285))
+	default:
+		ctrl |= 31
+		n := size - 65821
+		ext = []byte{byte(n >> 16), byte(n >> 8), byte(n)}
+	}
+	b = append(b, ctrl)
+	if typ > typeMap {
+		b = append(b, byte(typ-7))
+	}
+	return append(b, ext...)
+}
@@ -0,0 +1,72 @@
+package types
+
+import (
+	"log"
+	"net"
+	"strings"
+)
+
+// parseMonitoredSubnets converts monitored_subnets CIDRs to networks, skipping
+// (with a warning) any that do not parse. Config validation is the
+// authoritative gate.
+func parseMonitoredSubnets(cidrs []string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, c := range cidrs {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			log.Printf("[processor] Warning: skipping invalid monitored subnet %q: %v", c, err)
+			continue
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// monitoredFilter is the rowFilter for the monitored_subnets allow-list. It
+// runs before every other filter and drops rows none of whose endpoint
+// addresses (the single-IP columns in addressFields; set-valued columns such as
+// dns answers are not endpoints) fall inside a monitored range. Rows with no
+// endpoint address set at all (e.g. a DHCP DISCOVER before a lease exists)
+// cannot be attributed to transit traffic and are kept.
+type monitoredFilter struct {
+	nets []*net.IPNet
+}
+
+func (f monitoredFilter) bind(h *logHeader, stats *FilterStats) func([]string) rowAction {
+	var addrIdx []int
+	for i, name := range h.fields {
+		if addressFields[name] {
+			addrIdx = append(addrIdx, i)
+		}
+	}
+	if len(addrIdx) == 0 {
+		return nil
+	}
+	return func(cols []string) rowAction {
+		seen := false
+		for _, idx := range addrIdx {
+			if idx >= len(cols) {
+				continue
+			}
+			ip := net.ParseIP(cols[idx])
+			if ip == nil {
+				continue
+			}
+			seen = true
+			for _, n := range f.nets {
+				if n.Contains(ip) {
+					return rowPassed
+				}
+			}
+		}
+		if !seen {
+			return rowPassed
+		}
+		stats.Unmonitored++
+		return rowDropped
+	}
+}
@@ -0,0 +1,71 @@
+package types
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFilterLogs_MonitoredSubnets(t *testing.T) {
+	dir := t.TempDir()
+	p := writeLog(t, dir, "conn.log", zeekHeader("conn", "uid", "id.orig_h", "id.resp_h"),
+		row("C1", "10.1.0.5", "8.8.8.8"),     // orig monitored
+		row("C2", "203.0.113.1", "10.1.2.3"), // resp monitored
+		row("C3", "203.0.113.1", "198.51.100.7"),
+		row("C4", "10.1.9.9", "10.2.0.1"),
+	)
+	report, err := FilterLogs(dir, []string{"conn.log"}, FilterOptions{MonitoredSubnets: []string{"10.1.0.0/16"}})
+	if err != nil {
+		t.Fatalf("FilterLogs: %v", err)
+	}
+	rows := readDataRows(t, p)
+	if got := strings.Join(rows, "|"); strings.Contains(got, "C3") || len(rows) != 3 {
+		t.Errorf("rows = %q, want C1, C2, C4", rows)
+	}
+	if got := report["conn.log"]; !reflect.DeepEqual(got, FilterStats{Dropped: 1, Passed: 3, Unmonitored: 1}) {
+		t.Errorf("stats = %+v", got)
+	}
+}
+
+func TestFilterLogs_MonitoredThenExcluded(t *testing.T) {
+	dir := t.TempDir()
+	p := writeLog(t, dir, "conn.log", zeekHeader("conn", "uid", "id.orig_h", "id.resp_h"),
+		row("C1", "10.1.0.5", "8.8.8.8"),     // monitored, kept
+		row("C2", "10.9.0.5", "8.8.8.8"),     // monitored but excluded (drop)
+		row("C3", "10.1.0.5", "10.8.0.1"),    // monitored, other end masked
+		row("C4", "198.51.100.1", "8.8.4.4"), // unmonitored
+	)
+	opts := FilterOptions{
+		MonitoredSubnets: []string{"10.0.0.0/8"},
+		ExcludedSubnets:  []string{"10.9.0.0/16", "10.8.0.0/16=mask"},
+	}
+	report, err := FilterLogs(dir, []string{"conn.log"}, opts)
+	if err != nil {
+		t.Fatalf("FilterLogs: %v", err)
+	}
+	want := []string{
+		row("C1", "10.1.0.5", "8.8.8.8"),
+		row("C3", "10.1.0.5", "0.0.0.0"),
+	}
+	if got := readDataRows(t, p); !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+	if got := report["conn.log"]; !reflect.DeepEqual(got, FilterStats{Dropped: 2, Masked: 1, Passed: 1, Unmonitored: 1}) {
+		t.Errorf("stats = %+v", got)
+	}
+}
+
+func TestFilterLogs_MonitoredKeepsAddresslessRows(t *testing.T) {
+	dir := t.TempDir()
+	p := writeLog(t, dir, "dhcp.log", zeekHeader("dhcp", "uids", "client_addr", "server_addr", "mac"),
+		row("D1", "-", "-", "aa:bb:cc:dd:ee:ff"),
+		row("D2", "172.16.0.9", "172.16.0.1", "aa:bb:cc:dd:ee:00"),
+	)
+	if _, err := FilterLogs(dir, []string{"dhcp.log"}, FilterOptions{MonitoredSubnets: []string{"10.0.0.0/8"}}); err != nil {
+		t.Fatalf("FilterLogs: %v", err)
+	}
+	rows := readDataRows(t, p)
+	if len(rows) != 1 || !strings.HasPrefix(rows[0], "D1\t") {
+		t.Errorf("rows = %q, want only D1", rows)
+	}
+}
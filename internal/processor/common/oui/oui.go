@@ -0,0 +1,241 @@
+// Package oui resolves MAC addresses to the vendor the IEEE assigned their
+// prefix to, and classifies addresses the registry cannot place: locally
+// administered (including randomized "private" addresses used by phones and
+// laptops) and multicast.
+//
+// The built-in registry is gopacket's copy of the IEEE MA-L (24-bit OUI)
+// assignments, so lookups work out of the box. It has no MA-M or MA-S
+// blocks and none assigned since gopacket last regenerated it; the IEEE's
+// current oui.csv, mam.csv and oas.csv (or the older oui.txt) are loaded
+// with Parse and layered over it with Fill.
+package oui
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/gopacket/macs"
+)
+
+// Assignment block sizes, in prefix bits: MA-L (the classic OUI), MA-M and
+// MA-S.
+var blockBits = []int{36, 28, 24}
+
+// Registry maps MAC address prefixes to organization names.
+type Registry struct {
+	// prefixes holds one map per block size, keyed by the prefix value.
+	prefixes map[int]map[uint64]string
+}
+
+// Len returns the number of assignments in the registry.
+func (r *Registry) Len() int {
+	n := 0
+	for _, m := range r.prefixes {
+		n += len(m)
+	}
+	return n
+}
+
+func (r *Registry) add(hexPrefix, org string) error {
+	bits := len(hexPrefix) * 4
+	if bits != 24 && bits != 28 && bits != 36 {
+		return fmt.Errorf("assignment %q is not a 24, 28 or 36-bit prefix", hexPrefix)
+	}
+	v, err := strconv.ParseUint(hexPrefix, 16, 64)
+	if err != nil {
+		return fmt.Errorf("assignment %q is not hexadecimal", hexPrefix)
+	}
+	org = strings.TrimSpace(org)
+	if org == "" {
+		return fmt.Errorf("assignment %s has no organization", hexPrefix)
+	}
+	r.set(bits, v, org)
+	return nil
+}
+
+func (r *Registry) set(bits int, prefix uint64, org string) {
+	if r.prefixes == nil {
+		r.prefixes = make(map[int]map[uint64]string)
+	}
+	if r.prefixes[bits] == nil {
+		r.prefixes[bits] = make(map[uint64]string)
+	}
+	r.prefixes[bits][prefix] = org
+}
+
+// Fill adds the assignments of from that r does not have, so a registry
+// loaded from a file can fall back to the embedded table.
+func (r *Registry) Fill(from *Registry) {
+	for bits, m := range from.prefixes {
+		for v, org := range m {
+			if _, ok := r.prefixes[bits][v]; !ok {
+				r.set(bits, v, org)
+			}
+		}
+	}
+}
+
+// Vendor returns the organization assigned the longest registered prefix of
+// mac. Locally administered and multicast addresses are never assigned, so
+// they are not looked up; see Classify.
+func (r *Registry) Vendor(mac net.HardwareAddr) (string, bool) {
+	if len(mac) < 6 || Classify(mac) != Universal {
+		return "", false
+	}
+	var v uint64
+	for _, b := range mac[:6] {
+		v = v<<8 | uint64(b)
+	}
+	for _, bits := range blockBits {
+		if org, ok := r.prefixes[bits][v>>(48-bits)]; ok {
+			return org, true
+		}
+	}
+	return "", false
+}
+
+var (
+	embeddedOnce sync.Once
+	embedded     *Registry
+)
+
+// Embedded returns the built-in MA-L registry. Callers must not modify it;
+// Fill a registry of their own from it instead.
+func Embedded() *Registry {
+	embeddedOnce.Do(func() {
+		embedded = &Registry{}
+		for prefix, org := range macs.ValidMACPrefixMap {
+			embedded.set(24, uint64(prefix[0])<<16|uint64(prefix[1])<<8|uint64(prefix[2]), org)
+		}
+	})
+	return embedded
+}
+
+// ouiTxtLine matches an assignment in the IEEE's oui.txt, e.g.
+// "00-22-72   (hex)		American Micro-Fuel Device Corp.".
+var ouiTxtLine = regexp.MustCompile(`^([0-9A-Fa-f]{2})-([0-9A-Fa-f]{2})-([0-9A-Fa-f]{2})\s+\(hex\)\s+(.+)$`)
+
+// Parse reads an IEEE registry file: the CSV format (Registry, Assignment,
+// Organization Name, Organization Address) of oui.csv, mam.csv and oas.csv,
+// or the text format of oui.txt.
+func Parse(r io.Reader) (*Registry, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(16)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	reg := &Registry{}
+	if strings.HasPrefix(strings.TrimPrefix(string(head), "\ufeff"), "Registry") {
+		err = parseCSV(br, reg)
+	} else {
+		err = parseText(br, reg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if reg.Len() == 0 {
+		return nil, errors.New("no OUI assignments found")
+	}
+	return reg, nil
+}
+
+func parseCSV(r io.Reader, reg *Registry) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	line := 0
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line++
+		if line == 1 || len(rec) < 3 {
+			continue // header
+		}
+		if err := reg.add(strings.TrimSpace(rec[1]), rec[2]); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+}
+
+func parseText(r io.Reader, reg *Registry) error {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if m := ouiTxtLine.FindStringSubmatch(strings.TrimSpace(s.Text())); m != nil {
+			if err := reg.add(m[1]+m[2]+m[3], m[4]); err != nil {
+				return err
+			}
+		}
+	}
+	return s.Err()
+}
+
+// Kind classifies a MAC address by its first octet and, for locally
+// administered addresses, the conventions that identify assigned ones.
+type Kind int
+
+const (
+	// Universal is a globally unique, IEEE-assigned unicast address.
+	Universal Kind = iota
+	// LocallyAdministered is a locally administered unicast address that
+	// software assigns under a known convention, such as a virtual NIC.
+	LocallyAdministered
+	// Randomized is any other locally administered unicast address: in
+	// practice the per-network private addresses of phones and laptops.
+	Randomized
+	// Multicast is a group (multicast or broadcast) address.
+	Multicast
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Universal:
+		return "universal"
+	case LocallyAdministered:
+		return "locally administered"
+	case Randomized:
+		return "randomized"
+	case Multicast:
+		return "multicast"
+	}
+	return "unknown"
+}
+
+// localConventions are locally administered prefixes that software assigns
+// deterministically, so an address in them is not a privacy address.
+var localConventions = [][]byte{
+	{0x02, 0x42},       // Docker bridge networks
+	{0x52, 0x54, 0x00}, // QEMU/KVM and libvirt
+	{0x0a, 0x00, 0x27}, // VirtualBox host-only adapters
+}
+
+// Classify returns the kind of mac.
+func Classify(mac net.HardwareAddr) Kind {
+	if len(mac) == 0 {
+		return Universal
+	}
+	switch {
+	case mac[0]&0x01 != 0:
+		return Multicast
+	case mac[0]&0x02 == 0:
+		return Universal
+	}
+	for _, p := range localConventions {
+		if len(mac) >= len(p) && string(mac[:len(p)]) == string(p) {
+			return LocallyAdministered
+		}
+	}
+	return Randomized
+}
@@ -0,0 +1,124 @@
+package oui
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func mac(t *testing.T, s string) net.HardwareAddr {
+	t.Helper()
+	m, err := net.ParseMAC(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestEmbedded(t *testing.T) {
+	// The IEEE has assigned tens of thousands of MA-L blocks alone; a table
+	// much smaller than that is a stand-in, not the registry.
+	r := Embedded()
+	if r.Len() < 25000 {
+		t.Fatalf("built-in table has %d assignments, want the full registry", r.Len())
+	}
+	for addr, want := range map[string]string{
+		"00:50:56:aa:bb:cc": "VMware, Inc.",
+		"b8:27:eb:01:02:03": "Raspberry Pi Foundation",
+		"00:15:5d:00:00:01": "Microsoft Corporation",
+	} {
+		if got, ok := r.Vendor(mac(t, addr)); !ok || got != want {
+			t.Errorf("Vendor(%s) = %q, %v; want %q", addr, got, ok, want)
+		}
+	}
+}
+
+const registryCSV = "\ufeffRegistry,Assignment,Organization Name,Organization Address\n" +
+	"MA-L,001122,\"Example, Inc.\",1 Main St\n" +
+	"MA-M,0011223,Example Medium Block,\n" +
+	"MA-S,001122334,Example Small Block,\n"
+
+func TestParse_CSVLongestMatch(t *testing.T) {
+	r, err := Parse(strings.NewReader(registryCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Len() != 3 {
+		t.Errorf("Len = %d, want 3", r.Len())
+	}
+	for addr, want := range map[string]string{
+		"00:11:22:ff:00:00": "Example, Inc.",
+		"00:11:22:30:00:00": "Example Medium Block",
+		"00:11:22:33:40:00": "Example Small Block",
+	} {
+		if got, _ := r.Vendor(mac(t, addr)); got != want {
+			t.Errorf("Vendor(%s) = %q, want %q", addr, got, want)
+		}
+	}
+	if _, ok := r.Vendor(mac(t, "00:11:23:00:00:00")); ok {
+		t.Error("unregistered prefix should not resolve")
+	}
+}
+
+func TestParse_Text(t *testing.T) {
+	text := "OUI/MA-L\t\t\t\t\t\t\tOrganization\n" +
+		"company_id\t\t\t\t\t\t\tOrganization\n\n" +
+		"00-22-72   (hex)\t\tAmerican Micro-Fuel Device Corp.\n" +
+		"002272     (base 16)\t\tAmerican Micro-Fuel Device Corp.\n" +
+		"\t\t\t\t2181 Buchanan Loop\n"
+	r, err := Parse(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := r.Vendor(mac(t, "00:22:72:01:02:03")); got != "American Micro-Fuel Device Corp." {
+		t.Errorf("Vendor = %q", got)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for name, in := range map[string]string{
+		"empty":       "",
+		"no entries":  "just some text\n",
+		"bad prefix":  "Registry,Assignment,Organization Name,Organization Address\nMA-L,00112,Short,\n",
+		"not hex":     "Registry,Assignment,Organization Name,Organization Address\nMA-L,00112G,Bad,\n",
+		"missing org": "Registry,Assignment,Organization Name,Organization Address\nMA-L,001122, ,\n",
+	} {
+		if _, err := Parse(strings.NewReader(in)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestFill(t *testing.T) {
+	r, err := Parse(strings.NewReader("Registry,Assignment,Organization Name,Organization Address\nMA-L,005056,Renamed Vendor,\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Fill(Embedded())
+	if got, _ := r.Vendor(mac(t, "00:50:56:00:00:01")); got != "Renamed Vendor" {
+		t.Errorf("file entry should win, got %q", got)
+	}
+	if got, _ := r.Vendor(mac(t, "b8:27:eb:00:00:01")); got != "Raspberry Pi Foundation" {
+		t.Errorf("built-in entry should fill the gap, got %q", got)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	for addr, want := range map[string]Kind{
+		"00:50:56:aa:bb:cc": Universal,
+		"ff:ff:ff:ff:ff:ff": Multicast,
+		"01:00:5e:00:00:fb": Multicast,
+		"33:33:00:00:00:01": Multicast,
+		"da:a1:19:12:34:56": Randomized,
+		"3e:22:fb:01:02:03": Randomized,
+		"02:42:ac:11:00:02": LocallyAdministered,
+		"52:54:00:12:34:56": LocallyAdministered,
+	} {
+		if got := Classify(mac(t, addr)); got != want {
+			t.Errorf("Classify(%s) = %v, want %v", addr, got, want)
+		}
+	}
+	if _, ok := Embedded().Vendor(mac(t, "da:a1:19:12:34:56")); ok {
+		t.Error("randomized addresses must not resolve to a vendor")
+	}
+}
@@ -0,0 +1,121 @@
+package types
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"EnigmaNetz/Enigma-Go-Sensor/internal/logenc"
+)
+
+// EncodeZeekLogs converts each of the given Zeek TSV logs in runDir to the
+// output encoding (see the logenc package) and returns a map of original log
+// names to the encoded file paths. Encoded files replace their .log source in
+// runDir with the encoding's extension (conn.log -> conn.csv), so retained
+// copies say what they contain. logenc.TSV (or "") leaves the logs untouched.
+// Missing logs are skipped, and any failure to encode a present log is
+// returned as an error.
+//
+// The second result compares each encoded log's size with its TSV source so
+// operators can judge what an encoding saves; it is nil for TSV. Logs are
+// streamed row by row; limit is the worker memory budget in bytes (0 =
+// DefaultMemoryLimit), which bounds the line length and any rows an encoder
+// buffers (Parquet row groups).
+func EncodeZeekLogs(runDir string, logFiles []string, encoding string, limit int64) (map[string]string, map[string]EncodedSize, error) {
+	if encoding == "" {
+		encoding = logenc.TSV
+	}
+	enc, ok := logenc.Lookup(encoding)
+	if !ok && encoding != logenc.TSV {
+		return nil, nil, fmt.Errorf("unknown output encoding %q (supported: %s)", encoding, strings.Join(logenc.Names(), ", "))
+	}
+	if limit <= 0 {
+		limit = DefaultMemoryLimit
+	}
+	if enc != nil {
+		enc = logenc.WithMemoryLimit(enc, limit/2)
+	}
+
+	paths := make(map[string]string)
+	var sizes map[string]EncodedSize
+	var totalTSV, totalEncoded int64
+	for _, logName := range logFiles {
+		logPath := filepath.Join(runDir, logName)
+		fi, err := os.Stat(logPath)
+		if err != nil {
+			continue
+		}
+		if enc == nil {
+			paths[logName] = logPath
+			continue
+		}
+		outPath := filepath.Join(runDir, strings.TrimSuffix(logName, filepath.Ext(logName))+enc.Ext())
+		if err := encodeLogFile(logPath, outPath, enc, limit); err != nil {
+			return nil, nil, fmt.Errorf("failed to encode %s as %s: %w", logName, encoding, err)
+		}
+		paths[logName] = outPath
+		size := EncodedSize{TSVBytes: fi.Size()}
+		if out, err := os.Stat(outPath); err == nil {
+			size.EncodedBytes = out.Size()
+		}
+		if sizes == nil {
+			sizes = make(map[string]EncodedSize)
+		}
+		sizes[logName] = size
+		totalTSV += size.TSVBytes
+		totalEncoded += size.EncodedBytes
+	}
+	if enc != nil {
+		log.Printf("[processor] Encoded %d Zeek logs as %s (%d bytes of TSV -> %d bytes)", len(paths), encoding, totalTSV, totalEncoded)
+	}
+	return paths, sizes, nil
+}
+
+// EncodedSize compares a log's size as Zeek wrote it with its encoded size.
+type EncodedSize struct {
+	TSVBytes     int64 `json:"tsv_bytes"`
+	EncodedBytes int64 `json:"encoded_bytes"`
+}
+
+// encodeLogFile streams logPath to outPath with enc, via a temporary file so a
+// failed encode never leaves a partial output behind, then removes the source.
+func encodeLogFile(logPath, outPath string, enc logenc.Encoder, limit int64) error {
+	in, err := os.Open(logPath)
+	if err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+	defer in.Close()
+	lr, err := newLogReader(in, maxLineBytes(limit))
+	if err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+	h := lr.header
+	if h.path == "" {
+		h.path = strings.TrimSuffix(filepath.Base(logPath), ".log")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(outPath), filepath.Base(outPath)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := enc.Encode(tmp, h.encoderHeader(), &logRows{lr: lr, sep: h.sep}); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), outPath); err != nil {
+		return fmt.Errorf("rename: %w", err)
+	}
+	in.Close()
+	return os.Remove(logPath)
+}
+
+// encoderHeader converts the parsed header to the encoder's schema type.
+func (h *logHeader) encoderHeader() logenc.Header {
+	return logenc.Header{Path: h.path, Fields: h.fields, Types: h.types, SetSep: h.setSep}
+}
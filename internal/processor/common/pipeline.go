@@ -0,0 +1,192 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"EnigmaNetz/Enigma-Go-Sensor/internal/logenc"
+)
+
+// ProcessLogs runs the stages that follow Zeek on the logs in runDir: the
+// Zeek health report, schema validation, fingerprint intel matching,
+// Community ID, window continuity, GeoIP and MAC vendor enrichment,
+// filtering, the asset inventory, beacon, DNS anomaly and encrypted DNS
+// detection, the traffic summary, and encoding. It is shared by ProcessPCAP
+// on every platform and by live Zeek mode, which feeds it each rotated log
+// set. metadata holds the caller's own upload metadata (e.g. pcap_path), to
+// which the run's is added; it may be nil. Only a validation, filtering or
+// encoding failure is an error; a validation failure is a *SchemaError,
+// after which the PCAP at pcap_path may have been moved to quarantine.
+func ProcessLogs(runDir string, opts ProcessOptions, metadata map[string]interface{}) (ProcessedData, error) {
+	health := ZeekHealthReport(runDir, opts)
+
+	// Logs Zeek left truncated, or with other columns than the sensor
+	// expects, are not uploaded; the run is quarantined instead.
+	if opts.ValidateSchemas {
+		if err := ValidateLogSchemas(runDir, opts.MemoryLimit); err != nil {
+			var schemaErr *SchemaError
+			if errors.As(err, &schemaErr) && opts.QuarantineDir != "" {
+				pcapPath, _ := metadata["pcap_path"].(string)
+				dir, qerr := QuarantineRun(runDir, pcapPath, opts.QuarantineDir, schemaErr, health)
+				if qerr != nil {
+					log.Printf("[processor] Warning: could not quarantine %s: %v", runDir, qerr)
+				}
+				schemaErr.Quarantine = dir
+			}
+			return ProcessedData{}, err
+		}
+	}
+
+	// Zeek's Intel framework has no JA3/JA4 indicator types, so fingerprint
+	// indicators are matched here and added to its intel.log.
+	intelHits, err := MatchIntelFingerprints(runDir, opts)
+	if err != nil {
+		log.Printf("[processor] Warning: intel fingerprint matching failed: %v", err)
+	}
+
+	// Community ID has to be computed from the real addresses, so it runs
+	// before filtering can mask them. Non-fatal: the logs are still valid.
+	if err := AddCommunityID(runDir, ZeekLogFiles, opts.CommunityIDSeed, opts.MemoryLimit); err != nil {
+		log.Printf("[processor] Warning: Community ID enrichment failed: %v", err)
+	}
+
+	// Continuity keys connections by their real addresses too. Non-fatal:
+	// the cut halves are just not linked.
+	truncated, err := AddWindowContinuity(runDir, opts)
+	if err != nil {
+		log.Printf("[processor] Warning: window continuity tagging failed: %v", err)
+	}
+
+	// GeoIP lookups also need the real addresses. Non-fatal: a missing or
+	// broken database just leaves the logs unenriched.
+	geoIPDatabases, err := EnrichGeoIP(runDir, ZeekLogFiles, opts.GeoIPPath, opts.MemoryLimit)
+	if err != nil {
+		log.Printf("[processor] Warning: GeoIP enrichment failed: %v", err)
+	}
+
+	if err := EnrichMACVendors(runDir, ZeekLogFiles, opts.OUIPaths, opts.MemoryLimit); err != nil {
+		log.Printf("[processor] Warning: MAC vendor enrichment failed: %v", err)
+	}
+
+	// Drop, mask or redact any flows/records in an excluded subnet or domain
+	// before the logs are renamed and uploaded. Fatal on failure: uploading
+	// unfiltered data would violate the "do not upload it" guarantee.
+	filterStats, err := FilterLogs(runDir, ZeekLogFiles, opts.FilterOptions())
+	if err != nil {
+		log.Printf("[processor] Exclusion filtering failed: %v", err)
+		return ProcessedData{}, fmt.Errorf("exclusion filtering failed: %w", err)
+	}
+
+	// The asset inventory only sees what survived filtering. Non-fatal: the
+	// logs are uploaded either way.
+	if err := UpdateAssetInventory(runDir, opts); err != nil {
+		log.Printf("[processor] Warning: asset inventory update failed: %v", err)
+	}
+	beacons, err := DetectBeacons(runDir, opts)
+	if err != nil {
+		log.Printf("[processor] Warning: beacon detection failed: %v", err)
+	}
+	dnsAnomalies, err := DetectDNSAnomalies(runDir, opts)
+	if err != nil {
+		log.Printf("[processor] Warning: DNS anomaly detection failed: %v", err)
+	}
+	encryptedDNS, err := DetectEncryptedDNS(runDir, opts)
+	if err != nil {
+		log.Printf("[processor] Warning: encrypted DNS detection failed: %v", err)
+	}
+	summaryRows, err := SummarizeTraffic(runDir, opts)
+	if err != nil {
+		log.Printf("[processor] Warning: traffic summary failed: %v", err)
+	}
+
+	encoding := opts.OutputEncoding
+	if encoding == "" {
+		encoding = logenc.TSV
+	}
+	paths, sizes, err := EncodeZeekLogs(runDir, OutputLogFiles(), encoding, opts.MemoryLimit)
+	if err != nil {
+		log.Printf("[processor] Failed to encode Zeek logs: %v", err)
+		return ProcessedData{}, err
+	}
+
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+	metadata["zeek_out_dir"] = runDir
+	metadata["timestamp"] = time.Now().UTC().Format("20060102T150405Z")
+	metadata["sampling_percentage"] = opts.SamplingPercentage
+	metadata["log_encoding"] = encoding
+	metadata["zeek_health"] = health
+	if len(opts.DisabledFeatures) > 0 {
+		disabled := make([]string, 0, len(opts.DisabledFeatures))
+		for feature := range opts.DisabledFeatures {
+			disabled = append(disabled, feature)
+		}
+		sort.Strings(disabled)
+		metadata["zeek_disabled_features"] = disabled
+	}
+	if len(opts.SubnetSampling) > 0 {
+		metadata["subnet_sampling"] = opts.SubnetSampling
+	}
+	if filterStats != nil {
+		metadata["log_filter"] = filterStats
+	}
+	if sizes != nil {
+		metadata["encoding_sizes"] = sizes
+	}
+	if len(geoIPDatabases) > 0 {
+		metadata["geoip_databases"] = geoIPDatabases
+	}
+	if beacons > 0 {
+		metadata["beacons"] = beacons
+	}
+	if dnsAnomalies > 0 {
+		metadata["dns_anomalies"] = dnsAnomalies
+	}
+	if encryptedDNS > 0 {
+		metadata["encrypted_dns"] = encryptedDNS
+	}
+	if truncated > 0 {
+		metadata["window_truncated_connections"] = truncated
+	}
+	if intelHits > 0 {
+		metadata["intel_fingerprint_hits"] = intelHits
+	}
+
+	// Uploading only the summary needs one: without it the full logs go.
+	summaryOnly := opts.Summary != nil && opts.Summary.Only && paths[SummaryLogFile] != ""
+	if summaryRows > 0 {
+		metadata["summary_rows"] = summaryRows
+		metadata["summary_only"] = summaryOnly
+	}
+	if opts.Summary != nil && opts.Summary.Only && !summaryOnly {
+		log.Printf("[processor] Warning: no traffic summary for %s; uploading the full logs", runDir)
+	}
+	log.Printf("[processor] Returning %s results: conn=%s, dns=%s, dhcp=%s, ja3_ja4=%s, ja4s=%s, summary=%s, metadata=%v", encoding, paths["conn.log"], paths["dns.log"], paths["dhcp.log"], paths["ja3_ja4.log"], paths["ja4s.log"], paths[SummaryLogFile], metadata)
+
+	result := ProcessedData{
+		ConnPath:         paths["conn.log"],
+		DNSPath:          paths["dns.log"],
+		DHCPPath:         paths["dhcp.log"],
+		JA3JA4Path:       paths["ja3_ja4.log"],
+		JA4SPath:         paths["ja4s.log"],
+		AssetsPath:       paths[AssetsLogFile],
+		DeviceEventsPath: paths[DeviceEventsLogFile],
+		BeaconsPath:      paths[BeaconsLogFile],
+		DNSAnomaliesPath: paths[DNSAnomaliesLogFile],
+		IntelPath:        paths[IntelLogFile],
+		EncryptedDNSPath: paths[EncryptedDNSLogFile],
+		SummaryPath:      paths[SummaryLogFile],
+		Encoding:         encoding,
+		Metadata:         metadata,
+	}
+	if summaryOnly {
+		// The full logs are still in runDir, encoded; they are just not
+		// uploaded.
+		result.ConnPath, result.DNSPath, result.DHCPPath, result.JA3JA4Path, result.JA4SPath = "", "", "", "", ""
+	}
+	return result, nil
+}
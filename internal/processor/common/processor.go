@@ -1,16 +1,15 @@
 package types
 
 import (
-	"fmt"
 	"log"
 	"os"
-	"path/filepath"
 
+	"EnigmaNetz/Enigma-Go-Sensor/internal/processor/common/beacon"
 	"EnigmaNetz/Enigma-Go-Sensor/internal/processor/common/zeekscripts"
 )
 
 // Processor defines the interface for platform-agnostic PCAP processing using Zeek.
-// Implementations should process the given PCAP file and return XLSX file paths for both con.log and dns.log.
+// Implementations should process the given PCAP file and return the encoded log paths (see EncodeZeekLogs).
 type Processor interface {
 	ProcessPCAP(pcapPath string, opts ProcessOptions) (ProcessedData, error)
 }
@@ -20,26 +19,141 @@ type Processor interface {
 type ProcessOptions struct {
 	// SamplingPercentage is the percentage of traffic to process (0-100).
 	SamplingPercentage float64
-	// ExcludedSubnets is the list of CIDRs whose flows/records must be dropped
-	// from the produced logs before upload. Empty = no filtering.
+	// SubnetSampling holds "CIDR=percentage" entries overriding
+	// SamplingPercentage for flows with an endpoint in that subnet.
+	SubnetSampling []string
+	// MonitoredSubnets is the allow-list of CIDRs in scope for this sensor;
+	// rows with no endpoint inside one of them are dropped before upload.
+	// Empty = everything is in scope.
+	MonitoredSubnets []string
+	// ExcludedSubnets is the list of "CIDR[=action]" entries whose flows/records
+	// must be dropped (or masked) in the produced logs before upload. Empty = no
+	// filtering.
 	ExcludedSubnets []string
+	// ExcludedDomains is the list of "pattern[=action]" entries whose DNS
+	// queries/answers and TLS server names must be dropped (or redacted) before
+	// upload. Empty = no filtering.
+	ExcludedDomains []string
+	// FilterRules is the list of record filter rules (rules package syntax);
+	// rows matching any rule are dropped before upload. Empty = no rules.
+	FilterRules []string
+	// OutputEncoding is the logenc encoding the logs are converted to before
+	// upload ("tsv", "csv", "ndjson", "xlsx", ...). Empty = tsv.
+	OutputEncoding string
+	// CommunityIDSeed is the Community ID v1 seed used for the community_id
+	// column; it must match the seed of the tools the logs are correlated
+	// with (0 is their default).
+	CommunityIDSeed uint16
+	// GeoIPPath is a MaxMind-format .mmdb file, or a directory of them, used
+	// to add country and ASN columns to conn.log and the TLS fingerprint
+	// logs. Empty = no GeoIP enrichment.
+	GeoIPPath string
+	// OUIPaths are local copies of the IEEE OUI registry files (oui.csv,
+	// mam.csv, oas.csv or oui.txt), or directories of them, used over the
+	// built-in MA-L registry for the mac_vendor columns. Empty = built-in
+	// registry only.
+	OUIPaths []string
+	// Assets is the persistent asset inventory this run's DHCP, DNS and conn
+	// observations are recorded in. nil = no inventory.
+	Assets AssetRecorder
+	// UploadAssets writes the assets that changed in this run to
+	// AssetsLogFile so they are uploaded with the Zeek logs.
+	UploadAssets bool
+	// DeviceEvents writes the new-device and device-change events the
+	// inventory raised in this run to DeviceEventsLogFile so they are
+	// uploaded with the Zeek logs.
+	DeviceEvents bool
+	// Beacons is the rolling connection history this run's conn.log is added
+	// to and scored against for beaconing; beaconing pairs are written to
+	// BeaconsLogFile. nil = no beacon detection.
+	Beacons *beacon.Tracker
+	// DNSAnomalies are the thresholds at which this run's dns.log is flagged
+	// for tunneling and DGA activity in DNSAnomaliesLogFile. nil = no DNS
+	// anomaly detection.
+	DNSAnomalies *DNSAnomalyThresholds
+	// EncryptedDNS writes this run's DNS over TLS, HTTPS and QUIC
+	// connections to EncryptedDNSLogFile (see DetectEncryptedDNS).
+	EncryptedDNS bool
+	// ResolversPath is a local resolver list (resolvers package CSV format)
+	// used over the embedded one to identify DoH resolvers. Empty =
+	// embedded list only.
+	ResolversPath string
+	// Summary aggregates this run's conn.log into SummaryLogFile (see
+	// SummarizeTraffic). nil = no summary.
+	Summary *SummaryOptions
+	// Continuity links the halves of connections cut by a window boundary
+	// in the continuity_id and window_truncated columns of conn.log.
+	// nil = no continuity columns.
+	Continuity *ContinuityTracker
+	// IntelDir is the directory of threat-intel feeds (CSV, STIX or Zeek
+	// intel files) this run's traffic is matched against; hits are written
+	// to IntelLogFile. The feeds are re-read when they change. "" = no intel
+	// matching.
+	IntelDir string
+	// DisabledFeatures are the features (Feature* names) whose scripts are
+	// left off the Zeek command line, because CheckZeek found the installed
+	// Zeek cannot parse them. nil = every feature runs.
+	DisabledFeatures map[string]bool
+	// ValidateSchemas checks the logs Zeek wrote against their schemas
+	// before processing them (see ValidateLogSchemas); a run that fails is
+	// not uploaded.
+	ValidateSchemas bool
+	// QuarantineDir is where a run failing validation is moved with its
+	// PCAP and the reason (see QuarantineRun). "" = failing runs are only
+	// reported.
+	QuarantineDir string
+	// Health are the limits beyond which a run's Zeek health report is
+	// logged as a warning.
+	Health HealthThresholds
+	// Shards is how many parts a PCAP of at least ShardMinBytes is split into
+	// to run one Zeek per part in parallel (see RunZeekSharded). 0 or 1 = one
+	// Zeek per PCAP.
+	Shards int
+	// ShardMinBytes is the smallest PCAP that is split into Shards.
+	ShardMinBytes int64
+	// MemoryLimit is the memory budget in bytes for this worker's log
+	// rewrites (filtering, enrichment, encoding), which stream the logs
+	// regardless of their size. 0 = DefaultMemoryLimit.
+	MemoryLimit int64
+}
+
+// FilterOptions returns the row filters FilterLogs should apply for this run.
+func (o ProcessOptions) FilterOptions() FilterOptions {
+	return FilterOptions{
+		MonitoredSubnets: o.MonitoredSubnets,
+		ExcludedSubnets:  o.ExcludedSubnets,
+		ExcludedDomains:  o.ExcludedDomains,
+		Rules:            o.FilterRules,
+		MemoryLimit:      o.MemoryLimit,
+	}
 }
 
 // ZeekLogFiles is the single source of truth for the Zeek logs the sensor
-// uploads. Both FilterExcludedSubnets and RenameZeekLogsToXLSX key off this
-// list so "what we filter" and "what we upload" can never drift apart — adding
-// a sixth uploaded log here automatically brings it under subnet filtering on
-// every platform.
-var ZeekLogFiles = []string{"conn.log", "dns.log", "dhcp.log", "ja3_ja4.log", "ja4s.log"}
+// uploads. Both FilterLogs and EncodeZeekLogs key off this list so "what
+// we filter" and "what we upload" can never drift apart — adding a sixth
+// uploaded log here automatically brings it under subnet and domain filtering
+// on every platform. IntelLogFile is only present when an intel directory is
+// configured and something matched.
+var ZeekLogFiles = []string{"conn.log", "dns.log", "dhcp.log", "ja3_ja4.log", "ja4s.log", IntelLogFile}
 
 // ProcessedData represents the output of PCAP processing.
+// Paths point at the encoded logs (see EncodeZeekLogs); Encoding names the
+// output encoding they are in.
 type ProcessedData struct {
-	ConnPath   string                 // XLSX file path for conn.xlsx
-	DNSPath    string                 // XLSX file path for dns.xlsx
-	DHCPPath   string                 // XLSX file path for dhcp.xlsx
-	JA3JA4Path string                 // XLSX file path for ja3_ja4.xlsx
-	JA4SPath   string                 // XLSX file path for ja4s.xlsx
-	Metadata   map[string]interface{} // Additional processing metadata
+	ConnPath         string                 // Encoded conn log path
+	DNSPath          string                 // Encoded dns log path
+	DHCPPath         string                 // Encoded dhcp log path
+	JA3JA4Path       string                 // Encoded ja3_ja4 log path
+	JA4SPath         string                 // Encoded ja4s log path
+	AssetsPath       string                 // Encoded assets log path; empty when no assets changed or uploads are off
+	DeviceEventsPath string                 // Encoded device_events log path; empty when there were no events or they are off
+	BeaconsPath      string                 // Encoded beacons log path; empty when nothing beaconed or detection is off
+	DNSAnomaliesPath string                 // Encoded dns_anomalies log path; empty when nothing was flagged or detection is off
+	IntelPath        string                 // Encoded intel log path; empty when nothing matched or no intel directory is set
+	EncryptedDNSPath string                 // Encoded encrypted_dns log path; empty when none was seen or detection is off
+	SummaryPath      string                 // Encoded summary log path; empty when summarization is off
+	Encoding         string                 // Output encoding of the paths above (logenc name)
+	Metadata         map[string]interface{} // Additional processing metadata
 }
 
 // FS abstracts file system operations for testability (matches Linux, used by Windows with os).
@@ -54,39 +168,22 @@ type OSFS struct{}
 func (OSFS) Stat(name string) (os.FileInfo, error) { return os.Stat(name) }
 func (OSFS) Rename(oldpath, newpath string) error  { return os.Rename(oldpath, newpath) }
 
-// RenameZeekLogsToXLSX renames Zeek log files to .xlsx and returns a map of original log names to new paths.
-// Returns error if any rename fails. Missing files are skipped.
-func RenameZeekLogsToXLSX(fs FS, runDir string, logFiles []string) (map[string]string, error) {
-	paths := make(map[string]string)
-	for _, logName := range logFiles {
-		logPath := filepath.Join(runDir, logName)
-		if _, err := fs.Stat(logPath); err == nil {
-			xlsxPath := filepath.Join(runDir, logName[:len(logName)-len(filepath.Ext(logName))]+".xlsx")
-			if err := fs.Rename(logPath, xlsxPath); err != nil {
-				return nil, fmt.Errorf("failed to rename %s to xlsx: %w", logName, err)
-			}
-			paths[logName] = xlsxPath
-		}
-	}
-	return paths, nil
-}
-
 // PrepareZeekArgsWithSampling prepares Zeek command arguments including sampling
-// configuration. Primarily used by Linux; Windows handles sampling via main.zeek.
-func PrepareZeekArgsWithSampling(runDir string, samplingPercentage float64, baseArgs []string) []string {
+// configuration. BuildZeekArgs adds the other scripts the sensor runs Zeek with.
+func PrepareZeekArgsWithSampling(runDir string, opts ProcessOptions, baseArgs []string) []string {
 	args := make([]string, len(baseArgs))
 	copy(args, baseArgs)
 
-	// Add sampling script if sampling percentage is less than 100. The embedded
-	// sampling.zeek is materialized into runDir and the Sampling::sampling_percentage
-	// arg is prepended before its path.
-	if samplingPercentage < 100 {
+	// Add sampling script if sampling is enabled (a global percentage below 100
+	// or per-subnet rates). The embedded sampling.zeek is materialized into
+	// runDir and its settings are appended after its path.
+	if opts.SamplingEnabled() {
 		if path, err := zeekscripts.Materialize(runDir, zeekscripts.Sampling); err != nil {
 			log.Printf("[processor] Warning: could not materialize sampling script (%v); processing all traffic", err)
 		} else {
-			args = append(args, fmt.Sprintf("Sampling::sampling_percentage=%.1f", samplingPercentage))
 			args = append(args, path)
-			log.Printf("[processor] Added sampling script at %.1f%% from %s", samplingPercentage, path)
+			args = AppendSamplingArgs(args, runDir, opts)
+			log.Printf("[processor] Added sampling script at %.1f%% from %s", opts.SamplingPercentage, path)
 		}
 	}
 
@@ -106,3 +203,60 @@ func AppendZeekScript(args []string, runDir, script string) ([]string, error) {
 	log.Printf("[processor] Added Zeek script %s from %s", script, path)
 	return append(args, path), nil
 }
+
+// zeekMACLogging is the Zeek policy script logging link-layer addresses in
+// conn.log. It ships with Zeek, so it is loaded by name.
+const zeekMACLogging = "policy/protocols/conn/mac-logging"
+
+// BuildZeekArgs returns the Zeek command line of one run: base (the packet
+// source and log directory options) followed by the sampling script and
+// settings, the DHCP fingerprint script, Zeek's mac-logging policy, the
+// JA3/JA4 fingerprint script, the diagnostics script, and the threat-intel
+// scripts, less opts.DisabledFeatures. Every script is
+// materialized into runDir, so concurrent runs never share a file and each
+// can sample differently. It is the one builder behind ProcessPCAP on every
+// platform and live Zeek mode; a script that cannot be written is left out
+// with a warning.
+func BuildZeekArgs(base []string, runDir string, opts ProcessOptions) []string {
+	args := PrepareZeekArgsWithSampling(runDir, opts, base)
+	off := opts.DisabledFeatures
+
+	// The DHCP fingerprint script puts param_req_list in dhcp.log.
+	var err error
+	if !off[FeatureDHCP] {
+		if args, err = AppendZeekScript(args, runDir, zeekscripts.DHCP); err != nil {
+			log.Printf("[processor] Warning: could not add DHCP fingerprint script: %v", err)
+		}
+	}
+
+	// Zeek's mac-logging policy adds orig_l2_addr and resp_l2_addr to
+	// conn.log, for EnrichMACVendors.
+	if !off[FeatureMACLogging] {
+		args = append(args, zeekMACLogging)
+	}
+
+	// The JA3/JA4 script produces ja3_ja4.log and ja4s.log. Without it the
+	// sensor uploads empty JA3/JA4 payloads and TLS device-role classification
+	// never runs. Warn loudly on failure: the upload path tolerates the
+	// missing logs, which would otherwise hide it entirely.
+	if !off[FeatureJA3JA4] {
+		if args, err = AppendZeekScript(args, runDir, zeekscripts.JA3JA4); err != nil {
+			log.Printf("[processor] WARNING: could not add JA3/JA4 fingerprint script: %v; ja3_ja4.log/ja4s.log will be empty and TLS device-role classification cannot run", err)
+		}
+	}
+
+	// The diagnostics script has Zeek measure capture loss and packets for
+	// the health report.
+	if !off[FeatureDiagnostics] {
+		if args, err = AppendZeekScript(args, runDir, zeekscripts.Diagnostics); err != nil {
+			log.Printf("[processor] Warning: could not add Zeek diagnostics script: %v", err)
+		}
+	}
+
+	// Threat-intel feeds are converted for Zeek's Intel framework on every
+	// run, so feed updates apply from the next window without a restart.
+	if off[FeatureIntel] {
+		return args
+	}
+	return append(args, IntelScripts(runDir, opts)...)
+}
@@ -2,59 +2,107 @@ package types_test
 
 import (
 	types "EnigmaNetz/Enigma-Go-Sensor/internal/processor/common"
-	"errors"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
-type mockFS struct {
-	existing  map[string]bool
-	renameErr map[string]error
+const testConnLog = "#separator \\x09\n" +
+	"#set_separator\t,\n" +
+	"#path\tconn\n" +
+	"#fields\tuid\tid.orig_h\tid.resp_p\ttunnel_parents\n" +
+	"#types\tstring\taddr\tport\tset[string]\n" +
+	"C1\t10.0.0.1\t443\t-\n" +
+	"C2\t10.0.0.2\t53\tA,B\n" +
+	"#close\t2024-01-01-00-01-00\n"
+
+func TestEncodeZeekLogs_TSVPassthrough(t *testing.T) {
+	runDir := t.TempDir()
+	connPath := filepath.Join(runDir, "conn.log")
+	if err := os.WriteFile(connPath, []byte(testConnLog), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, enc := range []string{"", "tsv"} {
+		paths, sizes, err := types.EncodeZeekLogs(runDir, []string{"conn.log", "dns.log"}, enc, 0)
+		if err != nil {
+			t.Fatalf("EncodeZeekLogs(%q): %v", enc, err)
+		}
+		if sizes != nil {
+			t.Errorf("EncodeZeekLogs(%q) sizes = %v, want nil for passthrough", enc, sizes)
+		}
+		if exp := map[string]string{"conn.log": connPath}; !reflect.DeepEqual(paths, exp) {
+			t.Errorf("EncodeZeekLogs(%q) = %v, want %v", enc, paths, exp)
+		}
+	}
+	if data, _ := os.ReadFile(connPath); string(data) != testConnLog {
+		t.Errorf("tsv passthrough modified the log:\n%s", data)
+	}
 }
 
-func (m *mockFS) Stat(name string) (os.FileInfo, error) {
-	if m.existing[name] {
-		return nil, nil
+func TestEncodeZeekLogs_CSV(t *testing.T) {
+	runDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(runDir, "conn.log"), []byte(testConnLog), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	paths, sizes, err := types.EncodeZeekLogs(runDir, []string{"conn.log", "dns.log"}, "csv", 0)
+	if err != nil {
+		t.Fatalf("EncodeZeekLogs: %v", err)
+	}
+	csvPath := filepath.Join(runDir, "conn.csv")
+	if exp := map[string]string{"conn.log": csvPath}; !reflect.DeepEqual(paths, exp) {
+		t.Errorf("paths = %v, want %v", paths, exp)
+	}
+	data, err := os.ReadFile(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "uid,id.orig_h,id.resp_p,tunnel_parents\nC1,10.0.0.1,443,\nC2,10.0.0.2,53,\"A,B\"\n"
+	if string(data) != want {
+		t.Errorf("csv = %q, want %q", data, want)
+	}
+	exp := map[string]types.EncodedSize{"conn.log": {TSVBytes: int64(len(testConnLog)), EncodedBytes: int64(len(want))}}
+	if !reflect.DeepEqual(sizes, exp) {
+		t.Errorf("sizes = %v, want %v", sizes, exp)
+	}
+	if _, err := os.Stat(filepath.Join(runDir, "conn.log")); !os.IsNotExist(err) {
+		t.Error("source .log should be replaced by the encoded file")
+	}
+	entries, _ := os.ReadDir(runDir)
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".tmp") {
+			t.Errorf("temporary file left behind: %s", e.Name())
+		}
 	}
-	return nil, os.ErrNotExist
 }
-func (m *mockFS) Rename(oldpath, newpath string) error {
-	if err, ok := m.renameErr[oldpath]; ok {
-		return err
+
+func TestEncodeZeekLogs_UnknownEncoding(t *testing.T) {
+	if _, _, err := types.EncodeZeekLogs(t.TempDir(), []string{"conn.log"}, "yaml", 0); err == nil {
+		t.Error("expected error for unknown encoding")
 	}
-	m.existing[newpath] = true
-	delete(m.existing, oldpath)
-	return nil
 }
 
-func TestRenameZeekLogsToXLSX(t *testing.T) {
-	runDir := "/tmp"
-	logFiles := []string{"conn.log", "dns.log"}
-	fs := &mockFS{
-		existing: map[string]bool{
-			filepath.Join(runDir, "conn.log"): true,
-			filepath.Join(runDir, "dns.log"):  false, // missing
-		},
-		renameErr: map[string]error{},
-	}
-	paths, err := types.RenameZeekLogsToXLSX(fs, runDir, logFiles)
+func TestEncodeZeekLogs_Parquet(t *testing.T) {
+	runDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(runDir, "conn.log"), []byte(testConnLog), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	paths, sizes, err := types.EncodeZeekLogs(runDir, []string{"conn.log"}, "parquet", 0)
 	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+		t.Fatalf("EncodeZeekLogs: %v", err)
 	}
-	exp := map[string]string{"conn.log": filepath.Join(runDir, "conn.xlsx")}
-	if !reflect.DeepEqual(paths, exp) {
-		t.Errorf("expected %v, got %v", exp, paths)
+	if paths["conn.log"] != filepath.Join(runDir, "conn.parquet") {
+		t.Errorf("paths = %v", paths)
 	}
-
-	// Test rename error
-	fs = &mockFS{
-		existing:  map[string]bool{filepath.Join(runDir, "conn.log"): true},
-		renameErr: map[string]error{filepath.Join(runDir, "conn.log"): errors.New("fail")},
-	}
-	_, err = types.RenameZeekLogsToXLSX(fs, runDir, []string{"conn.log"})
-	if err == nil || err.Error() != "failed to rename conn.log to xlsx: fail" {
-		t.Errorf("expected rename error, got %v", err)
+	data, err := os.ReadFile(paths["conn.log"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "PAR1") || !strings.HasSuffix(string(data), "PAR1") {
+		t.Error("encoded file is not a Parquet file")
+	}
+	if s := sizes["conn.log"]; s.TSVBytes != int64(len(testConnLog)) || s.EncodedBytes != int64(len(data)) {
+		t.Errorf("sizes = %+v", s)
 	}
 }
@@ -0,0 +1,196 @@
+// Package resolvers identifies public DNS resolvers offering encrypted DNS
+// (DNS over TLS, HTTPS or QUIC) by their addresses and TLS server names.
+//
+// A list of well-known resolvers is embedded so lookups work out of the box;
+// a local list in the same CSV format (provider,type,value with types ip,
+// cidr and domain) is loaded with Parse and layered over it with Fill, so
+// new resolvers can be added without a sensor release.
+package resolvers
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+//go:embed resolvers.csv
+var embeddedCSV string
+
+// List maps resolver addresses, networks and server names to the provider
+// operating them.
+type List struct {
+	addrs    map[netip.Addr]string
+	prefixes map[netip.Prefix]string
+	names    map[string]string
+}
+
+// Len returns the number of entries in the list.
+func (l *List) Len() int {
+	return len(l.addrs) + len(l.prefixes) + len(l.names)
+}
+
+func (l *List) add(provider, typ, value string) error {
+	provider, value = strings.TrimSpace(provider), strings.TrimSpace(value)
+	if provider == "" {
+		return fmt.Errorf("entry %q has no provider", value)
+	}
+	switch strings.ToLower(strings.TrimSpace(typ)) {
+	case "ip":
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return fmt.Errorf("entry %q is not an IP address", value)
+		}
+		l.setAddr(addr.Unmap(), provider)
+	case "cidr":
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return fmt.Errorf("entry %q is not a CIDR", value)
+		}
+		l.setPrefix(prefix.Masked(), provider)
+	case "domain":
+		name := normalizeName(value)
+		if name == "" || !strings.Contains(name, ".") {
+			return fmt.Errorf("entry %q is not a domain name", value)
+		}
+		l.setName(name, provider)
+	default:
+		return fmt.Errorf("entry %q has unknown type %q (want ip, cidr or domain)", value, typ)
+	}
+	return nil
+}
+
+func (l *List) setAddr(addr netip.Addr, provider string) {
+	if l.addrs == nil {
+		l.addrs = make(map[netip.Addr]string)
+	}
+	l.addrs[addr] = provider
+}
+
+func (l *List) setPrefix(prefix netip.Prefix, provider string) {
+	if l.prefixes == nil {
+		l.prefixes = make(map[netip.Prefix]string)
+	}
+	l.prefixes[prefix] = provider
+}
+
+func (l *List) setName(name, provider string) {
+	if l.names == nil {
+		l.names = make(map[string]string)
+	}
+	l.names[name] = provider
+}
+
+// Fill adds the entries of from that l does not have, so a list loaded from
+// a file can fall back to the embedded one.
+func (l *List) Fill(from *List) {
+	for addr, provider := range from.addrs {
+		if _, ok := l.addrs[addr]; !ok {
+			l.setAddr(addr, provider)
+		}
+	}
+	for prefix, provider := range from.prefixes {
+		if _, ok := l.prefixes[prefix]; !ok {
+			l.setPrefix(prefix, provider)
+		}
+	}
+	for name, provider := range from.names {
+		if _, ok := l.names[name]; !ok {
+			l.setName(name, provider)
+		}
+	}
+}
+
+// ByAddr returns the provider of the resolver at addr: listed itself, or in
+// the longest listed network containing it.
+func (l *List) ByAddr(addr netip.Addr) (string, bool) {
+	addr = addr.Unmap()
+	if provider, ok := l.addrs[addr]; ok {
+		return provider, true
+	}
+	best := -1
+	provider := ""
+	for prefix, p := range l.prefixes {
+		if prefix.Bits() > best && prefix.Contains(addr) {
+			best, provider = prefix.Bits(), p
+		}
+	}
+	return provider, best >= 0
+}
+
+// ByName returns the provider of the resolver a TLS server name belongs to:
+// a listed domain or a subdomain of one.
+func (l *List) ByName(serverName string) (string, bool) {
+	name := normalizeName(serverName)
+	for name != "" {
+		if provider, ok := l.names[name]; ok {
+			return provider, true
+		}
+		_, parent, ok := strings.Cut(name, ".")
+		if !ok || !strings.Contains(parent, ".") {
+			return "", false
+		}
+		name = parent
+	}
+	return "", false
+}
+
+func normalizeName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
+
+var (
+	embeddedOnce sync.Once
+	embedded     *List
+)
+
+// Embedded returns the built-in list of well-known resolvers. Callers must
+// not modify it; Fill a list of their own from it instead.
+func Embedded() *List {
+	embeddedOnce.Do(func() {
+		l, err := Parse(strings.NewReader(embeddedCSV))
+		if err != nil {
+			panic("resolvers: embedded list: " + err.Error())
+		}
+		embedded = l
+	})
+	return embedded
+}
+
+// Parse reads a resolver list: CSV records of provider, type (ip, cidr or
+// domain) and value. A first record starting "provider" is a header; blank
+// lines and lines starting with # are skipped.
+func Parse(r io.Reader) (*List, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.Comment = '#'
+	cr.TrimLeadingSpace = true
+	l := &List{}
+	for first := true; ; first = false {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if first && strings.EqualFold(strings.TrimPrefix(rec[0], "\ufeff"), "provider") {
+			continue
+		}
+		line, _ := cr.FieldPos(0)
+		if len(rec) < 3 {
+			return nil, fmt.Errorf("line %d: want provider,type,value", line)
+		}
+		if err := l.add(rec[0], rec[1], rec[2]); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	if l.Len() == 0 {
+		return nil, errors.New("no resolvers found")
+	}
+	return l, nil
+}
@@ -0,0 +1,83 @@
+package resolvers
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestEmbedded(t *testing.T) {
+	l := Embedded()
+	if l.Len() == 0 {
+		t.Fatal("embedded list is empty")
+	}
+	for addr, want := range map[string]string{
+		"8.8.8.8":              "Google",
+		"::ffff:1.1.1.1":       "Cloudflare",
+		"2620:fe::fe":          "Quad9",
+		"45.90.28.17":          "NextDNS",
+		"2a07:a8c0::1234:5678": "NextDNS",
+	} {
+		if got, ok := l.ByAddr(netip.MustParseAddr(addr)); !ok || got != want {
+			t.Errorf("ByAddr(%s) = %q, %v; want %q", addr, got, ok, want)
+		}
+	}
+	for name, want := range map[string]string{
+		"dns.google":                 "Google",
+		"mozilla.cloudflare-dns.com": "Cloudflare",
+		"DNS.Quad9.net.":             "Quad9",
+		"abc123.dns.nextdns.io":      "NextDNS",
+	} {
+		if got, ok := l.ByName(name); !ok || got != want {
+			t.Errorf("ByName(%s) = %q, %v; want %q", name, got, ok, want)
+		}
+	}
+	for _, name := range []string{"www.google.com", "quad9.net", "google", ""} {
+		if got, ok := l.ByName(name); ok {
+			t.Errorf("ByName(%s) = %q; want no match", name, got)
+		}
+	}
+	if got, ok := l.ByAddr(netip.MustParseAddr("192.0.2.1")); ok {
+		t.Errorf("ByAddr(192.0.2.1) = %q; want no match", got)
+	}
+}
+
+func TestParse_Fill(t *testing.T) {
+	l, err := Parse(strings.NewReader("# corporate list\nprovider,type,value\n" +
+		"Example DoH,domain,doh.example.net\n" +
+		"Example DoH,cidr,198.51.100.0/24\n" +
+		"Example DoH,ip,198.51.100.53\n" +
+		"Overridden,ip,8.8.8.8\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Fill(Embedded())
+	for addr, want := range map[string]string{
+		"198.51.100.9":  "Example DoH",
+		"198.51.100.53": "Example DoH",
+		"8.8.8.8":       "Overridden",
+		"8.8.4.4":       "Google",
+	} {
+		if got, ok := l.ByAddr(netip.MustParseAddr(addr)); !ok || got != want {
+			t.Errorf("ByAddr(%s) = %q, %v; want %q", addr, got, ok, want)
+		}
+	}
+	if got, ok := l.ByName("doh.example.net"); !ok || got != "Example DoH" {
+		t.Errorf("ByName(doh.example.net) = %q, %v", got, ok)
+	}
+
+	for _, bad := range []string{
+		"",
+		"provider,type,value\n",
+		"Example,ip,not-an-ip\n",
+		"Example,cidr,10.0.0.0/33\n",
+		"Example,domain,localhost\n",
+		"Example,url,https://doh.example.net/dns-query\n",
+		",ip,192.0.2.1\n",
+		"Example,ip\n",
+	} {
+		if _, err := Parse(strings.NewReader(bad)); err == nil {
+			t.Errorf("Parse(%q) succeeded", bad)
+		}
+	}
+}
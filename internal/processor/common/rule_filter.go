@@ -0,0 +1,61 @@
+package types
+
+import (
+	"log"
+
+	"EnigmaNetz/Enigma-Go-Sensor/internal/rules"
+)
+
+// parseFilterRules parses record filter rules, skipping (with a warning) any
+// that do not parse. Config validation rejects invalid rules at load time, so
+// this only matters for callers that bypass it.
+func parseFilterRules(texts []string) []*rules.Rule {
+	var out []*rules.Rule
+	for _, t := range texts {
+		r, err := rules.Parse(t)
+		if err != nil {
+			log.Printf("[processor] Warning: skipping filter rule: %v", err)
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// ruleFilter is the rowFilter for zeek.filter_rules. Rules are tried in order
+// and the first match drops the row.
+type ruleFilter struct {
+	rules []*rules.Rule
+}
+
+// bind resolves the rules that target this log against its header and seeds
+// their hit counters. Rules referencing a column the log lacks are skipped.
+func (f ruleFilter) bind(h *logHeader, stats *FilterStats) func([]string) rowAction {
+	var bound []*rules.Bound
+	for _, r := range f.rules {
+		if !r.AppliesTo(h.path) {
+			continue
+		}
+		if b := r.Bind(h.fields, h.types, h.setSep); b != nil {
+			bound = append(bound, b)
+		}
+	}
+	if len(bound) == 0 {
+		return nil
+	}
+	if stats.RuleHits == nil {
+		stats.RuleHits = make(map[string]int, len(bound))
+	}
+	for _, b := range bound {
+		stats.RuleHits[b.Rule.Text] += 0
+	}
+	return func(cols []string) rowAction {
+		for _, b := range bound {
+			if b.Match(cols) {
+				stats.RuleHits[b.Rule.Text]++
+				return rowDropped
+			}
+		}
+		return rowPassed
+	}
+}
@@ -0,0 +1,84 @@
+package types
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilterLogs_Rules(t *testing.T) {
+	dir := t.TempDir()
+	header := zeekHeader("conn", "uid", "id.orig_h", "id.resp_h", "id.resp_p", "proto")
+	header[len(header)-1] = "#types\tstring\taddr\taddr\tport\tenum"
+	p := writeLog(t, dir, "conn.log", header,
+		row("C1", "10.0.0.1", "10.0.0.2", "873", "tcp"),
+		row("C2", "10.0.0.1", "10.0.0.2", "445", "tcp"),
+		row("C3", "10.0.0.1", "10.0.0.2", "445", "udp"),
+		row("C4", "10.0.0.1", "10.0.0.3", "443", "tcp"),
+	)
+	writeLog(t, dir, "dns.log", zeekHeader("dns", "uid", "query", "qtype_name"),
+		row("D1", "example.com", "A"),
+	)
+
+	rules := []string{
+		"drop conn where id.resp_p in (873, 445) and proto == tcp",
+		"drop conn where id.resp_h == 10.0.0.3",
+		"drop dns where qtype_name == PTR",
+		"drop * where query == never.example",
+	}
+	report, err := FilterLogs(dir, []string{"conn.log", "dns.log"}, FilterOptions{Rules: rules})
+	if err != nil {
+		t.Fatalf("FilterLogs: %v", err)
+	}
+
+	rows := readDataRows(t, p)
+	if len(rows) != 1 || !strings.HasPrefix(rows[0], "C3\t") {
+		t.Fatalf("conn rows = %q, want only C3", rows)
+	}
+	conn := report["conn.log"]
+	if conn.Dropped != 3 || conn.Passed != 1 {
+		t.Errorf("conn stats = %+v", conn)
+	}
+	wantConn := map[string]int{rules[0]: 2, rules[1]: 1}
+	if len(conn.RuleHits) != len(wantConn) {
+		t.Errorf("conn rule hits = %v, want %v", conn.RuleHits, wantConn)
+	}
+	for r, n := range wantConn {
+		if conn.RuleHits[r] != n {
+			t.Errorf("conn hits[%q] = %d, want %d", r, conn.RuleHits[r], n)
+		}
+	}
+
+	// dns.log rules that bind but never fire still report a zero counter.
+	dns := report["dns.log"]
+	if dns.Passed != 1 || len(dns.RuleHits) != 2 || dns.RuleHits[rules[2]] != 0 || dns.RuleHits[rules[3]] != 0 {
+		t.Errorf("dns stats = %+v", dns)
+	}
+}
+
+func TestFilterLogs_RulesSeeUnmaskedRows(t *testing.T) {
+	dir := t.TempDir()
+	header := zeekHeader("conn", "uid", "id.orig_h", "id.resp_h")
+	header[len(header)-1] = "#types\tstring\taddr\taddr"
+	p := writeLog(t, dir, "conn.log", header,
+		row("C1", "10.1.2.3", "192.0.2.1"),
+		row("C2", "10.1.2.4", "192.0.2.1"),
+	)
+
+	// The rule matches the address Zeek logged, not the masked one.
+	rule := "drop conn where id.orig_h == 10.1.2.3"
+	report, err := FilterLogs(dir, []string{"conn.log"}, FilterOptions{
+		ExcludedSubnets: []string{"10.0.0.0/8=mask"},
+		Rules:           []string{rule},
+	})
+	if err != nil {
+		t.Fatalf("FilterLogs: %v", err)
+	}
+	rows := readDataRows(t, p)
+	if len(rows) != 1 || !strings.HasPrefix(rows[0], "C2\t0.0.0.0\t") {
+		t.Fatalf("conn rows = %q, want only C2, masked", rows)
+	}
+	conn := report["conn.log"]
+	if conn.Dropped != 1 || conn.Masked != 1 || conn.RuleHits[rule] != 1 {
+		t.Errorf("conn stats = %+v", conn)
+	}
+}
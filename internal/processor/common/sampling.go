@@ -0,0 +1,100 @@
+package types
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// subnetSamplingScript is the generated Zeek script that loads the per-subnet
+// sampling rates into Sampling::subnet_rates. It is written into the run
+// directory and passed to Zeek after sampling.zeek has been loaded.
+const subnetSamplingScript = "subnet-sampling.zeek"
+
+// SubnetRate is one parsed zeek.subnet_sampling entry.
+type SubnetRate struct {
+	Net        *net.IPNet
+	Percentage float64
+}
+
+// ParseSubnetRate parses a "CIDR=percentage" entry (e.g. "10.50.0.0/16=5").
+// The percentage must be within 0-100.
+func ParseSubnetRate(entry string) (SubnetRate, error) {
+	cidr, pct, found := strings.Cut(strings.TrimSpace(entry), "=")
+	if !found {
+		return SubnetRate{}, fmt.Errorf("missing \"=percentage\" in %q", entry)
+	}
+	_, n, err := net.ParseCIDR(strings.TrimSpace(cidr))
+	if err != nil {
+		return SubnetRate{}, fmt.Errorf("invalid CIDR in %q: %w", entry, err)
+	}
+	rate, err := strconv.ParseFloat(strings.TrimSpace(pct), 64)
+	if err != nil || rate < 0 || rate > 100 {
+		return SubnetRate{}, fmt.Errorf("invalid percentage in %q (expected 0-100)", entry)
+	}
+	return SubnetRate{Net: n, Percentage: rate}, nil
+}
+
+// SamplingEnabled reports whether the sampling script must be loaded for opts:
+// a global rate below 100% or any per-subnet rate.
+func (o ProcessOptions) SamplingEnabled() bool {
+	return o.SamplingPercentage < 100 || len(o.SubnetSampling) > 0
+}
+
+// AppendSamplingArgs appends the Sampling module settings for opts to args:
+// the global Sampling::sampling_percentage redef and, when per-subnet rates are
+// configured, a generated script that fills Sampling::subnet_rates. The
+// sampling script itself must already be (or subsequently be) loaded by the
+// caller. Invalid subnet entries are skipped with a warning; config validation
+// is the authoritative gate.
+func AppendSamplingArgs(args []string, runDir string, opts ProcessOptions) []string {
+	if opts.SamplingPercentage < 100 {
+		args = append(args, fmt.Sprintf("Sampling::sampling_percentage=%.1f", opts.SamplingPercentage))
+	}
+	if len(opts.SubnetSampling) == 0 {
+		return args
+	}
+	path, err := writeSubnetSamplingScript(runDir, opts.SubnetSampling)
+	if err != nil {
+		log.Printf("[processor] Warning: could not write subnet sampling script (%v); using the global sampling rate", err)
+		return args
+	}
+	log.Printf("[processor] Added subnet sampling rates %v from %s", opts.SubnetSampling, path)
+	return append(args, path)
+}
+
+// writeSubnetSamplingScript renders the subnet rates as a Zeek redef into
+// runDir and returns the script path.
+func writeSubnetSamplingScript(runDir string, entries []string) (string, error) {
+	var b strings.Builder
+	b.WriteString("# Generated by enigma-sensor from zeek.subnet_sampling; do not edit.\n")
+	b.WriteString("redef Sampling::subnet_rates += {\n")
+	for _, e := range entries {
+		r, err := ParseSubnetRate(e)
+		if err != nil {
+			log.Printf("[processor] Warning: skipping subnet sampling entry: %v", err)
+			continue
+		}
+		fmt.Fprintf(&b, "    [%s] = %s,\n", zeekSubnet(r.Net), strconv.FormatFloat(r.Percentage, 'f', 2, 64))
+	}
+	b.WriteString("};\n")
+	path := filepath.Join(runDir, subnetSamplingScript)
+	if err := os.WriteFile(path, []byte(b.String()), 0o600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// zeekSubnet formats n as a Zeek subnet literal; IPv6 prefixes are bracketed
+// ("[fd00::]/8").
+func zeekSubnet(n *net.IPNet) string {
+	ones, _ := n.Mask.Size()
+	if n.IP.To4() != nil {
+		return fmt.Sprintf("%s/%d", n.IP.To4(), ones)
+	}
+	return fmt.Sprintf("[%s]/%d", n.IP, ones)
+}
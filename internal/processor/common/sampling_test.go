@@ -0,0 +1,252 @@
+package types
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+
+	"EnigmaNetz/Enigma-Go-Sensor/internal/processor/common/zeekscripts"
+)
+
+func TestParseSubnetRate(t *testing.T) {
+	r, err := ParseSubnetRate(" 10.50.0.0/16 = 5 ")
+	if err != nil {
+		t.Fatalf("ParseSubnetRate: %v", err)
+	}
+	if r.Net.String() != "10.50.0.0/16" || r.Percentage != 5 {
+		t.Errorf("got %v=%v", r.Net, r.Percentage)
+	}
+	for _, bad := range []string{"10.50.0.0/16", "10.50.0.0=5", "10.50.0.0/16=101", "10.50.0.0/16=-1", "10.50.0.0/16=x"} {
+		if _, err := ParseSubnetRate(bad); err == nil {
+			t.Errorf("ParseSubnetRate(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestPrepareZeekArgsWithSampling(t *testing.T) {
+	base := []string{"-r", "x.pcap"}
+
+	dir := t.TempDir()
+	if got := PrepareZeekArgsWithSampling(dir, ProcessOptions{SamplingPercentage: 100}, base); len(got) != len(base) {
+		t.Errorf("sampling off: args = %v, want base args only", got)
+	}
+
+	opts := ProcessOptions{
+		SamplingPercentage: 50,
+		SubnetSampling:     []string{"10.1.0.0/16=100", "fd00::/8=2.5", "bogus"},
+	}
+	got := PrepareZeekArgsWithSampling(dir, opts, base)
+	want := []string{
+		"-r", "x.pcap",
+		filepath.Join(dir, "sampling.zeek"),
+		"Sampling::sampling_percentage=50.0",
+		filepath.Join(dir, subnetSamplingScript),
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("args = %v, want %v", got, want)
+	}
+	script, err := os.ReadFile(filepath.Join(dir, subnetSamplingScript))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"redef Sampling::subnet_rates += {", "[10.1.0.0/16] = 100.00,", "[[fd00::]/8] = 2.50,"} {
+		if !strings.Contains(string(script), line) {
+			t.Errorf("generated script missing %q:\n%s", line, script)
+		}
+	}
+	if strings.Contains(string(script), "bogus") {
+		t.Errorf("invalid entry leaked into script:\n%s", script)
+	}
+}
+
+func TestBuildZeekArgs(t *testing.T) {
+	feeds := t.TempDir()
+	writeTestFile(t, feeds, "tip.csv", "c2.example\n")
+	base := []string{"-r", "x.pcap", "-C"}
+
+	// Each run gets its own copy of every script, with its own sampling.
+	full, sampled := t.TempDir(), t.TempDir()
+	got := BuildZeekArgs(base, full, ProcessOptions{SamplingPercentage: 100})
+	want := []string{"-r", "x.pcap", "-C", filepath.Join(full, "dhcp-fingerprint.zeek"), zeekMACLogging, filepath.Join(full, "ja3-ja4-fingerprinting.zeek"), filepath.Join(full, "diagnostics.zeek")}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("args = %v, want %v", got, want)
+	}
+	got = BuildZeekArgs(base, sampled, ProcessOptions{SamplingPercentage: 25, IntelDir: feeds})
+	want = []string{
+		"-r", "x.pcap", "-C",
+		filepath.Join(sampled, "sampling.zeek"), "Sampling::sampling_percentage=25.0",
+		filepath.Join(sampled, "dhcp-fingerprint.zeek"), zeekMACLogging, filepath.Join(sampled, "ja3-ja4-fingerprinting.zeek"),
+		filepath.Join(sampled, "diagnostics.zeek"),
+		filepath.Join(sampled, "intel.zeek"), filepath.Join(sampled, intelFilesScript),
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("args = %v, want %v", got, want)
+	}
+	for _, arg := range got[3:] {
+		if strings.HasSuffix(arg, ".zeek") {
+			if _, err := os.Stat(arg); err != nil {
+				t.Errorf("script not materialized: %v", err)
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(full, "sampling.zeek")); err == nil {
+		t.Error("unsampled run got a sampling script")
+	}
+}
+
+// samplingFlows are flows with their sampling buckets, worked out by hand
+// from keep_flow in sampling.zeek: the first four bytes of the MD5 of the
+// key, modulo 10000. The key lists the lower endpoint first, so it is the
+// same whichever side Zeek sees as the originator.
+var samplingFlows = []struct {
+	client, server string
+	cport, sport   uint16
+	key            string
+	bucket         int
+}{
+	{"10.0.0.1", "192.0.2.1", 40000, 50000, "10.0.0.1|40000/udp|192.0.2.1|50000/udp", 5758},
+	{"10.0.0.1", "192.0.2.1", 40001, 50000, "10.0.0.1|40001/udp|192.0.2.1|50000/udp", 5500},
+}
+
+// subnetSamplingEntries are the subnet rates subnetSamplingFlows are sampled
+// under, with a global rate of 95%.
+var subnetSamplingEntries = []string{"10.0.0.0/8=60", "10.0.0.0/24=70", "192.0.2.0/24=80", "198.51.100.0/24=0"}
+
+// subnetSamplingFlows are UDP flows with the sample_rate sampling.zeek must
+// log for them under subnetSamplingEntries: the higher of the endpoints' most
+// specific subnet rates, or the global rate when neither endpoint has one.
+// Their buckets, worked out by hand as for samplingFlows, are all below 3000,
+// so every flow with a rate above 30% is kept; a rate of 0 drops the flow.
+var subnetSamplingFlows = []struct {
+	client, server string
+	cport          uint16
+	rate           string // "" when the flow is dropped
+}{
+	{"10.0.0.1", "203.0.113.1", 40004, "70"},    // 10.0.0.0/24 is more specific than 10.0.0.0/8
+	{"10.1.0.1", "203.0.113.1", 40003, "60"},    // 10.0.0.0/8
+	{"10.1.0.1", "192.0.2.1", 40001, "80"},      // both endpoints have a rate: the higher wins
+	{"10.0.0.1", "198.51.100.1", 40002, "70"},   // even over a rate of 0
+	{"203.0.113.5", "203.0.113.1", 40000, "95"}, // neither endpoint has a rate
+	{"203.0.113.5", "198.51.100.1", 40000, ""},  // dropped by its subnet's rate of 0
+}
+
+// TestSamplingZeek runs sampling.zeek on each flow of samplingFlows, once
+// with the client sending and once with the server sending, at rates just
+// above and at its bucket: both directions must be kept at the first and
+// dropped at the second. It then runs subnetSamplingFlows under
+// subnetSamplingEntries and checks each kept row's sample_rate. It needs
+// Zeek, on PATH or where the Linux packages install it.
+func TestSamplingZeek(t *testing.T) {
+	zeek, err := exec.LookPath("zeek")
+	if err != nil {
+		if zeek, err = exec.LookPath("/opt/zeek/bin/zeek"); err != nil {
+			t.Skip("zeek not installed")
+		}
+	}
+	dir := t.TempDir()
+	script, err := zeekscripts.Materialize(dir, zeekscripts.Sampling)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// connRows runs Zeek with the sampling script and args on a capture of
+	// packets and returns the rows of its conn.log by column name.
+	connRows := func(name string, packets [][]byte, args ...string) []map[string]string {
+		t.Helper()
+		runDir := filepath.Join(dir, name)
+		if err := os.MkdirAll(runDir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		pcap := filepath.Join(runDir, "flow.pcap")
+		f, err := os.Create(pcap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := pcapgo.NewWriter(f)
+		if err := w.WriteFileHeader(65535, layers.LinkTypeEthernet); err != nil {
+			t.Fatal(err)
+		}
+		for i, packet := range packets {
+			ci := gopacket.CaptureInfo{Timestamp: time.Unix(1700000000, int64(i)*1000), CaptureLength: len(packet), Length: len(packet)}
+			if err := w.WritePacket(ci, packet); err != nil {
+				t.Fatal(err)
+			}
+		}
+		f.Close()
+		cmd := exec.Command(zeek, append([]string{"-C", "-r", pcap, script}, args...)...)
+		cmd.Dir = runDir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("zeek: %v\n%s", err, out)
+		}
+		connLog := filepath.Join(runDir, "conn.log")
+		if _, err := os.Stat(connLog); os.IsNotExist(err) {
+			return nil
+		}
+		fields := strings.Split(readHeaderLine(t, connLog, "fields"), "\t")[1:]
+		var rows []map[string]string
+		for _, line := range readDataRows(t, connLog) {
+			row := make(map[string]string)
+			for i, v := range strings.Split(line, "\t") {
+				if i < len(fields) {
+					row[fields[i]] = v
+				}
+			}
+			rows = append(rows, row)
+		}
+		return rows
+	}
+	kept := func(name string, packet []byte, rate float64) bool {
+		t.Helper()
+		return len(connRows(name, [][]byte{packet}, fmt.Sprintf("Sampling::sampling_percentage=%.2f", rate))) > 0
+	}
+	for i, f := range samplingFlows {
+		fwd := shardTestPacket(t, f.client, f.server, f.cport, f.sport, false)
+		rev := shardTestPacket(t, f.server, f.client, f.sport, f.cport, false)
+		above, at := float64(f.bucket+1)/100, float64(f.bucket)/100
+		for _, c := range []struct {
+			name   string
+			packet []byte
+		}{{"fwd", fwd}, {"rev", rev}} {
+			if !kept(fmt.Sprintf("%d-%s-above", i, c.name), c.packet, above) {
+				t.Errorf("%s %s: dropped at %.2f%%", f.key, c.name, above)
+			}
+			if kept(fmt.Sprintf("%d-%s-at", i, c.name), c.packet, at) {
+				t.Errorf("%s %s: kept at %.2f%%", f.key, c.name, at)
+			}
+		}
+	}
+
+	// The subnet rates, loaded as the processor loads them.
+	args := AppendSamplingArgs(nil, dir, ProcessOptions{SamplingPercentage: 95, SubnetSampling: subnetSamplingEntries})
+	var packets [][]byte
+	for _, f := range subnetSamplingFlows {
+		packets = append(packets, shardTestPacket(t, f.client, f.server, f.cport, 53, false))
+	}
+	rates := make(map[string]string)
+	for _, row := range connRows("subnets", packets, args...) {
+		rates[row["id.orig_h"]+"|"+row["id.orig_p"]+"|"+row["id.resp_h"]] = row["sample_rate"]
+	}
+	for _, f := range subnetSamplingFlows {
+		key := fmt.Sprintf("%s|%d|%s", f.client, f.cport, f.server)
+		got, ok := rates[key]
+		switch {
+		case f.rate == "" && ok:
+			t.Errorf("%s: kept with sample_rate %s, want dropped", key, got)
+		case f.rate == "":
+		case !ok:
+			t.Errorf("%s: dropped, want sample_rate %s", key, f.rate)
+		default:
+			if r, err := strconv.ParseFloat(got, 64); err != nil || strconv.FormatFloat(r, 'f', -1, 64) != f.rate {
+				t.Errorf("%s: sample_rate %s, want %s", key, got, f.rate)
+			}
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// QuarantineReasonFile is written beside a quarantined run's logs with the
+// reason it was quarantined.
+const QuarantineReasonFile = "quarantine.json"
+
+// schemaField is a column a log must have, and its Zeek type.
+type schemaField struct{ name, typ string }
+
+var (
+	schemaConnID = []schemaField{{"id.orig_h", "addr"}, {"id.orig_p", "port"}, {"id.resp_h", "addr"}, {"id.resp_p", "port"}}
+	schemaTSUID  = []schemaField{{"ts", "time"}, {"uid", "string"}}
+)
+
+// logSchemas are the columns each uploaded log must have as Zeek wrote it.
+// Columns beyond them, from Zeek upgrades or local scripts, are accepted.
+var logSchemas = map[string][]schemaField{
+	"conn.log":    concatFields(schemaTSUID, schemaConnID, []schemaField{{"proto", "enum"}}),
+	"dns.log":     concatFields(schemaTSUID, schemaConnID, []schemaField{{"proto", "enum"}, {"query", "string"}}),
+	"dhcp.log":    {{"ts", "time"}, {"uids", "set[string]"}, {"mac", "string"}},
+	"ja3_ja4.log": concatFields(schemaTSUID, []schemaField{{"ja3", "string"}, {"ja4", "string"}}),
+	"ja4s.log":    concatFields(schemaTSUID, []schemaField{{"ja4s", "string"}}),
+	IntelLogFile:  {{"ts", "time"}, {"seen.indicator", "string"}, {"matched", "set[enum]"}},
+}
+
+func concatFields(parts ...[]schemaField) []schemaField {
+	var fields []schemaField
+	for _, p := range parts {
+		fields = append(fields, p...)
+	}
+	return fields
+}
+
+// SchemaError reports the logs of a run that failed ValidateLogSchemas.
+type SchemaError struct {
+	// Problems has one entry per failing log, "<log>: <problem>".
+	Problems []string
+	// Quarantine is the directory the run was moved to, or "" when it was
+	// not quarantined.
+	Quarantine string
+}
+
+func (e *SchemaError) Error() string {
+	msg := fmt.Sprintf("%d logs fail schema validation: %s", len(e.Problems), strings.Join(e.Problems, "; "))
+	if e.Quarantine != "" {
+		msg += "; quarantined in " + e.Quarantine
+	}
+	return msg
+}
+
+// ValidateLogSchemas checks the logs Zeek wrote to runDir before the sensor
+// touches them: each must declare its columns and their types, have the
+// required columns of its schema with the expected types, have that many
+// columns in every row, and end with Zeek's #close footer, which a Zeek
+// killed mid-run never writes. Logs Zeek did not write are not checked. It
+// returns a *SchemaError listing the first problem of each failing log.
+func ValidateLogSchemas(runDir string, limit int64) error {
+	var problems []string
+	for _, name := range ZeekLogFiles {
+		problem, err := validateLogSchema(filepath.Join(runDir, name), logSchemas[name], limit)
+		if err != nil {
+			problem = err.Error()
+		}
+		if problem != "" {
+			problems = append(problems, name+": "+problem)
+		}
+	}
+	if problems != nil {
+		return &SchemaError{Problems: problems}
+	}
+	return nil
+}
+
+// validateLogSchema returns the first problem of the log at path, or "".
+func validateLogSchema(path string, schema []schemaField, limit int64) (string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	lr, err := newLogReader(f, maxLineBytes(limit))
+	if err != nil {
+		return "", err
+	}
+	h := lr.header
+	switch {
+	case h.fields == nil:
+		return "no #fields header", nil
+	case len(h.types) != len(h.fields):
+		return fmt.Sprintf("%d #types for %d #fields", len(h.types), len(h.fields)), nil
+	}
+	for _, want := range schema {
+		i := h.index(want.name)
+		if i < 0 {
+			return fmt.Sprintf("missing column %s", want.name), nil
+		}
+		if h.types[i] != want.typ {
+			return fmt.Sprintf("column %s is %s, want %s", want.name, h.types[i], want.typ), nil
+		}
+	}
+
+	closed := false
+	row := 0
+	for {
+		l, err := lr.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if !isDataLine(l.text) {
+			if strings.HasPrefix(l.text, "#close") {
+				closed = true
+			}
+			continue
+		}
+		row++
+		if closed {
+			return fmt.Sprintf("row %d after #close", row), nil
+		}
+		if !l.terminated {
+			return fmt.Sprintf("row %d is truncated", row), nil
+		}
+		if n := strings.Count(l.text, h.sep) + 1; n != len(h.fields) {
+			return fmt.Sprintf("row %d has %d columns, want %d", row, n, len(h.fields)), nil
+		}
+	}
+	if !closed {
+		return "no #close footer (Zeek did not finish the log)", nil
+	}
+	return "", nil
+}
+
+// quarantineRecord is the content of QuarantineReasonFile.
+type quarantineRecord struct {
+	Time     string     `json:"time"`
+	RunDir   string     `json:"run_dir"`
+	PCAP     string     `json:"pcap,omitempty"`
+	Problems []string   `json:"problems"`
+	Health   ZeekHealth `json:"zeek_health"`
+}
+
+// QuarantineRun moves the Zeek logs and output of runDir, and pcapPath when
+// it is set, to a new directory of quarantineDir named after the run, with
+// the reason in QuarantineReasonFile, so a run whose logs cannot be trusted
+// is kept for inspection instead of uploaded or deleted. It returns the new
+// directory, which is "" only when nothing was moved.
+func QuarantineRun(runDir, pcapPath, quarantineDir string, schemaErr *SchemaError, health ZeekHealth) (string, error) {
+	name := filepath.Base(runDir)
+	if pcapPath != "" {
+		name = strings.TrimSuffix(filepath.Base(pcapPath), filepath.Ext(pcapPath))
+	}
+	if err := os.MkdirAll(quarantineDir, 0o750); err != nil {
+		return "", fmt.Errorf("create quarantine dir: %w", err)
+	}
+	dir, err := os.MkdirTemp(quarantineDir, name+"-")
+	if err != nil {
+		return "", fmt.Errorf("create quarantine dir: %w", err)
+	}
+
+	// The PCAP goes first: once it is moved the run is quarantined, and
+	// the caller must not delete or move it.
+	if pcapPath != "" {
+		if err := os.Rename(pcapPath, filepath.Join(dir, filepath.Base(pcapPath))); err != nil {
+			os.Remove(dir)
+			return "", fmt.Errorf("move %s to quarantine: %w", filepath.Base(pcapPath), err)
+		}
+	}
+	files, err := filepath.Glob(filepath.Join(runDir, "*.log"))
+	if err != nil {
+		return dir, err
+	}
+	for _, src := range append(files, filepath.Join(runDir, ZeekOutputFile)) {
+		if err := os.Rename(src, filepath.Join(dir, filepath.Base(src))); err != nil && !os.IsNotExist(err) {
+			return dir, fmt.Errorf("move %s to quarantine: %w", filepath.Base(src), err)
+		}
+	}
+
+	record, err := json.MarshalIndent(quarantineRecord{
+		Time:     time.Now().UTC().Format(time.RFC3339),
+		RunDir:   runDir,
+		PCAP:     pcapPath,
+		Problems: schemaErr.Problems,
+		Health:   health,
+	}, "", "  ")
+	if err != nil {
+		return dir, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, QuarantineReasonFile), append(record, '\n'), 0o644); err != nil {
+		return dir, fmt.Errorf("write quarantine reason: %w", err)
+	}
+	log.Printf("[processor] WARNING: quarantined %s in %s: %s", runDir, dir, strings.Join(schemaErr.Problems, "; "))
+	return dir, nil
+}
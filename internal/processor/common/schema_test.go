@@ -0,0 +1,90 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const schemaTestConn = "#separator \\x09\n#set_separator\t,\n#path\tconn\n#open\t2023-11-14-22-13-20\n" +
+	"#fields\tts\tuid\tid.orig_h\tid.orig_p\tid.resp_h\tid.resp_p\tproto\tservice\n" +
+	"#types\ttime\tstring\taddr\tport\taddr\tport\tenum\tstring\n" +
+	"1.0\tCa\t10.0.0.1\t50000\t192.0.2.1\t443\ttcp\tssl\n" +
+	"2.0\tCb\t10.0.0.2\t50001\t192.0.2.1\t53\tudp\tdns\n"
+
+func TestValidateLogSchemas(t *testing.T) {
+	for name, tc := range map[string]struct {
+		log, problem string
+	}{
+		"valid":            {schemaTestConn + "#close\t2023-11-14-22-14-20\n", ""},
+		"no close":         {schemaTestConn, "no #close footer"},
+		"truncated row":    {schemaTestConn + "3.0\tCc\t10.0.0.3", "row 3 is truncated"},
+		"short row":        {schemaTestConn + "3.0\tCc\n#close\tx\n", "row 3 has 2 columns, want 8"},
+		"missing column":   {strings.Replace(schemaTestConn, "\tproto\t", "\tprotocol\t", 1) + "#close\tx\n", "missing column proto"},
+		"wrong type":       {strings.Replace(schemaTestConn, "#types\ttime", "#types\tdouble", 1) + "#close\tx\n", "column ts is double, want time"},
+		"types mismatched": {strings.Replace(schemaTestConn, "\tenum\tstring\n", "\tenum\n", 1) + "#close\tx\n", "7 #types for 8 #fields"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestFile(t, dir, "conn.log", tc.log)
+			err := ValidateLogSchemas(dir, 0)
+			if tc.problem == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			var schemaErr *SchemaError
+			if !errors.As(err, &schemaErr) || len(schemaErr.Problems) != 1 || !strings.HasPrefix(schemaErr.Problems[0], "conn.log: "+tc.problem) {
+				t.Errorf("err = %v, want %q", err, tc.problem)
+			}
+		})
+	}
+}
+
+func TestProcessLogs_Quarantine(t *testing.T) {
+	runDir := t.TempDir()
+	quarantine := filepath.Join(t.TempDir(), "quarantine")
+	writeTestFile(t, runDir, "conn.log", schemaTestConn)
+	writeTestFile(t, runDir, "capture.pcap", "pcap")
+	writeTestFile(t, runDir, ZeekOutputFile, "killed\n")
+	pcapPath := filepath.Join(runDir, "capture.pcap")
+
+	opts := ProcessOptions{ValidateSchemas: true, QuarantineDir: quarantine}
+	_, err := ProcessLogs(runDir, opts, map[string]interface{}{"pcap_path": pcapPath})
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) || schemaErr.Quarantine == "" {
+		t.Fatalf("err = %v", err)
+	}
+	if filepath.Dir(schemaErr.Quarantine) != quarantine || !strings.HasPrefix(filepath.Base(schemaErr.Quarantine), "capture-") {
+		t.Errorf("quarantined in %s", schemaErr.Quarantine)
+	}
+	for _, name := range []string{"conn.log", "capture.pcap", ZeekOutputFile} {
+		if _, err := os.Stat(filepath.Join(schemaErr.Quarantine, name)); err != nil {
+			t.Errorf("%s not quarantined: %v", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(runDir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s left in the run directory", name)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(schemaErr.Quarantine, QuarantineReasonFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record quarantineRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.PCAP != pcapPath || len(record.Problems) != 1 || !strings.Contains(record.Problems[0], "#close") {
+		t.Errorf("reason = %s", data)
+	}
+
+	// Without validation the same logs are processed.
+	writeTestFile(t, runDir, "conn.log", schemaTestConn)
+	if _, err := ProcessLogs(runDir, ProcessOptions{}, nil); err != nil {
+		t.Errorf("unvalidated: %v", err)
+	}
+}
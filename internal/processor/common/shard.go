@@ -0,0 +1,363 @@
+package types
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// shardSnaplen is the snapshot length written to shard PCAPs. It is the
+// largest any capture tool uses, so no packet of the original exceeds it.
+const shardSnaplen = 262144
+
+// ZeekRunner runs Zeek on a PCAP, writing its logs to logDir. It
+// materializes the scripts it loads into logDir, so runs on different
+// directories can proceed in parallel.
+type ZeekRunner func(pcapPath, logDir string) error
+
+// RunZeekSharded runs Zeek on pcapPath with its logs written to runDir. When
+// opts.Shards is above 1 and the PCAP is at least opts.ShardMinBytes, the
+// PCAP is split into that many shards by ShardPCAP, Zeek runs on each in
+// parallel and MergeShardLogs merges their logs into runDir, so one large
+// PCAP uses as many cores as shards. A PCAP that cannot be split is run
+// whole. The shards are deleted afterwards.
+func RunZeekSharded(pcapPath, runDir string, opts ProcessOptions, run ZeekRunner) error {
+	if opts.Shards <= 1 {
+		return run(pcapPath, runDir)
+	}
+	info, err := os.Stat(pcapPath)
+	if err != nil || info.Size() < opts.ShardMinBytes {
+		return run(pcapPath, runDir)
+	}
+
+	shardRoot := filepath.Join(runDir, "shards-"+strings.TrimSuffix(filepath.Base(pcapPath), filepath.Ext(pcapPath)))
+	defer os.RemoveAll(shardRoot)
+	started := time.Now()
+	shards, err := ShardPCAP(pcapPath, shardRoot, opts.Shards)
+	if err != nil {
+		log.Printf("[processor] Warning: could not split %s into shards (%v); running one Zeek on it", pcapPath, err)
+		return run(pcapPath, runDir)
+	}
+	log.Printf("[processor] Split %s (%d MB) into %d shards in %s", filepath.Base(pcapPath), info.Size()>>20, len(shards), time.Since(started).Round(time.Millisecond))
+
+	dirs := make([]string, len(shards))
+	errs := make([]error, len(shards))
+	var wg sync.WaitGroup
+	for i, shard := range shards {
+		dirs[i] = filepath.Dir(shard)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := run(shard, dirs[i]); err != nil {
+				errs[i] = fmt.Errorf("shard %d: %w", i, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	if err := MergeShardLogs(dirs, runDir, opts.MemoryLimit); err != nil {
+		return fmt.Errorf("merge shard logs: %w", err)
+	}
+	mergeZeekOutputs(dirs, runDir)
+	log.Printf("[processor] Merged the logs of %d shards into %s", len(shards), runDir)
+	return nil
+}
+
+// mergeZeekOutputs appends the output of each shard's Zeek to runDir's
+// ZeekOutputFile for the health report.
+func mergeZeekOutputs(dirs []string, runDir string) {
+	out, err := os.OpenFile(filepath.Join(runDir, ZeekOutputFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		log.Printf("[processor] Warning: could not keep Zeek's output: %v", err)
+		return
+	}
+	defer out.Close()
+	for _, dir := range dirs {
+		in, err := os.Open(filepath.Join(dir, ZeekOutputFile))
+		if err != nil {
+			continue
+		}
+		_, err = io.Copy(out, in)
+		in.Close()
+		if err != nil {
+			log.Printf("[processor] Warning: could not keep Zeek's output: %v", err)
+			return
+		}
+	}
+}
+
+// ShardPCAP splits the pcap or pcapng file pcapPath into n pcap files, each
+// in its own numbered directory of dir, and returns their paths. Packets
+// are assigned by shardOf, which keeps both directions of a flow, and every
+// fragment of a datagram, in the same shard. Packets that are not IP go to
+// the first shard. A pcapng file mixing link types cannot be split.
+func ShardPCAP(pcapPath, dir string, n int) ([]string, error) {
+	f, err := os.Open(pcapPath)
+	if err != nil {
+		return nil, fmt.Errorf("open pcap: %w", err)
+	}
+	defer f.Close()
+	reader, err := openPacketReader(f)
+	if err != nil {
+		return nil, err
+	}
+	linkType := reader.LinkType()
+	ngr, _ := reader.(*pcapgo.NgReader)
+
+	paths := make([]string, n)
+	files := make([]*os.File, n)
+	bufs := make([]*bufio.Writer, n)
+	writers := make([]*pcapgo.Writer, n)
+	defer func() {
+		for _, f := range files {
+			if f != nil {
+				f.Close()
+			}
+		}
+	}()
+	for i := range paths {
+		shardDir := filepath.Join(dir, fmt.Sprintf("%02d", i))
+		if err := os.MkdirAll(shardDir, 0o750); err != nil {
+			return nil, fmt.Errorf("create shard dir: %w", err)
+		}
+		paths[i] = filepath.Join(shardDir, "shard.pcap")
+		if files[i], err = os.Create(paths[i]); err != nil {
+			return nil, fmt.Errorf("create shard: %w", err)
+		}
+		bufs[i] = bufio.NewWriterSize(files[i], streamBufferSize)
+		writers[i] = pcapgo.NewWriterNanos(bufs[i])
+		if err := writers[i].WriteFileHeader(shardSnaplen, linkType); err != nil {
+			return nil, fmt.Errorf("write shard header: %w", err)
+		}
+	}
+
+	for {
+		data, ci, err := reader.ReadPacketData()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read pcap: %w", err)
+		}
+		if ngr != nil {
+			if iface, err := ngr.Interface(ci.InterfaceIndex); err == nil && iface.LinkType != linkType {
+				return nil, fmt.Errorf("pcapng mixes link types %s and %s", linkType, iface.LinkType)
+			}
+		}
+		i := shardOf(data, linkType, n)
+		if err := writers[i].WritePacket(ci, data); err != nil {
+			return nil, fmt.Errorf("write shard: %w", err)
+		}
+	}
+	for i, f := range files {
+		if err := bufs[i].Flush(); err != nil {
+			return nil, fmt.Errorf("write shard: %w", err)
+		}
+		if err := f.Close(); err != nil {
+			return nil, fmt.Errorf("write shard: %w", err)
+		}
+		files[i] = nil
+	}
+	return paths, nil
+}
+
+// shardOf returns the shard of n a packet belongs to: a hash of its address
+// pair and, for TCP, UDP and SCTP, its port pair. gopacket's flow hashes are
+// the same for a flow and its reverse, so both directions share a shard.
+//
+// IP fragments are hashed by address pair alone, whatever their protocol:
+// gopacket decodes no transport layer from a fragment, not even the first
+// one that carries the ports, and all fragments of a datagram must reach the
+// same Zeek for it to be reassembled. The trade-off is that a flow sending
+// both fragmented and whole packets, such as UDP with some large datagrams,
+// can be split between two shards; each datagram is still analyzed whole,
+// but the flow may be logged once per shard. Hashing every packet by address
+// pair instead would put all flows between two busy hosts, such as a NAT
+// gateway and a server, in one shard.
+func shardOf(data []byte, linkType layers.LinkType, n int) int {
+	p := gopacket.NewPacket(data, linkType, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+	network := p.NetworkLayer()
+	if network == nil {
+		return 0
+	}
+	h := network.NetworkFlow().FastHash()
+	if transport := p.TransportLayer(); transport != nil {
+		switch transport.LayerType() {
+		case layers.LayerTypeTCP, layers.LayerTypeUDP, layers.LayerTypeSCTP:
+			h = h*31 + transport.TransportFlow().FastHash()
+		}
+	}
+	return int(h % uint64(n))
+}
+
+// shardLog is one shard's copy of a log being merged.
+type shardLog struct {
+	r      *logReader
+	f      *os.File
+	cur    string  // the next data row, "" once exhausted
+	ts     float64 // cur's ts
+	open   string  // the #open line
+	closed string  // the #close line
+	header *logHeader
+}
+
+// advance reads the next data row, keeping the #open and #close lines met
+// on the way.
+func (s *shardLog) advance(tsIdx int) error {
+	for {
+		l, err := s.r.next()
+		if err == io.EOF {
+			s.cur = ""
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case strings.HasPrefix(l.text, "#open"):
+			s.open = l.text
+		case strings.HasPrefix(l.text, "#close"):
+			s.closed = l.text
+		case isDataLine(l.text):
+			s.cur = l.text
+			s.ts, _ = strconv.ParseFloat(column(strings.Split(l.text, s.header.sep), tsIdx), 64)
+			return nil
+		}
+	}
+}
+
+// MergeShardLogs merges the logs Zeek wrote to each of dirs into single logs
+// in runDir. A log's rows are interleaved by ts, keeping each shard's rows in
+// the order Zeek wrote them, so the merged log is as time-ordered as one
+// Zeek would have written. Its header is the first shard's, with the
+// earliest #open and the latest #close. Every shard's copy of a log
+// must have the same columns. limit is the worker memory budget in bytes
+// (0 = DefaultMemoryLimit).
+func MergeShardLogs(dirs []string, runDir string, limit int64) error {
+	names := make(map[string]bool)
+	for _, dir := range dirs {
+		logs, err := filepath.Glob(filepath.Join(dir, "*.log"))
+		if err != nil {
+			return err
+		}
+		for _, path := range logs {
+			names[filepath.Base(path)] = true
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		if err := mergeShardLog(dirs, name, filepath.Join(runDir, name), limit); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// mergeShardLog merges the shards' copies of the log name into dst.
+func mergeShardLog(dirs []string, name, dst string, limit int64) error {
+	var shards []*shardLog
+	defer func() {
+		for _, s := range shards {
+			s.f.Close()
+		}
+	}()
+	var preamble []string
+	tsIdx := -1
+	for _, dir := range dirs {
+		f, err := os.Open(filepath.Join(dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		r, err := newLogReader(f, maxLineBytes(limit))
+		if err != nil {
+			f.Close()
+			return err
+		}
+		s := &shardLog{r: r, f: f, header: r.header}
+		shards = append(shards, s)
+		if len(shards) == 1 {
+			tsIdx = s.header.index("ts")
+			for _, l := range r.queued {
+				if isDataLine(l.text) {
+					break
+				}
+				preamble = append(preamble, l.text)
+			}
+		} else if strings.Join(s.header.fields, "\t") != strings.Join(shards[0].header.fields, "\t") {
+			return fmt.Errorf("shard %s has different columns", dir)
+		}
+		if err := s.advance(tsIdx); err != nil {
+			return err
+		}
+	}
+	if len(shards) == 0 {
+		return nil
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w := bufio.NewWriterSize(out, streamBufferSize)
+	for _, line := range preamble {
+		if strings.HasPrefix(line, "#open") {
+			for _, s := range shards {
+				if s.open != "" && s.open < line {
+					line = s.open
+				}
+			}
+		}
+		w.WriteString(line + "\n")
+	}
+	for {
+		next := -1
+		for i, s := range shards {
+			if s.cur != "" && (next < 0 || s.ts < shards[next].ts) {
+				next = i
+			}
+		}
+		if next < 0 {
+			break
+		}
+		w.WriteString(shards[next].cur + "\n")
+		if err := shards[next].advance(tsIdx); err != nil {
+			return err
+		}
+	}
+	closed := ""
+	for _, s := range shards {
+		if s.closed > closed {
+			closed = s.closed
+		}
+	}
+	if closed != "" {
+		w.WriteString(closed + "\n")
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return out.Close()
+}
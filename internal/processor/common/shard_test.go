@@ -0,0 +1,308 @@
+package types
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// shardTestPacket serializes an Ethernet/IPv4 packet carrying TCP, or UDP
+// when tcp is false.
+func shardTestPacket(t *testing.T, src, dst string, sport, dport uint16, tcp bool) []byte {
+	t.Helper()
+	eth := &layers.Ethernet{SrcMAC: net.HardwareAddr{0, 1, 2, 3, 4, 5}, DstMAC: net.HardwareAddr{0, 1, 2, 3, 4, 6}, EthernetType: layers.EthernetTypeIPv4}
+	ip := &layers.IPv4{Version: 4, TTL: 64, SrcIP: net.ParseIP(src).To4(), DstIP: net.ParseIP(dst).To4()}
+	var transport gopacket.SerializableLayer
+	if tcp {
+		ip.Protocol = layers.IPProtocolTCP
+		l := &layers.TCP{SrcPort: layers.TCPPort(sport), DstPort: layers.TCPPort(dport), ACK: true}
+		l.SetNetworkLayerForChecksum(ip)
+		transport = l
+	} else {
+		ip.Protocol = layers.IPProtocolUDP
+		l := &layers.UDP{SrcPort: layers.UDPPort(sport), DstPort: layers.UDPPort(dport)}
+		l.SetNetworkLayerForChecksum(ip)
+		transport = l
+	}
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, eth, ip, transport, gopacket.Payload("x")); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// writeShardTestPCAP writes 40 TCP connections and 10 UDP flows with packets
+// in both directions, and returns the path and the packet count.
+func writeShardTestPCAP(t *testing.T, dir string) (string, int) {
+	t.Helper()
+	path := filepath.Join(dir, "big.pcap")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := pcapgo.NewWriter(f)
+	if err := w.WriteFileHeader(65535, layers.LinkTypeEthernet); err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	ts := time.Unix(1700000000, 0)
+	write := func(data []byte) {
+		ts = ts.Add(time.Millisecond)
+		if err := w.WritePacket(gopacket.CaptureInfo{Timestamp: ts, CaptureLength: len(data), Length: len(data)}, data); err != nil {
+			t.Fatal(err)
+		}
+		count++
+	}
+	for i := 0; i < 50; i++ {
+		client := fmt.Sprintf("10.0.0.%d", i%5+1)
+		sport := uint16(40000 + i)
+		tcp := i < 40
+		write(shardTestPacket(t, client, "192.0.2.1", sport, 443, tcp))
+		write(shardTestPacket(t, "192.0.2.1", client, 443, sport, tcp))
+	}
+	return path, count
+}
+
+// shardFlows reads a shard and returns its packets' flows, in the
+// direction-independent form "a b".
+func shardFlows(t *testing.T, path string) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := pcapgo.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var flows []string
+	for {
+		data, _, err := r.ReadPacketData()
+		if err == io.EOF {
+			return flows
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := gopacket.NewPacket(data, r.LinkType(), gopacket.Default)
+		src, dst := p.NetworkLayer().NetworkFlow().Endpoints()
+		sport, dport := p.TransportLayer().TransportFlow().Endpoints()
+		a, b := src.String()+":"+sport.String(), dst.String()+":"+dport.String()
+		if b < a {
+			a, b = b, a
+		}
+		flows = append(flows, a+" "+b)
+	}
+}
+
+func TestShardPCAP(t *testing.T) {
+	dir := t.TempDir()
+	path, count := writeShardTestPCAP(t, dir)
+	shards, err := ShardPCAP(path, filepath.Join(dir, "shards"), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shards) != 4 {
+		t.Fatalf("shards = %v", shards)
+	}
+
+	// Both directions of every connection are in the same shard, and no
+	// packet is lost.
+	shardOfFlow := make(map[string]int)
+	total, used := 0, 0
+	for i, shard := range shards {
+		flows := shardFlows(t, shard)
+		if len(flows) > 0 {
+			used++
+		}
+		total += len(flows)
+		for _, flow := range flows {
+			if j, seen := shardOfFlow[flow]; seen && j != i {
+				t.Errorf("flow %s in shards %d and %d", flow, j, i)
+			}
+			shardOfFlow[flow] = i
+		}
+	}
+	if total != count {
+		t.Errorf("%d packets in the shards, want %d", total, count)
+	}
+	if used < 2 {
+		t.Errorf("all packets in %d shard", used)
+	}
+	if len(shardOfFlow) != 50 {
+		t.Errorf("%d flows, want 50", len(shardOfFlow))
+	}
+}
+
+// shardTestFragment returns an Ethernet frame holding a fragment of a UDP
+// datagram from src to dst: the first when offset is 0, carrying the UDP
+// header, and a later one otherwise. With v6 the addresses are IPv6 and
+// the fragment is marked by a Fragment extension header.
+func shardTestFragment(t *testing.T, src, dst string, sport, dport uint16, offset uint16, v6 bool) []byte {
+	t.Helper()
+	eth := &layers.Ethernet{SrcMAC: net.HardwareAddr{0, 1, 2, 3, 4, 5}, DstMAC: net.HardwareAddr{0, 1, 2, 3, 4, 6}, EthernetType: layers.EthernetTypeIPv4}
+	payload := []byte("fragment")
+	if offset == 0 {
+		payload = []byte{byte(sport >> 8), byte(sport), byte(dport >> 8), byte(dport), 0, 100, 0, 0}
+	}
+	var ip gopacket.SerializableLayer
+	if v6 {
+		eth.EthernetType = layers.EthernetTypeIPv6
+		ip = &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolIPv6Fragment, SrcIP: net.ParseIP(src), DstIP: net.ParseIP(dst)}
+		// Next header UDP, the offset in 8-byte units, more fragments
+		// unless this is the last, and an identification.
+		more := uint16(1)
+		if offset != 0 {
+			more = 0
+		}
+		off := offset<<3 | more
+		payload = append([]byte{byte(layers.IPProtocolUDP), 0, byte(off >> 8), byte(off), 0, 0, 0, 7}, payload...)
+	} else {
+		l := &layers.IPv4{Version: 4, TTL: 64, Id: 7, Protocol: layers.IPProtocolUDP, SrcIP: net.ParseIP(src).To4(), DstIP: net.ParseIP(dst).To4(), FragOffset: offset}
+		if offset == 0 {
+			l.Flags = layers.IPv4MoreFragments
+		}
+		ip = l
+	}
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true}
+	if err := gopacket.SerializeLayers(buf, opts, eth, ip, gopacket.Payload(payload)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestShardOf(t *testing.T) {
+	const n = 16
+	shard := func(data []byte) int { return shardOf(data, layers.LinkTypeEthernet, n) }
+
+	// Both directions of a TCP or UDP flow share a shard, and flows between
+	// one address pair are spread by their ports.
+	for _, tcp := range []bool{true, false} {
+		used := make(map[int]bool)
+		for sport := uint16(40000); sport < 40032; sport++ {
+			fwd := shard(shardTestPacket(t, "10.0.0.1", "192.0.2.1", sport, 53, tcp))
+			rev := shard(shardTestPacket(t, "192.0.2.1", "10.0.0.1", 53, sport, tcp))
+			if fwd != rev {
+				t.Errorf("tcp=%v port %d: shards %d and %d for the two directions", tcp, sport, fwd, rev)
+			}
+			used[fwd] = true
+		}
+		if len(used) < 2 {
+			t.Errorf("tcp=%v: 32 flows between one address pair all in one shard", tcp)
+		}
+	}
+
+	// Every fragment of a datagram, in either direction and whatever its
+	// ports, goes to its address pair's shard.
+	for _, c := range []struct {
+		name     string
+		src, dst string
+		v6       bool
+	}{
+		{"ipv4", "10.0.0.1", "192.0.2.1", false},
+		{"ipv6", "2001:db8::1", "2001:db8::2", true},
+	} {
+		want := shard(shardTestFragment(t, c.src, c.dst, 40000, 53, 0, c.v6))
+		for sport := uint16(40001); sport < 40032; sport++ {
+			for _, got := range []int{
+				shard(shardTestFragment(t, c.src, c.dst, sport, 53, 0, c.v6)),
+				shard(shardTestFragment(t, c.src, c.dst, sport, 53, 185, c.v6)),
+				shard(shardTestFragment(t, c.dst, c.src, 53, sport, 185, c.v6)),
+			} {
+				if got != want {
+					t.Errorf("%s port %d: fragment in shard %d, want %d", c.name, sport, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestMergeShardLogs(t *testing.T) {
+	header := "#separator \\x09\n#set_separator\t,\n#path\tconn\n#open\t%s\n#fields\tts\tuid\n#types\ttime\tstring\n"
+	dirs := []string{t.TempDir(), t.TempDir(), t.TempDir()}
+	writeTestFile(t, dirs[0], "conn.log", fmt.Sprintf(header, "2023-11-14-22-13-25")+"1.0\tCa\n3.0\tCc\n4.0\tCd\n#close\t2023-11-14-22-14-20\n")
+	writeTestFile(t, dirs[1], "conn.log", fmt.Sprintf(header, "2023-11-14-22-13-20")+"2.0\tCb\n5.0\tCe\n#close\t2023-11-14-22-14-30\n")
+	writeTestFile(t, dirs[2], "dns.log", "#separator \\x09\n#path\tdns\n#fields\tts\tquery\n0.5\texample.com\n")
+	runDir := t.TempDir()
+
+	if err := MergeShardLogs(dirs, runDir, 0); err != nil {
+		t.Fatal(err)
+	}
+	lines := readLines(t, filepath.Join(runDir, "conn.log"))
+	want := []string{
+		"#separator \\x09", "#set_separator\t,", "#path\tconn", "#open\t2023-11-14-22-13-20", "#fields\tts\tuid", "#types\ttime\tstring",
+		"1.0\tCa", "2.0\tCb", "3.0\tCc", "4.0\tCd", "5.0\tCe",
+		"#close\t2023-11-14-22-14-30",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("conn.log =\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+	// A log only one shard wrote is copied as is.
+	if lines := readLines(t, filepath.Join(runDir, "dns.log")); len(lines) != 4 || lines[3] != "0.5\texample.com" {
+		t.Errorf("dns.log = %q", lines)
+	}
+
+	// Shards disagreeing on the columns cannot be merged.
+	writeTestFile(t, dirs[2], "conn.log", "#separator \\x09\n#fields\tts\tuid\tproto\n")
+	if err := MergeShardLogs(dirs, t.TempDir(), 0); err == nil {
+		t.Error("expected an error for shards with different columns")
+	}
+}
+
+func TestRunZeekSharded(t *testing.T) {
+	dir := t.TempDir()
+	path, count := writeShardTestPCAP(t, dir)
+
+	// A fake Zeek writes one conn.log row per packet.
+	var runs atomic.Int32
+	run := func(pcap, logDir string) error {
+		runs.Add(1)
+		var b strings.Builder
+		b.WriteString("#separator \\x09\n#path\tconn\n#fields\tts\tflow\n")
+		for i, flow := range shardFlows(t, pcap) {
+			fmt.Fprintf(&b, "%d\t%s\n", i, flow)
+		}
+		return os.WriteFile(filepath.Join(logDir, "conn.log"), []byte(b.String()), 0o644)
+	}
+
+	// Below the size threshold the PCAP is run whole.
+	if err := RunZeekSharded(path, dir, ProcessOptions{Shards: 4, ShardMinBytes: 1 << 30}, run); err != nil || runs.Load() != 1 {
+		t.Fatalf("%d runs, err %v", runs.Load(), err)
+	}
+
+	runs.Store(0)
+	if err := RunZeekSharded(path, dir, ProcessOptions{Shards: 4}, run); err != nil {
+		t.Fatal(err)
+	}
+	if runs.Load() != 4 {
+		t.Errorf("%d runs, want 4", runs.Load())
+	}
+	if lines := readLines(t, filepath.Join(dir, "conn.log")); len(lines) != 3+count {
+		t.Errorf("merged conn.log has %d lines, want %d", len(lines), 3+count)
+	}
+	if entries, _ := filepath.Glob(filepath.Join(dir, "shards-*")); len(entries) != 0 {
+		t.Errorf("shards left behind: %v", entries)
+	}
+
+	// A failing shard fails the run.
+	err := RunZeekSharded(path, dir, ProcessOptions{Shards: 2}, func(pcap, logDir string) error {
+		return fmt.Errorf("zeek crashed")
+	})
+	if err == nil || !strings.Contains(err.Error(), "zeek crashed") {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -1,13 +1,11 @@
 package types
 
 import (
-	"fmt"
 	"log"
 	"net"
-	"os"
-	"path/filepath"
-	"strconv"
 	"strings"
+
+	"EnigmaNetz/Enigma-Go-Sensor/internal/policy"
 )
 
 // addressFields is the set of Zeek log column names that hold a single IP
@@ -31,143 +29,160 @@ var addressFields = map[string]bool{
 // by the log's #set_separator) which may include IP addresses. dns.log "answers"
 // is the case that matters: a DNS reply resolving to an excluded-subnet IP would
 // otherwise leak that internal address even when the client/resolver are not in
-// an excluded subnet. Each element is checked individually; non-IP members
-// (CNAMEs, MX targets, TXT data, ...) are ignored.
+// an excluded subnet. intel.log "seen.indicator" is a single value, but is
+// checked the same way since it holds an address only for address
+// indicators. Each element is checked individually; non-IP members (CNAMEs,
+// MX targets, TXT data, ...) are ignored.
 var addressSetFields = map[string]bool{
-	"answers": true,
+	"answers":        true,
+	"seen.indicator": true,
 }
 
-// zeekUnsetMarkers are the placeholder tokens Zeek writes for an absent value.
-// They are not addresses and must be skipped, not parsed.
-var zeekUnsetMarkers = map[string]bool{
-	"-":       true,
-	"(empty)": true,
+// derivedFields names, per endpoint address column, the columns computed
+// from that address earlier in the pipeline: the community ID hash of both
+// endpoints and the GeoIP columns of each. They are filled in before filtering
+// and would otherwise keep identifying an endpoint that a policy masked or
+// truncated, so they are unset on any row where the endpoint was rewritten.
+var derivedFields = map[string][]string{
+	"id.orig_h": {communityIDField, "orig_cc"},
+	"id.resp_h": {communityIDField, "resp_cc", "resp_asn", "resp_as_org"},
+}
+
+// Prefix lengths used by policy.SubnetTruncate.
+const (
+	truncatePrefixV4 = 24
+	truncatePrefixV6 = 64
+)
+
+// subnetPolicy pairs an excluded subnet with the action applied to addresses
+// inside it.
+type subnetPolicy struct {
+	net    *net.IPNet
+	action string
 }
 
 // FilterExcludedSubnets rewrites each of the given Zeek TSV logs in runDir in
-// place, dropping any data row that references an excluded-subnet address —
-// either a source/destination address column (see addressFields) or an IP in a
-// set-valued column such as dns.log "answers" (see addressSetFields). Header/
-// footer lines (#separator, #fields, #types, #open, #close, ...) are preserved
-// verbatim. Missing log files are a no-op (JA3/JA4 may be absent, e.g. on
-// Linux). An empty/whitespace CIDR list turns the feature off.
+// place, applying the per-subnet policy to any data row that references an
+// excluded-subnet address — either a source/destination address column (see
+// addressFields) or an IP in a set-valued column such as dns.log "answers" (see
+// addressSetFields). A row is dropped if any of its addresses falls under a
+// drop policy; otherwise matching addresses are masked or truncated in place.
+// When subnets overlap, the most specific (longest prefix) entry wins, and
+// columns derived from a rewritten endpoint (see derivedFields) are unset. An
+// empty/whitespace CIDR list turns the feature off.
 //
-// Filtering is a "do not upload it" guarantee, so any read/parse/write failure
-// on a present log is returned as an error rather than swallowed — the caller
-// aborts the capture window rather than risk uploading unfiltered data.
-func FilterExcludedSubnets(runDir string, logFiles []string, excludedCIDRs []string) error {
-	nets := parseCIDRs(excludedCIDRs)
-	if len(nets) == 0 {
-		return nil
-	}
-	for _, name := range logFiles {
-		if err := filterLogFile(filepath.Join(runDir, name), nets); err != nil {
-			return fmt.Errorf("filter %s: %w", name, err)
-		}
-	}
-	return nil
+// It is FilterLogs with only the subnet filter enabled; see FilterLogs for the
+// header preservation, missing-file and fail-closed error contract.
+func FilterExcludedSubnets(runDir string, logFiles []string, excludedCIDRs []string) (map[string]FilterStats, error) {
+	return FilterLogs(runDir, logFiles, FilterOptions{ExcludedSubnets: excludedCIDRs})
 }
 
-// parseCIDRs converts CIDR strings to *net.IPNet. Malformed entries are skipped
-// with a warning; config validation is the authoritative gate, this keeps the
-// filter robust when called directly (e.g. in tests).
-func parseCIDRs(cidrs []string) []*net.IPNet {
-	var nets []*net.IPNet
-	for _, c := range cidrs {
-		c = strings.TrimSpace(c)
-		if c == "" {
+// parseSubnetPolicies converts "CIDR[=action]" entries to subnet policies.
+// Malformed entries are skipped with a warning; config validation is the
+// authoritative gate, this keeps the filter robust when called directly (e.g.
+// in tests).
+func parseSubnetPolicies(entries []string) []subnetPolicy {
+	var policies []subnetPolicy
+	for _, e := range entries {
+		if strings.TrimSpace(e) == "" {
 			continue
 		}
-		_, n, err := net.ParseCIDR(c)
+		cidr, action := policy.SplitSubnet(e)
+		_, n, err := net.ParseCIDR(cidr)
 		if err != nil {
-			log.Printf("[processor] Warning: skipping invalid excluded subnet %q: %v", c, err)
+			log.Printf("[processor] Warning: skipping invalid excluded subnet %q: %v", e, err)
+			continue
+		}
+		if !policy.ValidSubnetAction(action) {
+			log.Printf("[processor] Warning: skipping excluded subnet %q: unknown action %q", e, action)
 			continue
 		}
-		nets = append(nets, n)
+		policies = append(policies, subnetPolicy{net: n, action: action})
 	}
-	return nets
+	return policies
 }
 
-// filterLogFile drops excluded rows from a single Zeek TSV log, in place.
-func filterLogFile(logPath string, nets []*net.IPNet) error {
-	data, err := os.ReadFile(logPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
-		return fmt.Errorf("read: %w", err)
-	}
-
-	lines := strings.Split(string(data), "\n")
+// subnetFilter is the rowFilter for excluded_subnets policies.
+type subnetFilter struct {
+	policies []subnetPolicy
+}
 
-	sep := "\t"
-	setSep := ","
+// bind locates the single-IP and set-of-IP columns of a log by name, and the
+// derivedFields of its endpoint columns.
+func (f subnetFilter) bind(h *logHeader, _ *FilterStats) func([]string) rowAction {
 	var addrIdx []int // single-IP columns
 	var setIdx []int  // set-of-values columns (e.g. dns answers)
-	for _, line := range lines {
-		if strings.HasPrefix(line, "#separator") {
-			sep = parseSeparator(line)
-			continue
+	type derived struct {
+		addr int
+		cols []int
+	}
+	var derivedIdx []derived
+	for i, name := range h.fields {
+		switch {
+		case addressFields[name]:
+			addrIdx = append(addrIdx, i)
+		case addressSetFields[name]:
+			setIdx = append(setIdx, i)
 		}
-		if strings.HasPrefix(line, "#set_separator") {
-			// Delimited by the main separator, which is already known by now.
-			if parts := strings.Split(line, sep); len(parts) >= 2 && parts[1] != "" {
-				setSep = parts[1]
+		d := derived{addr: i}
+		for _, field := range derivedFields[name] {
+			if j := h.index(field); j >= 0 {
+				d.cols = append(d.cols, j)
 			}
-			continue
 		}
-		if strings.HasPrefix(line, "#fields") {
-			// Drop the "#fields" token so the remaining indices align with data columns.
-			fields := strings.Split(line, sep)[1:]
-			for i, f := range fields {
-				switch {
-				case addressFields[f]:
-					addrIdx = append(addrIdx, i)
-				case addressSetFields[f]:
-					setIdx = append(setIdx, i)
-				}
-			}
-			break
+		if len(d.cols) > 0 {
+			derivedIdx = append(derivedIdx, d)
 		}
 	}
-	// No #fields header, or no address columns in this log: nothing to filter.
 	if len(addrIdx) == 0 && len(setIdx) == 0 {
 		return nil
 	}
-
-	out := make([]string, 0, len(lines))
-	dropped := 0
-	for _, line := range lines {
-		// Preserve every header/footer line and the trailing empty element
-		// (which round-trips a final newline) exactly as-is.
-		if line == "" || strings.HasPrefix(line, "#") {
-			out = append(out, line)
-			continue
+	before := make([]string, len(derivedIdx))
+	return func(cols []string) rowAction {
+		for i, d := range derivedIdx {
+			before[i] = column(cols, d.addr)
 		}
-		if rowExcluded(strings.Split(line, sep), addrIdx, setIdx, setSep, nets) {
-			dropped++
-			continue
+		action := applyRowPolicies(cols, addrIdx, setIdx, h.setSep, f.policies)
+		if action != rowMasked {
+			return action
 		}
-		out = append(out, line)
-	}
-
-	if dropped == 0 {
-		return nil
-	}
-	if err := os.WriteFile(logPath, []byte(strings.Join(out, "\n")), 0644); err != nil {
-		return fmt.Errorf("write: %w", err)
+		for i, d := range derivedIdx {
+			if column(cols, d.addr) == before[i] {
+				continue
+			}
+			for _, j := range d.cols {
+				if j < len(cols) {
+					cols[j] = "-"
+				}
+			}
+		}
+		return action
 	}
-	log.Printf("[processor] Subnet filter dropped %d row(s) from %s", dropped, filepath.Base(logPath))
-	return nil
 }
 
-// rowExcluded reports whether the row references an excluded-subnet IP in any
-// single-IP column (addrIdx) or any set-valued column (setIdx, split on setSep).
-func rowExcluded(cols []string, addrIdx, setIdx []int, setSep string, nets []*net.IPNet) bool {
+// applyRowPolicies checks every single-IP column (addrIdx) and every element of
+// every set-valued column (setIdx, split on setSep) against the policies. Any
+// drop match drops the row; otherwise mask/truncate matches are rewritten in
+// cols. cols is only modified when the result is rowMasked.
+func applyRowPolicies(cols []string, addrIdx, setIdx []int, setSep string, policies []subnetPolicy) rowAction {
+	type edit struct {
+		col  int
+		elem int // -1 for single-IP columns
+		val  string
+	}
+	var edits []edit
 	for _, idx := range addrIdx {
-		if idx < len(cols) && ipInNets(cols[idx], nets) {
-			return true
+		if idx >= len(cols) {
+			continue
+		}
+		p := matchPolicy(cols[idx], policies)
+		if p == nil {
+			continue
+		}
+		if p.action == policy.SubnetDrop {
+			return rowDropped
 		}
+		edits = append(edits, edit{col: idx, elem: -1, val: rewriteAddr(cols[idx], p.action)})
 	}
 	for _, idx := range setIdx {
 		if idx >= len(cols) {
@@ -177,51 +192,73 @@ func rowExcluded(cols []string, addrIdx, setIdx []int, setSep string, nets []*ne
 		if cell == "" || zeekUnsetMarkers[cell] {
 			continue
 		}
-		for _, v := range strings.Split(cell, setSep) {
-			if ipInNets(v, nets) {
-				return true
+		for i, v := range strings.Split(cell, setSep) {
+			p := matchPolicy(v, policies)
+			if p == nil {
+				continue
+			}
+			if p.action == policy.SubnetDrop {
+				return rowDropped
 			}
+			edits = append(edits, edit{col: idx, elem: i, val: rewriteAddr(v, p.action)})
 		}
 	}
-	return false
+	if len(edits) == 0 {
+		return rowPassed
+	}
+	for _, e := range edits {
+		if e.elem < 0 {
+			cols[e.col] = e.val
+			continue
+		}
+		elems := strings.Split(cols[e.col], setSep)
+		elems[e.elem] = e.val
+		cols[e.col] = strings.Join(elems, setSep)
+	}
+	return rowMasked
 }
 
-// ipInNets reports whether val is a valid IP inside one of the excluded subnets.
-// Zeek unset markers and non-IP values (e.g. hostnames in a dns answers set)
-// return false.
-func ipInNets(val string, nets []*net.IPNet) bool {
+// matchPolicy returns the most specific policy whose subnet contains val, or
+// nil if val is not an IP or falls outside every subnet.
+func matchPolicy(val string, policies []subnetPolicy) *subnetPolicy {
 	if val == "" || zeekUnsetMarkers[val] {
-		return false
+		return nil
 	}
 	ip := net.ParseIP(val)
 	if ip == nil {
-		return false
+		return nil
 	}
-	for _, n := range nets {
-		if n.Contains(ip) {
-			return true
+	var best *subnetPolicy
+	bestOnes := -1
+	for i := range policies {
+		if !policies[i].net.Contains(ip) {
+			continue
+		}
+		if ones, _ := policies[i].net.Mask.Size(); ones > bestOnes {
+			best, bestOnes = &policies[i], ones
 		}
 	}
-	return false
+	return best
 }
 
-// parseSeparator decodes a Zeek "#separator" header line. Zeek writes the
-// separator as an escape (e.g. "#separator \x09" for tab) using a literal space
-// delimiter, since the separator cannot delimit its own definition. Defaults to
-// tab if the line is malformed.
-func parseSeparator(line string) string {
-	parts := strings.SplitN(line, " ", 2)
-	if len(parts) < 2 {
-		return "\t"
+// rewriteAddr applies a mask or truncate action to a textual IP address.
+func rewriteAddr(val, action string) string {
+	ip := net.ParseIP(val)
+	if ip == nil {
+		return val
 	}
-	sep := strings.TrimSpace(parts[1])
-	if strings.HasPrefix(sep, `\x`) {
-		if b, err := strconv.ParseUint(sep[2:], 16, 8); err == nil {
-			return string(rune(b))
+	v4 := ip.To4()
+	switch action {
+	case policy.SubnetMask:
+		if v4 != nil {
+			return net.IPv4zero.String()
 		}
+		return net.IPv6unspecified.String()
+	case policy.SubnetTruncate:
+		if v4 != nil {
+			return v4.Mask(net.CIDRMask(truncatePrefixV4, 32)).String()
+		}
+		return ip.Mask(net.CIDRMask(truncatePrefixV6, 128)).String()
 	}
-	if sep == "" {
-		return "\t"
-	}
-	return sep
+	return val
 }
@@ -1,8 +1,10 @@
 package types
 
 import (
+	"net/netip"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -56,6 +58,23 @@ func readDataRows(t *testing.T, path string) []string {
 	return out
 }
 
+// readHeaderLine returns the #name line of a log file's header, e.g. its
+// #fields or #types line.
+func readHeaderLine(t *testing.T, path, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "#"+name+"\t") {
+			return line
+		}
+	}
+	t.Fatalf("%s has no #%s line", path, name)
+	return ""
+}
+
 func TestFilterExcludedSubnets_ConnDropsBySrcOrDst(t *testing.T) {
 	dir := t.TempDir()
 	hdr := zeekHeader("conn", "ts", "uid", "id.orig_h", "id.orig_p", "id.resp_h", "id.resp_p", "proto")
@@ -65,7 +84,7 @@ func TestFilterExcludedSubnets_ConnDropsBySrcOrDst(t *testing.T) {
 		row("3", "CC", "192.168.1.5", "5555", "8.8.8.8", "443", "tcp"),  // neither -> keep
 	)
 
-	if err := FilterExcludedSubnets(dir, []string{"conn.log"}, []string{"10.0.0.0/8"}); err != nil {
+	if _, err := FilterExcludedSubnets(dir, []string{"conn.log"}, []string{"10.0.0.0/8"}); err != nil {
 		t.Fatalf("FilterExcludedSubnets: %v", err)
 	}
 
@@ -91,7 +110,7 @@ func TestFilterExcludedSubnets_DHCPAddressColumns(t *testing.T) {
 		row("3", "DC", "aa:bb:cc:dd:ee:03", "192.168.1.9", "192.168.1.1", "10.9.9.9", "-", "3600"),
 	)
 
-	if err := FilterExcludedSubnets(dir, []string{"dhcp.log"}, []string{"10.0.0.0/8"}); err != nil {
+	if _, err := FilterExcludedSubnets(dir, []string{"dhcp.log"}, []string{"10.0.0.0/8"}); err != nil {
 		t.Fatalf("FilterExcludedSubnets: %v", err)
 	}
 
@@ -109,7 +128,7 @@ func TestFilterExcludedSubnets_PreservesHeadersAndFooter(t *testing.T) {
 	)
 	before, _ := os.ReadFile(path)
 
-	if err := FilterExcludedSubnets(dir, []string{"conn.log"}, []string{"10.0.0.0/8"}); err != nil {
+	if _, err := FilterExcludedSubnets(dir, []string{"conn.log"}, []string{"10.0.0.0/8"}); err != nil {
 		t.Fatalf("FilterExcludedSubnets: %v", err)
 	}
 
@@ -143,7 +162,7 @@ func TestFilterExcludedSubnets_FeatureOffLeavesFileUnchanged(t *testing.T) {
 	before, _ := os.ReadFile(path)
 
 	// Empty CIDR list = feature off: no rows should be dropped.
-	if err := FilterExcludedSubnets(dir, []string{"conn.log"}, nil); err != nil {
+	if _, err := FilterExcludedSubnets(dir, []string{"conn.log"}, nil); err != nil {
 		t.Fatalf("FilterExcludedSubnets: %v", err)
 	}
 
@@ -156,7 +175,7 @@ func TestFilterExcludedSubnets_FeatureOffLeavesFileUnchanged(t *testing.T) {
 func TestFilterExcludedSubnets_MissingFileIsNoOp(t *testing.T) {
 	dir := t.TempDir()
 	// ja3_ja4.log / ja4s.log frequently absent (e.g. on Linux). Must not error.
-	if err := FilterExcludedSubnets(dir, []string{"ja3_ja4.log", "ja4s.log"}, []string{"10.0.0.0/8"}); err != nil {
+	if _, err := FilterExcludedSubnets(dir, []string{"ja3_ja4.log", "ja4s.log"}, []string{"10.0.0.0/8"}); err != nil {
 		t.Fatalf("expected no-op for missing files, got %v", err)
 	}
 }
@@ -175,7 +194,7 @@ func TestFilterExcludedSubnets_DNSAnswers(t *testing.T) {
 		row("3", "DNSC", "192.168.1.10", "5300", "192.168.1.1", "53", "udp", "x.corp", "A", "-"),
 	)
 
-	if err := FilterExcludedSubnets(dir, []string{"dns.log"}, []string{"10.0.0.0/8"}); err != nil {
+	if _, err := FilterExcludedSubnets(dir, []string{"dns.log"}, []string{"10.0.0.0/8"}); err != nil {
 		t.Fatalf("FilterExcludedSubnets: %v", err)
 	}
 
@@ -208,7 +227,7 @@ func TestFilterExcludedSubnets_DNSAnswersCustomSetSeparator(t *testing.T) {
 		row("2", "S2", "192.168.1.10", "192.168.1.1", "8.8.8.8;1.1.1.1"),  // both public -> keep
 	)
 
-	if err := FilterExcludedSubnets(dir, []string{"dns.log"}, []string{"10.0.0.0/8"}); err != nil {
+	if _, err := FilterExcludedSubnets(dir, []string{"dns.log"}, []string{"10.0.0.0/8"}); err != nil {
 		t.Fatalf("FilterExcludedSubnets: %v", err)
 	}
 
@@ -226,7 +245,7 @@ func TestFilterExcludedSubnets_IPv6(t *testing.T) {
 		row("2", "V6B", "2606:4700::1", "1234", "2001:4860:4860::8888", "53", "udp"), // out of range -> keep
 	)
 
-	if err := FilterExcludedSubnets(dir, []string{"conn.log"}, []string{"fd00::/8"}); err != nil {
+	if _, err := FilterExcludedSubnets(dir, []string{"conn.log"}, []string{"fd00::/8"}); err != nil {
 		t.Fatalf("FilterExcludedSubnets: %v", err)
 	}
 
@@ -246,7 +265,7 @@ func TestFilterExcludedSubnets_ReadErrorAborts(t *testing.T) {
 	if err := os.Mkdir(filepath.Join(dir, "conn.log"), 0755); err != nil {
 		t.Fatal(err)
 	}
-	if err := FilterExcludedSubnets(dir, []string{"conn.log"}, []string{"10.0.0.0/8"}); err == nil {
+	if _, err := FilterExcludedSubnets(dir, []string{"conn.log"}, []string{"10.0.0.0/8"}); err == nil {
 		t.Fatal("expected an error when a log cannot be read (fail-closed), got nil")
 	}
 }
@@ -259,7 +278,7 @@ func TestFilterExcludedSubnets_MultipleCIDRsAndTLSLog(t *testing.T) {
 		row("2", "JB", "203.0.113.7", "1.1.1.1", "abc", "def"), // out of range -> keep
 	)
 
-	if err := FilterExcludedSubnets(dir, []string{"ja3_ja4.log"}, []string{"10.0.0.0/8", "172.20.10.0/24"}); err != nil {
+	if _, err := FilterExcludedSubnets(dir, []string{"ja3_ja4.log"}, []string{"10.0.0.0/8", "172.20.10.0/24"}); err != nil {
 		t.Fatalf("FilterExcludedSubnets: %v", err)
 	}
 
@@ -268,3 +287,135 @@ func TestFilterExcludedSubnets_MultipleCIDRsAndTLSLog(t *testing.T) {
 		t.Fatalf("expected only row JB kept, got %v", rows)
 	}
 }
+
+func TestFilterExcludedSubnets_MaskAndTruncatePolicies(t *testing.T) {
+	dir := t.TempDir()
+	hdr := zeekHeader("conn", "ts", "uid", "id.orig_h", "id.orig_p", "id.resp_h", "id.resp_p", "proto")
+	path := writeLog(t, dir, "conn.log", hdr,
+		row("1", "MA", "192.168.1.5", "5555", "10.1.2.3", "443", "tcp"),           // resp masked
+		row("2", "MB", "172.20.10.77", "5555", "8.8.8.8", "53", "udp"),            // orig truncated
+		row("3", "MC", "172.20.10.77", "5555", "10.9.9.9", "443", "tcp"),          // both rewritten
+		row("4", "MD", "fd00::1234", "1234", "2001:4860:4860::8888", "53", "udp"), // v6 truncated
+		row("5", "ME", "192.168.1.5", "5555", "8.8.8.8", "443", "tcp"),            // untouched
+	)
+
+	report, err := FilterExcludedSubnets(dir, []string{"conn.log"},
+		[]string{"10.0.0.0/8=mask", "172.20.10.0/24=truncate-to-prefix", "fd00::/8=truncate-to-prefix"})
+	if err != nil {
+		t.Fatalf("FilterExcludedSubnets: %v", err)
+	}
+
+	want := []string{
+		row("1", "MA", "192.168.1.5", "5555", "0.0.0.0", "443", "tcp"),
+		row("2", "MB", "172.20.10.0", "5555", "8.8.8.8", "53", "udp"),
+		row("3", "MC", "172.20.10.0", "5555", "0.0.0.0", "443", "tcp"),
+		row("4", "MD", "fd00::", "1234", "2001:4860:4860::8888", "53", "udp"),
+		row("5", "ME", "192.168.1.5", "5555", "8.8.8.8", "443", "tcp"),
+	}
+	rows := readDataRows(t, path)
+	if strings.Join(rows, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected rows:\n got %v\nwant %v", rows, want)
+	}
+	if got := report["conn.log"]; !reflect.DeepEqual(got, FilterStats{Dropped: 0, Masked: 4, Passed: 1}) {
+		t.Errorf("unexpected stats %+v", got)
+	}
+}
+
+// TestFilterExcludedSubnets_MaskUnsetsCommunityID checks that community_id,
+// hashed from the real addresses before filtering, does not survive on a row
+// whose endpoint was masked or truncated.
+func TestFilterExcludedSubnets_MaskUnsetsCommunityID(t *testing.T) {
+	dir := t.TempDir()
+	hdr := zeekHeader("conn", "ts", "uid", "id.orig_h", "id.orig_p", "id.resp_h", "id.resp_p", "proto")
+	path := writeLog(t, dir, "conn.log", hdr,
+		row("1", "MA", "192.168.1.5", "5555", "10.1.2.3", "443", "tcp"),
+		row("2", "MB", "172.20.10.77", "5555", "8.8.8.8", "53", "udp"),
+		row("3", "MC", "192.168.1.5", "5555", "8.8.8.8", "443", "tcp"),
+	)
+	if err := AddCommunityID(dir, []string{"conn.log"}, 0, 0); err != nil {
+		t.Fatalf("AddCommunityID: %v", err)
+	}
+	if _, err := FilterExcludedSubnets(dir, []string{"conn.log"},
+		[]string{"10.0.0.0/8=mask", "172.20.10.0/24=truncate-to-prefix"}); err != nil {
+		t.Fatalf("FilterExcludedSubnets: %v", err)
+	}
+
+	rows := readDataRows(t, path)
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(rows))
+	}
+	for i, r := range rows[:2] {
+		if !strings.HasSuffix(r, "\t-") {
+			t.Errorf("masked row %d kept its community_id: %q", i, r)
+		}
+	}
+	want := CommunityID(0, protoTCP, netip.MustParseAddr("192.168.1.5"), netip.MustParseAddr("8.8.8.8"), 5555, 443)
+	if !strings.HasSuffix(rows[2], "\t"+want) {
+		t.Errorf("untouched row = %q, want community_id %s", rows[2], want)
+	}
+}
+
+func TestFilterExcludedSubnets_DropWinsOverMaskInSameRow(t *testing.T) {
+	dir := t.TempDir()
+	hdr := zeekHeader("dns", "ts", "uid", "id.orig_h", "id.resp_h", "answers")
+	path := writeLog(t, dir, "dns.log", hdr,
+		// client masked, but an answer is in a drop subnet -> whole row dropped
+		row("1", "D1", "10.1.1.1", "192.168.1.1", "93.184.216.34,172.16.0.9"),
+		// only a masked answer -> kept with that element masked
+		row("2", "D2", "192.168.1.10", "192.168.1.1", "cname.example.com,10.2.2.2"),
+	)
+
+	report, err := FilterExcludedSubnets(dir, []string{"dns.log"}, []string{"10.0.0.0/8=mask", "172.16.0.0/12"})
+	if err != nil {
+		t.Fatalf("FilterExcludedSubnets: %v", err)
+	}
+
+	rows := readDataRows(t, path)
+	want := row("2", "D2", "192.168.1.10", "192.168.1.1", "cname.example.com,0.0.0.0")
+	if len(rows) != 1 || rows[0] != want {
+		t.Fatalf("expected only %q, got %v", want, rows)
+	}
+	if got := report["dns.log"]; !reflect.DeepEqual(got, FilterStats{Dropped: 1, Masked: 1, Passed: 0}) {
+		t.Errorf("unexpected stats %+v", got)
+	}
+}
+
+func TestFilterExcludedSubnets_MostSpecificPolicyWins(t *testing.T) {
+	dir := t.TempDir()
+	hdr := zeekHeader("conn", "ts", "uid", "id.orig_h", "id.resp_h")
+	path := writeLog(t, dir, "conn.log", hdr,
+		row("1", "P1", "10.1.2.3", "8.8.8.8"),  // only in 10/8 -> dropped
+		row("2", "P2", "10.50.0.7", "8.8.8.8"), // in 10.50/16 too -> masked
+	)
+
+	// Order must not matter: the /16 mask carve-out beats the /8 drop.
+	report, err := FilterExcludedSubnets(dir, []string{"conn.log"}, []string{"10.50.0.0/16=mask", "10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("FilterExcludedSubnets: %v", err)
+	}
+
+	rows := readDataRows(t, path)
+	if len(rows) != 1 || rows[0] != row("2", "P2", "0.0.0.0", "8.8.8.8") {
+		t.Fatalf("expected only masked P2, got %v", rows)
+	}
+	if got := report["conn.log"]; !reflect.DeepEqual(got, FilterStats{Dropped: 1, Masked: 1}) {
+		t.Errorf("unexpected stats %+v", got)
+	}
+}
+
+func TestFilterExcludedSubnets_ReportOmitsMissingLogs(t *testing.T) {
+	dir := t.TempDir()
+	hdr := zeekHeader("conn", "ts", "uid", "id.orig_h", "id.resp_h")
+	writeLog(t, dir, "conn.log", hdr, row("1", "R1", "192.168.1.1", "8.8.8.8"))
+
+	report, err := FilterExcludedSubnets(dir, []string{"conn.log", "ja4s.log"}, []string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("FilterExcludedSubnets: %v", err)
+	}
+	if _, ok := report["ja4s.log"]; ok {
+		t.Errorf("missing log should not appear in the report: %v", report)
+	}
+	if got := report["conn.log"]; !reflect.DeepEqual(got, FilterStats{Passed: 1}) {
+		t.Errorf("unexpected stats %+v", got)
+	}
+}
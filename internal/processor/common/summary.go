@@ -0,0 +1,403 @@
+package types
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SummaryLogFile is the per-window traffic summary a run writes beside the
+// Zeek logs when summarization is enabled. With SummaryOptions.Only it is
+// uploaded instead of the logs it summarizes.
+const SummaryLogFile = "summary.log"
+
+// Kinds of summary row.
+const (
+	// SummaryTotal is the one row totalling the window.
+	SummaryTotal = "total"
+	// SummaryProto is one row per transport protocol (tcp, udp, icmp).
+	SummaryProto = "proto"
+	// SummaryService is one row per application protocol Zeek identified.
+	SummaryService = "service"
+	// SummaryHost is one row per internal host, counted from its side.
+	SummaryHost = "host"
+	// SummaryTalker is one row per top originator/responder pair by bytes.
+	SummaryTalker = "talker"
+)
+
+// SummaryOptions configure SummarizeTraffic.
+type SummaryOptions struct {
+	// TopTalkers is how many originator/responder pairs, by bytes, are
+	// listed.
+	TopTalkers int
+	// Only uploads the summary instead of the conn, dns, dhcp, ja3_ja4 and
+	// ja4s logs. The derived logs (assets, device events, beacons, DNS
+	// anomalies, encrypted DNS, intel) are still uploaded.
+	Only bool
+}
+
+// summaryUnknownService names the service of connections Zeek identified no
+// application protocol for.
+const summaryUnknownService = "unknown"
+
+// The summary keeps at most this many internal hosts and pairs, and
+// external destinations per host, in a window, so a scan or flood cannot
+// exhaust memory. Connections beyond the caps still count towards the
+// totals.
+const (
+	maxSummaryHosts        = 65536
+	maxSummaryPairs        = 200000
+	maxSummaryDestinations = 4096
+)
+
+// trafficCounts are the connection, byte and packet totals of a summary row.
+// Sent and received are from the host's side, or the originator's for the
+// total, protocol, service and talker rows.
+// They are estimates of the unsampled traffic, so they are kept unrounded
+// until the row is written.
+type trafficCounts struct {
+	conns                float64
+	bytesSent, bytesRecv float64
+	pktsSent, pktsRecv   float64
+	externalDestinations map[string]struct{} // distinct external responders, capped
+}
+
+// add counts one connection, weighted by the inverse of its sampling rate.
+func (c *trafficCounts) add(weight float64, sent, recv, pktsSent, pktsRecv int64) {
+	c.conns += weight
+	c.bytesSent += weight * float64(sent)
+	c.bytesRecv += weight * float64(recv)
+	c.pktsSent += weight * float64(pktsSent)
+	c.pktsRecv += weight * float64(pktsRecv)
+}
+
+func (c *trafficCounts) addDestination(addr string, limit int) {
+	if c.externalDestinations == nil {
+		c.externalDestinations = make(map[string]struct{})
+	}
+	if _, ok := c.externalDestinations[addr]; ok || len(c.externalDestinations) >= limit {
+		return
+	}
+	c.externalDestinations[addr] = struct{}{}
+}
+
+// SummaryRow is one row of SummaryLogFile.
+type SummaryRow struct {
+	Kind string // SummaryTotal, SummaryProto, SummaryService, SummaryHost or SummaryTalker
+	// Host is the internal host (host), or the originator (talker).
+	Host string
+	// Peer is the responder (talker).
+	Peer string
+	// Name is the protocol (proto) or service (service).
+	Name                 string
+	Connections          int64
+	BytesSent            int64
+	BytesReceived        int64
+	PacketsSent          int64
+	PacketsReceived      int64
+	ExternalDestinations int // distinct external responders (total, host)
+}
+
+// TrafficSummary is the summary SummarizeTraffic computes for a window.
+type TrafficSummary struct {
+	Start, End time.Time
+	Rows       []SummaryRow
+}
+
+// SummarizeTraffic aggregates runDir's conn.log into SummaryLogFile: the
+// window's connection, byte and packet totals, the protocol and service mix,
+// per internal host totals and distinct external destinations, and the top
+// talking pairs. Internal hosts are those in opts.MonitoredSubnets, or, when
+// none are set, private, loopback and link-local addresses; external
+// destinations are the other unicast responders. Bytes are IP bytes, so they
+// include headers, when Zeek logged them. A row sampled at a sample_rate of r
+// percent counts 100/r times, so the totals estimate the traffic before
+// sampling; distinct destinations are only those seen. It runs after FilterLogs so the
+// summary never counts what the full logs would not have uploaded, and does
+// nothing when opts.Summary is nil. It returns the number of rows, 0 when
+// conn.log does not exist.
+func SummarizeTraffic(runDir string, opts ProcessOptions) (int, error) {
+	if opts.Summary == nil {
+		return 0, nil
+	}
+	summary, present, err := summarizeConnLog(filepath.Join(runDir, "conn.log"), opts)
+	if err != nil || !present {
+		return 0, err
+	}
+	if err := WriteSummaryLog(filepath.Join(runDir, SummaryLogFile), summary); err != nil {
+		return 0, err
+	}
+	return len(summary.Rows), nil
+}
+
+// summarizeConnLog computes the TrafficSummary of the conn.log at path.
+func summarizeConnLog(path string, opts ProcessOptions) (TrafficSummary, bool, error) {
+	internal := internalAddrFunc(opts.MonitoredSubnets)
+	var (
+		summary  TrafficSummary
+		total    trafficCounts
+		protos   = make(map[string]*trafficCounts)
+		services = make(map[string]*trafficCounts)
+		hosts    = make(map[string]*trafficCounts)
+		pairs    = make(map[[2]string]*trafficCounts)
+	)
+	counts := func(m map[string]*trafficCounts, key string, limit int) *trafficCounts {
+		c := m[key]
+		if c == nil && len(m) < limit {
+			c = &trafficCounts{}
+			m[key] = c
+		}
+		return c
+	}
+
+	present, err := scanLog(path, opts.MemoryLimit, func(h *logHeader) func([]string) {
+		tsIdx, durIdx := h.index("ts"), h.index("duration")
+		origIdx, respIdx := h.index("id.orig_h"), h.index("id.resp_h")
+		protoIdx, serviceIdx := h.index("proto"), h.index("service")
+		origBytesIdx, respBytesIdx := h.index("orig_ip_bytes"), h.index("resp_ip_bytes")
+		if origBytesIdx < 0 || respBytesIdx < 0 {
+			origBytesIdx, respBytesIdx = h.index("orig_bytes"), h.index("resp_bytes")
+		}
+		origPktsIdx, respPktsIdx := h.index("orig_pkts"), h.index("resp_pkts")
+		rateIdx := h.index("sample_rate")
+		if origIdx < 0 || respIdx < 0 {
+			return nil
+		}
+		return func(cols []string) {
+			ts := zeekTime(column(cols, tsIdx))
+			if !ts.IsZero() {
+				end := ts.Add(zeekDuration(column(cols, durIdx)))
+				if summary.Start.IsZero() || ts.Before(summary.Start) {
+					summary.Start = ts
+				}
+				if end.After(summary.End) {
+					summary.End = end
+				}
+			}
+			w := sampleWeight(column(cols, rateIdx))
+			sent, recv := zeekCount(column(cols, origBytesIdx)), zeekCount(column(cols, respBytesIdx))
+			pktsSent, pktsRecv := zeekCount(column(cols, origPktsIdx)), zeekCount(column(cols, respPktsIdx))
+			total.add(w, sent, recv, pktsSent, pktsRecv)
+
+			proto := column(cols, protoIdx)
+			if zeekUnsetMarkers[proto] {
+				proto = summaryUnknownService
+			}
+			if c := counts(protos, proto, maxSummaryHosts); c != nil {
+				c.add(w, sent, recv, pktsSent, pktsRecv)
+			}
+			service := column(cols, serviceIdx)
+			if zeekUnsetMarkers[service] {
+				service = summaryUnknownService
+			}
+			if c := counts(services, service, maxSummaryHosts); c != nil {
+				c.add(w, sent, recv, pktsSent, pktsRecv)
+			}
+
+			// Addresses masked by the exclusion filters are unspecified and
+			// are not attributed to anyone.
+			orig, origOK := summaryAddr(column(cols, origIdx))
+			resp, respOK := summaryAddr(column(cols, respIdx))
+			origInternal := origOK && internal(orig)
+			respInternal := respOK && internal(resp)
+			respExternal := respOK && !respInternal && resp.IsGlobalUnicast()
+			if origInternal {
+				if c := counts(hosts, orig.String(), maxSummaryHosts); c != nil {
+					c.add(w, sent, recv, pktsSent, pktsRecv)
+					if respExternal {
+						c.addDestination(resp.String(), maxSummaryDestinations)
+					}
+				}
+				if respExternal {
+					total.addDestination(resp.String(), maxSummaryPairs)
+				}
+			}
+			if respInternal {
+				if c := counts(hosts, resp.String(), maxSummaryHosts); c != nil {
+					c.add(w, recv, sent, pktsRecv, pktsSent)
+				}
+			}
+			if origOK && respOK {
+				key := [2]string{orig.String(), resp.String()}
+				if c := pairs[key]; c != nil || len(pairs) < maxSummaryPairs {
+					if c == nil {
+						c = &trafficCounts{}
+						pairs[key] = c
+					}
+					c.add(w, sent, recv, pktsSent, pktsRecv)
+				}
+			}
+		}
+	})
+	if err != nil || !present {
+		return summary, present, err
+	}
+
+	summary.Rows = append(summary.Rows, total.row(SummaryTotal, "", "", ""))
+	summary.Rows = append(summary.Rows, sortedSummaryRows(protos, func(name string, c *trafficCounts) SummaryRow {
+		return c.row(SummaryProto, "", "", name)
+	})...)
+	summary.Rows = append(summary.Rows, sortedSummaryRows(services, func(name string, c *trafficCounts) SummaryRow {
+		return c.row(SummaryService, "", "", name)
+	})...)
+	summary.Rows = append(summary.Rows, sortedSummaryRows(hosts, func(host string, c *trafficCounts) SummaryRow {
+		return c.row(SummaryHost, host, "", "")
+	})...)
+
+	talkers := make([]SummaryRow, 0, len(pairs))
+	for key, c := range pairs {
+		talkers = append(talkers, c.row(SummaryTalker, key[0], key[1], ""))
+	}
+	sortSummaryRows(talkers)
+	if limit := opts.Summary.TopTalkers; limit >= 0 && len(talkers) > limit {
+		talkers = talkers[:limit]
+	}
+	summary.Rows = append(summary.Rows, talkers...)
+
+	log.Printf("[processor] Traffic summary: %.0f connections, %d protocols, %d services, %d internal hosts, %d talkers", total.conns, len(protos), len(services), len(hosts), len(talkers))
+	return summary, true, nil
+}
+
+func (c *trafficCounts) row(kind, host, peer, name string) SummaryRow {
+	return SummaryRow{
+		Kind:                 kind,
+		Host:                 host,
+		Peer:                 peer,
+		Name:                 name,
+		Connections:          int64(math.Round(c.conns)),
+		BytesSent:            int64(math.Round(c.bytesSent)),
+		BytesReceived:        int64(math.Round(c.bytesRecv)),
+		PacketsSent:          int64(math.Round(c.pktsSent)),
+		PacketsReceived:      int64(math.Round(c.pktsRecv)),
+		ExternalDestinations: len(c.externalDestinations),
+	}
+}
+
+// sortedSummaryRows returns a row per entry of m, busiest first.
+func sortedSummaryRows(m map[string]*trafficCounts, row func(string, *trafficCounts) SummaryRow) []SummaryRow {
+	rows := make([]SummaryRow, 0, len(m))
+	for key, c := range m {
+		rows = append(rows, row(key, c))
+	}
+	sortSummaryRows(rows)
+	return rows
+}
+
+// sortSummaryRows orders rows by bytes in both directions, then connections,
+// busiest first, with ties broken by key so the log is stable.
+func sortSummaryRows(rows []SummaryRow) {
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if ab, bb := a.BytesSent+a.BytesReceived, b.BytesSent+b.BytesReceived; ab != bb {
+			return ab > bb
+		}
+		if a.Connections != b.Connections {
+			return a.Connections > b.Connections
+		}
+		if a.Host+a.Name != b.Host+b.Name {
+			return a.Host+a.Name < b.Host+b.Name
+		}
+		return a.Peer < b.Peer
+	})
+}
+
+// internalAddrFunc returns whether an address is an internal host: inside
+// one of monitoredSubnets, or without any, a private, loopback or link-local
+// address.
+func internalAddrFunc(monitoredSubnets []string) func(netip.Addr) bool {
+	nets := parseMonitoredSubnets(monitoredSubnets)
+	if len(nets) == 0 {
+		return func(a netip.Addr) bool {
+			return a.IsPrivate() || a.IsLoopback() || a.IsLinkLocalUnicast()
+		}
+	}
+	return func(a netip.Addr) bool {
+		ip := net.IP(a.AsSlice())
+		for _, n := range nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// sampleWeight is how many connections a conn.log row sampled at the given
+// sample_rate stands for: 100/rate, or 1 when the row was not sampled.
+func sampleWeight(rate string) float64 {
+	r, err := strconv.ParseFloat(rate, 64)
+	if err != nil || r <= 0 || r >= 100 {
+		return 1
+	}
+	return 100 / r
+}
+
+// summaryAddr parses an endpoint address of conn.log; ok is false for unset
+// and masked addresses.
+func summaryAddr(value string) (netip.Addr, bool) {
+	addr, err := netip.ParseAddr(value)
+	if err != nil || addr.IsUnspecified() {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// summaryLogFields are the columns of SummaryLogFile.
+var summaryLogFields = []struct{ name, typ string }{
+	{"ts", "time"},
+	{"duration", "interval"},
+	{"kind", "string"},
+	{"host", "addr"},
+	{"peer", "addr"},
+	{"name", "string"},
+	{"connections", "count"},
+	{"bytes_sent", "count"},
+	{"bytes_received", "count"},
+	{"packets_sent", "count"},
+	{"packets_received", "count"},
+	{"external_destinations", "count"},
+}
+
+// WriteSummaryLog writes summary as a Zeek TSV log at path. Every row
+// carries the window's start time and duration.
+func WriteSummaryLog(path string, summary TrafficSummary) error {
+	var b strings.Builder
+	writeZeekHeader(&b, "summary", summaryLogFields)
+	duration := "-"
+	if !summary.Start.IsZero() {
+		duration = strconv.FormatFloat(summary.End.Sub(summary.Start).Seconds(), 'f', 6, 64)
+	}
+	for _, r := range summary.Rows {
+		external := "-"
+		if r.Kind == SummaryTotal || r.Kind == SummaryHost {
+			external = strconv.Itoa(r.ExternalDestinations)
+		}
+		row := []string{
+			zeekTimeString(summary.Start),
+			duration,
+			r.Kind,
+			zeekString(r.Host),
+			zeekString(r.Peer),
+			zeekString(r.Name),
+			strconv.FormatInt(r.Connections, 10),
+			strconv.FormatInt(r.BytesSent, 10),
+			strconv.FormatInt(r.BytesReceived, 10),
+			strconv.FormatInt(r.PacketsSent, 10),
+			strconv.FormatInt(r.PacketsReceived, 10),
+			external,
+		}
+		b.WriteString(strings.Join(row, "\t") + "\n")
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package types
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// summaryTestConn has two internal hosts talking to the Internet, to each
+// other and to an inbound scanner, and a row whose originator was masked.
+const summaryTestConn = "#separator \\x09\n#set_separator\t,\n#path\tconn\n" +
+	"#fields\tts\tuid\tid.orig_h\tid.orig_p\tid.resp_h\tid.resp_p\tproto\tservice\tduration\torig_bytes\tresp_bytes\torig_pkts\torig_ip_bytes\tresp_pkts\tresp_ip_bytes\n" +
+	"#types\ttime\tstring\taddr\tport\taddr\tport\tenum\tstring\tinterval\tcount\tcount\tcount\tcount\tcount\tcount\n" +
+	"1000.000000\tC1\t192.168.1.10\t5353\t8.8.8.8\t53\tudp\tdns\t0.100000\t32\t92\t1\t60\t1\t120\n" +
+	"1001.000000\tC2\t192.168.1.10\t50000\t93.184.216.34\t443\ttcp\tssl\t5.000000\t600\t48000\t10\t1000\t40\t50000\n" +
+	"1002.000000\tC3\t192.168.1.20\t50001\t93.184.216.34\t443\ttcp\tssl\t2.000000\t300\t1800\t5\t500\t5\t2000\n" +
+	"1003.000000\tC4\t203.0.113.5\t40000\t192.168.1.20\t22\ttcp\t-\t1.000000\t100\t50\t2\t200\t1\t100\n" +
+	"1004.000000\tC5\t192.168.1.10\t50002\t192.168.1.20\t445\ttcp\tsmb\t10.000000\t2000\t3000\t20\t3000\t20\t4000\n" +
+	"1005.000000\tC6\t0.0.0.0\t68\t192.168.1.20\t67\tudp\t-\t-\t-\t-\t1\t10\t0\t0\n" +
+	"#close\t2024-01-01-00-00-00\n"
+
+func TestSummarizeTraffic(t *testing.T) {
+	runDir := t.TempDir()
+	writeTestFile(t, runDir, "conn.log", summaryTestConn)
+
+	if n, err := SummarizeTraffic(runDir, ProcessOptions{}); n != 0 || err != nil {
+		t.Fatalf("disabled: %d, %v", n, err)
+	}
+	n, err := SummarizeTraffic(runDir, ProcessOptions{Summary: &SummaryOptions{TopTalkers: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := readLines(t, filepath.Join(runDir, SummaryLogFile))
+	if lines[5] != "#fields\tts\tduration\tkind\thost\tpeer\tname\tconnections\tbytes_sent\tbytes_received\tpackets_sent\tpackets_received\texternal_destinations" {
+		t.Errorf("fields = %q", lines[5])
+	}
+	var rows []string
+	for _, l := range lines[7:] {
+		if !strings.HasPrefix(l, "1000.000000\t14.000000\t") {
+			t.Errorf("row not stamped with the window: %q", l)
+		}
+		rows = append(rows, strings.TrimPrefix(l, "1000.000000\t14.000000\t"))
+	}
+	want := []string{
+		"total\t-\t-\t-\t6\t4770\t56220\t39\t67\t2",
+		"proto\t-\t-\ttcp\t4\t4700\t56100\t37\t66\t-",
+		"proto\t-\t-\tudp\t2\t70\t120\t2\t1\t-",
+		"service\t-\t-\tssl\t2\t1500\t52000\t15\t45\t-",
+		"service\t-\t-\tsmb\t1\t3000\t4000\t20\t20\t-",
+		"service\t-\t-\tunknown\t2\t210\t100\t3\t1\t-",
+		"service\t-\t-\tdns\t1\t60\t120\t1\t1\t-",
+		"host\t192.168.1.10\t-\t-\t3\t4060\t54120\t31\t61\t2",
+		"host\t192.168.1.20\t-\t-\t4\t4600\t5210\t26\t28\t1",
+		"talker\t192.168.1.10\t93.184.216.34\t-\t1\t1000\t50000\t10\t40\t-",
+		"talker\t192.168.1.10\t192.168.1.20\t-\t1\t3000\t4000\t20\t20\t-",
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows =\n%s\nwant\n%s", strings.Join(rows, "\n"), strings.Join(want, "\n"))
+	}
+	if n != len(want) {
+		t.Errorf("returned %d rows, want %d", n, len(want))
+	}
+
+	// With monitored subnets only they are internal: the scanner's network
+	// is monitored too, so it becomes a host.
+	summary, _, err := summarizeConnLog(filepath.Join(runDir, "conn.log"), ProcessOptions{
+		MonitoredSubnets: []string{"192.168.1.0/25", "203.0.113.0/24"},
+		Summary:          &SummaryOptions{TopTalkers: 0},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := map[string]int{}
+	for _, r := range summary.Rows {
+		switch r.Kind {
+		case SummaryHost:
+			hosts[r.Host] = r.ExternalDestinations
+		case SummaryTalker:
+			t.Errorf("talker listed with top_talkers 0: %+v", r)
+		}
+	}
+	if want := map[string]int{"192.168.1.10": 2, "192.168.1.20": 1, "203.0.113.5": 0}; !reflect.DeepEqual(hosts, want) {
+		t.Errorf("hosts = %v, want %v", hosts, want)
+	}
+}
+
+func TestSummarizeTraffic_Sampled(t *testing.T) {
+	// One connection kept at 50%, one at 25% and one logged before sampling
+	// was enabled: they stand for 2, 4 and 1 connections.
+	conn := "#separator \\x09\n#set_separator\t,\n#path\tconn\n" +
+		"#fields\tts\tuid\tid.orig_h\tid.orig_p\tid.resp_h\tid.resp_p\tproto\tservice\tduration\torig_bytes\tresp_bytes\torig_pkts\torig_ip_bytes\tresp_pkts\tresp_ip_bytes\tsample_rate\n" +
+		"#types\ttime\tstring\taddr\tport\taddr\tport\tenum\tstring\tinterval\tcount\tcount\tcount\tcount\tcount\tcount\tdouble\n" +
+		"1000.000000\tC1\t192.168.1.10\t5353\t8.8.8.8\t53\tudp\tdns\t0.100000\t32\t92\t1\t60\t1\t120\t50.0\n" +
+		"1001.000000\tC2\t192.168.1.10\t50000\t93.184.216.34\t443\ttcp\tssl\t5.000000\t600\t48000\t10\t1000\t40\t50000\t25.0\n" +
+		"1002.000000\tC3\t192.168.1.20\t50001\t93.184.216.34\t443\ttcp\tssl\t2.000000\t300\t1800\t5\t500\t5\t2000\t-\n"
+	path := filepath.Join(t.TempDir(), "conn.log")
+	writeTestFile(t, filepath.Dir(path), "conn.log", conn)
+
+	summary, _, err := summarizeConnLog(path, ProcessOptions{Summary: &SummaryOptions{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := map[string]SummaryRow{}
+	for _, r := range summary.Rows {
+		rows[string(r.Kind)+" "+r.Host+r.Name] = r
+	}
+	want := map[string][5]int64{
+		"total ":            {7, 4620, 202240, 47, 167},
+		"service ssl":       {5, 4500, 202000, 45, 165},
+		"host 192.168.1.10": {6, 4120, 200240, 42, 162},
+		"proto udp":         {2, 120, 240, 2, 2},
+	}
+	for key, w := range want {
+		r := rows[key]
+		if got := [5]int64{r.Connections, r.BytesSent, r.BytesReceived, r.PacketsSent, r.PacketsReceived}; got != w {
+			t.Errorf("%s = %v, want %v", key, got, w)
+		}
+	}
+	if got := rows["host 192.168.1.10"].ExternalDestinations; got != 2 {
+		t.Errorf("external destinations = %d, want the 2 seen", got)
+	}
+}
+
+func TestProcessLogs_SummaryOnly(t *testing.T) {
+	for _, only := range []bool{false, true} {
+		runDir := t.TempDir()
+		writeTestFile(t, runDir, "conn.log", summaryTestConn)
+		result, err := ProcessLogs(runDir, ProcessOptions{Summary: &SummaryOptions{TopTalkers: 10, Only: only}}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.SummaryPath == "" {
+			t.Errorf("only=%v: no summary path", only)
+		}
+		if (result.ConnPath == "") != only {
+			t.Errorf("only=%v: conn path = %q", only, result.ConnPath)
+		}
+		if result.Metadata["summary_only"] != only {
+			t.Errorf("only=%v: summary_only = %v", only, result.Metadata["summary_only"])
+		}
+	}
+
+	// Without a conn.log there is no summary, and the full logs go.
+	runDir := t.TempDir()
+	writeTestFile(t, runDir, "dns.log", "#separator \\x09\n#fields\tts\n#types\ttime\n1.0\n")
+	result, err := ProcessLogs(runDir, ProcessOptions{Summary: &SummaryOptions{TopTalkers: 10, Only: true}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.SummaryPath != "" || result.DNSPath == "" {
+		t.Errorf("summary = %q, dns = %q", result.SummaryPath, result.DNSPath)
+	}
+}
@@ -0,0 +1,203 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"EnigmaNetz/Enigma-Go-Sensor/internal/processor/common/zeekscripts"
+)
+
+// The features the sensor loads scripts into Zeek for, as reported by
+// CheckZeek and keyed in ProcessOptions.DisabledFeatures.
+const (
+	FeatureSampling    = "sampling"
+	FeatureDHCP        = "dhcp_fingerprint"
+	FeatureMACLogging  = "mac_logging"
+	FeatureJA3JA4      = "ja3_ja4"
+	FeatureDiagnostics = "diagnostics"
+	FeatureIntel       = "intel"
+	FeatureLive        = "live"
+)
+
+// zeekFeatureLoss says what is lost when an optional feature is disabled.
+// Sampling and live rotation are not optional: without the first Zeek would
+// process traffic the sensor was told to skip, without the second live mode
+// produces no windows.
+var zeekFeatureLoss = map[string]string{
+	FeatureDHCP:        "dhcp.log has no param_req_list fingerprints",
+	FeatureMACLogging:  "conn.log has no link-layer addresses, so no orig_mac_vendor or resp_mac_vendor",
+	FeatureJA3JA4:      "ja3_ja4.log and ja4s.log are empty and TLS device-role classification cannot run",
+	FeatureDiagnostics: "the Zeek health report has no capture loss or packet counts",
+	FeatureIntel:       "threat-intel feeds are matched on TLS fingerprints only",
+}
+
+// zeekCheckTimeout bounds each Zeek invocation of CheckZeek.
+const zeekCheckTimeout = 2 * time.Minute
+
+// ZeekExec runs the sensor's Zeek with args and returns its combined output.
+// Script paths in args are absolute; the platform maps them as its Zeek
+// expects.
+type ZeekExec func(ctx context.Context, args ...string) ([]byte, error)
+
+// LocalZeek returns a ZeekExec running the Zeek executable at path.
+func LocalZeek(path string) ZeekExec {
+	return func(ctx context.Context, args ...string) ([]byte, error) {
+		return exec.CommandContext(ctx, path, args...).CombinedOutput()
+	}
+}
+
+// ZeekCheck is the outcome of CheckZeek.
+type ZeekCheck struct {
+	Path    string
+	Version string
+	// Disabled maps each optional feature whose scripts Zeek cannot parse to
+	// Zeek's error.
+	Disabled map[string]string
+}
+
+// Report describes each disabled feature and what is lost without it, in a
+// stable order.
+func (c ZeekCheck) Report() []string {
+	var report []string
+	for _, feature := range c.DisabledFeatures() {
+		report = append(report, fmt.Sprintf("%s disabled (%s): %s", feature, zeekFeatureLoss[feature], c.Disabled[feature]))
+	}
+	return report
+}
+
+// DisabledFeatures returns the names of the disabled features, sorted.
+func (c ZeekCheck) DisabledFeatures() []string {
+	features := make([]string, 0, len(c.Disabled))
+	for feature := range c.Disabled {
+		features = append(features, feature)
+	}
+	sort.Strings(features)
+	return features
+}
+
+// CheckZeek makes sure the Zeek at path can run the sensor's scripts before
+// the first window depends on it. It reads Zeek's version, then dry-runs
+// Zeek with --parse-only on its own and with the scripts of each feature
+// opts enables, embedded and generated (subnet sampling rates, intel
+// indicators) alike; live adds the live mode rotation script. An optional
+// feature Zeek cannot parse is returned in Disabled. It is an error when
+// Zeek cannot run at all or cannot parse a script the sensor cannot do
+// without.
+func CheckZeek(path string, run ZeekExec, opts ProcessOptions, live bool) (ZeekCheck, error) {
+	check := ZeekCheck{Path: path, Disabled: make(map[string]string)}
+	out, err := runZeekCheck(run, "--version")
+	if err != nil {
+		return check, fmt.Errorf("zeek at %s does not run: %w", path, err)
+	}
+	check.Version = ParseZeekVersion(string(out))
+	if _, err := runZeekCheck(run, "--parse-only"); err != nil {
+		return check, fmt.Errorf("zeek %s at %s cannot load its own scripts: %w", check.Version, path, err)
+	}
+
+	dir, err := os.MkdirTemp("", "zeek-check-")
+	if err != nil {
+		return check, fmt.Errorf("zeek script check: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, feature := range []string{FeatureSampling, FeatureDHCP, FeatureMACLogging, FeatureJA3JA4, FeatureDiagnostics, FeatureIntel, FeatureLive} {
+		scripts, err := zeekFeatureScripts(feature, dir, opts, live)
+		if err != nil {
+			return check, fmt.Errorf("zeek script check: %s: %w", feature, err)
+		}
+		if len(scripts) == 0 {
+			continue
+		}
+		if _, err := runZeekCheck(run, append([]string{"--parse-only"}, scripts...)...); err != nil {
+			if _, optional := zeekFeatureLoss[feature]; !optional {
+				return check, fmt.Errorf("zeek %s at %s cannot run the %s scripts: %w", check.Version, path, feature, err)
+			}
+			check.Disabled[feature] = err.Error()
+		}
+	}
+	return check, nil
+}
+
+// zeekFeatureScripts materializes the scripts of feature into dir and
+// returns the arguments loading them, or nil when opts does not use it.
+func zeekFeatureScripts(feature, dir string, opts ProcessOptions, live bool) ([]string, error) {
+	var name string
+	switch feature {
+	case FeatureSampling:
+		if !opts.SamplingEnabled() {
+			return nil, nil
+		}
+		path, err := zeekscripts.Materialize(dir, zeekscripts.Sampling)
+		if err != nil {
+			return nil, err
+		}
+		return AppendSamplingArgs([]string{path}, dir, opts), nil
+	case FeatureIntel:
+		if opts.IntelDir == "" {
+			return nil, nil
+		}
+		if scripts := IntelScripts(dir, opts); scripts != nil {
+			return scripts, nil
+		}
+		// Feeds without Zeek indicators yet may gain some.
+		name = zeekscripts.Intel
+	case FeatureLive:
+		if !live {
+			return nil, nil
+		}
+		name = zeekscripts.Live
+	case FeatureDHCP:
+		name = zeekscripts.DHCP
+	case FeatureMACLogging:
+		return []string{zeekMACLogging}, nil
+	case FeatureJA3JA4:
+		name = zeekscripts.JA3JA4
+	case FeatureDiagnostics:
+		name = zeekscripts.Diagnostics
+	}
+	path, err := zeekscripts.Materialize(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	return []string{path}, nil
+}
+
+// runZeekCheck runs Zeek, turning a failure into an error carrying the first
+// error Zeek printed, or its first line of output.
+func runZeekCheck(run ZeekExec, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), zeekCheckTimeout)
+	defer cancel()
+	out, err := run(ctx, args...)
+	if err == nil {
+		return out, nil
+	}
+	first := ""
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.Contains(strings.ToLower(line), "error") {
+			first = line
+			break
+		}
+		if first == "" {
+			first = line
+		}
+	}
+	if first == "" {
+		return out, err
+	}
+	return out, fmt.Errorf("%w: %s", err, first)
+}
+
+// ParseZeekVersion extracts the version from the output of zeek --version,
+// e.g. "zeek version 6.0.0".
+func ParseZeekVersion(output string) string {
+	line := strings.TrimSpace(output)
+	if _, version, ok := strings.Cut(line, "version "); ok {
+		return strings.TrimSpace(version)
+	}
+	return line
+}
@@ -0,0 +1,91 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeZeek is a ZeekExec that fails --parse-only for any script named in
+// broken, printing a Zeek-style error, and records the scripts it parsed.
+func fakeZeek(broken ...string) (ZeekExec, *[]string) {
+	var parsed []string
+	return func(ctx context.Context, args ...string) ([]byte, error) {
+		if args[0] == "--version" {
+			return []byte("zeek version 6.0.3\n"), nil
+		}
+		for _, arg := range args[1:] {
+			if _, err := os.Stat(arg); err != nil && strings.HasSuffix(arg, ".zeek") {
+				return nil, err
+			}
+			parsed = append(parsed, filepath.Base(arg))
+			for _, b := range broken {
+				if filepath.Base(arg) == b {
+					return []byte("warning: deprecated\nerror in " + arg + ", line 3: unknown identifier\n"), errors.New("exit status 1")
+				}
+			}
+		}
+		return nil, nil
+	}, &parsed
+}
+
+func TestCheckZeek(t *testing.T) {
+	feeds := t.TempDir()
+	writeTestFile(t, feeds, "tip.csv", "c2.example\n")
+	opts := ProcessOptions{SamplingPercentage: 50, IntelDir: feeds}
+
+	run, parsed := fakeZeek("ja3-ja4-fingerprinting.zeek")
+	check, err := CheckZeek("/opt/zeek/bin/zeek", run, opts, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if check.Version != "6.0.3" {
+		t.Errorf("version = %q", check.Version)
+	}
+	if len(check.Disabled) != 1 || !strings.Contains(check.Disabled[FeatureJA3JA4], "unknown identifier") {
+		t.Errorf("disabled = %v", check.Disabled)
+	}
+	for _, script := range []string{"sampling.zeek", "dhcp-fingerprint.zeek", "mac-logging", "diagnostics.zeek", "intel.zeek", intelFilesScript} {
+		if !strings.Contains(strings.Join(*parsed, " "), script) {
+			t.Errorf("%s not checked: %v", script, *parsed)
+		}
+	}
+	if report := check.Report(); len(report) != 1 || !strings.HasPrefix(report[0], "ja3_ja4 disabled (ja3_ja4.log and ja4s.log are empty") {
+		t.Errorf("report = %q", report)
+	}
+
+	// The live rotation script is only checked in live mode, and required.
+	run, _ = fakeZeek("live.zeek")
+	if _, err := CheckZeek("zeek", run, ProcessOptions{}, false); err != nil {
+		t.Errorf("live script checked outside live mode: %v", err)
+	}
+	if _, err := CheckZeek("zeek", run, ProcessOptions{}, true); err == nil || !strings.Contains(err.Error(), "live") {
+		t.Errorf("live err = %v", err)
+	}
+	// So is sampling: without it Zeek would process everything.
+	run, _ = fakeZeek("sampling.zeek")
+	if _, err := CheckZeek("zeek", run, opts, false); err == nil {
+		t.Error("expected an error for a sampling script Zeek cannot parse")
+	}
+
+	// A Zeek that does not run cannot be degraded around.
+	_, err = CheckZeek("zeek", func(ctx context.Context, args ...string) ([]byte, error) {
+		return nil, errors.New("executable file not found")
+	}, opts, false)
+	if err == nil || !strings.Contains(err.Error(), "does not run") {
+		t.Errorf("missing Zeek err = %v", err)
+	}
+}
+
+func TestBuildZeekArgs_DisabledFeatures(t *testing.T) {
+	dir := t.TempDir()
+	opts := ProcessOptions{SamplingPercentage: 100, DisabledFeatures: map[string]bool{FeatureMACLogging: true, FeatureJA3JA4: true, FeatureDiagnostics: true}}
+	got := BuildZeekArgs([]string{"-r", "x.pcap"}, dir, opts)
+	want := []string{"-r", "x.pcap", filepath.Join(dir, "dhcp-fingerprint.zeek")}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("args = %v, want %v", got, want)
+	}
+}
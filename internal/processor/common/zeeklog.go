@@ -0,0 +1,87 @@
+package types
+
+import (
+	"strconv"
+	"strings"
+)
+
+// zeekUnsetMarkers are the placeholder tokens Zeek writes for an absent value.
+// They are not addresses and must be skipped, not parsed.
+var zeekUnsetMarkers = map[string]bool{
+	"-":       true,
+	"(empty)": true,
+}
+
+// logHeader is the parsed "#" preamble of a Zeek TSV log. Columns are always
+// located by name through this header (never by hardcoded index), so every
+// stage that inspects or rewrites a log works across all uploaded logs and
+// survives column changes in custom scripts.
+type logHeader struct {
+	path   string   // log stream name from #path (e.g. "conn"), if present
+	sep    string   // field separator (decoded from #separator)
+	setSep string   // set/vector element separator (#set_separator)
+	fields []string // #fields column names, aligned with data columns
+	types  []string // #types column types, aligned with fields
+}
+
+// parseLogHeader scans the leading header lines of a log and returns its
+// separators, field names and types. Defaults (tab, comma) are used for any
+// separator line that is absent. fields is nil when there is no #fields line.
+func parseLogHeader(lines []string) *logHeader {
+	h := &logHeader{sep: "\t", setSep: ","}
+	for _, line := range lines {
+		if line != "" && !strings.HasPrefix(line, "#") {
+			break
+		}
+		switch {
+		case strings.HasPrefix(line, "#separator"):
+			h.sep = parseSeparator(line)
+		case strings.HasPrefix(line, "#path"):
+			if parts := strings.Split(line, h.sep); len(parts) >= 2 {
+				h.path = parts[1]
+			}
+		case strings.HasPrefix(line, "#set_separator"):
+			// Delimited by the main separator, which is already known by now.
+			if parts := strings.Split(line, h.sep); len(parts) >= 2 && parts[1] != "" {
+				h.setSep = parts[1]
+			}
+		case strings.HasPrefix(line, "#fields"):
+			// Drop the "#fields" token so the remaining indices align with data columns.
+			h.fields = strings.Split(line, h.sep)[1:]
+		case strings.HasPrefix(line, "#types"):
+			h.types = strings.Split(line, h.sep)[1:]
+		}
+	}
+	return h
+}
+
+// index returns the data column index of field name, or -1 if absent.
+func (h *logHeader) index(name string) int {
+	for i, f := range h.fields {
+		if f == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseSeparator decodes a Zeek "#separator" header line. Zeek writes the
+// separator as an escape (e.g. "#separator \x09" for tab) using a literal space
+// delimiter, since the separator cannot delimit its own definition. Defaults to
+// tab if the line is malformed.
+func parseSeparator(line string) string {
+	parts := strings.SplitN(line, " ", 2)
+	if len(parts) < 2 {
+		return "\t"
+	}
+	sep := strings.TrimSpace(parts[1])
+	if strings.HasPrefix(sep, `\x`) {
+		if b, err := strconv.ParseUint(sep[2:], 16, 8); err == nil {
+			return string(rune(b))
+		}
+	}
+	if sep == "" {
+		return "\t"
+	}
+	return sep
+}
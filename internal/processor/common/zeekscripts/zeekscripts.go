@@ -17,9 +17,12 @@ import (
 // Script filenames embedded in the binary. These are the canonical names Zeek
 // writes logs for (e.g. ja3-ja4-fingerprinting.zeek -> ja3_ja4.log / ja4s.log).
 const (
-	JA3JA4   = "ja3-ja4-fingerprinting.zeek"
-	DHCP     = "dhcp-fingerprint.zeek"
-	Sampling = "sampling.zeek"
+	JA3JA4      = "ja3-ja4-fingerprinting.zeek"
+	DHCP        = "dhcp-fingerprint.zeek"
+	Sampling    = "sampling.zeek"
+	Intel       = "intel.zeek"
+	Live        = "live.zeek"
+	Diagnostics = "diagnostics.zeek"
 )
 
 //go:embed *.zeek
@@ -8,10 +8,8 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"time"
 
 	types "EnigmaNetz/Enigma-Go-Sensor/internal/processor/common"
-	"EnigmaNetz/Enigma-Go-Sensor/internal/processor/common/zeekscripts"
 )
 
 // zeekBinary is the path to the Zeek executable
@@ -75,84 +73,57 @@ func NewProcessor() *Processor {
 	}
 }
 
+// CheckZeek dry-runs the sensor's scripts with the processor's Zeek (see
+// types.CheckZeek).
+func (p *Processor) CheckZeek(opts types.ProcessOptions) (types.ZeekCheck, error) {
+	return types.CheckZeek(p.zeekPath, types.LocalZeek(p.zeekPath), opts, false)
+}
+
 // For tests
 func NewProcessorWithDeps(fs FS, cmdRunner CmdRunner, zeekPath string) *Processor {
 	return &Processor{fs: fs, cmdRunner: cmdRunner, zeekPath: zeekPath}
 }
 
-// ProcessPCAP runs Zeek on the given PCAP, converts logs to XLSX, and returns their paths
+// ProcessPCAP runs Zeek on the given PCAP, encodes the logs in the configured output encoding, and returns their paths
 func (p *Processor) ProcessPCAP(pcapPath string, opts types.ProcessOptions) (types.ProcessedData, error) {
 	// Use the directory containing the PCAP as the run directory
 	runDir := filepath.Dir(pcapPath)
 	log.Printf("[processor] Run directory: %s", runDir)
 
-	// Prepare Zeek command with sampling if needed
-	baseArgs := []string{"-r", pcapPath, fmt.Sprintf("Log::default_logdir=%s", runDir), "-C"}
-	zeekArgs := types.PrepareZeekArgsWithSampling(runDir, opts.SamplingPercentage, baseArgs)
-
-	// Add DHCP fingerprint script so param_req_list appears in dhcp.log. Scripts are
-	// embedded in the binary and materialized into runDir, so this no longer depends
-	// on the process's working directory (which broke packaged systemd installs).
-	var err error
-	if zeekArgs, err = types.AppendZeekScript(zeekArgs, runDir, zeekscripts.DHCP); err != nil {
-		log.Printf("[processor] Warning: could not add DHCP fingerprint script: %v", err)
-	}
-
-	// Add JA3/JA4 fingerprint script so ja3_ja4.log / ja4s.log are produced (mirrors
-	// the Windows custom-scripts/main.zeek path). Without it the Linux sensor uploads
-	// empty JA3/JA4 payloads and TLS device-role classification never runs on
-	// Linux-sensor data. Warn loudly on failure: the upload path tolerates the
-	// missing logs, which would otherwise hide it entirely.
-	if zeekArgs, err = types.AppendZeekScript(zeekArgs, runDir, zeekscripts.JA3JA4); err != nil {
-		log.Printf("[processor] WARNING: could not add JA3/JA4 fingerprint script: %v; ja3_ja4.log/ja4s.log will be empty and TLS device-role classification cannot run", err)
-	}
-
-	log.Printf("[processor] Running Zeek: %s %v", p.zeekPath, zeekArgs)
-	cmd := p.cmdRunner.Command(p.zeekPath, zeekArgs...)
-	cmdStdout, ok := cmd.(*realCmd)
-	if ok {
-		cmdStdout.cmd.Stdout = os.Stdout
-		cmdStdout.cmd.Stderr = os.Stderr
+	// runZeek runs one Zeek on pcap with its logs and scripts in logDir; a
+	// large PCAP may be split and run as several (see RunZeekSharded).
+	runZeek := func(pcap, logDir string) error {
+		baseArgs := []string{"-r", pcap, fmt.Sprintf("Log::default_logdir=%s", logDir), "-C"}
+		zeekArgs := types.BuildZeekArgs(baseArgs, logDir, opts)
+
+		log.Printf("[processor] Running Zeek: %s %v", p.zeekPath, zeekArgs)
+		cmd := p.cmdRunner.Command(p.zeekPath, zeekArgs...)
+		cmdStdout, ok := cmd.(*realCmd)
+		if ok {
+			stdout, stderr, closeOutput := types.OpenZeekOutput(logDir)
+			defer closeOutput()
+			cmdStdout.cmd.Stdout = stdout
+			cmdStdout.cmd.Stderr = stderr
+		}
+		return cmd.Run()
 	}
-	if err := cmd.Run(); err != nil {
+	if err := types.RunZeekSharded(pcapPath, runDir, opts, runZeek); err != nil {
 		log.Printf("[processor] Zeek execution failed: %v", err)
 		return types.ProcessedData{}, fmt.Errorf("zeek failed: %w", err)
 	}
 	log.Printf("[processor] Zeek execution completed successfully.")
 
 	dhcpLogPath := filepath.Join(runDir, "dhcp.log")
-	if err := types.EnrichDHCPLog(pcapPath, dhcpLogPath); err != nil {
+	if err := types.EnrichDHCPLog(pcapPath, dhcpLogPath, opts.MemoryLimit); err != nil {
 		log.Printf("[processor] Warning: DHCP enrichment failed: %v", err)
 	}
 
-	// Drop any flows/records in an excluded subnet before the logs are renamed
-	// and uploaded. Fatal on failure: uploading unfiltered data would violate
-	// the "do not upload it" guarantee.
-	if err := types.FilterExcludedSubnets(runDir, types.ZeekLogFiles, opts.ExcludedSubnets); err != nil {
-		log.Printf("[processor] Subnet exclusion filtering failed: %v", err)
-		return types.ProcessedData{}, fmt.Errorf("subnet exclusion filtering failed: %w", err)
-	}
-
-	paths, err := types.RenameZeekLogsToXLSX(p.fs, runDir, types.ZeekLogFiles)
-	if err != nil {
-		log.Printf("[processor] Failed to rename Zeek logs: %v", err)
-		return types.ProcessedData{}, err
-	}
+	return types.ProcessLogs(runDir, opts, map[string]interface{}{"pcap_path": pcapPath})
+}
 
-	metadata := map[string]interface{}{
-		"zeek_out_dir":        runDir,
-		"timestamp":           time.Now().UTC().Format("20060102T150405Z"),
-		"pcap_path":           pcapPath,
-		"sampling_percentage": opts.SamplingPercentage,
-	}
-	log.Printf("[processor] Returning results: conn.xlsx=%s, dns.xlsx=%s, dhcp.xlsx=%s, ja3_ja4.xlsx=%s, ja4s.xlsx=%s, metadata=%v", paths["conn.log"], paths["dns.log"], paths["dhcp.log"], paths["ja3_ja4.log"], paths["ja4s.log"], metadata)
-
-	return types.ProcessedData{
-		ConnPath:   paths["conn.log"],
-		DNSPath:    paths["dns.log"],
-		DHCPPath:   paths["dhcp.log"],
-		JA3JA4Path: paths["ja3_ja4.log"],
-		JA4SPath:   paths["ja4s.log"],
-		Metadata:   metadata,
-	}, nil
+// ProcessLogs runs the post-Zeek stages on a directory of logs Zeek wrote
+// without a PCAP, the rotated windows of live mode.
+func (p *Processor) ProcessLogs(runDir string, opts types.ProcessOptions) (types.ProcessedData, error) {
+	log.Printf("[processor] Run directory: %s", runDir)
+	return types.ProcessLogs(runDir, opts, nil)
 }
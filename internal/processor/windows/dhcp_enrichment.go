@@ -4,6 +4,6 @@ package windows
 
 import types "EnigmaNetz/Enigma-Go-Sensor/internal/processor/common"
 
-func enrichDHCPLog(pcapPath, dhcpLogPath string) error {
-	return types.EnrichDHCPLog(pcapPath, dhcpLogPath)
+func enrichDHCPLog(pcapPath, dhcpLogPath string, limit int64) error {
+	return types.EnrichDHCPLog(pcapPath, dhcpLogPath, limit)
 }
@@ -34,7 +34,7 @@ func TestPatchDHCPLog_FillsFingerprints(t *testing.T) {
 		"11:22:33:44:55:66": "1,3,6,15,28,43",
 	}
 
-	if err := types.PatchDHCPLog(f.Name(), fingerprints); err != nil {
+	if err := types.PatchDHCPLog(f.Name(), fingerprints, 0); err != nil {
 		t.Fatalf("PatchDHCPLog error: %v", err)
 	}
 
@@ -65,7 +65,7 @@ func TestPatchDHCPLog_Idempotent(t *testing.T) {
 	fingerprints := map[string]string{
 		"aa:bb:cc:dd:ee:ff": "9,9,9,9",
 	}
-	if err := types.PatchDHCPLog(f.Name(), fingerprints); err != nil {
+	if err := types.PatchDHCPLog(f.Name(), fingerprints, 0); err != nil {
 		t.Fatalf("PatchDHCPLog error: %v", err)
 	}
 
@@ -76,7 +76,7 @@ func TestPatchDHCPLog_Idempotent(t *testing.T) {
 }
 
 func TestPatchDHCPLog_MissingFile(t *testing.T) {
-	err := types.PatchDHCPLog("/nonexistent/dhcp.log", map[string]string{"aa:bb:cc:dd:ee:ff": "1,3,6"})
+	err := types.PatchDHCPLog("/nonexistent/dhcp.log", map[string]string{"aa:bb:cc:dd:ee:ff": "1,3,6"}, 0)
 	if err != nil {
 		t.Errorf("expected nil for missing file, got: %v", err)
 	}
@@ -92,7 +92,7 @@ func TestPatchDHCPLog_NoParamReqListColumn(t *testing.T) {
 	f.WriteString("#fields\tts\tmac\tlease_time\n1746000000.0\taa:bb:cc:dd:ee:ff\t86400.0\n")
 	f.Close()
 
-	err = types.PatchDHCPLog(f.Name(), map[string]string{"aa:bb:cc:dd:ee:ff": "1,3,6"})
+	err = types.PatchDHCPLog(f.Name(), map[string]string{"aa:bb:cc:dd:ee:ff": "1,3,6"}, 0)
 	if err != nil {
 		t.Errorf("expected nil when column absent, got: %v", err)
 	}
@@ -4,13 +4,13 @@ package windows
 
 import (
 	types "EnigmaNetz/Enigma-Go-Sensor/internal/processor/common"
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
-	"time"
 )
 
 type execCmdFunc func(name string, arg ...string) *exec.Cmd
@@ -39,24 +39,44 @@ func toZeekPath(path string) string {
 	return strings.ReplaceAll(path, string(os.PathSeparator), "/")
 }
 
-// prepareWindowsZeekArgsWithSampling prepares Zeek arguments for Windows using the copied sampling script
-func prepareWindowsZeekArgsWithSampling(runDir string, samplingPercentage float64, baseArgs []string) []string {
-	args := make([]string, len(baseArgs))
-	copy(args, baseArgs)
+// zeekBaseDir is the directory the Zeek runtime is extracted to, relative to
+// the sensor's working directory.
+var zeekBaseDir = filepath.Join("zeek-windows", "zeek-runtime-win64")
 
-	// Add sampling percentage parameter if sampling is enabled
-	// The sampling script is already loaded via main.zeek
-	if samplingPercentage < 100 {
-		args = append(args, fmt.Sprintf("Sampling::sampling_percentage=%.1f", samplingPercentage))
-		log.Printf("[processor] Added sampling configuration at %.1f%% (script loaded via main.zeek)", samplingPercentage)
-	}
+// runtimeMainZeek returns the runtime's own site script, relative to
+// zeekShare. The sensor loads it as shipped (it is re-extracted at every
+// start) ahead of its per-run scripts, and never modifies it.
+func runtimeMainZeek(zeekShare string) string {
+	return filepath.Join(zeekShare, "site", "custom-scripts", "main.zeek")
+}
 
-	return args
+// CheckZeek dry-runs the sensor's scripts with the bundled Zeek (see
+// types.CheckZeek), run the way ProcessPCAP runs it: from zeekBaseDir and
+// after the runtime's main.zeek.
+func (p *Processor) CheckZeek(opts types.ProcessOptions) (types.ZeekCheck, error) {
+	zeekPath := filepath.Join(zeekBaseDir, "bin", "zeek.exe")
+	zeekShareAbs, err := filepath.Abs(filepath.Join(zeekBaseDir, "share", "zeek"))
+	if err != nil {
+		return types.ZeekCheck{Path: zeekPath}, err
+	}
+	run := func(ctx context.Context, args ...string) ([]byte, error) {
+		if len(args) > 0 && args[0] == "--parse-only" {
+			args = append([]string{args[0], runtimeMainZeek(zeekShareAbs)}, args[1:]...)
+		}
+		zeekArgs := make([]string, len(args))
+		for i, arg := range args {
+			zeekArgs[i] = toZeekPath(arg)
+		}
+		cmd := exec.CommandContext(ctx, "bin/zeek.exe", zeekArgs...)
+		cmd.Dir = zeekBaseDir
+		cmd.Env = append(os.Environ(), "ZEEKPATH="+zeekShareAbs)
+		return cmd.CombinedOutput()
+	}
+	return types.CheckZeek(zeekPath, run, opts, false)
 }
 
 func (p *Processor) ProcessPCAP(pcapPath string, opts types.ProcessOptions) (types.ProcessedData, error) {
 	runDir := filepath.Dir(pcapPath)
-	zeekBaseDir := filepath.Join("zeek-windows", "zeek-runtime-win64")
 	zeekPath := filepath.Join(zeekBaseDir, "bin", "zeek.exe")
 	if _, err := p.fs.Stat(zeekPath); err != nil {
 		log.Printf("[processor] Zeek executable not found at %s: %v", zeekPath, err)
@@ -70,25 +90,31 @@ func (p *Processor) ProcessPCAP(pcapPath string, opts types.ProcessOptions) (typ
 		return types.ProcessedData{}, err
 	}
 
-	// Normalize paths for Zeek
-	zeekRunDir := toZeekPath(runDir)
-	zeekPcapPath := toZeekPath(pcapPath)
-	zeekScript := toZeekPath(filepath.Join(zeekShareAbs, "site", "custom-scripts", "main.zeek"))
-
-	// Prepare Zeek command arguments with sampling
-	baseArgs := []string{"-r", zeekPcapPath, zeekScript, fmt.Sprintf("Log::default_logdir=%s", zeekRunDir), "-C"}
-
-	// For Windows, we handle sampling by modifying the search paths to use absolute paths
-	zeekArgs := prepareWindowsZeekArgsWithSampling(runDir, opts.SamplingPercentage, baseArgs)
-
-	log.Printf("[processor] Running Zeek: %s %v", zeekPath, zeekArgs)
-
-	cmd := p.execCmd("bin/zeek.exe", zeekArgs...)
-	cmd.Dir = zeekBaseDir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Env = append(os.Environ(), "ZEEKPATH="+zeekShareAbs)
-	if err := cmd.Run(); err != nil {
+	// runZeek runs one Zeek on pcap with its logs in logDir; a large PCAP may
+	// be split and run as several (see RunZeekSharded).
+	runZeek := func(pcap, logDir string) error {
+		// The runtime's main.zeek is loaded unmodified; the sensor's scripts
+		// are materialized into logDir like on Linux, so runs do not share a
+		// file. Paths are absolute, as Zeek runs from zeekBaseDir, and use
+		// forward slashes.
+		baseArgs := []string{"-r", pcap, runtimeMainZeek(zeekShareAbs), fmt.Sprintf("Log::default_logdir=%s", logDir), "-C"}
+		zeekArgs := types.BuildZeekArgs(baseArgs, logDir, opts)
+		for i, arg := range zeekArgs {
+			zeekArgs[i] = toZeekPath(arg)
+		}
+
+		log.Printf("[processor] Running Zeek: %s %v", zeekPath, zeekArgs)
+
+		cmd := p.execCmd("bin/zeek.exe", zeekArgs...)
+		cmd.Dir = zeekBaseDir
+		stdout, stderr, closeOutput := types.OpenZeekOutput(logDir)
+		defer closeOutput()
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		cmd.Env = append(os.Environ(), "ZEEKPATH="+zeekShareAbs)
+		return cmd.Run()
+	}
+	if err := types.RunZeekSharded(pcapPath, runDir, opts, runZeek); err != nil {
 		log.Printf("[processor] Zeek execution failed: %v", err)
 		return types.ProcessedData{}, fmt.Errorf("zeek failed: %w", err)
 	}
@@ -99,38 +125,9 @@ func (p *Processor) ProcessPCAP(pcapPath string, opts types.ProcessOptions) (typ
 	// DHCP::Options$param_req_list at script level, so we extract it here
 	// directly from the pcap using gopacket.
 	dhcpLogPath := filepath.Join(runDir, "dhcp.log")
-	if err := enrichDHCPLog(pcapPath, dhcpLogPath); err != nil {
+	if err := enrichDHCPLog(pcapPath, dhcpLogPath, opts.MemoryLimit); err != nil {
 		log.Printf("[processor] Warning: DHCP enrichment failed: %v", err)
 	}
 
-	// Drop any flows/records in an excluded subnet before the logs are renamed
-	// and uploaded. Fatal on failure: uploading unfiltered data would violate
-	// the "do not upload it" guarantee.
-	if err := types.FilterExcludedSubnets(runDir, types.ZeekLogFiles, opts.ExcludedSubnets); err != nil {
-		log.Printf("[processor] Subnet exclusion filtering failed: %v", err)
-		return types.ProcessedData{}, fmt.Errorf("subnet exclusion filtering failed: %w", err)
-	}
-
-	paths, err := types.RenameZeekLogsToXLSX(p.fs, runDir, types.ZeekLogFiles)
-	if err != nil {
-		log.Printf("[processor] Failed to rename Zeek logs: %v", err)
-		return types.ProcessedData{}, err
-	}
-
-	metadata := map[string]interface{}{
-		"zeek_out_dir":        runDir,
-		"timestamp":           time.Now().UTC().Format("20060102T150405Z"),
-		"pcap_path":           pcapPath,
-		"sampling_percentage": opts.SamplingPercentage,
-	}
-	log.Printf("[processor] Returning results: conn.xlsx=%s, dns.xlsx=%s, dhcp.xlsx=%s, ja3_ja4.xlsx=%s, ja4s.xlsx=%s, metadata=%v", paths["conn.log"], paths["dns.log"], paths["dhcp.log"], paths["ja3_ja4.log"], paths["ja4s.log"], metadata)
-
-	return types.ProcessedData{
-		ConnPath:   paths["conn.log"],
-		DNSPath:    paths["dns.log"],
-		DHCPPath:   paths["dhcp.log"],
-		JA3JA4Path: paths["ja3_ja4.log"],
-		JA4SPath:   paths["ja4s.log"],
-		Metadata:   metadata,
-	}, nil
+	return types.ProcessLogs(runDir, opts, map[string]interface{}{"pcap_path": pcapPath})
 }
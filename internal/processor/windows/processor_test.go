@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -97,3 +98,45 @@ func TestProcessPCAP(t *testing.T) {
 		t.Errorf("Expected non-empty XLSX paths, got: %+v", result)
 	}
 }
+
+// TestProcessPCAP_MaterializesScripts verifies that Zeek is run with the
+// embedded scripts written into the run directory, after the runtime's
+// main.zeek, which is loaded but left unmodified.
+func TestProcessPCAP_MaterializesScripts(t *testing.T) {
+	runDir := t.TempDir()
+	pcapPath := filepath.Join(runDir, "test.pcap")
+	zeekBaseDir := filepath.Join("zeek-windows", "zeek-runtime-win64")
+	if err := os.MkdirAll(zeekBaseDir, 0755); err != nil {
+		t.Fatalf("Failed to create zeekBaseDir: %v", err)
+	}
+	defer os.RemoveAll("zeek-windows")
+	fs := &mockFS{
+		existing:  map[string]bool{filepath.Clean(filepath.Join(zeekBaseDir, "bin", "zeek.exe")): true},
+		renameErr: map[string]error{},
+	}
+	var args []string
+	execCmd := func(name string, arg ...string) *exec.Cmd {
+		args = arg
+		return exec.Command("cmd", "/C", "echo")
+	}
+	p := NewTestProcessor(execCmd, fs)
+
+	if _, err := p.ProcessPCAP(pcapPath, types.ProcessOptions{SamplingPercentage: 50}); err != nil {
+		t.Fatalf("ProcessPCAP failed: %v", err)
+	}
+	joined := strings.Join(args, " ")
+	if strings.Contains(joined, `\`) {
+		t.Errorf("unexpected zeek args: %v", args)
+	}
+	if len(args) < 3 || !strings.HasSuffix(args[2], "/share/zeek/site/custom-scripts/main.zeek") {
+		t.Errorf("zeek args do not load the runtime's main.zeek after the pcap: %v", args)
+	}
+	for _, script := range []string{"sampling.zeek", "dhcp-fingerprint.zeek", "ja3-ja4-fingerprinting.zeek"} {
+		if !strings.Contains(joined, toZeekPath(filepath.Join(runDir, script))) {
+			t.Errorf("zeek args lack %s: %v", script, args)
+		}
+		if _, err := os.Stat(filepath.Join(runDir, script)); err != nil {
+			t.Errorf("%s not materialized: %v", script, err)
+		}
+	}
+}
@@ -0,0 +1,635 @@
+// Package rules implements the small record filter language used by the
+// zeek.filter_rules option. A rule names a log and a boolean condition over that
+// log's columns, for example:
+//
+//	drop conn where id.resp_p in (873, 445) and proto == tcp
+//	drop dns where qtype_name == "PTR"
+//	drop * where id.resp_h in (10.0.0.0/8) and not service == dns
+//
+// Conditions combine comparisons with and, or, not and parentheses. Supported
+// operators are ==, !=, <, <=, >, >=, =~ (regular expression), in and not in.
+// Columns are resolved by name from the log's #fields header and compared
+// according to its #types: numbers (count, int, port, double, time, interval)
+// numerically, addresses by IP with CIDR containment for "in"/"==", and
+// everything else as text. A set or vector column matches when any element
+// does. Unset values ("-") only match an explicit "-" literal.
+//
+// The package has no dependencies on the rest of the sensor so configuration
+// loading can validate rules with the same parser the processor uses.
+package rules
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ActionDrop is the only rule action: matching rows are removed.
+const ActionDrop = "drop"
+
+// AnyLog is the log name that applies a rule to every uploaded log.
+const AnyLog = "*"
+
+// Rule is a parsed filter rule.
+type Rule struct {
+	// Text is the normalized rule source, used as its identity in hit counters.
+	Text string
+	// Action is what to do with matching rows (always ActionDrop).
+	Action string
+	// Log is the log the rule applies to ("conn", "dns", ...) or AnyLog.
+	Log string
+
+	cond   node
+	fields []string
+}
+
+// ParseList parses a semicolon-separated list of rules. Empty entries are
+// ignored.
+func ParseList(s string) ([]*Rule, error) {
+	var out []*Rule
+	for _, part := range Split(s) {
+		r, err := Parse(part)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// Split splits a semicolon-separated rule list into trimmed, non-empty rule
+// sources without parsing them. Semicolons inside quoted strings are kept.
+func Split(s string) []string {
+	var out []string
+	var cur strings.Builder
+	inQuote := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && inQuote && i+1 < len(s):
+			cur.WriteByte(c)
+			i++
+			c = s[i]
+		case c == '"':
+			inQuote = !inQuote
+		case c == ';' && !inQuote:
+			if t := strings.TrimSpace(cur.String()); t != "" {
+				out = append(out, t)
+			}
+			cur.Reset()
+			continue
+		}
+		cur.WriteByte(c)
+	}
+	if t := strings.TrimSpace(cur.String()); t != "" {
+		out = append(out, t)
+	}
+	return out
+}
+
+// Parse parses a single rule of the form "drop <log> where <condition>".
+func Parse(text string) (*Rule, error) {
+	toks, err := lex(text)
+	if err != nil {
+		return nil, fmt.Errorf("rule %q: %w", text, err)
+	}
+	p := &parser{toks: toks}
+	r, err := p.rule()
+	if err != nil {
+		return nil, fmt.Errorf("rule %q: %w", text, err)
+	}
+	r.Text = strings.Join(strings.Fields(text), " ")
+	return r, nil
+}
+
+// AppliesTo reports whether the rule targets the named log (e.g. "conn").
+func (r *Rule) AppliesTo(logName string) bool {
+	return r.Log == AnyLog || r.Log == logName
+}
+
+// Bind resolves the rule's columns against a log header. fields and types are
+// the #fields and #types entries (types may be nil); setSep is the log's
+// #set_separator. It returns nil when the log lacks any column the rule
+// references, so a rule never fires on a log it cannot fully evaluate.
+func (r *Rule) Bind(fields, types []string, setSep string) *Bound {
+	idx := make(map[string]int, len(fields))
+	for i, f := range fields {
+		idx[f] = i
+	}
+	for _, f := range r.fields {
+		if _, ok := idx[f]; !ok {
+			return nil
+		}
+	}
+	env := &bindEnv{index: idx, types: types, setSep: setSep}
+	return &Bound{Rule: r, match: r.cond.bind(env)}
+}
+
+// Bound is a rule resolved against one log's header.
+type Bound struct {
+	Rule  *Rule
+	match func(cols []string) bool
+}
+
+// Match reports whether the data row (split into columns) satisfies the rule.
+func (b *Bound) Match(cols []string) bool {
+	return b.match(cols)
+}
+
+// --- lexer -----------------------------------------------------------------
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota // identifiers, keywords, numbers, addresses, CIDRs
+	tokString
+	tokOp // == != < <= > >= =~
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func lex(s string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			toks = append(toks, token{tokLParen, "("})
+			i++
+		case c == ')':
+			toks = append(toks, token{tokRParen, ")"})
+			i++
+		case c == ',':
+			toks = append(toks, token{tokComma, ","})
+			i++
+		case c == '"':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				b.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			toks = append(toks, token{tokString, b.String()})
+			i = j + 1
+		case strings.ContainsRune("=!<>", rune(c)):
+			two := ""
+			if i+1 < len(s) {
+				two = s[i : i+2]
+			}
+			switch two {
+			case "==", "!=", "<=", ">=", "=~":
+				toks = append(toks, token{tokOp, two})
+				i += 2
+			default:
+				if c == '<' || c == '>' {
+					toks = append(toks, token{tokOp, string(c)})
+					i++
+				} else {
+					return nil, fmt.Errorf("unexpected %q at offset %d", c, i)
+				}
+			}
+		default:
+			j := i
+			for j < len(s) && !strings.ContainsRune(" \t\n\r(),\"=!<>", rune(s[j])) {
+				j++
+			}
+			toks = append(toks, token{tokWord, s[i:j]})
+			i = j
+		}
+	}
+	return toks, nil
+}
+
+// --- parser ----------------------------------------------------------------
+
+type parser struct {
+	toks []token
+	pos  int
+	seen map[string]bool
+	out  *Rule
+}
+
+func (p *parser) peek() *token {
+	if p.pos < len(p.toks) {
+		return &p.toks[p.pos]
+	}
+	return nil
+}
+
+func (p *parser) next() *token {
+	t := p.peek()
+	if t != nil {
+		p.pos++
+	}
+	return t
+}
+
+// keyword reports (and consumes) the next token if it is the given keyword.
+func (p *parser) keyword(kw string) bool {
+	if t := p.peek(); t != nil && t.kind == tokWord && strings.EqualFold(t.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) rule() (*Rule, error) {
+	r := &Rule{}
+	p.out = r
+	p.seen = map[string]bool{}
+	if !p.keyword(ActionDrop) {
+		return nil, fmt.Errorf("must start with %q", ActionDrop)
+	}
+	r.Action = ActionDrop
+	t := p.next()
+	if t == nil || t.kind != tokWord || isKeyword(t.text) {
+		return nil, fmt.Errorf("expected a log name after %q", ActionDrop)
+	}
+	r.Log = strings.TrimSuffix(strings.ToLower(t.text), ".log")
+	if !p.keyword("where") {
+		return nil, fmt.Errorf("expected \"where\" after log name %q", t.text)
+	}
+	cond, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t != nil {
+		return nil, fmt.Errorf("unexpected %q", t.text)
+	}
+	r.cond = cond
+	return r, nil
+}
+
+func (p *parser) or() (node, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (node, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) not() (node, error) {
+	if p.keyword("not") {
+		n, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.next()
+	if t == nil {
+		return nil, fmt.Errorf("unexpected end of rule")
+	}
+	if t.kind == tokLParen {
+		n, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c == nil || c.kind != tokRParen {
+			return nil, fmt.Errorf("missing \")\"")
+		}
+		return n, nil
+	}
+	if t.kind != tokWord || isKeyword(t.text) {
+		return nil, fmt.Errorf("expected a field name, got %q", t.text)
+	}
+	field := t.text
+	if !p.seen[field] {
+		p.seen[field] = true
+		p.out.fields = append(p.out.fields, field)
+	}
+
+	cmp := &cmpNode{field: field}
+	switch {
+	case p.keyword("in"):
+		cmp.op = "in"
+	case p.keyword("not"):
+		if !p.keyword("in") {
+			return nil, fmt.Errorf("expected \"in\" after \"%s not\"", field)
+		}
+		cmp.op = "not in"
+	default:
+		op := p.next()
+		if op == nil || op.kind != tokOp {
+			return nil, fmt.Errorf("expected an operator after %q", field)
+		}
+		cmp.op = op.text
+	}
+
+	if cmp.op == "in" || cmp.op == "not in" {
+		vals, err := p.list()
+		if err != nil {
+			return nil, err
+		}
+		cmp.values = vals
+	} else {
+		v := p.next()
+		if v == nil || (v.kind != tokWord && v.kind != tokString) {
+			return nil, fmt.Errorf("expected a value after %s %s", field, cmp.op)
+		}
+		cmp.values = []string{v.text}
+	}
+	if cmp.op == "=~" {
+		re, err := regexp.Compile(cmp.values[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %w", cmp.values[0], err)
+		}
+		cmp.re = re
+	}
+	return cmp, nil
+}
+
+// list parses "(v1, v2, ...)". A single unparenthesized value is also accepted.
+func (p *parser) list() ([]string, error) {
+	t := p.next()
+	if t == nil {
+		return nil, fmt.Errorf("expected a value list")
+	}
+	if t.kind == tokWord || t.kind == tokString {
+		return []string{t.text}, nil
+	}
+	if t.kind != tokLParen {
+		return nil, fmt.Errorf("expected \"(\" to start a value list, got %q", t.text)
+	}
+	var vals []string
+	for {
+		v := p.next()
+		if v == nil || (v.kind != tokWord && v.kind != tokString) {
+			return nil, fmt.Errorf("expected a value in list")
+		}
+		vals = append(vals, v.text)
+		sep := p.next()
+		if sep == nil {
+			return nil, fmt.Errorf("missing \")\" after value list")
+		}
+		if sep.kind == tokRParen {
+			return vals, nil
+		}
+		if sep.kind != tokComma {
+			return nil, fmt.Errorf("expected \",\" or \")\" in value list, got %q", sep.text)
+		}
+	}
+}
+
+func isKeyword(w string) bool {
+	switch strings.ToLower(w) {
+	case "and", "or", "not", "in", "where", "drop":
+		return true
+	}
+	return false
+}
+
+// --- evaluation ------------------------------------------------------------
+
+type bindEnv struct {
+	index  map[string]int
+	types  []string
+	setSep string
+}
+
+type node interface {
+	bind(env *bindEnv) func(cols []string) bool
+}
+
+type andNode struct{ l, r node }
+type orNode struct{ l, r node }
+type notNode struct{ n node }
+
+func (n andNode) bind(env *bindEnv) func([]string) bool {
+	l, r := n.l.bind(env), n.r.bind(env)
+	return func(cols []string) bool { return l(cols) && r(cols) }
+}
+
+func (n orNode) bind(env *bindEnv) func([]string) bool {
+	l, r := n.l.bind(env), n.r.bind(env)
+	return func(cols []string) bool { return l(cols) || r(cols) }
+}
+
+func (n notNode) bind(env *bindEnv) func([]string) bool {
+	inner := n.n.bind(env)
+	return func(cols []string) bool { return !inner(cols) }
+}
+
+// valueKind is how a column's values are compared.
+type valueKind int
+
+const (
+	kindString valueKind = iota
+	kindNumber
+	kindAddr
+	kindBool
+)
+
+// kindOf maps a Zeek #types entry (element type for set/vector) to a kind.
+func kindOf(zeekType string) (kind valueKind, multi bool) {
+	t := zeekType
+	if open := strings.IndexByte(t, '['); open >= 0 && strings.HasSuffix(t, "]") {
+		multi = true
+		t = t[open+1 : len(t)-1]
+	}
+	switch t {
+	case "count", "int", "port", "double", "time", "interval":
+		return kindNumber, multi
+	case "addr":
+		return kindAddr, multi
+	case "bool":
+		return kindBool, multi
+	}
+	return kindString, multi
+}
+
+type cmpNode struct {
+	field  string
+	op     string
+	values []string
+	re     *regexp.Regexp
+}
+
+// operand is a literal pre-parsed for one value kind.
+type operand struct {
+	raw  string
+	num  float64
+	ok   bool // num, ip or subnet parsed successfully
+	ip   net.IP
+	cidr *net.IPNet
+}
+
+func (n *cmpNode) bind(env *bindEnv) func([]string) bool {
+	col := env.index[n.field]
+	kind, multi := kindString, false
+	if col < len(env.types) {
+		kind, multi = kindOf(env.types[col])
+	} else if n.op == "<" || n.op == "<=" || n.op == ">" || n.op == ">=" {
+		kind = kindNumber
+	}
+
+	ops := make([]operand, len(n.values))
+	for i, v := range n.values {
+		o := operand{raw: v}
+		switch kind {
+		case kindNumber:
+			f, err := strconv.ParseFloat(v, 64)
+			o.num, o.ok = f, err == nil
+		case kindAddr:
+			if _, c, err := net.ParseCIDR(v); err == nil {
+				o.cidr, o.ok = c, true
+			} else if ip := net.ParseIP(v); ip != nil {
+				o.ip, o.ok = ip, true
+			}
+		case kindBool:
+			switch strings.ToLower(v) {
+			case "true", "t":
+				o.raw = "T"
+			case "false", "f":
+				o.raw = "F"
+			}
+		}
+		ops[i] = o
+	}
+
+	matchOne := func(cell string) bool {
+		switch n.op {
+		case "=~":
+			return n.re.MatchString(cell)
+		case "==", "in":
+			for _, o := range ops {
+				if equalValue(kind, cell, o) {
+					return true
+				}
+			}
+			return false
+		case "!=", "not in":
+			for _, o := range ops {
+				if equalValue(kind, cell, o) {
+					return false
+				}
+			}
+			return true
+		}
+		return orderValue(kind, cell, n.op, ops[0])
+	}
+
+	negated := n.op == "!=" || n.op == "not in"
+	return func(cols []string) bool {
+		if col >= len(cols) {
+			return false
+		}
+		cell := cols[col]
+		if cell == "-" || cell == "(empty)" {
+			// Unset values only compare against an explicit "-" literal.
+			for _, o := range ops {
+				if o.raw == "-" {
+					return !negated
+				}
+			}
+			return false
+		}
+		if !multi {
+			return matchOne(cell)
+		}
+		elems := strings.Split(cell, env.setSep)
+		if negated {
+			// "!=" / "not in" on a set: no element may match.
+			for _, e := range elems {
+				if !matchOne(e) {
+					return false
+				}
+			}
+			return true
+		}
+		for _, e := range elems {
+			if matchOne(e) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func equalValue(kind valueKind, cell string, o operand) bool {
+	switch kind {
+	case kindNumber:
+		f, err := strconv.ParseFloat(cell, 64)
+		return o.ok && err == nil && f == o.num
+	case kindAddr:
+		ip := net.ParseIP(cell)
+		if ip == nil || !o.ok {
+			return cell == o.raw
+		}
+		if o.cidr != nil {
+			return o.cidr.Contains(ip)
+		}
+		return ip.Equal(o.ip)
+	}
+	return cell == o.raw
+}
+
+func orderValue(kind valueKind, cell, op string, o operand) bool {
+	var c int
+	if kind == kindNumber {
+		f, err := strconv.ParseFloat(cell, 64)
+		if err != nil || !o.ok {
+			return false
+		}
+		switch {
+		case f < o.num:
+			c = -1
+		case f > o.num:
+			c = 1
+		}
+	} else {
+		c = strings.Compare(cell, o.raw)
+	}
+	switch op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
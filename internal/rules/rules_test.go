@@ -0,0 +1,124 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+)
+
+var connFields = []string{"ts", "uid", "id.orig_h", "id.orig_p", "id.resp_h", "id.resp_p", "proto", "service", "duration", "tunnel_parents"}
+var connTypes = []string{"time", "string", "addr", "port", "addr", "port", "enum", "string", "interval", "set[string]"}
+
+func connRow(origH, respH, respP, proto, service, duration, parents string) []string {
+	return []string{"1700000000.0", "C1", origH, "5000", respH, respP, proto, service, duration, parents}
+}
+
+func TestParse_Errors(t *testing.T) {
+	bad := []string{
+		"",
+		"keep conn where proto == tcp",
+		"drop conn proto == tcp",
+		"drop where proto == tcp",
+		"drop conn where",
+		"drop conn where proto",
+		"drop conn where proto ==",
+		"drop conn where proto = tcp",
+		"drop conn where id.resp_p in (873, 445",
+		"drop conn where id.resp_p in (873 445)",
+		"drop conn where (proto == tcp",
+		"drop conn where proto == tcp extra",
+		`drop conn where service == "unterminated`,
+		"drop conn where service =~ \"[\"",
+		"drop conn where proto not == tcp",
+	}
+	for _, s := range bad {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", s)
+		}
+	}
+}
+
+func TestParse_Normalizes(t *testing.T) {
+	r, err := Parse("  DROP   conn.log  WHERE proto == tcp ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Log != "conn" || r.Action != ActionDrop {
+		t.Errorf("got log=%q action=%q", r.Log, r.Action)
+	}
+	if r.Text != "DROP conn.log WHERE proto == tcp" {
+		t.Errorf("Text = %q", r.Text)
+	}
+	if !r.AppliesTo("conn") || r.AppliesTo("dns") {
+		t.Error("AppliesTo mismatch")
+	}
+	all, _ := Parse("drop * where proto == tcp")
+	if !all.AppliesTo("dns") {
+		t.Error("* rule should apply to every log")
+	}
+}
+
+func TestSplit(t *testing.T) {
+	got := Split(`drop conn where proto == tcp; ; drop dns where query == "a;b" ;`)
+	want := []string{"drop conn where proto == tcp", `drop dns where query == "a;b"`}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Split = %q, want %q", got, want)
+	}
+	rs, err := ParseList(`drop conn where proto == tcp; drop dns where query == "a;b"`)
+	if err != nil || len(rs) != 2 {
+		t.Fatalf("ParseList = %v, %v", rs, err)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		rule string
+		row  []string
+		want bool
+	}{
+		{"drop conn where id.resp_p in (873, 445) and proto == tcp", connRow("10.0.0.1", "10.0.0.2", "445", "tcp", "-", "1.5", "-"), true},
+		{"drop conn where id.resp_p in (873, 445) and proto == tcp", connRow("10.0.0.1", "10.0.0.2", "445", "udp", "-", "1.5", "-"), false},
+		{"drop conn where id.resp_p in (873, 445) and proto == tcp", connRow("10.0.0.1", "10.0.0.2", "443", "tcp", "-", "1.5", "-"), false},
+		{"drop conn where id.resp_p not in (80, 443)", connRow("10.0.0.1", "10.0.0.2", "22", "tcp", "-", "1", "-"), true},
+		{"drop conn where id.resp_p == 443.0", connRow("10.0.0.1", "10.0.0.2", "443", "tcp", "-", "1", "-"), true},
+		{"drop conn where duration < 0.5", connRow("10.0.0.1", "10.0.0.2", "22", "tcp", "-", "0.25", "-"), true},
+		{"drop conn where duration >= 0.5", connRow("10.0.0.1", "10.0.0.2", "22", "tcp", "-", "0.25", "-"), false},
+		{"drop conn where duration > 0", connRow("10.0.0.1", "10.0.0.2", "22", "tcp", "-", "-", "-"), false},
+		{"drop conn where duration == -", connRow("10.0.0.1", "10.0.0.2", "22", "tcp", "-", "-", "-"), true},
+		{"drop conn where service != -", connRow("10.0.0.1", "10.0.0.2", "22", "tcp", "-", "1", "-"), false},
+		{"drop conn where service != -", connRow("10.0.0.1", "10.0.0.2", "22", "tcp", "ssh", "1", "-"), true},
+		{"drop conn where service != dns", connRow("10.0.0.1", "10.0.0.2", "22", "tcp", "-", "1", "-"), false},
+		{"drop conn where id.resp_h in (10.0.0.0/8, 192.168.1.1)", connRow("1.1.1.1", "10.9.9.9", "22", "tcp", "-", "1", "-"), true},
+		{"drop conn where id.resp_h in (10.0.0.0/8, 192.168.1.1)", connRow("1.1.1.1", "192.168.1.1", "22", "tcp", "-", "1", "-"), true},
+		{"drop conn where id.resp_h == fd00::/8", connRow("1.1.1.1", "fd00::1", "22", "tcp", "-", "1", "-"), true},
+		{"drop conn where id.resp_h == 10.0.0.0/8", connRow("1.1.1.1", "11.0.0.1", "22", "tcp", "-", "1", "-"), false},
+		{`drop conn where service =~ "^ss"`, connRow("1.1.1.1", "10.0.0.1", "22", "tcp", "ssh", "1", "-"), true},
+		{"drop conn where tunnel_parents == CabC", connRow("1.1.1.1", "10.0.0.1", "22", "tcp", "-", "1", "CaaA,CabC"), true},
+		{"drop conn where tunnel_parents != CabC", connRow("1.1.1.1", "10.0.0.1", "22", "tcp", "-", "1", "CaaA,CabC"), false},
+		{"drop conn where not (proto == tcp or proto == udp)", connRow("1.1.1.1", "10.0.0.1", "0", "icmp", "-", "1", "-"), true},
+		{"drop conn where proto == udp or proto == tcp and id.resp_p == 22", connRow("1.1.1.1", "10.0.0.1", "53", "udp", "-", "1", "-"), true},
+		{"drop conn where proto == udp or proto == tcp and id.resp_p == 22", connRow("1.1.1.1", "10.0.0.1", "23", "tcp", "-", "1", "-"), false},
+	}
+	for _, tt := range tests {
+		r, err := Parse(tt.rule)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.rule, err)
+		}
+		b := r.Bind(connFields, connTypes, ",")
+		if b == nil {
+			t.Fatalf("Bind(%q) = nil", tt.rule)
+		}
+		if got := b.Match(tt.row); got != tt.want {
+			t.Errorf("%q on %v = %v, want %v", tt.rule, tt.row, got, tt.want)
+		}
+	}
+}
+
+func TestBind_MissingField(t *testing.T) {
+	r, err := Parse("drop * where not query == example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := r.Bind(connFields, connTypes, ","); b != nil {
+		t.Error("rule referencing an absent column must not bind")
+	}
+}
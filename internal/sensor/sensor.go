@@ -16,10 +16,12 @@ import (
 
 	"EnigmaNetz/Enigma-Go-Sensor/config"
 	"EnigmaNetz/Enigma-Go-Sensor/internal/api"
+	"EnigmaNetz/Enigma-Go-Sensor/internal/assets"
 	"EnigmaNetz/Enigma-Go-Sensor/internal/capture/common"
 	"EnigmaNetz/Enigma-Go-Sensor/internal/pcapingest"
 	types "EnigmaNetz/Enigma-Go-Sensor/internal/processor/common"
-	"EnigmaNetz/Enigma-Go-Sensor/internal/processor/common/zeekscripts"
+	"EnigmaNetz/Enigma-Go-Sensor/internal/processor/common/beacon"
+	"EnigmaNetz/Enigma-Go-Sensor/internal/zeeklive"
 	"archive/zip"
 	"runtime"
 )
@@ -42,6 +44,18 @@ type Uploader interface {
 	UploadLogs(ctx context.Context, files api.LogFiles) error
 }
 
+// LogProcessor processes a directory of Zeek logs that were not produced
+// from a PCAP, as live Zeek mode rotates them.
+type LogProcessor interface {
+	ProcessLogs(runDir string, opts types.ProcessOptions) (types.ProcessedData, error)
+}
+
+// ZeekChecker is implemented by processors that can dry-run the sensor's
+// Zeek scripts with the Zeek they run, at startup.
+type ZeekChecker interface {
+	CheckZeek(opts types.ProcessOptions) (types.ZeekCheck, error)
+}
+
 // validateZipPath checks if a zip entry path is safe from directory traversal attacks
 func validateZipPath(path string) error {
 	// Check for ".." path traversal elements
@@ -135,87 +149,192 @@ func ensureZeekWindows() error {
 		}
 	}
 
-	// Write the embedded sampling and DHCP fingerprint scripts into the Windows
-	// Zeek runtime's custom-scripts directory and load them from main.zeek. The
-	// scripts are embedded in the binary (see the zeekscripts package), so this no
-	// longer depends on a repo-relative zeek-scripts/ directory shipped alongside
-	// the executable.
-	customScriptsDir := filepath.Join(zeekDir, "zeek-runtime-win64", "share", "zeek", "site", "custom-scripts")
-	mainZeekPath := filepath.Join(customScriptsDir, "main.zeek")
+	// The sensor's Zeek scripts are not installed into the runtime: each run
+	// materializes the embedded scripts into its own directory (see
+	// types.BuildZeekArgs).
+	return nil
+}
 
-	if _, err := zeekscripts.Materialize(customScriptsDir, zeekscripts.Sampling); err != nil {
-		log.Printf("[sensor] Warning: Failed to write sampling script to Windows Zeek runtime: %v", err)
-	} else {
-		log.Printf("[sensor] Successfully wrote sampling script to Windows Zeek runtime")
-		if err := addSamplingScriptToMainZeek(mainZeekPath); err != nil {
-			log.Printf("[sensor] Warning: Failed to update main.zeek: %v", err)
+// ingestOptions derives the PCAP ingest watcher's processing knobs from the
+// live ones. Ingested files can be far larger than a capture window, so only
+// they are split to run several Zeeks at once. They also hold traffic from
+// another time, so they get their own beacon history, kept in memory only,
+// and no continuity tracker: neither should link them with live windows.
+// Nor do they update the asset inventory, which expires devices by wall clock
+// and would take an old capture's devices for new or changed ones.
+func ingestOptions(cfg *config.Config, opts types.ProcessOptions) types.ProcessOptions {
+	opts.Shards = cfg.PcapIngest.Shards
+	opts.ShardMinBytes = int64(cfg.PcapIngest.ShardMinMB) << 20
+	opts.Continuity = nil
+	opts.Assets = nil
+	if opts.Beacons != nil {
+		opts.Beacons = newBeaconTracker(cfg)
+	}
+	return opts
+}
+
+// processOptions builds the per-run processing knobs from the config. Live
+// captures and the PCAP ingest watcher share it so both paths filter and sample
+// identically.
+func processOptions(cfg *config.Config) types.ProcessOptions {
+	opts := types.ProcessOptions{
+		SamplingPercentage: cfg.Zeek.SamplingPercentage,
+		SubnetSampling:     cfg.SubnetSamplingList(),
+		MonitoredSubnets:   cfg.MonitoredSubnetList(),
+		ExcludedSubnets:    cfg.ExcludedSubnetList(),
+		ExcludedDomains:    cfg.ExcludedDomainList(),
+		FilterRules:        cfg.FilterRuleList(),
+		OutputEncoding:     cfg.Zeek.OutputEncoding,
+		CommunityIDSeed:    uint16(cfg.Zeek.CommunityIDSeed),
+		GeoIPPath:          cfg.Zeek.GeoIPPath,
+		OUIPaths:           cfg.OUIPathList(),
+		IntelDir:           cfg.Zeek.IntelDir,
+		ValidateSchemas:    cfg.Validation.Enabled,
+		QuarantineDir:      cfg.Validation.QuarantineDir,
+		Health: types.HealthThresholds{
+			CaptureLossPercent: cfg.HealthCaptureLossThreshold(),
+			ReporterErrors:     cfg.Zeek.HealthReporterErrors,
+		},
+		UploadAssets: cfg.Assets.Enabled && cfg.Assets.Upload,
+		DeviceEvents: cfg.Assets.Enabled && cfg.Assets.DeviceEvents,
+		MemoryLimit:  int64(cfg.Capture.WorkerMemoryMB) << 20,
+	}
+	if cfg.DNSAnomalies.Enabled {
+		opts.DNSAnomalies = &types.DNSAnomalyThresholds{
+			MinUniqueNames: cfg.DNSAnomalies.MinUniqueNames,
+			Entropy:        cfg.DNSEntropyThreshold(),
+			QueryLength:    float64(cfg.DNSAnomalies.QueryLengthThreshold),
+			TXTQueries:     cfg.DNSAnomalies.TXTThreshold,
+			MinNXDomains:   cfg.DNSAnomalies.MinNXDomains,
+			NXDomainRatio:  cfg.DNSNXDomainRatio(),
+			DGAEntropy:     cfg.DNSDGAEntropyThreshold(),
 		}
 	}
-
-	if _, err := zeekscripts.Materialize(customScriptsDir, zeekscripts.DHCP); err != nil {
-		log.Printf("[sensor] Warning: Failed to write DHCP fingerprint script to Windows Zeek runtime: %v", err)
-	} else {
-		log.Printf("[sensor] Successfully wrote DHCP fingerprint script to Windows Zeek runtime")
-		if err := addFingerprintScriptToMainZeek(mainZeekPath); err != nil {
-			log.Printf("[sensor] Warning: Failed to update main.zeek for DHCP fingerprint: %v", err)
+	if cfg.EncryptedDNS.Enabled {
+		opts.EncryptedDNS = true
+		opts.ResolversPath = cfg.EncryptedDNS.ResolversPath
+	}
+	if cfg.Summary.Enabled {
+		opts.Summary = &types.SummaryOptions{
+			TopTalkers: cfg.Summary.TopTalkers,
+			Only:       cfg.Summary.Upload == config.SummaryUploadInstead,
 		}
 	}
-
-	return nil
+	return opts
 }
 
-// addSamplingScriptToMainZeek adds the sampling script load directive to main.zeek if not already present
-func addSamplingScriptToMainZeek(mainZeekPath string) error {
-	// Read the current main.zeek file
-	content, err := os.ReadFile(mainZeekPath)
+// checkZeek dry-runs the sensor's scripts with the Zeek that will run them,
+// the live Zeek at zeek.path in live mode and the processor's otherwise,
+// according to zeek.script_check. In degrade mode the features the Zeek
+// cannot run are reported and disabled in opts; in strict mode they stop
+// the sensor.
+func checkZeek(cfg *config.Config, processor Processor, opts *types.ProcessOptions, live bool) error {
+	if cfg.Zeek.ScriptCheck == config.ScriptCheckOff {
+		return nil
+	}
+	var check types.ZeekCheck
+	var err error
+	if live {
+		path := cfg.Zeek.Path
+		if path == "" {
+			path = zeeklive.DefaultZeekPath
+		}
+		check, err = types.CheckZeek(path, types.LocalZeek(path), *opts, true)
+	} else if checker, ok := processor.(ZeekChecker); ok {
+		check, err = checker.CheckZeek(*opts)
+	} else {
+		return nil
+	}
 	if err != nil {
-		return fmt.Errorf("failed to read main.zeek: %w", err)
+		return fmt.Errorf("zeek script check: %w", err)
 	}
-
-	contentStr := string(content)
-	samplingLoadDirective := "@load ./sampling.zeek"
-
-	// Check if the sampling script is already loaded
-	if strings.Contains(contentStr, samplingLoadDirective) {
-		log.Printf("[sensor] Sampling script already loaded in main.zeek")
+	if len(check.Disabled) == 0 {
+		log.Printf("[sensor] Zeek %s at %s parses all of the sensor's scripts", check.Version, check.Path)
 		return nil
 	}
-
-	// Add the sampling script load directive
-	updatedContent := contentStr + "\n" + samplingLoadDirective + "\n"
-
-	// Write the updated content back
-	if err := os.WriteFile(mainZeekPath, []byte(updatedContent), 0644); err != nil {
-		return fmt.Errorf("failed to write updated main.zeek: %w", err)
+	report := check.Report()
+	if cfg.Zeek.ScriptCheck == config.ScriptCheckStrict {
+		return fmt.Errorf("zeek %s at %s cannot run all of the sensor's scripts (zeek.script_check is %q): %s", check.Version, check.Path, config.ScriptCheckStrict, strings.Join(report, "; "))
+	}
+	opts.DisabledFeatures = make(map[string]bool, len(check.Disabled))
+	for feature := range check.Disabled {
+		opts.DisabledFeatures[feature] = true
+	}
+	log.Printf("[sensor] WARNING: Zeek %s at %s cannot run all of the sensor's scripts; running with %d features disabled", check.Version, check.Path, len(report))
+	for _, line := range report {
+		log.Printf("[sensor] WARNING: Zeek feature %s", line)
 	}
-
-	log.Printf("[sensor] Added sampling script load directive to main.zeek")
 	return nil
 }
 
-// addFingerprintScriptToMainZeek adds the DHCP fingerprint script load directive to main.zeek if not already present
-func addFingerprintScriptToMainZeek(mainZeekPath string) error {
-	content, err := os.ReadFile(mainZeekPath)
-	if err != nil {
-		return fmt.Errorf("failed to read main.zeek: %w", err)
-	}
+// beaconHistoryPath is where the beacon history is kept across restarts.
+func beaconHistoryPath(cfg *config.Config) string {
+	return filepath.Join(cfg.Buffering.Dir, "beacons", "history.gob")
+}
 
-	contentStr := string(content)
-	fingerprintLoadDirective := "@load ./dhcp-fingerprint.zeek"
+// newBeaconTracker returns an empty beacon tracker configured from cfg.
+func newBeaconTracker(cfg *config.Config) *beacon.Tracker {
+	return beacon.New(beacon.Config{
+		Lookback:       time.Duration(cfg.Beacons.LookbackHours) * time.Hour,
+		MinConnections: cfg.Beacons.MinConnections,
+		Threshold:      cfg.BeaconScoreThreshold(),
+		MaxPairs:       cfg.Beacons.MaxPairs,
+	})
+}
 
-	if strings.Contains(contentStr, fingerprintLoadDirective) {
-		log.Printf("[sensor] DHCP fingerprint script already loaded in main.zeek")
-		return nil
+// openBeaconTracker returns a beacon tracker configured from cfg with the
+// history saved by the previous run, if any. A missing or unreadable history
+// only means beacons take a lookback to show again.
+func openBeaconTracker(cfg *config.Config) *beacon.Tracker {
+	tracker := newBeaconTracker(cfg)
+	f, err := os.Open(beaconHistoryPath(cfg))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("[sensor] Warning: beacon history unavailable: %v", err)
+		}
+		return tracker
 	}
-
-	updatedContent := contentStr + "\n" + fingerprintLoadDirective + "\n"
-
-	if err := os.WriteFile(mainZeekPath, []byte(updatedContent), 0644); err != nil {
-		return fmt.Errorf("failed to write updated main.zeek: %w", err)
+	defer f.Close()
+	if err := tracker.Load(f); err != nil {
+		log.Printf("[sensor] Warning: discarding beacon history: %v", err)
+		return tracker
 	}
+	log.Printf("[sensor] Beacon history loaded with %d connection pairs", tracker.Len())
+	return tracker
+}
 
-	log.Printf("[sensor] Added DHCP fingerprint script load directive to main.zeek")
-	return nil
+// beaconSaveMu serializes saveBeaconTracker, which workers call as they
+// finish their windows and which shares one temporary file.
+var beaconSaveMu sync.Mutex
+
+// saveBeaconTracker writes the tracker's history to path, replacing the
+// previous one only once it is complete.
+func saveBeaconTracker(tracker *beacon.Tracker, path string) {
+	beaconSaveMu.Lock()
+	defer beaconSaveMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		log.Printf("[sensor] Warning: could not save beacon history: %v", err)
+		return
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		log.Printf("[sensor] Warning: could not save beacon history: %v", err)
+		return
+	}
+	err = tracker.Save(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		log.Printf("[sensor] Warning: could not save beacon history: %v", err)
+		return
+	}
+	log.Printf("[sensor] Beacon history saved with %d connection pairs", tracker.Len())
 }
 
 // deletePCAPFile deletes the given PCAP file and logs the result.
@@ -237,9 +356,9 @@ func deletePCAPFile(pcapPath string, logPrefix string) {
 	}
 }
 
-// deleteZeekOutDir removes the zeek output directory containing the given PCAP file.
-func deleteZeekOutDir(pcapPath string, logPrefix string) {
-	zeekDir := filepath.Dir(pcapPath)
+// deleteRunDir removes a zeek_out_* run directory: the one a capture's PCAP
+// is in, or a live Zeek window.
+func deleteRunDir(zeekDir string, logPrefix string) {
 	if !strings.HasPrefix(filepath.Base(zeekDir), "zeek_out_") {
 		log.Printf("%s Refusing to delete directory %s: not a zeek_out_* folder", logPrefix, zeekDir)
 		return
@@ -253,7 +372,8 @@ func deleteZeekOutDir(pcapPath string, logPrefix string) {
 
 // RunSensor orchestrates capture, processing, and upload with graceful shutdown
 // If disableSignals is true, signal handling is skipped (for tests)
-// If skipEnsureZeek is true, ensureZeekWindows is not called (for tests)
+// If skipEnsureZeek is true, ensureZeekWindows and checkZeek are not called
+// (for tests)
 func RunSensor(ctx context.Context, cfg *config.Config, capturer Capturer, processor Processor, uploader Uploader, disableSignalsAndSkipZeek ...bool) (retErr error) {
 	skipEnsureZeek := false
 	disableSignals := false
@@ -270,6 +390,21 @@ func RunSensor(ctx context.Context, cfg *config.Config, capturer Capturer, proce
 		}
 	}
 
+	// Live mode feeds the logs of a long-lived Zeek straight to the
+	// processing stages, which the processor has to expose.
+	live := cfg.Capture.Mode == config.CaptureModeLive
+	var logProcessor LogProcessor
+	if live {
+		if runtime.GOOS == "windows" {
+			return fmt.Errorf("capture.mode %q is not supported on Windows", config.CaptureModeLive)
+		}
+		lp, ok := processor.(LogProcessor)
+		if !ok {
+			return fmt.Errorf("capture.mode %q: processor cannot process Zeek logs without a PCAP", config.CaptureModeLive)
+		}
+		logProcessor = lp
+	}
+
 	outputDir := cfg.Capture.OutputDir
 	window := time.Duration(cfg.Capture.WindowSeconds) * time.Second
 	loop := cfg.Capture.Loop
@@ -281,6 +416,42 @@ func RunSensor(ctx context.Context, cfg *config.Config, capturer Capturer, proce
 	pcapQueue := make(chan string, maxWorkers)
 	var wg sync.WaitGroup
 
+	opts := processOptions(cfg)
+	if !skipEnsureZeek {
+		if err := checkZeek(cfg, processor, &opts, live); err != nil {
+			return err
+		}
+	}
+
+	// The asset inventory is shared by every worker and the ingest watcher.
+	// It is registered for closing before the deferred wait for the workers,
+	// so it is closed after them. Non-fatal: without it logs are still
+	// processed and uploaded.
+	if cfg.Assets.Enabled {
+		inventory, err := assets.Open(assets.Dir(cfg.Buffering.Dir), time.Duration(cfg.Assets.RetentionDays)*24*time.Hour)
+		if err != nil {
+			log.Printf("[sensor] Warning: asset inventory unavailable: %v", err)
+		} else {
+			log.Printf("[sensor] Asset inventory opened with %d assets", inventory.Len())
+			defer inventory.Close()
+			opts.Assets = inventory
+		}
+	}
+	// Likewise the beacon history. Each worker saves it after every window,
+	// so a crash or a kill loses at most the windows in progress.
+	if cfg.Beacons.Enabled {
+		opts.Beacons = openBeaconTracker(cfg)
+	}
+	// Live Zeek keeps connection state across its windows, so only replayed
+	// captures have connections cut by a window boundary.
+	if cfg.Continuity.Enabled {
+		if live {
+			log.Printf("[sensor] continuity.enabled has no effect in live mode, where connections are not cut by windows")
+		} else {
+			opts.Continuity = types.NewContinuityTracker(time.Duration(cfg.Continuity.EdgeSeconds)*time.Second, time.Duration(cfg.Continuity.MaxGapSeconds)*time.Second)
+		}
+	}
+
 	// Shutdown signaling: close the channel so all workers can detect it
 	shutdownCh := make(chan struct{})
 	var shutdownOnce sync.Once
@@ -288,43 +459,77 @@ func RunSensor(ctx context.Context, cfg *config.Config, capturer Capturer, proce
 		shutdownOnce.Do(func() { close(shutdownCh) })
 	}
 
-	// Processing worker function
+	// finish cleans up after a queued item once it was processed (or failed
+	// to): a capture's PCAP is deleted unless it was quarantined, a live
+	// window is marked processed, and either run directory is deleted when
+	// nothing is retained.
+	finish := func(path, prefix string, quarantined bool) {
+		if live {
+			if err := zeeklive.MarkDone(path); err != nil {
+				log.Printf("%s Failed to mark window %s processed: %v", prefix, path, err)
+			}
+		} else if !quarantined {
+			deletePCAPFile(path, prefix)
+		}
+		if cfg.Capture.RetentionHours != nil && *cfg.Capture.RetentionHours == 0 {
+			runDir := path
+			if !live {
+				runDir = filepath.Dir(path)
+			}
+			deleteRunDir(runDir, prefix)
+		}
+	}
+
+	// Processing worker function. In live mode the queue carries the window
+	// directories of the live Zeek process instead of PCAP paths.
 	worker := func(id int) {
 		defer wg.Done()
 		prefix := fmt.Sprintf("[worker-%d]", id)
-		for pcapPath := range pcapQueue {
-			absPCAPPath, err := filepath.Abs(pcapPath)
+		for path := range pcapQueue {
+			absPath, err := filepath.Abs(path)
 			if err != nil {
-				log.Printf("%s Failed to get absolute path for PCAP: %v", prefix, err)
+				log.Printf("%s Failed to get absolute path for %s: %v", prefix, path, err)
 				continue
 			}
-			if _, err := os.Stat(absPCAPPath); err != nil {
-				log.Printf("%s PCAP file does not exist or is not accessible: %v", prefix, err)
+			if _, err := os.Stat(absPath); err != nil {
+				log.Printf("%s %s does not exist or is not accessible: %v", prefix, path, err)
 				continue
 			}
-			log.Printf("%s Processing PCAP file at absolute path: %s", prefix, absPCAPPath)
 
-			result, err := processor.ProcessPCAP(absPCAPPath, types.ProcessOptions{
-				SamplingPercentage: cfg.Zeek.SamplingPercentage,
-				ExcludedSubnets:    cfg.ExcludedSubnetList(),
-			})
+			var result types.ProcessedData
+			if live {
+				log.Printf("%s Processing live Zeek window at absolute path: %s", prefix, absPath)
+				result, err = logProcessor.ProcessLogs(absPath, opts)
+			} else {
+				log.Printf("%s Processing PCAP file at absolute path: %s", prefix, absPath)
+				result, err = processor.ProcessPCAP(absPath, opts)
+			}
+			if opts.Beacons != nil {
+				saveBeaconTracker(opts.Beacons, beaconHistoryPath(cfg))
+			}
 			if err != nil {
 				log.Printf("%s Processing failed: %v", prefix, err)
-				deletePCAPFile(absPCAPPath, prefix)
-				if cfg.Capture.RetentionHours != nil && *cfg.Capture.RetentionHours == 0 {
-					deleteZeekOutDir(absPCAPPath, prefix)
-				}
+				var schemaErr *types.SchemaError
+				finish(absPath, prefix, errors.As(err, &schemaErr) && schemaErr.Quarantine != "")
 				continue
 			}
-			log.Printf("%s Processing complete. Conn XLSX: %s, DNS XLSX: %s, DHCP XLSX: %s, JA3JA4 XLSX: %s, JA4S XLSX: %s, Metadata: %+v", prefix, result.ConnPath, result.DNSPath, result.DHCPPath, result.JA3JA4Path, result.JA4SPath, result.Metadata)
+			log.Printf("%s Processing complete (%s). Conn: %s, DNS: %s, DHCP: %s, JA3JA4: %s, JA4S: %s, Metadata: %+v", prefix, result.Encoding, result.ConnPath, result.DNSPath, result.DHCPPath, result.JA3JA4Path, result.JA4SPath, result.Metadata)
 
 			if uploader != nil {
 				uploadErr := uploader.UploadLogs(ctx, api.LogFiles{
-					DNSPath:    result.DNSPath,
-					ConnPath:   result.ConnPath,
-					DHCPPath:   result.DHCPPath,
-					JA3JA4Path: result.JA3JA4Path,
-					JA4SPath:   result.JA4SPath,
+					DNSPath:          result.DNSPath,
+					ConnPath:         result.ConnPath,
+					DHCPPath:         result.DHCPPath,
+					JA3JA4Path:       result.JA3JA4Path,
+					JA4SPath:         result.JA4SPath,
+					AssetsPath:       result.AssetsPath,
+					DeviceEventsPath: result.DeviceEventsPath,
+					BeaconsPath:      result.BeaconsPath,
+					DNSAnomaliesPath: result.DNSAnomaliesPath,
+					IntelPath:        result.IntelPath,
+					EncryptedDNSPath: result.EncryptedDNSPath,
+					SummaryPath:      result.SummaryPath,
+					Encoding:         result.Encoding,
 				})
 				if uploadErr != nil {
 					if uploadErr == api.ErrAPIGone {
@@ -337,11 +542,8 @@ func RunSensor(ctx context.Context, cfg *config.Config, capturer Capturer, proce
 					log.Printf("%s Log upload successful.", prefix)
 				}
 			}
-			// Only delete the capture file after successful processing and upload attempt
-			deletePCAPFile(absPCAPPath, prefix)
-			if cfg.Capture.RetentionHours != nil && *cfg.Capture.RetentionHours == 0 {
-				deleteZeekOutDir(absPCAPPath, prefix)
-			}
+			// Only clean up after successful processing and upload attempt
+			finish(absPath, prefix, false)
 		}
 		log.Printf("[worker-%d] Exiting worker goroutine", id)
 	}
@@ -357,8 +559,7 @@ func RunSensor(ctx context.Context, cfg *config.Config, capturer Capturer, proce
 			WatchDir:          cfg.PcapIngest.WatchDir,
 			PollInterval:      time.Duration(cfg.PcapIngest.PollIntervalSeconds) * time.Second,
 			FileStableSeconds: cfg.PcapIngest.FileStableSeconds,
-			SamplingPct:       cfg.Zeek.SamplingPercentage,
-			ExcludedSubnets:   cfg.ExcludedSubnetList(),
+			ProcessOptions:    ingestOptions(cfg, opts),
 		}, processor, uploader)
 
 		wg.Add(1)
@@ -418,13 +619,21 @@ func RunSensor(ctx context.Context, cfg *config.Config, capturer Capturer, proce
 		}
 	}
 
-	for {
-		// Clean up old zeek_out_* folders every iteration (skip when 0; worker handles immediate cleanup)
+	// Clean up old zeek_out_* folders (skip when 0; worker handles immediate cleanup)
+	cleanRetained := func() {
 		if cfg.Capture.RetentionHours != nil && *cfg.Capture.RetentionHours > 0 {
 			cleanOldZeekOutFolders(cfg.Capture.OutputDir, *cfg.Capture.RetentionHours)
 		} else if cfg.Capture.RetentionHours == nil {
 			cleanOldZeekOutFolders(cfg.Capture.OutputDir, cfg.Logging.LogRetentionDays*24)
 		}
+	}
+
+	if live {
+		return runLive(ctx, cfg, opts, pcapQueue, closeQueue, shutdownCh, sigCh, cleanRetained)
+	}
+
+	for {
+		cleanRetained()
 		select {
 		case <-ctx.Done():
 			log.Printf("Context canceled, shutting down after current capture...")
@@ -487,3 +696,56 @@ func RunSensor(ctx context.Context, cfg *config.Config, capturer Capturer, proce
 	log.Printf("Shutdown complete.")
 	return nil
 }
+
+// runLive is the main loop of live mode: a supervised Zeek process reads the
+// interface and its rotated windows are queued for the workers until the
+// sensor is stopped. Zeek is stopped, and its last window queued, before the
+// queue is closed.
+func runLive(ctx context.Context, cfg *config.Config, opts types.ProcessOptions, queue chan<- string, closeQueue func(), shutdownCh <-chan struct{}, sigCh <-chan os.Signal, cleanRetained func()) error {
+	iface, err := cfg.GetFirstInterface()
+	if err != nil {
+		closeQueue()
+		return err
+	}
+	window := time.Duration(cfg.Capture.WindowSeconds) * time.Second
+	supervisor := zeeklive.New(zeeklive.Config{
+		ZeekPath:       cfg.Zeek.Path,
+		Interface:      iface,
+		Window:         window,
+		OutputDir:      cfg.Capture.OutputDir,
+		ProcessOptions: opts,
+	})
+	liveCtx, stopLive := context.WithCancel(ctx)
+	defer stopLive()
+	liveDone := make(chan error, 1)
+	go func() { liveDone <- supervisor.Run(liveCtx, queue) }()
+	stop := func() error {
+		stopLive()
+		err := <-liveDone
+		closeQueue()
+		return err
+	}
+
+	cleanRetained()
+	cleanup := time.NewTicker(window)
+	defer cleanup.Stop()
+	for {
+		select {
+		case err := <-liveDone:
+			// Run only returns on its own when Zeek cannot be started.
+			closeQueue()
+			return err
+		case <-ctx.Done():
+			log.Printf("Context canceled, stopping live Zeek...")
+			return stop()
+		case <-shutdownCh:
+			stop()
+			return ErrAPIGone
+		case sig := <-sigCh:
+			log.Printf("Received signal %v, stopping live Zeek...", sig)
+			return stop()
+		case <-cleanup.C:
+			cleanRetained()
+		}
+	}
+}
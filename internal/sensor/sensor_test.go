@@ -4,7 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/netip"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"sync/atomic"
 	"testing"
@@ -12,8 +15,11 @@ import (
 
 	"EnigmaNetz/Enigma-Go-Sensor/config"
 	"EnigmaNetz/Enigma-Go-Sensor/internal/api"
+	"EnigmaNetz/Enigma-Go-Sensor/internal/assets"
 	"EnigmaNetz/Enigma-Go-Sensor/internal/capture/common"
 	types "EnigmaNetz/Enigma-Go-Sensor/internal/processor/common"
+	"EnigmaNetz/Enigma-Go-Sensor/internal/processor/common/beacon"
+	"EnigmaNetz/Enigma-Go-Sensor/internal/zeeklive"
 )
 
 func intPtr(v int) *int { return &v }
@@ -56,6 +62,17 @@ func (m *mockProcessor) ProcessPCAP(pcapPath string, opts types.ProcessOptions)
 	}, nil
 }
 
+// mockLogProcessor also processes live Zeek windows.
+type mockLogProcessor struct {
+	mockProcessor
+	windows chan string
+}
+
+func (m *mockLogProcessor) ProcessLogs(runDir string, opts types.ProcessOptions) (types.ProcessedData, error) {
+	m.windows <- runDir
+	return types.ProcessedData{ConnPath: filepath.Join(runDir, "conn.log")}, nil
+}
+
 type mockUploader struct {
 	calls *int32
 	fail  bool
@@ -99,8 +116,10 @@ func minimalConfig(loop bool) *config.Config {
 			OutputDir            string `json:"output_dir"`
 			WindowSeconds        int    `json:"window_seconds"`
 			Loop                 bool   `json:"loop"`
+			Mode                 string `json:"mode"`
 			Interface            string `json:"interface"`
 			MaxProcessingWorkers int    `json:"max_processing_workers"`
+			WorkerMemoryMB       int    `json:"worker_memory_mb"`
 			RetentionHours       *int   `json:"retention_hours,omitempty"`
 		}{
 			OutputDir:            "/tmp",
@@ -135,6 +154,8 @@ func minimalConfig(loop bool) *config.Config {
 			WatchDir            string `json:"watch_dir"`
 			PollIntervalSeconds int    `json:"poll_interval_seconds"`
 			FileStableSeconds   int    `json:"file_stable_seconds"`
+			Shards              int    `json:"shards"`
+			ShardMinMB          int    `json:"shard_min_mb"`
 		}{},
 	}
 }
@@ -208,6 +229,63 @@ func TestRunSensor_ProcessorError(t *testing.T) {
 	t.Log("TestRunSensor_ProcessorError end reached")
 }
 
+// runDirCapturer writes each capture into its own run directory, as the
+// real capturers do.
+type runDirCapturer struct {
+	dir string
+}
+
+func (c *runDirCapturer) Capture(ctx context.Context, cfg common.CaptureConfig) (string, error) {
+	runDir := filepath.Join(c.dir, "run")
+	if err := os.MkdirAll(runDir, 0o755); err != nil {
+		return "", err
+	}
+	pcapPath := filepath.Join(runDir, "capture.pcap")
+	return pcapPath, os.WriteFile(pcapPath, []byte("pcap"), 0o644)
+}
+
+// truncatingProcessor leaves a conn.log Zeek did not finish beside the PCAP
+// and runs the real post-Zeek pipeline on it.
+type truncatingProcessor struct{}
+
+func (truncatingProcessor) ProcessPCAP(pcapPath string, opts types.ProcessOptions) (types.ProcessedData, error) {
+	runDir := filepath.Dir(pcapPath)
+	conn := "#separator \\x09\n#path\tconn\n" +
+		"#fields\tts\tuid\tid.orig_h\tid.orig_p\tid.resp_h\tid.resp_p\tproto\n" +
+		"#types\ttime\tstring\taddr\tport\taddr\tport\tenum\n" +
+		"1.0\tCa\t10.0.0.1\t50000\t192.0.2.1\t443\ttcp\n"
+	if err := os.WriteFile(filepath.Join(runDir, "conn.log"), []byte(conn), 0o644); err != nil {
+		return types.ProcessedData{}, err
+	}
+	return types.ProcessLogs(runDir, opts, map[string]interface{}{"pcap_path": pcapPath})
+}
+
+func TestRunSensor_Quarantine(t *testing.T) {
+	var upCalls int32
+	cfg := minimalConfig(false)
+	cfg.Validation.Enabled = true
+	cfg.Validation.QuarantineDir = filepath.Join(t.TempDir(), "quarantine")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := RunSensor(ctx, cfg, &runDirCapturer{dir: t.TempDir()}, truncatingProcessor{}, &mockUploader{calls: &upCalls}, true, true)
+	if err != nil {
+		t.Fatalf("RunSensor failed: %v", err)
+	}
+	if upCalls != 0 {
+		t.Errorf("uploaded %d times, want the run quarantined instead", upCalls)
+	}
+	runs, err := os.ReadDir(cfg.Validation.QuarantineDir)
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("quarantined runs %v, err %v", runs, err)
+	}
+	for _, name := range []string{"conn.log", "capture.pcap", types.QuarantineReasonFile} {
+		if _, err := os.Stat(filepath.Join(cfg.Validation.QuarantineDir, runs[0].Name(), name)); err != nil {
+			t.Errorf("%s not quarantined: %v", name, err)
+		}
+	}
+}
+
 func TestRunSensor_QueueFull(t *testing.T) {
 	defer t.Log("TestRunSensor_QueueFull completed")
 	var capCalls, procCalls int32
@@ -281,52 +359,6 @@ func TestRunSensor_ConcurrentWorkers(t *testing.T) {
 	t.Log("TestRunSensor_ConcurrentWorkers end reached")
 }
 
-func TestAddFingerprintScriptToMainZeek_AddsDirective(t *testing.T) {
-	f, err := os.CreateTemp("", "main-*.zeek")
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer os.Remove(f.Name())
-	f.WriteString("@load base/protocols/dhcp\n")
-	f.Close()
-
-	if err := addFingerprintScriptToMainZeek(f.Name()); err != nil {
-		t.Fatalf("unexpected error: %v", err)
-	}
-
-	content, _ := os.ReadFile(f.Name())
-	if !strings.Contains(string(content), "@load ./dhcp-fingerprint.zeek") {
-		t.Errorf("expected directive in main.zeek, got:\n%s", content)
-	}
-}
-
-func TestAddFingerprintScriptToMainZeek_Idempotent(t *testing.T) {
-	f, err := os.CreateTemp("", "main-*.zeek")
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer os.Remove(f.Name())
-	f.WriteString("@load base/protocols/dhcp\n@load ./dhcp-fingerprint.zeek\n")
-	f.Close()
-
-	if err := addFingerprintScriptToMainZeek(f.Name()); err != nil {
-		t.Fatalf("unexpected error: %v", err)
-	}
-
-	content, _ := os.ReadFile(f.Name())
-	count := strings.Count(string(content), "@load ./dhcp-fingerprint.zeek")
-	if count != 1 {
-		t.Errorf("expected directive exactly once, found %d times", count)
-	}
-}
-
-func TestAddFingerprintScriptToMainZeek_MissingFile(t *testing.T) {
-	err := addFingerprintScriptToMainZeek("/nonexistent/path/main.zeek")
-	if err == nil {
-		t.Error("expected error for missing file, got nil")
-	}
-}
-
 func TestValidateZipPath_RejectsPathTraversal(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -352,3 +384,189 @@ func TestValidateZipPath_RejectsPathTraversal(t *testing.T) {
 		})
 	}
 }
+
+func TestRunSensor_Live(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("live mode is not supported on Windows")
+	}
+	out := t.TempDir()
+	zeek := filepath.Join(t.TempDir(), "zeek")
+	if err := os.WriteFile(zeek, []byte("#!/bin/sh\nexec sleep 30\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	window := filepath.Join(out, fmt.Sprintf("%s%d", zeeklive.DirPrefix, time.Now().Unix()-60))
+	if err := os.MkdirAll(window, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := minimalConfig(true)
+	cfg.Capture.Mode = config.CaptureModeLive
+	cfg.Capture.OutputDir = out
+	cfg.Capture.WindowSeconds = 60
+	cfg.Zeek.Path = zeek
+
+	// The capturer and ProcessPCAP are not used in live mode.
+	var capCalls, upCalls int32
+	proc := &mockLogProcessor{mockProcessor: mockProcessor{calls: new(int32)}, windows: make(chan string, 1)}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- RunSensor(ctx, cfg, &mockCapturer{calls: &capCalls}, proc, &mockUploader{calls: &upCalls}, true, true)
+	}()
+	select {
+	case dir := <-proc.windows:
+		if dir != window {
+			t.Errorf("processed %s, want %s", dir, window)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("live window not processed")
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if !zeeklive.Done(window) {
+		t.Error("window not marked processed")
+	}
+	if capCalls != 0 || *proc.calls != 0 || upCalls != 1 {
+		t.Errorf("capture calls %d, ProcessPCAP calls %d, uploads %d", capCalls, *proc.calls, upCalls)
+	}
+
+	// A processor without ProcessLogs cannot run live.
+	if err := RunSensor(context.Background(), cfg, &mockCapturer{calls: &capCalls}, &mockProcessor{calls: new(int32)}, nil, true, true); err == nil {
+		t.Error("expected an error for a processor without ProcessLogs")
+	}
+}
+
+// checkingProcessor reports a fixed Zeek script check.
+type checkingProcessor struct {
+	mockProcessor
+	check types.ZeekCheck
+	err   error
+}
+
+func (c *checkingProcessor) CheckZeek(opts types.ProcessOptions) (types.ZeekCheck, error) {
+	return c.check, c.err
+}
+
+func TestCheckZeek(t *testing.T) {
+	proc := &checkingProcessor{check: types.ZeekCheck{
+		Path:     "/opt/zeek/bin/zeek",
+		Version:  "5.0.0",
+		Disabled: map[string]string{types.FeatureJA3JA4: "exit status 1: error in ja3-ja4-fingerprinting.zeek"},
+	}}
+	cfg := minimalConfig(false)
+
+	// Degraded: the failing feature is disabled.
+	cfg.Zeek.ScriptCheck = config.ScriptCheckDegrade
+	var opts types.ProcessOptions
+	if err := checkZeek(cfg, proc, &opts, false); err != nil {
+		t.Fatal(err)
+	}
+	if !opts.DisabledFeatures[types.FeatureJA3JA4] || len(opts.DisabledFeatures) != 1 {
+		t.Errorf("DisabledFeatures = %v", opts.DisabledFeatures)
+	}
+
+	// Strict: the sensor refuses to start, naming the feature.
+	cfg.Zeek.ScriptCheck = config.ScriptCheckStrict
+	opts = types.ProcessOptions{}
+	if err := checkZeek(cfg, proc, &opts, false); err == nil || !strings.Contains(err.Error(), types.FeatureJA3JA4) {
+		t.Errorf("strict check err = %v", err)
+	}
+
+	// A Zeek that cannot run stops the sensor unless the check is off.
+	proc.err = errors.New("zeek at /opt/zeek/bin/zeek does not run")
+	cfg.Zeek.ScriptCheck = config.ScriptCheckDegrade
+	if err := checkZeek(cfg, proc, &opts, false); err == nil {
+		t.Error("expected an error for a Zeek that does not run")
+	}
+	cfg.Zeek.ScriptCheck = config.ScriptCheckOff
+	if err := checkZeek(cfg, proc, &opts, false); err != nil || opts.DisabledFeatures != nil {
+		t.Errorf("check off: err %v, DisabledFeatures %v", err, opts.DisabledFeatures)
+	}
+
+	// Processors that cannot check are trusted.
+	cfg.Zeek.ScriptCheck = config.ScriptCheckStrict
+	if err := checkZeek(cfg, &mockProcessor{calls: new(int32)}, &opts, false); err != nil {
+		t.Error(err)
+	}
+}
+
+// beaconProcessor observes one connection pair per window.
+type beaconProcessor struct{ mockProcessor }
+
+func (m *beaconProcessor) ProcessPCAP(pcapPath string, opts types.ProcessOptions) (types.ProcessedData, error) {
+	opts.Beacons.Observe(beacon.Key{Orig: netip.MustParseAddr("10.0.0.1"), Resp: netip.MustParseAddr("203.0.113.1"), Port: 443}, time.Unix(1700000000, 0))
+	return m.mockProcessor.ProcessPCAP(pcapPath, opts)
+}
+
+// historyUploader records whether the beacon history was on disk when the
+// window was uploaded.
+type historyUploader struct {
+	path  string
+	saved bool
+}
+
+func (m *historyUploader) UploadLogs(ctx context.Context, files api.LogFiles) error {
+	_, err := os.Stat(m.path)
+	m.saved = err == nil
+	return nil
+}
+
+func TestRunSensor_SavesBeaconHistory(t *testing.T) {
+	cfg := minimalConfig(false)
+	cfg.Buffering.Dir = t.TempDir()
+	cfg.Beacons.Enabled = true
+	cfg.Beacons.LookbackHours = 24
+	cfg.Beacons.MinConnections = 10
+	cfg.Beacons.MaxPairs = 100
+	up := &historyUploader{path: beaconHistoryPath(cfg)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := RunSensor(ctx, cfg, &mockCapturer{calls: new(int32)}, &beaconProcessor{mockProcessor{calls: new(int32)}}, up, true, true); err != nil {
+		t.Fatal(err)
+	}
+	// The history is saved after the window, not only when the sensor stops.
+	if !up.saved {
+		t.Error("beacon history not saved before the window was uploaded")
+	}
+	if tracker := openBeaconTracker(cfg); tracker.Len() != 1 {
+		t.Errorf("saved history has %d pairs, want 1", tracker.Len())
+	}
+}
+
+func TestIngestOptions(t *testing.T) {
+	cfg := minimalConfig(false)
+	cfg.PcapIngest.Shards = 4
+	cfg.PcapIngest.ShardMinMB = 64
+	live := processOptions(cfg)
+	live.Beacons = newBeaconTracker(cfg)
+	live.Continuity = types.NewContinuityTracker(time.Second, time.Minute)
+	inventory, err := assets.Open(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inventory.Close()
+	live.Assets = inventory
+
+	ingest := ingestOptions(cfg, live)
+	if ingest.Shards != 4 || ingest.ShardMinBytes != 64<<20 {
+		t.Errorf("shards = %d, min bytes = %d", ingest.Shards, ingest.ShardMinBytes)
+	}
+	if ingest.Continuity != nil {
+		t.Error("ingest shares the continuity tracker")
+	}
+	if ingest.Beacons == nil || ingest.Beacons == live.Beacons {
+		t.Error("ingest does not have its own beacon tracker")
+	}
+	if ingest.Assets != nil {
+		t.Error("ingest shares the asset inventory")
+	}
+	if live.Shards != 0 || live.Continuity == nil {
+		t.Error("live options were modified")
+	}
+	live.Beacons = nil
+	if ingest := ingestOptions(cfg, live); ingest.Beacons != nil {
+		t.Error("ingest enabled beacons")
+	}
+}
@@ -0,0 +1,349 @@
+// Package zeeklive runs Zeek as one long-lived process reading the capture
+// interface directly, the alternative to capturing a PCAP per window and
+// replaying it with zeek -r. Reading once halves the disk I/O and keeps
+// connection state across window boundaries.
+//
+// Zeek rotates its logs every window into a zeek_out_live_<close> directory
+// of the output directory (see the embedded live.zeek), and the Supervisor
+// hands each completed directory on to be processed like the logs of a
+// replayed capture. If Zeek exits it is restarted, and the logs it left
+// behind are processed as a window of their own. Zeek's output is kept in
+// the spool directory and carried into the next window handed on, where the
+// health report finds it.
+package zeeklive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	types "EnigmaNetz/Enigma-Go-Sensor/internal/processor/common"
+	"EnigmaNetz/Enigma-Go-Sensor/internal/processor/common/zeekscripts"
+)
+
+// DirPrefix starts the name of every window directory, which ends in the
+// window's close time in Unix seconds.
+const DirPrefix = "zeek_out_live_"
+
+// DefaultZeekPath is the Zeek executable used when Config.ZeekPath is empty.
+const DefaultZeekPath = "/opt/zeek/bin/zeek"
+
+const (
+	// spoolDirName is the directory of the output directory Zeek runs in and
+	// writes its current logs to.
+	spoolDirName = "zeek_live"
+	// settingsScript is the generated script with the rotation settings.
+	settingsScript = "live-settings.zeek"
+	// doneMarker is created in a window directory once it was processed, so
+	// a retained directory is not processed again after a restart.
+	doneMarker = ".processed"
+	// settle is how long after its close time a window is handed on, so
+	// every log has been rotated into it.
+	settle = 5 * time.Second
+	// handoffTimeout bounds how long Run waits at shutdown for the last
+	// windows to be taken; the rest are handed on after the next start.
+	handoffTimeout = time.Minute
+)
+
+// Config configures a Supervisor.
+type Config struct {
+	// ZeekPath is the Zeek executable. Empty = DefaultZeekPath.
+	ZeekPath string
+	// Interface is the interface Zeek reads ("any" for all of them).
+	Interface string
+	// Window is the log rotation interval.
+	Window time.Duration
+	// OutputDir is where the window directories are created.
+	OutputDir string
+	// ProcessOptions supply the sampling settings and intel directory Zeek
+	// runs with.
+	ProcessOptions types.ProcessOptions
+	// PollInterval is how often completed windows are looked for.
+	// 0 = one second.
+	PollInterval time.Duration
+}
+
+// Supervisor runs and restarts Zeek and hands on its rotated windows.
+type Supervisor struct {
+	cfg        Config
+	spool      string
+	command    func(ctx context.Context, name string, arg ...string) *exec.Cmd
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	queued     map[string]bool
+	// outputOffset is how much of the running Zeek's ZeekOutputFile in the
+	// spool directory was already carried into a window.
+	outputOffset int64
+}
+
+// New returns a Supervisor for cfg.
+func New(cfg Config) *Supervisor {
+	if cfg.ZeekPath == "" {
+		cfg.ZeekPath = DefaultZeekPath
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	return &Supervisor{
+		cfg:        cfg,
+		spool:      filepath.Join(cfg.OutputDir, spoolDirName),
+		command:    exec.CommandContext,
+		minBackoff: time.Second,
+		maxBackoff: time.Minute,
+		queued:     make(map[string]bool),
+	}
+}
+
+// Run starts Zeek and sends the directory of every completed window to
+// windows until ctx is canceled, restarting Zeek with an exponential backoff
+// whenever it exits. When a window cannot be sent because windows is full it
+// is retried on the next poll, so a busy pipeline delays windows rather than
+// dropping them. On cancellation Zeek is interrupted, which makes it rotate
+// its open logs, and the remaining windows are sent before Run returns.
+// windows is not closed. Only a failure to start Zeek at all is an error.
+func (s *Supervisor) Run(ctx context.Context, windows chan<- string) error {
+	spool, err := filepath.Abs(s.spool)
+	if err != nil {
+		return err
+	}
+	s.spool = spool
+	if err := os.MkdirAll(s.spool, 0o755); err != nil {
+		return fmt.Errorf("create live Zeek directory: %w", err)
+	}
+	backoff := s.minBackoff
+	for {
+		s.salvage()
+		args, err := s.args()
+		if err != nil {
+			return err
+		}
+		cmd := s.command(ctx, s.cfg.ZeekPath, args...)
+		cmd.Dir = s.spool
+		stdout, stderr, closeOutput := types.OpenZeekOutput(s.spool)
+		s.outputOffset = 0
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+		cmd.WaitDelay = 30 * time.Second
+		started := time.Now()
+		if err := cmd.Start(); err != nil {
+			closeOutput()
+			return fmt.Errorf("start zeek: %w", err)
+		}
+		log.Printf("[zeek-live] Zeek started on %s (pid %d), rotating logs every %s: %s %v", s.cfg.Interface, cmd.Process.Pid, s.cfg.Window, s.cfg.ZeekPath, args)
+
+		exited := make(chan error, 1)
+		go func() { exited <- cmd.Wait() }()
+		ticker := time.NewTicker(s.cfg.PollInterval)
+		var exitErr error
+	running:
+		for {
+			select {
+			case exitErr = <-exited:
+				break running
+			case <-ticker.C:
+				s.dispatch(windows, false, nil)
+			}
+		}
+		ticker.Stop()
+		closeOutput()
+		if ctx.Err() != nil {
+			log.Printf("[zeek-live] Zeek stopped")
+			s.shutdown(windows)
+			return nil
+		}
+
+		if time.Since(started) > 2*s.maxBackoff {
+			backoff = s.minBackoff
+		}
+		log.Printf("[zeek-live] Zeek exited unexpectedly (%v); restarting in %s", exitErr, backoff)
+		s.salvage()
+		s.dispatch(windows, true, nil)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			s.shutdown(windows)
+			return nil
+		}
+		backoff = min(2*backoff, s.maxBackoff)
+	}
+}
+
+// shutdown hands on the windows left once Zeek has stopped, waiting for up
+// to handoffTimeout for room in windows.
+func (s *Supervisor) shutdown(windows chan<- string) {
+	s.salvage()
+	ctx, cancel := context.WithTimeout(context.Background(), handoffTimeout)
+	defer cancel()
+	s.dispatch(windows, true, ctx.Done())
+}
+
+// args returns the Zeek command line: the interface, the sensor's scripts
+// materialized into the spool directory, and the rotation settings.
+func (s *Supervisor) args() ([]string, error) {
+	opts := s.cfg.ProcessOptions
+	base := []string{"-i", s.cfg.Interface, "-C", fmt.Sprintf("Log::default_logdir=%s", s.spool)}
+	// Zeek's Intel framework re-reads the intel file whenever dispatch
+	// rewrites it, so feed updates apply without a restart.
+	args := types.BuildZeekArgs(base, s.spool, opts)
+
+	// Rotation is what produces the windows, so it is not optional.
+	args, err := types.AppendZeekScript(args, s.spool, zeekscripts.Live)
+	if err != nil {
+		return nil, fmt.Errorf("live Zeek rotation script: %w", err)
+	}
+	outputDir, err := filepath.Abs(s.cfg.OutputDir)
+	if err != nil {
+		return nil, err
+	}
+	settings := fmt.Sprintf("# Generated by enigma-sensor for live mode; do not edit.\n"+
+		"redef Log::default_rotation_interval = %d secs;\n"+
+		"redef Live::output_dir = \"%s\";\n",
+		int(s.cfg.Window/time.Second), strings.ReplaceAll(filepath.ToSlash(outputDir), `"`, `\"`))
+	settingsPath := filepath.Join(s.spool, settingsScript)
+	if err := os.WriteFile(settingsPath, []byte(settings), 0o600); err != nil {
+		return nil, fmt.Errorf("live Zeek rotation settings: %w", err)
+	}
+	return append(args, settingsPath), nil
+}
+
+// salvage moves the logs Zeek left in the spool directory without rotating
+// them, after a crash, into a window directory of their own.
+func (s *Supervisor) salvage() {
+	logs, _ := filepath.Glob(filepath.Join(s.spool, "*.log"))
+	if len(logs) == 0 {
+		return
+	}
+	closed := time.Now().Unix()
+	dir := filepath.Join(s.cfg.OutputDir, DirPrefix+strconv.FormatInt(closed, 10))
+	for {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			break
+		}
+		closed++
+		dir = filepath.Join(s.cfg.OutputDir, DirPrefix+strconv.FormatInt(closed, 10))
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Printf("[zeek-live] Warning: could not save the logs of the previous Zeek run: %v", err)
+		return
+	}
+	for _, path := range logs {
+		if err := os.Rename(path, filepath.Join(dir, filepath.Base(path))); err != nil {
+			log.Printf("[zeek-live] Warning: could not save %s: %v", filepath.Base(path), err)
+		}
+	}
+	s.carryOutput(dir)
+	log.Printf("[zeek-live] Saved %d unrotated logs of the previous Zeek run to %s", len(logs), dir)
+}
+
+// carryOutput appends what Zeek wrote to its output since the last window
+// was handed on to the ZeekOutputFile of the window directory dir, so the
+// window's health report sees the output of the Zeek that wrote it.
+func (s *Supervisor) carryOutput(dir string) {
+	in, err := os.Open(filepath.Join(s.spool, types.ZeekOutputFile))
+	if err != nil {
+		return
+	}
+	defer in.Close()
+	if _, err := in.Seek(s.outputOffset, io.SeekStart); err != nil {
+		return
+	}
+	out, err := os.OpenFile(filepath.Join(dir, types.ZeekOutputFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		log.Printf("[zeek-live] Warning: could not keep Zeek's output: %v", err)
+		return
+	}
+	defer out.Close()
+	n, err := io.Copy(out, in)
+	s.outputOffset += n
+	if err != nil {
+		log.Printf("[zeek-live] Warning: could not keep Zeek's output: %v", err)
+	}
+}
+
+// dispatch sends the completed windows not yet handed on, oldest first. A
+// window is complete settle after its close time, or at once when all is
+// set, as it is once Zeek has stopped. Windows that do not fit in windows
+// are left for the next call, unless wait is set, in which case dispatch
+// waits for room until wait is closed.
+func (s *Supervisor) dispatch(windows chan<- string, all bool, wait <-chan struct{}) {
+	entries, err := os.ReadDir(s.cfg.OutputDir)
+	if err != nil {
+		log.Printf("[zeek-live] Warning: could not list %s: %v", s.cfg.OutputDir, err)
+		return
+	}
+	type window struct {
+		dir    string
+		closed int64
+	}
+	var ready []window
+	cutoff := time.Now().Add(-settle).Unix()
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() || !strings.HasPrefix(name, DirPrefix) || s.queued[name] {
+			continue
+		}
+		closed, err := strconv.ParseInt(strings.TrimPrefix(name, DirPrefix), 10, 64)
+		if err != nil || (!all && closed > cutoff) {
+			continue
+		}
+		dir := filepath.Join(s.cfg.OutputDir, name)
+		if Done(dir) {
+			continue
+		}
+		ready = append(ready, window{dir, closed})
+	}
+	sort.Slice(ready, func(i, j int) bool { return ready[i].closed < ready[j].closed })
+	sent := 0
+	for _, w := range ready {
+		s.carryOutput(w.dir)
+		if wait != nil {
+			select {
+			case windows <- w.dir:
+			case <-wait:
+				log.Printf("[zeek-live] %d windows left for the next start", len(ready)-sent)
+				return
+			}
+		} else {
+			select {
+			case windows <- w.dir:
+			default:
+				log.Printf("[zeek-live] Processing queue full; %d windows wait for the next poll", len(ready)-sent)
+				return
+			}
+		}
+		s.queued[filepath.Base(w.dir)] = true
+		sent++
+		log.Printf("[zeek-live] Window %s ready for processing", w.dir)
+	}
+	if sent > 0 && s.cfg.ProcessOptions.IntelDir != "" {
+		// Refresh the intel file Zeek watches once per window.
+		types.IntelScripts(s.spool, s.cfg.ProcessOptions)
+	}
+	for name := range s.queued {
+		if _, err := os.Stat(filepath.Join(s.cfg.OutputDir, name)); errors.Is(err, os.ErrNotExist) {
+			delete(s.queued, name)
+		}
+	}
+}
+
+// MarkDone records that the window directory dir was processed, so it is
+// not handed on again when it is retained across a restart.
+func MarkDone(dir string) error {
+	return os.WriteFile(filepath.Join(dir, doneMarker), nil, 0o644)
+}
+
+// Done reports whether the window directory dir was processed.
+func Done(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, doneMarker))
+	return err == nil
+}
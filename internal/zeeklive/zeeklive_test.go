@@ -0,0 +1,149 @@
+//go:build linux || darwin
+
+package zeeklive
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	types "EnigmaNetz/Enigma-Go-Sensor/internal/processor/common"
+)
+
+// fakeZeek writes an executable shell script standing in for Zeek.
+func fakeZeek(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "zeek")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func receive(t *testing.T, windows <-chan string) string {
+	t.Helper()
+	select {
+	case dir := <-windows:
+		return dir
+	case <-time.After(10 * time.Second):
+		t.Fatal("no window handed on")
+		return ""
+	}
+}
+
+func TestSupervisor_Windows(t *testing.T) {
+	out := t.TempDir()
+	now := time.Now().Unix()
+	mkWindow := func(closed int64) string {
+		dir := filepath.Join(out, DirPrefix+strconv.FormatInt(closed, 10))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+	settled := mkWindow(now - 60)
+	processed := mkWindow(now - 120)
+	if err := MarkDone(processed); err != nil {
+		t.Fatal(err)
+	}
+	open := mkWindow(now + 3600)
+
+	s := New(Config{
+		ZeekPath:     fakeZeek(t, `echo "$@" > args.txt; echo listening on eth0 >&2; exec sleep 30`),
+		Interface:    "eth0",
+		Window:       5 * time.Minute,
+		OutputDir:    out,
+		PollInterval: 10 * time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	windows := make(chan string, 4)
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx, windows) }()
+
+	// Only the settled window is handed on while Zeek runs, once.
+	if dir := receive(t, windows); dir != settled {
+		t.Errorf("window = %s, want %s", dir, settled)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if len(windows) != 0 {
+		t.Errorf("unexpected window %s", <-windows)
+	}
+
+	args, err := os.ReadFile(filepath.Join(out, spoolDirName, "args.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(args), "-i eth0 -C Log::default_logdir=") || !strings.Contains(string(args), settingsScript) {
+		t.Errorf("zeek args = %q", args)
+	}
+	settings, err := os.ReadFile(filepath.Join(out, spoolDirName, settingsScript))
+	if err != nil || !strings.Contains(string(settings), "redef Log::default_rotation_interval = 300 secs;") {
+		t.Errorf("settings = %q, err %v", settings, err)
+	}
+
+	// Stopping hands on the window still open.
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if dir := receive(t, windows); dir != open {
+		t.Errorf("window at shutdown = %s, want %s", dir, open)
+	}
+
+	// Zeek's output is carried into the windows handed on.
+	var output []byte
+	for _, dir := range []string{settled, open} {
+		b, _ := os.ReadFile(filepath.Join(dir, types.ZeekOutputFile))
+		output = append(output, b...)
+	}
+	if !strings.Contains(string(output), "listening on eth0") {
+		t.Errorf("windows' Zeek output = %q", output)
+	}
+}
+
+func TestSupervisor_Restart(t *testing.T) {
+	out := t.TempDir()
+	s := New(Config{
+		ZeekPath:     fakeZeek(t, `echo "#fields	ts" > conn.log; echo fatal error: no such device >&2; exit 1`),
+		Interface:    "any",
+		Window:       time.Minute,
+		OutputDir:    out,
+		PollInterval: 10 * time.Millisecond,
+	})
+	s.minBackoff = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	windows := make(chan string, 4)
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx, windows) }()
+
+	// Zeek is restarted after each crash, and the logs it left unrotated
+	// are handed on as a window.
+	for i := 0; i < 2; i++ {
+		dir := receive(t, windows)
+		if !strings.HasPrefix(filepath.Base(dir), DirPrefix) {
+			t.Fatalf("window = %s", dir)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "conn.log")); err != nil {
+			t.Errorf("salvaged conn.log: %v", err)
+		}
+		if output, err := os.ReadFile(filepath.Join(dir, types.ZeekOutputFile)); err != nil || string(output) != "fatal error: no such device\n" {
+			t.Errorf("salvaged Zeek output = %q, err %v", output, err)
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSupervisor_StartFailure(t *testing.T) {
+	s := New(Config{ZeekPath: filepath.Join(t.TempDir(), "missing"), Interface: "any", Window: time.Minute, OutputDir: t.TempDir()})
+	if err := s.Run(context.Background(), make(chan string, 1)); err == nil {
+		t.Error("expected an error when Zeek cannot be started")
+	}
+}
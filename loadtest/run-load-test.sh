@@ -153,9 +153,10 @@ generate_summary() {
             pcap_size=$(du -sh ../captures/*/capture_*.pcap 2>/dev/null | awk '{total+=$1} END {print total"KB"}' || echo "Unknown")
         fi
 
-        # Count Excel report files (Zeek generates conn.xlsx and dns.xlsx)
-        if ls ../captures/*/conn.xlsx >/dev/null 2>&1 || ls ../captures/*/dns.xlsx >/dev/null 2>&1; then
-            zeek_lines=$(ls ../captures/*/conn.xlsx ../captures/*/dns.xlsx 2>/dev/null | wc -l)
+        # Count encoded Zeek log files (conn/dns in the configured output encoding)
+        zeek_files=$(ls ../captures/*/conn.* ../captures/*/dns.* 2>/dev/null | grep -E '\.(log|csv|ndjson|xlsx|parquet)$')
+        if [ -n "$zeek_files" ]; then
+            zeek_lines=$(echo "$zeek_files" | wc -l)
         fi
     fi
 
@@ -218,8 +219,8 @@ generate_summary() {
 - **Capture Duration:** ${TEST_DURATION}s
 
 ### Zeek Analysis
-- **Zeek Reports Generated:** $zeek_lines Excel files
-- **Expected Output:** conn.xlsx and dns.xlsx files with network analysis
+- **Zeek Logs Generated:** $zeek_lines conn/dns files in the zeek.output_encoding format (.log for tsv, .csv, .ndjson, .xlsx or .parquet)
+- **Expected Output:** conn and dns logs (e.g. conn.log, dns.log) with network analysis
 
 ### Sensor Health
 - **Sensor Log Entries:** $sensor_log_lines entries
@@ -248,7 +249,7 @@ fi)
 
 ### Data Quality
 - **Network Traffic Captured:** $(if [ "$pcap_files" -gt 0 ]; then echo "PCAP files generated"; else echo "No PCAP capture"; fi)
-- **Zeek Analysis:** $(if [ "$zeek_lines" -gt 0 ]; then echo "Excel reports generated"; else echo "No analysis reports"; fi)
+- **Zeek Analysis:** $(if [ "$zeek_lines" -gt 0 ]; then echo "Zeek logs generated"; else echo "No Zeek logs"; fi)
 - **Sensor Reliability:** $(if [ "$sensor_errors" -eq 0 ]; then echo "No errors"; else echo "$sensor_errors errors"; fi)
 
 ## Files Generated
@@ -262,7 +263,7 @@ else
     echo "- **Basic Stats:** \`$RESULTS_DIR/stats.log\`"
 fi)
 - **PCAP Files:** \`../captures/\` ($pcap_files files, $pcap_size total)
-- **Zeek Reports:** \`../captures/\` ($zeek_lines Excel files)
+- **Zeek Logs:** \`../captures/\` ($zeek_lines conn/dns files)
 
 ## Performance Analysis
 